@@ -49,6 +49,9 @@ func initialize() error {
 	if err != nil {
 		return err
 	}
+	if len(config.HistogramBuckets) > 0 {
+		metricAccumulator.SetHistogramBuckets(config.HistogramBuckets)
+	}
 	fmt.Println("server cert: ", config.ServerCert)
 	caCert, err := os.ReadFile(config.ServerCert) // "./keys/server_cert.pem"
 	if err != nil {
@@ -75,12 +78,17 @@ func initialize() error {
 	grpcURL := config.GrpcURL
 	var mservice *metricservice.MetricService
 	var sender metricservice.MetricSender
+	var grpcSender *metricservice.GrpcClient
 
 	if grpcURL != "" {
-		sender = metricservice.NewGrpcSender(grpcURL)
+		// одно соединение и один поток на все время работы агента
+		grpcSender = metricservice.NewGrpcSender(grpcURL, config.AgentID, config.MaxRequestRetries)
+		sender = grpcSender
 	} else {
-		sender = metricservice.NewHTTPSender(client, fmt.Sprintf("https://%s/updates/", config.Address), config.MaxRequestRetries, config.Key)
+		sender = metricservice.NewHTTPSender(client, fmt.Sprintf("https://%s/updates/", config.Address),
+			config.MaxRequestRetries, config.Key, config.AgentID)
 	}
+	log.Println("agent id:", config.AgentID)
 
 	mservice = metricservice.NewMetricService(config, metricAccumulator, sender, 10)
 
@@ -117,6 +125,13 @@ func initialize() error {
 
 	wg.Wait()
 
+	if grpcSender != nil {
+		// дожидаемся, пока сервер сохранит метрики, уже отправленные в поток
+		if err := grpcSender.Close(); err != nil {
+			log.Println("error in closing gRPC metrics stream:", err)
+		}
+	}
+
 	return nil
 }
 
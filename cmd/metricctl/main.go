@@ -0,0 +1,87 @@
+// Metricctl is a maintenance tool for the metric server storage.
+//
+// Copying all metrics from one storage to another (for example, when moving
+// a server from file storage to Postgres):
+//
+//	metricctl storage copy -from file:/tmp/metrics-db.json -to "postgres:host=localhost dbname=metrics"
+//
+// Storages are addressed as file:PATH (JSON snapshot), bolt:PATH (embedded bbolt database)
+// or postgres:DSN.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/storagecopy"
+)
+
+const usage = `usage: metricctl storage copy -from SOURCE -to DESTINATION [-merge] [-timeout DURATION]
+
+SOURCE and DESTINATION are file:PATH, bolt:PATH or postgres:DSN`
+
+var errUsage = errors.New(usage)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string) error {
+	if len(args) < 2 || args[0] != "storage" || args[1] != "copy" {
+		return errUsage
+	}
+	return storageCopy(args[2:])
+}
+
+// storageCopy переносит метрики между хранилищами (metricctl storage copy)
+func storageCopy(args []string) error {
+	fs := flag.NewFlagSet("storage copy", flag.ContinueOnError)
+	from := fs.String("from", "", "source storage: file:PATH, bolt:PATH or postgres:DSN")
+	to := fs.String("to", "", "destination storage: file:PATH, bolt:PATH or postgres:DSN")
+	merge := fs.Bool("merge", false, "copy into a non-empty destination (counters, histograms and summaries are summed)")
+	timeout := fs.Duration("timeout", 5*time.Minute, "timeout for the whole copy")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" {
+		return errUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	src, err := storagecopy.Open(*from, false)
+	if err != nil {
+		return fmt.Errorf("opening source storage: %w", err)
+	}
+	defer src.Close(ctx)
+
+	dst, err := storagecopy.Open(*to, true)
+	if err != nil {
+		return fmt.Errorf("opening destination storage: %w", err)
+	}
+
+	copied, err := storagecopy.Copy(ctx, src, dst, *merge)
+	if err != nil {
+		dst.Close(ctx)
+		return err
+	}
+	// для файла слепок записывается при закрытии, поэтому ошибку закрытия нельзя пропускать
+	if err = dst.Close(ctx); err != nil {
+		return fmt.Errorf("closing destination storage: %w", err)
+	}
+
+	log.Printf("copied %d metrics", copied)
+	return nil
+}
@@ -3,8 +3,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,13 +17,22 @@ import (
 	"github.com/adettelle/go-metric-collector/internal/api"
 	database "github.com/adettelle/go-metric-collector/internal/db"
 	"github.com/adettelle/go-metric-collector/internal/grpcserver"
+	"github.com/adettelle/go-metric-collector/internal/ingest/graphite"
+	"github.com/adettelle/go-metric-collector/internal/ingest/statsd"
 	"github.com/adettelle/go-metric-collector/internal/migrator"
 
 	"github.com/adettelle/go-metric-collector/internal/server/config"
+	"github.com/adettelle/go-metric-collector/internal/server/service"
+	"github.com/adettelle/go-metric-collector/internal/server/stream"
+	"github.com/adettelle/go-metric-collector/internal/storage/boltstorage"
 	"github.com/adettelle/go-metric-collector/internal/storage/dbstorage"
 	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
 )
 
+// shutdownTimeout - сколько при остановке сервера ждем завершения текущих запросов,
+// после чего их контекст отменяется вместе с запросами к хранилищу
+const shutdownTimeout = 10 * time.Second
+
 var (
 	buildVersion string = "N/A"
 	buildDate    string = "N/A"
@@ -54,12 +65,21 @@ func initialize() error {
 		return err
 	}
 
+	// все записи gauge и counter метрик, откуда бы они ни пришли, рассылаются подписчикам потоков
+	hub := stream.NewHub()
+	storager = api.NewNotifyingStorager(storager, hub)
+
 	var wg sync.WaitGroup
 	mAPI := api.NewMetricHandlers(storager, cfg, &wg)
+	mAPI.Hub = hub
 	router := api.NewMetricRouter(storager, mAPI)
+	// контекст всех HTTP запросов: отменяется, если они не завершились за shutdownTimeout
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 	srv := &http.Server{
-		Addr:    cfg.Address,
-		Handler: router,
+		Addr:        cfg.Address,
+		Handler:     router,
+		BaseContext: func(net.Listener) context.Context { return requestsCtx },
 	}
 	go func() {
 		fmt.Printf("Starting server on %s\n", cfg.Address)
@@ -70,12 +90,36 @@ func initialize() error {
 		}
 	}()
 
-	go func() {
-		err := grpcserver.StartServer(storager, cfg.GrpcPort)
-		if err != nil {
-			log.Fatal(err)
+	grpcServer, err := grpcserver.StartServer(storager, mAPI.Agents, hub, cfg.GrpcPort, cfg.StampAgentID)
+	if err != nil {
+		return err
+	}
+
+	var statsdServer *statsd.Server
+	if cfg.StatsdAddress != "" {
+		statsdServer = statsd.NewServer(cfg.StatsdAddress,
+			time.Second*time.Duration(cfg.StatsdFlushInterval), storager)
+		if err := statsdServer.Start(); err != nil {
+			return err
 		}
-	}()
+	}
+
+	var graphiteServer *graphite.Server
+	if cfg.GraphiteAddress != "" {
+		graphiteServer = graphite.NewServer(cfg.GraphiteAddress, storager)
+		if err := graphiteServer.Start(); err != nil {
+			return err
+		}
+	}
+
+	// фоновые задачи хранилища: удаление метрик, которые давно не обновлялись,
+	// и компакция истории
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	if cfg.MetricTTL > 0 {
+		go service.StartExpiryLoop(bgCtx, storager, time.Second*time.Duration(cfg.MetricTTL))
+	}
+	go service.StartCompactionLoop(bgCtx, storager, time.Second*time.Duration(cfg.CompactionInterval))
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
@@ -86,13 +130,50 @@ func initialize() error {
 		s := <-c
 		log.Printf("Got termination signal: %s. Graceful shutdown", s)
 
-		if err := srv.Shutdown(context.Background()); err != nil {
-			log.Fatal(err) // failure/timeout shutting down the server gracefully
+		// потоки метрик не завершаются сами, закрываем их до остановки HTTP сервера
+		hub.Close()
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+		err := srv.Shutdown(shutdownCtx)
+		cancelShutdown()
+		if errors.Is(err, context.DeadlineExceeded) {
+			// зависшие запросы прерываются вместе с их запросами к хранилищу
+			log.Println("requests have not finished in time, cancelling them")
+			cancelRequests()
+		} else if err != nil {
+			log.Fatal(err) // failure shutting down the server gracefully
+		}
+
+		// дожидаемся записи принятых по gRPC пакетов; потоки агентов открыты постоянно,
+		// поэтому если они не закрылись вовремя, сервер останавливается принудительно
+		grpcStopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(grpcStopped)
+		}()
+		select {
+		case <-grpcStopped:
+		case <-time.After(shutdownTimeout):
+			log.Println("grpc streams have not finished in time, closing them")
+			grpcServer.Stop()
+			<-grpcStopped
 		}
 
 		mAPI.Finalizing = true
+		stopBackground()
 
-		err = storager.Finalize()
+		if graphiteServer != nil {
+			if err := graphiteServer.Shutdown(); err != nil {
+				log.Println("unable to stop graphite server:", err)
+			}
+		}
+		if statsdServer != nil {
+			// дописываем в хранилище StatsD метрики, накопленные с последнего сброса
+			if err := statsdServer.Shutdown(); err != nil {
+				log.Println("unable to flush statsd metrics:", err)
+			}
+		}
+
+		err = storager.Finalize(context.Background())
 		if err != nil {
 			log.Println(err)
 			log.Println("unable to write to file")
@@ -111,15 +192,25 @@ func initStorager(cfg *config.Config) (api.Storager, error) {
 	// log.Println("config in initStorager:", cfg)
 	var storager api.Storager
 
-	if cfg.DBParams != "" {
+	if cfg.EmbeddedDBPath != "" {
+		// встроенная база в одном файле: не нужен ни сервер Postgres, ни сохранение слепков
+		bs, err := boltstorage.New(cfg.EmbeddedDBPath)
+		if err != nil {
+			return nil, err
+		}
+		bs.Retention = retentionPolicy(cfg)
+		storager = bs
+
+	} else if cfg.DBParams != "" {
 
 		db, err := database.NewDBConnection(cfg.DBParams).Connect()
 		if err != nil {
 			log.Fatal(err)
 		}
 		storager = &dbstorage.DBStorage{
-			Ctx: context.Background(),
-			DB:  db,
+			DB:           db,
+			QueryTimeout: time.Second * time.Duration(cfg.QueryTimeout),
+			Retention:    retentionPolicy(cfg),
 		}
 
 		migrator.MustApplyMigrations(cfg.DBParams)
@@ -127,18 +218,22 @@ func initStorager(cfg *config.Config) (api.Storager, error) {
 	} else {
 		var ms *memstorage.MemStorage
 		log.Println("cfg.StoragePath in initStorager:", cfg.StoragePath)
-		ms, err := memstorage.New(cfg.ShouldRestore(), cfg.StoragePath)
-		log.Println("ms.StoragePath in initStorager:", ms.FileName)
+		// сжатие передается в New, чтобы им был записан и слепок после восстановления;
+		// значение уже проверено при чтении конфигурации
+		ms, err := memstorage.New(cfg.ShouldRestore(), cfg.StoragePath,
+			memstorage.WithSnapshotCompression(memstorage.Compression(cfg.SnapshotCompression)))
 		if err != nil {
 			return nil, err
 		}
+		log.Println("ms.StoragePath in initStorager:", ms.FileName)
+		ms.Retention = retentionPolicy(cfg)
 
 		if cfg.StoreInterval > 0 {
 			go memstorage.StartSaveLoop(time.Second*time.Duration(cfg.StoreInterval),
 				cfg.StoragePath, ms)
 		} else if cfg.StoreInterval == 0 {
 			// если config.StoreInterval равен 0, то мы назначаем MemStorage FileName, чтобы
-			// он мог синхронно писать изменения
+			// он мог синхронно писать изменения (в журнал изменений рядом со слепком)
 			ms.FileName = cfg.StoragePath
 		}
 
@@ -146,3 +241,12 @@ func initStorager(cfg *config.Config) (api.Storager, error) {
 	}
 	return storager, nil
 }
+
+// retentionPolicy - сроки хранения истории из конфигурации (незаданные берутся по умолчанию)
+func retentionPolicy(cfg *config.Config) memstorage.RetentionPolicy {
+	return memstorage.RetentionPolicy{
+		Raw:    time.Second * time.Duration(cfg.RetentionRaw),
+		Minute: time.Second * time.Duration(cfg.RetentionMinute),
+		Hour:   time.Second * time.Duration(cfg.RetentionHour),
+	}.WithDefaults()
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Buckets - верхние границы корзин гистограмм агента.
+// В флаге и переменной окружения задаются строкой "0.01,0.1,1",
+// в json файле конфигурации - массивом [0.01, 0.1, 1].
+type Buckets []float64
+
+// String реализует flag.Value
+func (b *Buckets) String() string {
+	if b == nil {
+		return ""
+	}
+	bounds := make([]string, 0, len(*b))
+	for _, bound := range *b {
+		bounds = append(bounds, strconv.FormatFloat(bound, 'g', -1, 64))
+	}
+	return strings.Join(bounds, ",")
+}
+
+// Set реализует flag.Value
+func (b *Buckets) Set(value string) error {
+	var buckets Buckets
+	for _, s := range strings.Split(value, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		bound, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return fmt.Errorf("invalid bucket bound %q: %w", s, err)
+		}
+		buckets = append(buckets, bound)
+	}
+	if err := buckets.validate(); err != nil {
+		return err
+	}
+	*b = buckets
+	return nil
+}
+
+// Decode реализует envconfig.Decoder
+func (b *Buckets) Decode(value string) error {
+	return b.Set(value)
+}
+
+// границы должны быть конечными и строго возрастать, иначе сервер отклонит гистограммы
+func (b Buckets) validate() error {
+	for i, bound := range b {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return fmt.Errorf("invalid bucket bound %v", bound)
+		}
+		if i > 0 && bound <= b[i-1] {
+			return fmt.Errorf("bucket bounds must be strictly increasing: %v", b.String())
+		}
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"net"
 	"strconv"
 
+	"github.com/adettelle/go-metric-collector/internal/agent/identity"
 	"github.com/adettelle/go-metric-collector/internal/helpers"
 	"github.com/kelseyhightower/envconfig"
 )
@@ -17,6 +18,7 @@ const (
 	defaultMaxRequestRetries = 3
 	defaultRateLimit         = 1
 	defaultReportInterval    = 10
+	defaultAgentIDFile       = "./agent-id"
 )
 
 type Config struct {
@@ -33,6 +35,14 @@ type Config struct {
 	// количество одновременно исходящих запросов на сервер
 	// (количество задач, которое одновременно происходит в worker pool)
 	RateLimit int `env:"RATE_LIMIT" flag:"l" json:"rate_limit"`
+	// метки, которые добавляются ко всем метрикам агента (например, host=web-1,env=prod)
+	Labels Labels `envconfig:"LABELS" flag:"labels" json:"labels"`
+	// ID агента, передается с каждым пакетом метрик;
+	// по умолчанию - имя хоста и UUID, сохраненный в файле AgentIDFile
+	AgentID     string `envconfig:"AGENT_ID" flag:"id" json:"agent_id"`
+	AgentIDFile string `envconfig:"AGENT_ID_FILE" flag:"id-file" json:"agent_id_file"` // по умолчанию ./agent-id
+	// границы корзин гистограмм (например, задержки отправки метрик), по умолчанию metrics.DefaultBuckets
+	HistogramBuckets Buckets `envconfig:"HISTOGRAM_BUCKETS" flag:"buckets" json:"histogram_buckets"`
 }
 
 // приоритет:
@@ -51,6 +61,10 @@ func New() (*Config, error) {
 	flag.StringVar(&cfg.ClientCert, "client-cert", cfg.ClientCert, "path to client sertificate")
 	flag.StringVar(&cfg.ServerCert, "server-cert", cfg.ServerCert, "path to server sertificate")
 	flag.StringVar(&cfg.GrpcURL, "grpc", cfg.GrpcURL, "grpc server url")
+	flag.Var(&cfg.Labels, "labels", "labels added to all metrics: name=value,name=value")
+	flag.StringVar(&cfg.AgentID, "id", cfg.AgentID, "agent id (default: hostname and persisted uuid)")
+	flag.StringVar(&cfg.AgentIDFile, "id-file", cfg.AgentIDFile, "path to file with persisted agent uuid")
+	flag.Var(&cfg.HistogramBuckets, "buckets", "histogram bucket upper bounds: 0.01,0.1,1")
 
 	flag.Parse()
 
@@ -91,6 +105,26 @@ func New() (*Config, error) {
 		if cfg.RateLimit == 0 {
 			cfg.RateLimit = cfgFromJSON.RateLimit
 		}
+		if len(cfg.Labels) == 0 {
+			for name := range cfgFromJSON.Labels {
+				if !isValidLabelName(name) {
+					return nil, fmt.Errorf("invalid label name %q", name)
+				}
+			}
+			cfg.Labels = cfgFromJSON.Labels
+		}
+		if cfg.AgentID == "" {
+			cfg.AgentID = cfgFromJSON.AgentID
+		}
+		if cfg.AgentIDFile == "" {
+			cfg.AgentIDFile = cfgFromJSON.AgentIDFile
+		}
+		if len(cfg.HistogramBuckets) == 0 {
+			if err := cfgFromJSON.HistogramBuckets.validate(); err != nil {
+				return nil, err
+			}
+			cfg.HistogramBuckets = cfgFromJSON.HistogramBuckets
+		}
 	}
 
 	if cfg.Address == "" {
@@ -108,6 +142,16 @@ func New() (*Config, error) {
 	if cfg.ReportInterval == 0 {
 		cfg.ReportInterval = defaultReportInterval
 	}
+	if cfg.AgentIDFile == "" {
+		cfg.AgentIDFile = defaultAgentIDFile
+	}
+	if cfg.AgentID == "" {
+		agentID, err := identity.Default(cfg.AgentIDFile)
+		if err != nil {
+			return nil, fmt.Errorf("error in getting agent id: %w", err)
+		}
+		cfg.AgentID = agentID
+	}
 
 	ensureAddrFLagIsCorrect(cfg.Address)
 
@@ -25,6 +25,33 @@ func TestConfigFromJSON(t *testing.T) {
 		PollInterval:      1,
 		ReportInterval:    10,
 		RateLimit:         1,
+		Labels:            Labels{"env": "test"},
+		AgentID:           "test-agent",
+		AgentIDFile:       "./agent-id",
+		HistogramBuckets:  Buckets{0.01, 0.1, 1},
 	}
 	assert.Equal(t, cfg, &expectedCfg)
 }
+
+func TestLabelsSet(t *testing.T) {
+	var labels Labels
+	assert.NoError(t, labels.Set("host=web-1, env=prod,,empty="))
+	assert.Equal(t, Labels{"host": "web-1", "env": "prod", "empty": ""}, labels)
+	assert.Equal(t, "empty=,env=prod,host=web-1", labels.String())
+
+	assert.Error(t, labels.Set("host"))
+	assert.Error(t, labels.Set("host-name=a"))
+	assert.Error(t, labels.Set("=a"))
+}
+
+func TestBucketsSet(t *testing.T) {
+	var buckets Buckets
+	assert.NoError(t, buckets.Set("0.01, 0.1,,1"))
+	assert.Equal(t, Buckets{0.01, 0.1, 1}, buckets)
+	assert.Equal(t, "0.01,0.1,1", buckets.String())
+
+	assert.Error(t, buckets.Set("1,0.1"))
+	assert.Error(t, buckets.Set("0.1,0.1"))
+	assert.Error(t, buckets.Set("a"))
+	assert.Error(t, buckets.Set("+Inf"))
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Labels - метки, которые агент добавляет ко всем отправляемым метрикам.
+// В флаге и переменной окружения задаются строкой "host=web-1,env=prod",
+// в json файле конфигурации - объектом {"host": "web-1", "env": "prod"}.
+type Labels map[string]string
+
+// String реализует flag.Value
+func (l *Labels) String() string {
+	if l == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*l))
+	for name, value := range *l {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set реализует flag.Value
+func (l *Labels) Set(value string) error {
+	labels := make(Labels)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, labelValue, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !isValidLabelName(name) {
+			return fmt.Errorf("invalid label %q, expected name=value", pair)
+		}
+		labels[name] = strings.TrimSpace(labelValue)
+	}
+	*l = labels
+	return nil
+}
+
+// Decode реализует envconfig.Decoder
+func (l *Labels) Decode(value string) error {
+	return l.Set(value)
+}
+
+// имя метки должно иметь вид [a-zA-Z_][a-zA-Z0-9_]*, иначе сервер отклонит метрики
+func isValidLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
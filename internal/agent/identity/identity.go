@@ -0,0 +1,52 @@
+// Package identity provides a stable agent ID that is sent with every batch of metrics.
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Default возвращает ID агента по умолчанию: имя хоста и UUID, сохраненный в файле path.
+// Если файла нет, UUID генерируется и записывается в него, поэтому ID агента
+// не меняется между перезапусками.
+func Default(path string) (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+
+	id, err := loadOrCreateUUID(path)
+	if err != nil {
+		return "", err
+	}
+
+	return hostname + "-" + id, nil
+}
+
+func loadOrCreateUUID(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		id, err := uuid.Parse(strings.TrimSpace(string(data)))
+		if err != nil {
+			return "", fmt.Errorf("invalid agent id in %s: %w", path, err)
+		}
+		return id.String(), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	id := uuid.NewString()
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err = os.WriteFile(path, []byte(id+"\n"), 0644); err != nil {
+		return "", err
+	}
+	return id, nil
+}
@@ -0,0 +1,38 @@
+package identity
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "agent-id")
+
+	id, err := Default(path)
+	require.NoError(t, err)
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(id, hostname+"-"))
+
+	_, err = uuid.Parse(strings.TrimPrefix(id, hostname+"-"))
+	require.NoError(t, err)
+
+	// при повторном запуске ID читается из файла
+	again, err := Default(path)
+	require.NoError(t, err)
+	require.Equal(t, id, again)
+}
+
+func TestDefaultInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent-id")
+	require.NoError(t, os.WriteFile(path, []byte("not a uuid"), 0644))
+
+	_, err := Default(path)
+	require.Error(t, err)
+}
@@ -3,14 +3,46 @@
 package metrics
 
 import (
+	"sort"
 	"sync"
+
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
 )
 
 type Metric struct {
-	Delta *int64   `json:"delta,omitempty"` // metric's value when metric type is counter
-	Value *float64 `json:"value,omitempty"` // metric's value when metric type is gauge
-	ID    string   `json:"id"`              // metric's name
-	MType string   `json:"type"`            // parameter that takes gauge or counter value
+	Delta     *int64            `json:"delta,omitempty"`     // metric's value when metric type is counter
+	Value     *float64          `json:"value,omitempty"`     // metric's value when metric type is gauge
+	Histogram *Histogram        `json:"histogram,omitempty"` // metric's value when metric type is histogram
+	Summary   *ddsketch.Sketch  `json:"summary,omitempty"`   // metric's value when metric type is summary
+	ID        string            `json:"id"`                  // metric's name
+	MType     string            `json:"type"`                // parameter that takes gauge, counter, histogram or summary value
+	Labels    map[string]string `json:"labels,omitempty"`    // metric's labels (host, env, ...)
+}
+
+// DefaultBuckets are upper bounds of histogram buckets used when none are configured.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram is a distribution of observed values over buckets.
+// Counts[i] is the number of values in the bucket with upper bound Bounds[i],
+// the last element of Counts is the +Inf bucket.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		Bounds: append([]float64(nil), bounds...),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *Histogram) observe(v float64) {
+	h.Counts[sort.SearchFloat64s(h.Bounds, v)]++
+	h.Sum += v
+	h.Count++
 }
 
 type AllMetrics struct {
@@ -21,12 +53,32 @@ type AllMetrics struct {
 type MetricAccumulator struct {
 	gauge   *sync.Map // map[string]float64 // имя метрики: ее значение
 	counter *sync.Map // map[string]int64
+	// гистограммы значений, накопленные с последней отправки
+	histogram map[string]*Histogram
+	buckets   []float64
+	// скетчи квантилей summary метрик, накопленные с последней отправки
+	summary map[string]*ddsketch.Sketch
+	mu      sync.Mutex // защищает histogram, buckets и summary
 }
 
 func New() *MetricAccumulator {
 	gauge := &sync.Map{}
 	counter := &sync.Map{}
-	return &MetricAccumulator{gauge: gauge, counter: counter}
+	return &MetricAccumulator{
+		gauge:     gauge,
+		counter:   counter,
+		histogram: make(map[string]*Histogram),
+		buckets:   DefaultBuckets,
+		summary:   make(map[string]*ddsketch.Sketch),
+	}
+}
+
+// SetHistogramBuckets sets upper bounds of buckets for histograms created after the call.
+func (ma *MetricAccumulator) SetHistogramBuckets(bounds []float64) {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	ma.buckets = append([]float64(nil), bounds...)
 }
 
 // Reset() resets the Gauge and Counter maps in the MemStorage structure,
@@ -40,6 +92,11 @@ func (ma *MetricAccumulator) Reset() {
 		ma.counter.Delete(key)
 		return true
 	})
+
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	clear(ma.histogram)
+	clear(ma.summary)
 }
 
 func (ma *MetricAccumulator) AddGaugeMetric(name string, value float64) {
@@ -71,3 +128,58 @@ func (ma *MetricAccumulator) GetAllGaugeMetrics() map[string]float64 {
 	})
 	return result
 }
+
+// ObserveHistogramMetric adds value v to the histogram with the given name.
+func (ma *MetricAccumulator) ObserveHistogramMetric(name string, v float64) {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	h, exists := ma.histogram[name]
+	if !exists {
+		h = newHistogram(ma.buckets)
+		ma.histogram[name] = h
+	}
+	h.observe(v)
+}
+
+// GetAllHistogramMetrics returns copies of histograms observed since the last Reset.
+func (ma *MetricAccumulator) GetAllHistogramMetrics() map[string]Histogram {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	result := make(map[string]Histogram, len(ma.histogram))
+	for name, h := range ma.histogram {
+		result[name] = Histogram{
+			Bounds: append([]float64(nil), h.Bounds...),
+			Counts: append([]uint64(nil), h.Counts...),
+			Sum:    h.Sum,
+			Count:  h.Count,
+		}
+	}
+	return result
+}
+
+// ObserveSummaryMetric adds value v to the quantile sketch with the given name.
+func (ma *MetricAccumulator) ObserveSummaryMetric(name string, v float64) {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	s, exists := ma.summary[name]
+	if !exists {
+		s = ddsketch.New(ddsketch.DefaultAlpha)
+		ma.summary[name] = s
+	}
+	s.Add(v)
+}
+
+// GetAllSummaryMetrics returns copies of sketches observed since the last Reset.
+func (ma *MetricAccumulator) GetAllSummaryMetrics() map[string]*ddsketch.Sketch {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	result := make(map[string]*ddsketch.Sketch, len(ma.summary))
+	for name, s := range ma.summary {
+		result[name] = s.Clone()
+	}
+	return result
+}
@@ -157,3 +157,43 @@ func TestGetAllCounterMetrics(t *testing.T) {
 	counterMetrics := ma.GetAllCounterMetrics()
 	assert.True(t, reflect.DeepEqual(counterMetrics, expected))
 }
+
+func TestObserveHistogramMetric(t *testing.T) {
+	ma := New()
+	ma.SetHistogramBuckets([]float64{0.1, 1})
+	ma.ObserveHistogramMetric("h1", 0.05)
+	ma.ObserveHistogramMetric("h1", 0.5)
+	ma.ObserveHistogramMetric("h1", 2)
+
+	expected := map[string]Histogram{
+		"h1": {Bounds: []float64{0.1, 1}, Counts: []uint64{1, 1, 1}, Sum: 2.55, Count: 3},
+	}
+	histogramMetrics := ma.GetAllHistogramMetrics()
+	assert.Equal(t, expected, histogramMetrics)
+
+	// возвращается копия: изменения не затрагивают накопленную гистограмму
+	histogramMetrics["h1"].Counts[0] = 100
+	assert.Equal(t, uint64(1), ma.GetAllHistogramMetrics()["h1"].Counts[0])
+
+	ma.Reset()
+	assert.Empty(t, ma.GetAllHistogramMetrics())
+}
+
+func TestObserveSummaryMetric(t *testing.T) {
+	ma := New()
+	for i := 1; i <= 10; i++ {
+		ma.ObserveSummaryMetric("s1", float64(i))
+	}
+
+	summaryMetrics := ma.GetAllSummaryMetrics()
+	require.Len(t, summaryMetrics, 1)
+	assert.Equal(t, uint64(10), summaryMetrics["s1"].Count)
+	assert.Equal(t, 55.0, summaryMetrics["s1"].Sum)
+
+	// возвращается копия: изменения не затрагивают накопленный скетч
+	summaryMetrics["s1"].Add(100)
+	assert.Equal(t, uint64(10), ma.GetAllSummaryMetrics()["s1"].Count)
+
+	ma.Reset()
+	assert.Empty(t, ma.GetAllSummaryMetrics())
+}
@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 
 	"github.com/adettelle/go-metric-collector/internal/security"
+	"github.com/adettelle/go-metric-collector/pkg/agentid"
 	"github.com/adettelle/go-metric-collector/pkg/retries"
 )
 
@@ -16,18 +19,50 @@ type HTTPSender struct {
 	URL               string
 	EncryptionKey     string
 	MaxRequestRetries int
+	AgentID           string // передается в заголовке X-Agent-ID
+	RealIP            string // адрес агента, передается в заголовке X-Real-IP
 	// publicKey         *rsa.PublicKey
 }
 
-func NewHTTPSender(client *http.Client, url string, maxRequestRetries int, encryptionKey string) *HTTPSender {
+func NewHTTPSender(client *http.Client, url string, maxRequestRetries int, encryptionKey string, agentID string) *HTTPSender {
 	return &HTTPSender{
 		Client:            client,
 		URL:               url,
 		MaxRequestRetries: maxRequestRetries,
 		EncryptionKey:     encryptionKey,
+		AgentID:           agentID,
+		RealIP:            outboundIP(url),
 	}
 }
 
+// outboundIP возвращает адрес, с которого агент обращается к серверу;
+// если его не удалось определить - 127.0.0.1
+func outboundIP(serverURL string) string {
+	const fallback = "127.0.0.1"
+
+	u, err := url.Parse(serverURL)
+	if err != nil || u.Host == "" {
+		return fallback
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "80")
+	}
+
+	// для UDP соединение не устанавливается, выбирается только локальный адрес
+	conn, err := net.Dial("udp", host)
+	if err != nil {
+		return fallback
+	}
+	defer conn.Close()
+
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return fallback
+	}
+	return addr.IP.String()
+}
+
 // SendMetricsChunk sends chunk of metrics, id is number of chunk
 func (c *HTTPSender) SendMetricsChunk(id int, chunk []MetricRequest) error {
 	var err error
@@ -70,9 +105,10 @@ func (c *HTTPSender) doSend(data *bytes.Buffer) error {
 		req.Header.Set("HashSHA256", hash)
 	}
 
-	netAddr := "127.0.0.1"
-
-	req.Header.Set("X-Real-IP", netAddr)
+	req.Header.Set("X-Real-IP", c.RealIP)
+	if c.AgentID != "" {
+		req.Header.Set(agentid.HeaderName, c.AgentID)
+	}
 
 	resp, err := c.Client.Do(req)
 	if err != nil {
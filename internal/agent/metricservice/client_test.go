@@ -0,0 +1,40 @@
+package metricservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPSenderSendsAgentID(t *testing.T) {
+	var agentID, realIP string
+	var received []MetricRequest
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agentID = r.Header.Get("X-Agent-ID")
+		realIP = r.Header.Get("X-Real-IP")
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	sender := NewHTTPSender(srv.Client(), srv.URL+"/updates/", 1, "", "web-1-agent")
+
+	value := 1.5
+	err := sender.SendMetricsChunk(0, []MetricRequest{{ID: "Alloc", MType: "gauge", Value: &value}})
+	require.NoError(t, err)
+
+	require.Equal(t, "web-1-agent", agentID)
+	// сервер слушает на loopback, поэтому агент обращается к нему с loopback адреса
+	require.Equal(t, "127.0.0.1", realIP)
+	require.Len(t, received, 1)
+	require.Equal(t, "Alloc", received[0].ID)
+}
+
+func TestOutboundIP(t *testing.T) {
+	require.Equal(t, "127.0.0.1", outboundIP("http://127.0.0.1:8080/updates/"))
+	require.Equal(t, "127.0.0.1", outboundIP("://bad url"))
+}
@@ -65,5 +65,7 @@ func retrieveAdditionalGaugeMetrics(metricAccumulator *m.MetricAccumulator) {
 	metricAccumulator.AddGaugeMetric("FreeMemory", float64(v.Free))
 	for i, CPUutilization := range CPUutilizations {
 		metricAccumulator.AddGaugeMetric(fmt.Sprintf("CPUutilization%d", i+1), CPUutilization)
+		// распределение загрузки по всем ядрам за период отправки (p50/p95/p99 на сервере)
+		metricAccumulator.ObserveSummaryMetric("CPUutilization", CPUutilization)
 	}
 }
@@ -2,53 +2,292 @@ package metricservice
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"sync"
 	"time"
 
+	"github.com/adettelle/go-metric-collector/pkg/agentid"
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
 	pb "github.com/adettelle/go-metric-collector/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
+const (
+	// пауза перед повторной попыткой после первой ошибки; удваивается после каждой следующей
+	grpcMinBackoff = 100 * time.Millisecond
+	grpcMaxBackoff = 10 * time.Second
+	// как часто проверять простаивающее соединение ping'ом (не чаще, чем разрешает сервер)
+	grpcKeepaliveTime    = 30 * time.Second
+	grpcKeepaliveTimeout = 10 * time.Second
+	// сколько ждать подтверждения пакета (или ответа UpdateMetrics, если сервер не поддерживает StreamMetrics)
+	grpcSendTimeout = 5 * time.Second
+)
+
+// GrpcClient отправляет пакеты метрик в одном долгоживущем потоке StreamMetrics поверх одного соединения.
+// Если поток оборвался, он открывается заново с нарастающей паузой между попытками (не больше maxRetries
+// повторов на пакет); с сервером, который не поддерживает StreamMetrics, клиент работает через UpdateMetrics.
+// Пакет считается отправленным, только когда сервер подтвердил его сохранение; неподтвержденный пакет
+// отправляется заново в новом потоке.
 type GrpcClient struct {
-	url string
+	url        string
+	agentID    string // передается в метаданных запроса x-agent-id
+	maxRetries int
+
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	sendTimeout time.Duration // сколько ждать подтверждения пакета
+
+	mu      sync.Mutex // пакеты отправляются в поток по одному
+	conn    *grpc.ClientConn
+	client  pb.MetricsClient
+	stream  pb.Metrics_StreamMetricsClient
+	cancel  context.CancelFunc // отменяет поток
+	unary   bool               // сервер не поддерживает StreamMetrics
+	backoff time.Duration      // пауза перед следующей попыткой; 0 - после успешной отправки
 }
 
-func NewGrpcSender(url string) *GrpcClient {
-	return &GrpcClient{url: url}
+func NewGrpcSender(url string, agentID string, maxRetries int) *GrpcClient {
+	return &GrpcClient{
+		url:         url,
+		agentID:     agentID,
+		maxRetries:  maxRetries,
+		minBackoff:  grpcMinBackoff,
+		maxBackoff:  grpcMaxBackoff,
+		sendTimeout: grpcSendTimeout,
+	}
 }
 
 // SendMetricsChunk sends chunk of metrics, id is number of chunk
 func (c *GrpcClient) SendMetricsChunk(id int, chunk []MetricRequest) error {
-	client, err := grpc.NewClient(c.url, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		return fmt.Errorf("failed to connect to gRPC server at localhost:3200: %v", err)
+	req := &pb.UpdateMetricsRequest{Metrics: metricsToProto(chunk)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		err := c.send(req)
+		if err == nil {
+			c.backoff = 0
+			log.Printf("chunk in worker %d sent to gRPC server", id)
+			return nil
+		}
+		log.Printf("error in sending chunk in worker %d to gRPC server (attempt %d): %v", id, attempt, err)
+		if attempt >= c.maxRetries || !isRetriableGrpcError(err) {
+			return err
+		}
+		c.wait()
 	}
-	defer client.Close()
-	mClient := pb.NewMetricsClient(client)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
+// send передает пакет в поток, при необходимости открывая его заново, и ждет подтверждения
+func (c *GrpcClient) send(req *pb.UpdateMetricsRequest) error {
+	if err := c.connect(); err != nil {
+		return err
+	}
+	if c.unary {
+		return c.sendUnary(req)
+	}
 
-	pbMetrics := []*pb.Metric{}
-	for _, mreq := range chunk {
-		var pbm pb.Metric
-		if mreq.MType == "counter" {
-			pbm = pb.Metric{Name: mreq.ID, Type: mreq.MType, Delta: *mreq.Delta}
-		} else {
-			pbm = pb.Metric{Name: mreq.ID, Type: mreq.MType, Value: *mreq.Value}
+	if c.stream == nil {
+		if err := c.openStream(); err != nil {
+			return c.fallbackToUnary(req, err)
 		}
-		pbMetrics = append(pbMetrics, &pbm)
 	}
-	res, err := mClient.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: pbMetrics}) // &req
+
+	// если сервер не ответил вовремя, поток отменяется, и Send или Recv возвращают ошибку
+	timer := time.AfterFunc(c.sendTimeout, c.cancel)
+	defer timer.Stop()
+
+	err := c.stream.Send(req)
+	if err == nil {
+		_, err = c.stream.Recv()
+	} else if errors.Is(err, io.EOF) {
+		// при обрыве потока Send возвращает io.EOF, а причину - Recv
+		_, err = c.stream.Recv()
+	}
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, io.EOF) {
+		err = errors.New("closed by server")
+	}
+	c.closeStream()
+	if status.Code(err) == codes.Unimplemented {
+		return c.fallbackToUnary(req, err)
+	}
+	// пакеты подтверждаются по одному, поэтому ошибка относится к текущему пакету
+	return fmt.Errorf("metrics stream broken: %w", err)
+}
+
+// fallbackToUnary переключает клиент на UpdateMetrics, если сервер не поддерживает StreamMetrics
+func (c *GrpcClient) fallbackToUnary(req *pb.UpdateMetricsRequest, err error) error {
+	if status.Code(err) != codes.Unimplemented {
+		return err
+	}
+	log.Println("gRPC server does not support StreamMetrics, using UpdateMetrics")
+	c.unary = true
+	return c.sendUnary(req)
+}
+
+// connect создает соединение с сервером; переподключение после обрыва выполняет само соединение
+func (c *GrpcClient) connect() error {
+	if c.conn != nil {
+		return nil
+	}
+	conn, err := grpc.NewClient(c.url,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                grpcKeepaliveTime,
+			Timeout:             grpcKeepaliveTimeout,
+			PermitWithoutStream: true,
+		}))
+	if err != nil {
+		return fmt.Errorf("failed to connect to gRPC server at %s: %w", c.url, err)
+	}
+	c.conn = conn
+	c.client = pb.NewMetricsClient(conn)
+	return nil
+}
+
+func (c *GrpcClient) outgoingContext(ctx context.Context) context.Context {
+	if c.agentID != "" {
+		return metadata.AppendToOutgoingContext(ctx, agentid.HeaderName, c.agentID)
+	}
+	return ctx
+}
+
+// openStream открывает поток и ждет, пока сервер его примет
+func (c *GrpcClient) openStream() error {
+	ctx, cancel := context.WithCancel(c.outgoingContext(context.Background()))
+	timer := time.AfterFunc(c.sendTimeout, cancel)
+	defer timer.Stop()
+
+	stream, err := c.client.StreamMetrics(ctx)
+	if err == nil {
+		// сервер отправляет заголовки, как только принимает поток
+		_, err = stream.Header()
+	}
+	if err != nil {
+		cancel()
+		return err
+	}
+	c.stream, c.cancel = stream, cancel
+	return nil
+}
+
+func (c *GrpcClient) closeStream() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.stream, c.cancel = nil, nil
+}
+
+func (c *GrpcClient) sendUnary(req *pb.UpdateMetricsRequest) error {
+	ctx, cancel := context.WithTimeout(c.outgoingContext(context.Background()), c.sendTimeout)
+	defer cancel()
+
+	res, err := c.client.UpdateMetrics(ctx, req)
 	if err != nil {
 		return err
 	}
 	if res.Error != "" {
 		return fmt.Errorf("error while sending metrics chunks to grpc: %v", res.Error)
 	}
-
-	log.Printf("Response from gRPC server's UpdateMetrics function is OK")
 	return nil
 }
+
+// wait выдерживает паузу перед следующей попыткой и увеличивает следующую паузу
+func (c *GrpcClient) wait() {
+	if c.backoff == 0 {
+		c.backoff = c.minBackoff
+	}
+	time.Sleep(c.backoff)
+	c.backoff = min(c.backoff*2, c.maxBackoff)
+}
+
+// Close закрывает поток и соединение; все отправленные пакеты к этому моменту уже подтверждены
+func (c *GrpcClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	if c.stream != nil {
+		timer := time.AfterFunc(c.sendTimeout, c.cancel)
+		if err = c.stream.CloseSend(); err == nil {
+			// сервер завершает поток, получив io.EOF
+			if _, err = c.stream.Recv(); errors.Is(err, io.EOF) {
+				err = nil
+				log.Println("metrics stream closed")
+			}
+		}
+		timer.Stop()
+		c.closeStream()
+	}
+	if c.conn != nil {
+		err = errors.Join(err, c.conn.Close())
+		c.conn, c.client = nil, nil
+	}
+	return err
+}
+
+// повторять отправку не имеет смысла, если сервер отклонил сам пакет или не принимает агента
+func isRetriableGrpcError(err error) bool {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.PermissionDenied, codes.Unauthenticated, codes.Unimplemented:
+		return false
+	}
+	return true
+}
+
+func metricsToProto(chunk []MetricRequest) []*pb.Metric {
+	pbMetrics := make([]*pb.Metric, 0, len(chunk))
+	for _, mreq := range chunk {
+		var pbm pb.Metric
+		switch mreq.MType {
+		case "counter":
+			pbm = pb.Metric{Name: mreq.ID, Type: mreq.MType, Delta: *mreq.Delta, Labels: mreq.Labels}
+		case "histogram":
+			h := &pb.Histogram{
+				Bounds: mreq.Histogram.Bounds,
+				Counts: mreq.Histogram.Counts,
+				Sum:    mreq.Histogram.Sum,
+				Count:  mreq.Histogram.Count,
+			}
+			pbm = pb.Metric{Name: mreq.ID, Type: mreq.MType, Histogram: h, Labels: mreq.Labels}
+		case "summary":
+			pbm = pb.Metric{Name: mreq.ID, Type: mreq.MType, Summary: summaryToProto(mreq.Summary), Labels: mreq.Labels}
+		default:
+			pbm = pb.Metric{Name: mreq.ID, Type: mreq.MType, Value: *mreq.Value, Labels: mreq.Labels}
+		}
+		pbMetrics = append(pbMetrics, &pbm)
+	}
+	return pbMetrics
+}
+
+func summaryToProto(s *ddsketch.Sketch) *pb.Summary {
+	res := &pb.Summary{
+		Alpha:    s.Alpha,
+		Positive: make(map[int32]uint64, len(s.Positive)),
+		Negative: make(map[int32]uint64, len(s.Negative)),
+		Zero:     s.Zero,
+		Sum:      s.Sum,
+		Count:    s.Count,
+		Min:      s.Min,
+		Max:      s.Max,
+	}
+	for k, c := range s.Positive {
+		res.Positive[int32(k)] = c
+	}
+	for k, c := range s.Negative {
+		res.Negative[int32(k)] = c
+	}
+	return res
+}
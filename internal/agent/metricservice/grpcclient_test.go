@@ -0,0 +1,221 @@
+package metricservice
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/pkg/agentid"
+	pb "github.com/adettelle/go-metric-collector/proto"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeMetricsServer запоминает принятые пакеты метрик
+type fakeMetricsServer struct {
+	pb.UnimplementedMetricsServer
+	noStreaming bool // сервер старой версии: только UpdateMetrics
+	failChunks  int  // сколько первых пакетов не удается сохранить
+	stall       bool // сервер принимает пакеты, но не подтверждает их
+
+	mu      sync.Mutex
+	streams int
+	chunks  [][]*pb.Metric
+	agents  []string
+}
+
+func (s *fakeMetricsServer) StreamMetrics(srv grpc.BidiStreamingServer[pb.UpdateMetricsRequest, pb.StreamMetricsResponse]) error {
+	if s.noStreaming {
+		return status.Error(codes.Unimplemented, "method StreamMetrics not implemented")
+	}
+	s.mu.Lock()
+	s.streams++
+	s.mu.Unlock()
+	if err := srv.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	var received uint64
+	for {
+		in, err := srv.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if s.stall {
+			<-srv.Context().Done()
+			return srv.Context().Err()
+		}
+		if s.fail() {
+			return status.Error(codes.Internal, "failed to save metrics")
+		}
+		md, _ := metadata.FromIncomingContext(srv.Context())
+		s.record(in.Metrics, md.Get(agentid.HeaderName))
+		received++
+		if err = srv.Send(&pb.StreamMetricsResponse{Received: received}); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *fakeMetricsServer) fail() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failChunks == 0 {
+		return false
+	}
+	s.failChunks--
+	return true
+}
+
+func (s *fakeMetricsServer) UpdateMetrics(ctx context.Context, in *pb.UpdateMetricsRequest) (*pb.UpdateMetricsResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.record(in.Metrics, md.Get(agentid.HeaderName))
+	return &pb.UpdateMetricsResponse{}, nil
+}
+
+func (s *fakeMetricsServer) record(metrics []*pb.Metric, agents []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chunks = append(s.chunks, metrics)
+	s.agents = append(s.agents, agents...)
+}
+
+func (s *fakeMetricsServer) received() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.chunks)
+}
+
+// startFakeServer запускает сервер на addr ("127.0.0.1:0" - на свободном порту)
+func startFakeServer(t *testing.T, addr string, fake *fakeMetricsServer) (*grpc.Server, string) {
+	lis, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	pb.RegisterMetricsServer(s, fake)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return s, lis.Addr().String()
+}
+
+func gaugeChunk(name string, value float64) []MetricRequest {
+	return []MetricRequest{{ID: name, MType: "gauge", Value: &value}}
+}
+
+// все пакеты идут в одном потоке, каждый подтверждается сервером до возврата из SendMetricsChunk
+func TestGrpcClientSingleStream(t *testing.T) {
+	fake := &fakeMetricsServer{}
+	_, addr := startFakeServer(t, "127.0.0.1:0", fake)
+
+	sender := NewGrpcSender(addr, "agent-1", 1)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sender.SendMetricsChunk(i, gaugeChunk("Alloc", float64(i))))
+		require.Equal(t, i+1, fake.received())
+	}
+	require.NoError(t, sender.Close())
+
+	require.Equal(t, 1, fake.streams)
+	require.Len(t, fake.chunks, 3)
+	require.Equal(t, 2.0, fake.chunks[2][0].Value)
+	require.Equal(t, []string{"agent-1", "agent-1", "agent-1"}, fake.agents)
+}
+
+// после перезапуска сервера клиент открывает новый поток и отправляет пакет заново
+func TestGrpcClientReconnect(t *testing.T) {
+	first := &fakeMetricsServer{}
+	server, addr := startFakeServer(t, "127.0.0.1:0", first)
+
+	sender := NewGrpcSender(addr, "", 5)
+	sender.minBackoff = 10 * time.Millisecond
+	require.NoError(t, sender.SendMetricsChunk(0, gaugeChunk("Alloc", 1)))
+	require.Equal(t, 1, first.received())
+
+	server.Stop()
+	// клиент заметил обрыв соединения
+	require.Eventually(t, func() bool { return sender.conn.GetState() != connectivity.Ready }, time.Second, 10*time.Millisecond)
+
+	second := &fakeMetricsServer{}
+	startFakeServer(t, addr, second)
+	require.NoError(t, sender.SendMetricsChunk(1, gaugeChunk("Alloc", 2)))
+	require.NoError(t, sender.Close())
+
+	require.Equal(t, 1, second.streams)
+	require.Len(t, second.chunks, 1)
+	require.Equal(t, 2.0, second.chunks[0][0].Value)
+	require.Zero(t, sender.backoff)
+}
+
+// пакет, который сервер не смог сохранить, отправляется заново в новом потоке и не теряется
+func TestGrpcClientRetriesUnsavedChunk(t *testing.T) {
+	fake := &fakeMetricsServer{failChunks: 1}
+	_, addr := startFakeServer(t, "127.0.0.1:0", fake)
+
+	sender := NewGrpcSender(addr, "", 2)
+	sender.minBackoff = time.Millisecond
+	require.NoError(t, sender.SendMetricsChunk(0, gaugeChunk("Alloc", 1)))
+	require.NoError(t, sender.SendMetricsChunk(1, gaugeChunk("Alloc", 2)))
+	require.NoError(t, sender.Close())
+
+	require.Equal(t, 2, fake.streams)
+	require.Len(t, fake.chunks, 2)
+	require.Equal(t, 1.0, fake.chunks[0][0].Value)
+	require.Equal(t, 2.0, fake.chunks[1][0].Value)
+}
+
+// если сервер не подтверждает пакет, отправка завершается ошибкой по таймауту, а не блокирует агента
+func TestGrpcClientSendTimeout(t *testing.T) {
+	fake := &fakeMetricsServer{stall: true}
+	_, addr := startFakeServer(t, "127.0.0.1:0", fake)
+
+	sender := NewGrpcSender(addr, "", 1)
+	sender.minBackoff = time.Millisecond
+	sender.sendTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	err := sender.SendMetricsChunk(0, gaugeChunk("Alloc", 1))
+	require.Equal(t, codes.Canceled, status.Code(err))
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, 2, fake.streams)
+	require.NoError(t, sender.Close())
+}
+
+// сервер без StreamMetrics получает пакеты через UpdateMetrics
+func TestGrpcClientFallbackToUnary(t *testing.T) {
+	fake := &fakeMetricsServer{noStreaming: true}
+	_, addr := startFakeServer(t, "127.0.0.1:0", fake)
+
+	sender := NewGrpcSender(addr, "agent-1", 1)
+	require.NoError(t, sender.SendMetricsChunk(0, gaugeChunk("Alloc", 1)))
+	require.NoError(t, sender.SendMetricsChunk(1, gaugeChunk("Alloc", 2)))
+	require.Equal(t, 2, fake.received())
+	require.True(t, sender.unary)
+	require.NoError(t, sender.Close())
+}
+
+// пока сервер недоступен, пауза между попытками растет; после maxRetries повторов пакет не отправляется
+func TestGrpcClientBackoff(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := lis.Addr().String()
+	require.NoError(t, lis.Close())
+
+	sender := NewGrpcSender(addr, "", 2)
+	sender.minBackoff = time.Millisecond
+	sender.maxBackoff = 3 * time.Millisecond
+
+	err = sender.SendMetricsChunk(0, gaugeChunk("Alloc", 1))
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	// 1ms перед первым повтором, 2ms перед вторым, следующая пауза ограничена maxBackoff
+	require.Equal(t, 3*time.Millisecond, sender.backoff)
+	require.NoError(t, sender.Close())
+}
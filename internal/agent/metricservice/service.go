@@ -11,6 +11,7 @@ import (
 
 	"github.com/adettelle/go-metric-collector/internal/agent/config"
 	"github.com/adettelle/go-metric-collector/pkg/collections"
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
 
 	m "github.com/adettelle/go-metric-collector/internal/agent/metrics"
 )
@@ -21,6 +22,7 @@ type MetricService struct {
 	sender            MetricSender //*Client
 	rateLimit         int
 	ChunkSize         int
+	labels            map[string]string // метки, которые добавляются ко всем метрикам агента
 }
 
 type MetricSender interface {
@@ -39,16 +41,23 @@ func NewMetricService(
 		sender:            sender,
 		rateLimit:         config.RateLimit,
 		ChunkSize:         chunkSize,
+		labels:            config.Labels,
 	}
 }
 
 type MetricRequest struct {
-	Delta *int64   `json:"delta,omitempty"` // metric's value when metric type is counter
-	Value *float64 `json:"value,omitempty"` // metric's value when metric type is gauge
-	ID    string   `json:"id"`              // metric's name
-	MType string   `json:"type"`            // parameter that takes gauge or counter value
+	Delta     *int64            `json:"delta,omitempty"`     // metric's value when metric type is counter
+	Value     *float64          `json:"value,omitempty"`     // metric's value when metric type is gauge
+	Histogram *m.Histogram      `json:"histogram,omitempty"` // histogram observed since the previous report
+	Summary   *ddsketch.Sketch  `json:"summary,omitempty"`   // quantile sketch of values observed since the previous report
+	ID        string            `json:"id"`                  // metric's name
+	MType     string            `json:"type"`                // parameter that takes gauge, counter, histogram or summary value
+	Labels    map[string]string `json:"labels,omitempty"`    // metric's labels (host, env, ...)
 }
 
+// ReportLatencyMetric - гистограмма длительности отправки пакета метрик на сервер, в секундах
+const ReportLatencyMetric = "ReportLatency"
+
 // SendLoop sends all metrics to the server (MemStorage) with delay
 func (ms *MetricService) SendLoop(ctx context.Context, delay time.Duration, wg *sync.WaitGroup) error { // , term <-chan struct{}
 	defer wg.Done()
@@ -108,7 +117,10 @@ func (ms *MetricService) finalizeSendLoop(chunks chan []MetricRequest) error {
 func (ms *MetricService) StartWorker(id int, chunks <-chan []MetricRequest, results chan<- bool) {
 	// worker:
 	for chunk := range chunks {
+		start := time.Now()
 		err := ms.sender.SendMetricsChunk(id, chunk) // SendMetricsChunkEncrypted
+		// задержка попадет на сервер со следующей отправкой
+		ms.metricAccumulator.ObserveHistogramMetric(ReportLatencyMetric, time.Since(start).Seconds())
 		if err != nil {
 			results <- false
 		} else {
@@ -159,9 +171,10 @@ func (ms *MetricService) collectAllMetrics() ([]MetricRequest, error) {
 
 	for name, value := range gaugeMetrics {
 		metric := MetricRequest{
-			MType: "gauge",
-			ID:    name,
-			Value: &value,
+			MType:  "gauge",
+			ID:     name,
+			Value:  &value,
+			Labels: ms.labels,
 		}
 		metrics = append(metrics, metric)
 	}
@@ -170,9 +183,34 @@ func (ms *MetricService) collectAllMetrics() ([]MetricRequest, error) {
 
 	for name, delta := range counterMetrics {
 		metric := MetricRequest{
-			MType: "counter",
-			ID:    name,
-			Delta: &delta,
+			MType:  "counter",
+			ID:     name,
+			Delta:  &delta,
+			Labels: ms.labels,
+		}
+		metrics = append(metrics, metric)
+	}
+
+	histogramMetrics := ms.metricAccumulator.GetAllHistogramMetrics()
+
+	for name, h := range histogramMetrics {
+		metric := MetricRequest{
+			MType:     "histogram",
+			ID:        name,
+			Histogram: &h,
+			Labels:    ms.labels,
+		}
+		metrics = append(metrics, metric)
+	}
+
+	summaryMetrics := ms.metricAccumulator.GetAllSummaryMetrics()
+
+	for name, sketch := range summaryMetrics {
+		metric := MetricRequest{
+			MType:   "summary",
+			ID:      name,
+			Summary: sketch,
+			Labels:  ms.labels,
 		}
 		metrics = append(metrics, metric)
 	}
@@ -73,6 +73,9 @@ func TestCollectAllMetrics(t *testing.T) {
 	ma := m.New()
 	ma.AddGaugeMetric("g1", 3.14)
 	ma.AddCounterMetric("c1", 100)
+	ma.SetHistogramBuckets([]float64{1})
+	ma.ObserveHistogramMetric("h1", 0.5)
+	ma.ObserveSummaryMetric("s1", 2)
 
 	ms := &MetricService{
 		metricAccumulator: ma,
@@ -81,7 +84,7 @@ func TestCollectAllMetrics(t *testing.T) {
 	metrics, err := ms.collectAllMetrics()
 	assert.NoError(t, err)
 
-	assert.Len(t, metrics, 2)
+	assert.Len(t, metrics, 4)
 
 	// Check for correct gauge metric
 	for _, metric := range metrics {
@@ -94,9 +97,40 @@ func TestCollectAllMetrics(t *testing.T) {
 			assert.Equal(t, "counter", metric.MType)
 			assert.Equal(t, int64(100), *metric.Delta)
 		}
+
+		if metric.ID == "h1" {
+			assert.Equal(t, "histogram", metric.MType)
+			assert.Equal(t, m.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Sum: 0.5, Count: 1}, *metric.Histogram)
+		}
+
+		if metric.ID == "s1" {
+			assert.Equal(t, "summary", metric.MType)
+			assert.Equal(t, uint64(1), metric.Summary.Count)
+		}
 	}
 }
 
+// длительность отправки каждого пакета попадает в гистограмму ReportLatency
+func TestStartWorkerObservesReportLatency(t *testing.T) {
+	ma := m.New()
+	ms := &MetricService{
+		metricAccumulator: ma,
+		sender:            &MockMetricSender{},
+	}
+
+	chunks := make(chan []MetricRequest, 2)
+	results := make(chan bool, 2)
+	chunks <- []MetricRequest{}
+	chunks <- []MetricRequest{}
+	close(chunks)
+
+	ms.StartWorker(0, chunks, results)
+
+	assert.True(t, <-results)
+	assert.True(t, <-results)
+	assert.Equal(t, uint64(2), ma.GetAllHistogramMetrics()[ReportLatencyMetric].Count)
+}
+
 // Test sends chunks of metrics
 func TestSendMultipleMetrics(t *testing.T) {
 	chunkSize := 2
@@ -3,35 +3,75 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha512"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/adettelle/go-metric-collector/internal/db"
 	"github.com/adettelle/go-metric-collector/internal/security"
+	"github.com/adettelle/go-metric-collector/internal/server/agents"
 	"github.com/adettelle/go-metric-collector/internal/server/config"
 	"github.com/adettelle/go-metric-collector/internal/server/service"
+	"github.com/adettelle/go-metric-collector/internal/server/stream"
 	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/pkg/agentid"
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
 )
 
 // Storager defines an interface for interacting with various storage mechanisms,
 // such as MemStorage or fileStorage. It describes operations to store, retrieve,
 // check for existence, and delete a "metric" entity.
+// Every method takes the context of the request it serves: cancelling the request
+// or shutting the server down cancels the storage operation.
 type Storager interface {
-	GetGaugeMetric(name string) (float64, bool, error)
-	GetCounterMetric(name string) (int64, bool, error)
-	AddGaugeMetric(name string, value float64) error
-	AddCounterMetric(name string, value int64) error
-	GetAllGaugeMetrics() (map[string]float64, error)
-	GetAllCounterMetrics() (map[string]int64, error)
-	Finalize() error // отрабатывает завершение приложения (при штатном завершении работы)
+	GetGaugeMetric(ctx context.Context, name string) (float64, bool, error)
+	GetCounterMetric(ctx context.Context, name string) (int64, bool, error)
+	AddGaugeMetric(ctx context.Context, name string, value float64) error
+	AddCounterMetric(ctx context.Context, name string, value int64) error
+	GetAllGaugeMetrics(ctx context.Context) (map[string]float64, error)
+	GetAllCounterMetrics(ctx context.Context) (map[string]int64, error)
+	GetHistogramMetric(ctx context.Context, name string) (memstorage.Histogram, bool, error)
+	// гистограмма h - приращение, которое прибавляется к накопленной гистограмме
+	AddHistogramMetric(ctx context.Context, name string, h memstorage.Histogram) error
+	GetAllHistogramMetrics(ctx context.Context) (map[string]memstorage.Histogram, error)
+	GetSummaryMetric(ctx context.Context, name string) (*ddsketch.Sketch, bool, error)
+	// скетч s объединяется с накопленным скетчем summary метрики
+	AddSummaryMetric(ctx context.Context, name string, s *ddsketch.Sketch) error
+	GetAllSummaryMetrics(ctx context.Context) (map[string]*ddsketch.Sketch, error)
+	// выборка метрик по типу и шаблону имени с сортировкой и страницей;
+	// возвращает страницу и общее количество подходящих метрик
+	ListMetrics(ctx context.Context, q memstorage.ListQuery) ([]memstorage.Metric, int, error)
+	// пакетная запись: сохраняются либо все метрики пакета, либо ни одна
+	AddMetrics(ctx context.Context, metrics []memstorage.Metric) error
+	// удаление метрики вместе с историей; false, если метрики не было
+	DeleteMetric(ctx context.Context, metricType, name string) (bool, error)
+	// пакетное удаление: удаляются либо все метрики пакета, либо ни одна;
+	// возвращает количество удаленных (метрики, которых не было, не учитываются)
+	DeleteMetrics(ctx context.Context, metrics []memstorage.Metric) (int, error)
+	// удаление метрик, которые не обновлялись дольше ttl; возвращает количество удаленных
+	DeleteStaleMetrics(ctx context.Context, ttl time.Duration) (int, error)
+	// история значений метрики за период с from по to включительно, упорядоченная по времени
+	GetGaugeHistory(ctx context.Context, name string, from, to time.Time) ([]memstorage.Sample, error)
+	GetCounterHistory(ctx context.Context, name string, from, to time.Time) ([]memstorage.Sample, error)
+	// агрегаты истории gauge или counter метрики с разрешением resolution (минута или час)
+	GetRollups(ctx context.Context, metricType, name string, resolution time.Duration, from, to time.Time) ([]memstorage.Rollup, error)
+	// пересчет часовых агрегатов и удаление истории старше сроков хранения
+	Compact(ctx context.Context) error
+	Finalize(ctx context.Context) error // отрабатывает завершение приложения (при штатном завершении работы)
 }
 
 // MetricHandlers contains dependencies for handling HTTP requests related
@@ -42,6 +82,8 @@ type MetricHandlers struct {
 	DBCon      db.DBConnector // new
 	Finalizing bool           // true означает, что надо делать graceful shutdowm
 	Wg         *sync.WaitGroup
+	Agents     *agents.Registry // агенты, приславшие метрики (по заголовку X-Agent-ID)
+	Hub        *stream.Hub      // подписчики на изменения метрик (см. NotifyingStorager); nil - потоки недоступны
 }
 
 func NewMetricHandlers(storager Storager, config *config.Config, wg *sync.WaitGroup) *MetricHandlers {
@@ -50,9 +92,39 @@ func NewMetricHandlers(storager Storager, config *config.Config, wg *sync.WaitGr
 		Config:   config,
 		DBCon:    db.NewDBConnection(config.DBParams),
 		Wg:       wg,
+		Agents:   agents.NewRegistry(),
 	}
 }
 
+// requestAgentID возвращает ID агента из заголовка X-Agent-ID; пустая строка - запрос не от агента
+func requestAgentID(r *http.Request) (string, error) {
+	agentID := r.Header.Get(agentid.HeaderName)
+	return agentID, agentid.Validate(agentID)
+}
+
+// stampAgentID возвращает ID агента, которым отмечаются его метрики (см. agentid.Stamp),
+// или пустую строку, если это выключено в конфигурации (по умолчанию)
+func (mh *MetricHandlers) stampAgentID(agentID string) string {
+	if mh.Config == nil || !mh.Config.StampAgentID {
+		return ""
+	}
+	return agentID
+}
+
+// recordAgent отмечает в реестре агента из заголовка X-Agent-ID, приславшего метрики keys
+func (mh *MetricHandlers) recordAgent(r *http.Request, keys []string) {
+	agentID := r.Header.Get(agentid.HeaderName)
+	if agentID == "" || mh.Agents == nil {
+		return
+	}
+
+	addr := r.Header.Get("X-Real-IP")
+	if addr == "" {
+		addr, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}
+	mh.Agents.Seen(agentID, addr, keys)
+}
+
 // MetricUpdate handles HTTP requests to update a metric,
 // accepting a JSON object in the request body.
 func (mh *MetricHandlers) MetricUpdate(w http.ResponseWriter, r *http.Request) {
@@ -87,16 +159,26 @@ func (mh *MetricHandlers) MetricUpdate(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err = memstorage.ValidateSeries(metric.ID, metric.Labels); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	agentID, err := requestAgentID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	metric.Labels = agentid.Stamp(metric.Labels, mh.stampAgentID(agentID))
 
 	switch {
 	case metric.MType == "gauge":
-		if err = mh.Storager.AddGaugeMetric(metric.ID, *metric.Value); err != nil {
+		if err = mh.Storager.AddGaugeMetric(r.Context(), metric.Key(), *metric.Value); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
 
-		_, ok, err = mh.Storager.GetGaugeMetric(metric.ID)
+		_, ok, err = mh.Storager.GetGaugeMetric(r.Context(), metric.Key())
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -108,14 +190,58 @@ func (mh *MetricHandlers) MetricUpdate(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 
 	case metric.MType == "counter":
-		err = mh.Storager.AddCounterMetric(metric.ID, *metric.Delta)
+		err = mh.Storager.AddCounterMetric(r.Context(), metric.Key(), *metric.Delta)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		_, ok, err = mh.Storager.GetCounterMetric(r.Context(), metric.Key())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	case metric.MType == "histogram":
+		if err = validateHistogram(metric.Histogram); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err = mh.Storager.AddHistogramMetric(r.Context(), metric.Key(), *metric.Histogram); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		_, ok, err = mh.Storager.GetHistogramMetric(r.Context(), metric.Key())
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	case metric.MType == "summary":
+		if err = validateSummary(metric.Summary); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err = mh.Storager.AddSummaryMetric(r.Context(), metric.Key(), metric.Summary); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 
-		_, ok, err = mh.Storager.GetCounterMetric(metric.ID)
+		_, ok, err = mh.Storager.GetSummaryMetric(r.Context(), metric.Key())
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -135,6 +261,8 @@ func (mh *MetricHandlers) MetricUpdate(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	mh.recordAgent(r, []string{metric.Key()})
+
 	resp, err := json.Marshal(metric)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -172,9 +300,13 @@ func (mh *MetricHandlers) MetricValue(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err = memstorage.ValidateSeries(metric.ID, metric.Labels); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	switch {
 	case metric.MType == "gauge":
-		value, ok, gaugeMetricErr := mh.Storager.GetGaugeMetric(metric.ID)
+		value, ok, gaugeMetricErr := mh.Storager.GetGaugeMetric(r.Context(), metric.Key())
 		if gaugeMetricErr != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -187,7 +319,7 @@ func (mh *MetricHandlers) MetricValue(w http.ResponseWriter, r *http.Request) {
 		metric.Value = &value
 
 	case metric.MType == "counter":
-		value, ok, counterMetricErr := mh.Storager.GetCounterMetric(metric.ID)
+		value, ok, counterMetricErr := mh.Storager.GetCounterMetric(r.Context(), metric.Key())
 		if counterMetricErr != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -199,6 +331,34 @@ func (mh *MetricHandlers) MetricValue(w http.ResponseWriter, r *http.Request) {
 
 		metric.Delta = &value
 
+	case metric.MType == "histogram":
+		value, ok, histogramMetricErr := mh.Storager.GetHistogramMetric(r.Context(), metric.Key())
+		if histogramMetricErr != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		metric.Histogram = &value
+
+	case metric.MType == "summary":
+		value, ok, summaryMetricErr := mh.Storager.GetSummaryMetric(r.Context(), metric.Key())
+		if summaryMetricErr != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		quantiles := memstorage.NewSummaryValue(value)
+		metric.Summary = value
+		metric.Quantiles = &quantiles
+
 	default:
 		w.WriteHeader(http.StatusBadRequest)
 		_, err = w.Write([]byte("No such metric"))
@@ -220,17 +380,23 @@ func (mh *MetricHandlers) MetricValue(w http.ResponseWriter, r *http.Request) {
 	w.Write(resp)
 }
 
-// CreateMetric adds a new metric with a specific name and value into MemStorage
-// POST http://localhost:8080/update/counter/someMetric/527
+// CreateMetric adds a new metric with a specific name and value into MemStorage;
+// labels may be passed as label.<name> query parameters.
+// POST http://localhost:8080/update/counter/someMetric/527?label.host=a
 func (mh *MetricHandlers) CreateMetric(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	metricName := r.PathValue("metric_name")
 	metricValue := r.PathValue("metric_value")
 	metricType := r.PathValue("metric_type")
 
+	metricName, err := seriesKeyFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	switch {
 	case metricType == "gauge":
 		value, err := strconv.ParseFloat(metricValue, 64)
@@ -238,7 +404,7 @@ func (mh *MetricHandlers) CreateMetric(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		err = mh.Storager.AddGaugeMetric(metricName, value)
+		err = mh.Storager.AddGaugeMetric(r.Context(), metricName, value)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -257,7 +423,70 @@ func (mh *MetricHandlers) CreateMetric(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		err = mh.Storager.AddCounterMetric(metricName, value)
+		err = mh.Storager.AddCounterMetric(r.Context(), metricName, value)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write([]byte("Created"))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+	case metricType == "histogram":
+		// значение добавляется в корзины уже накопленной гистограммы,
+		// для новой метрики используются корзины по умолчанию
+		value, err := strconv.ParseFloat(metricValue, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		stored, ok, err := mh.Storager.GetHistogramMetric(r.Context(), metricName)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		bounds := memstorage.DefaultBuckets
+		if ok {
+			bounds = stored.Bounds
+		}
+		delta := memstorage.NewHistogram(bounds)
+		delta.Observe(value)
+		err = mh.Storager.AddHistogramMetric(r.Context(), metricName, delta)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write([]byte("Created"))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+	case metricType == "summary":
+		// значение добавляется в скетч с точностью уже накопленного скетча
+		value, err := strconv.ParseFloat(metricValue, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		stored, ok, err := mh.Storager.GetSummaryMetric(r.Context(), metricName)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		alpha := ddsketch.DefaultAlpha
+		if ok {
+			alpha = stored.Alpha
+		}
+		sketch := ddsketch.New(alpha)
+		sketch.Add(value)
+		err = mh.Storager.AddSummaryMetric(r.Context(), metricName, sketch)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -282,14 +511,19 @@ func (mh *MetricHandlers) CreateMetric(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetMetric retrieves the value of a metric with the specified type
-// and name from MemStorage
-// GET http://localhost:8080/value/counter/HeapAlloc
+// and name from MemStorage; labels may be passed as label.<name> query parameters.
+// GET http://localhost:8080/value/counter/HeapAlloc?label.host=a
 func (mh *MetricHandlers) GetMetricByValue(w http.ResponseWriter, r *http.Request) {
-	metricNameToSearch := r.PathValue("metric_name")
 	metricTypeToSearch := r.PathValue("metric_type")
+
+	metricNameToSearch, err := seriesKeyFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	switch {
 	case metricTypeToSearch == "counter":
-		metric, metricExists, err := mh.Storager.GetCounterMetric(metricNameToSearch)
+		metric, metricExists, err := mh.Storager.GetCounterMetric(r.Context(), metricNameToSearch)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -304,7 +538,7 @@ func (mh *MetricHandlers) GetMetricByValue(w http.ResponseWriter, r *http.Reques
 			return
 		}
 	case metricTypeToSearch == "gauge":
-		metric, metricExists, err := mh.Storager.GetGaugeMetric(metricNameToSearch)
+		metric, metricExists, err := mh.Storager.GetGaugeMetric(r.Context(), metricNameToSearch)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -318,6 +552,50 @@ func (mh *MetricHandlers) GetMetricByValue(w http.ResponseWriter, r *http.Reques
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+	case metricTypeToSearch == "summary":
+		// по скетчу вычисляются количество, сумма и квантили p50, p95, p99
+		metric, metricExists, err := mh.Storager.GetSummaryMetric(r.Context(), metricNameToSearch)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !metricExists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		resp, err := json.Marshal(memstorage.NewSummaryValue(metric))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(resp)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	case metricTypeToSearch == "histogram":
+		// гистограмма не сводится к одному числу, поэтому отдается в JSON
+		metric, metricExists, err := mh.Storager.GetHistogramMetric(r.Context(), metricNameToSearch)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !metricExists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		resp, err := json.Marshal(metric)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(resp)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 	default:
 		w.WriteHeader(http.StatusNotFound)
 		_, err := w.Write([]byte("No such metric type"))
@@ -330,30 +608,73 @@ func (mh *MetricHandlers) GetMetricByValue(w http.ResponseWriter, r *http.Reques
 
 }
 
-// используем интерфейс mh.Storager (Reporter), у кого есть GetAllCounterMetrics, GetAllGaugeMetrics
-func (mh *MetricHandlers) GetAllMetrics(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html")
-	err := service.WriteMetricsReport(mh.Storager, w) // было mh *MetricHandlers
+// DeleteMetric removes the metric with the specified type and name together
+// with its history; labels may be passed as label.<name> query parameters.
+// When the server has a key, the request is signed over its path and query.
+// DELETE http://localhost:8080/value/gauge/CPUutilization8?label.host=a
+func (mh *MetricHandlers) DeleteMetric(w http.ResponseWriter, r *http.Request) {
+	if mh.Finalizing {
+		w.WriteHeader(http.StatusTeapot)
+		return
+	}
+
+	mh.Wg.Add(1)
+	defer mh.Wg.Done()
+
+	if mh.Config != nil && mh.Config.Key != "" {
+		// тела у запроса нет, поэтому подписывается путь вместе с параметрами
+		hash := security.CreateSign(r.URL.RequestURI(), mh.Config.Key)
+		if !hmac.Equal([]byte(hash), []byte(r.Header.Get("HashSHA256"))) {
+			log.Println("The signature is incorrect")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	metricType := r.PathValue("metric_type")
+	if !memstorage.ValidMetricType(metricType) {
+		w.WriteHeader(http.StatusNotFound)
+		_, err := w.Write([]byte("No such metric type"))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+
+	metricName, err := seriesKeyFromRequest(r)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-}
 
-func (mh *MetricHandlers) CheckConnectionToDB(w http.ResponseWriter, r *http.Request) {
-	log.Println("Checking DB")
-	_, err := mh.DBCon.Connect() // db.ConnectWithRerties(mh.Config.DBParams)
+	ok, err := mh.Storager.DeleteMetric(r.Context(), metricType, metricName)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
+	_, err = w.Write([]byte("Deleted"))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 }
 
-// MetricsUpdate processes an HTTP POST request that contains a batch of
-// metrics ([]Metrics) in JSON format.
-func (mh *MetricHandlers) MetricsUpdate(w http.ResponseWriter, r *http.Request) {
+// metricsDeleteResponse - ответ на пакетное удаление метрик
+type metricsDeleteResponse struct {
+	Deleted int `json:"deleted"` // количество удаленных метрик (несуществующие не учитываются)
+}
+
+// MetricsDelete removes a batch of metrics given as a JSON list of
+// {"id", "type", "labels"} objects and returns the number of deleted metrics.
+// The request is signed like /updates/ when the server has a key.
+// POST http://localhost:8080/delete/
+func (mh *MetricHandlers) MetricsDelete(w http.ResponseWriter, r *http.Request) {
 	if mh.Finalizing {
 		w.WriteHeader(http.StatusTeapot)
 		return
@@ -362,25 +683,16 @@ func (mh *MetricHandlers) MetricsUpdate(w http.ResponseWriter, r *http.Request)
 	mh.Wg.Add(1)
 	defer mh.Wg.Done()
 
-	var err error
-	var ok bool
-
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
-
-	var Metrics []memstorage.Metric
+	var metrics []memstorage.Metric
 	var buf bytes.Buffer
 
-	// читаем тело запроса
-	_, err = buf.ReadFrom(r.Body)
+	_, err := buf.ReadFrom(r.Body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if mh.Config.Key != "" {
+	if mh.Config != nil && mh.Config.Key != "" {
 		// вычисляем хеш и сравниваем в HTTP-заголовке запроса с именем HashSHA256
 		hash := security.CreateSign(buf.String(), mh.Config.Key)
 		if !hmac.Equal([]byte(hash), []byte(r.Header.Get("HashSHA256"))) {
@@ -388,61 +700,703 @@ func (mh *MetricHandlers) MetricsUpdate(w http.ResponseWriter, r *http.Request)
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		log.Println("The signature is authentic")
 	}
 
-	// десериализуем JSON в Metrric
-	if err = json.Unmarshal(buf.Bytes(), &Metrics); err != nil { //  decryptedBody
+	if err = json.Unmarshal(buf.Bytes(), &metrics); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	for _, metric := range metrics {
+		if !memstorage.ValidMetricType(metric.MType) {
+			http.Error(w, "No such metric type: "+metric.MType, http.StatusBadRequest)
+			return
+		}
+		if err = memstorage.ValidateSeries(metric.ID, metric.Labels); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
-	for _, metric := range Metrics {
-		switch {
-		case metric.MType == "gauge":
-			if err = mh.Storager.AddGaugeMetric(metric.ID, *metric.Value); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
+	// пакет удаляется целиком: либо все метрики, либо ни одной
+	var res metricsDeleteResponse
+	res.Deleted, err = mh.Storager.DeleteMetrics(r.Context(), metrics)
+	if err != nil {
+		log.Println("error in deleting metrics:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-			_, ok, err = mh.Storager.GetGaugeMetric(metric.ID)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			if !ok {
-				w.WriteHeader(http.StatusNotFound)
-				return
-			}
+	resp, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
 
-		case metric.MType == "counter":
-			if err = mh.Storager.AddCounterMetric(metric.ID, *metric.Delta); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
+// MetricsValue returns the current values of a batch of metrics given as
+// a JSON list of {"id", "type", "labels"} objects. The response lists the
+// metrics in the same order; a metric that is not stored is returned
+// without a value and with "not_found": true. The request is signed
+// like /updates/ when the server has a key.
+// POST http://localhost:8080/values/
+func (mh *MetricHandlers) MetricsValue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
 
-			_, ok, err = mh.Storager.GetCounterMetric(metric.ID)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				return
+	var metrics []memstorage.Metric
+	var buf bytes.Buffer
+
+	_, err := buf.ReadFrom(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if mh.Config != nil && mh.Config.Key != "" {
+		// вычисляем хеш и сравниваем в HTTP-заголовке запроса с именем HashSHA256
+		hash := security.CreateSign(buf.String(), mh.Config.Key)
+		if !hmac.Equal([]byte(hash), []byte(r.Header.Get("HashSHA256"))) {
+			log.Println("The signature is incorrect")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err = json.Unmarshal(buf.Bytes(), &metrics); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = service.ValidateLookup(metrics); err != nil {
+		if errors.Is(err, memstorage.ErrUnknownMetricType) {
+			http.Error(w, "No such metric", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	values, err := service.LookupMetrics(r.Context(), mh.Storager, metrics)
+	if err != nil {
+		log.Println("error in reading metrics:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := json.Marshal(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// validateHistogram проверяет гистограмму, присланную в JSON
+func validateHistogram(h *memstorage.Histogram) error {
+	if h == nil {
+		return fmt.Errorf("histogram metric has no histogram value")
+	}
+	return h.Validate()
+}
+
+// validateSummary проверяет скетч summary метрики, присланный в JSON
+func validateSummary(s *ddsketch.Sketch) error {
+	if s == nil {
+		return fmt.Errorf("summary metric has no summary value")
+	}
+	return s.Validate()
+}
+
+// labelParamPrefix - префикс параметров запроса, которые задают метки метрики;
+// остальные параметры (например, для сброса кэша) на ключ метрики не влияют
+const labelParamPrefix = "label."
+
+// seriesKeyFromRequest возвращает ключ метрики из имени в пути запроса и меток,
+// переданных в параметрах запроса с префиксом label. (?label.host=a&label.env=prod)
+func seriesKeyFromRequest(r *http.Request) (string, error) {
+	return seriesKey(r.PathValue("metric_name"), r.URL.Query())
+}
+
+// seriesKey возвращает ключ метрики из имени и меток, переданных в параметрах запроса с префиксом label.
+func seriesKey(metricName string, params url.Values) (string, error) {
+	if err := memstorage.ValidateMetricName(metricName); err != nil {
+		return "", err
+	}
+
+	labels := make(memstorage.Labels)
+	for param := range params {
+		if name, ok := strings.CutPrefix(param, labelParamPrefix); ok {
+			labels[name] = params.Get(param)
+		}
+	}
+	if err := memstorage.ValidateLabels(labels); err != nil {
+		return "", err
+	}
+	return memstorage.SeriesKey(metricName, labels), nil
+}
+
+// rangeQueryResponse - ответ на запрос истории метрики
+type rangeQueryResponse struct {
+	Name   string              `json:"name"`
+	Type   string              `json:"type"`
+	Fn     string              `json:"fn"`
+	Step   float64             `json:"step"` // шаг в секундах
+	Points []memstorage.Sample `json:"points"`
+}
+
+// QueryRange returns metric history aligned to steps as a JSON object.
+// Gauges take the last value in each step, counters are reported as
+// increase (default) or per-second rate, chosen by the fn parameter.
+// Labels of the series are passed as label.* parameters, as for /value/.
+// GET http://localhost:8080/api/v1/query_range?type=gauge&name=HeapAlloc&from=1700000000&to=1700003600&step=60s
+func (mh *MetricHandlers) QueryRange(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	metricType := params.Get("type")
+	fn := params.Get("fn")
+
+	if params.Get("name") == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	metricName, err := seriesKey(params.Get("name"), params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	q, err := parseRangeQuery(params.Get("from"), params.Get("to"), params.Get("step"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var samples []memstorage.Sample
+	var points []memstorage.Sample
+
+	switch {
+	case metricType == "gauge":
+		if fn == "" {
+			fn = "last"
+		}
+		if fn != "last" {
+			http.Error(w, "unsupported fn for gauge: "+fn, http.StatusBadRequest)
+			return
+		}
+		samples, err = mh.Storager.GetGaugeHistory(r.Context(), metricName, q.HistoryFrom(), q.To)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		points = service.LastInStep(samples, q)
+
+	case metricType == "counter":
+		if fn == "" {
+			fn = "increase"
+		}
+		samples, err = mh.Storager.GetCounterHistory(r.Context(), metricName, q.HistoryFrom(), q.To)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch fn {
+		case "increase":
+			points = service.Increase(samples, q)
+		case "rate":
+			points = service.Rate(samples, q)
+		case "last":
+			points = service.LastInStep(samples, q)
+		default:
+			http.Error(w, "unsupported fn for counter: "+fn, http.StatusBadRequest)
+			return
+		}
+
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		_, err = w.Write([]byte("No such metric type"))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+
+	resp, err := json.Marshal(rangeQueryResponse{
+		Name:   metricName,
+		Type:   metricType,
+		Fn:     fn,
+		Step:   q.Step.Seconds(),
+		Points: points,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// defaultRollupsDuration - период запроса агрегатов истории по умолчанию
+const defaultRollupsDuration = 24 * time.Hour
+
+// rollupPoint - агрегат в ответе на запрос агрегатов истории
+type rollupPoint struct {
+	Start time.Time `json:"start"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Avg   float64   `json:"avg"`
+	Last  float64   `json:"last"`
+	Sum   float64   `json:"sum"` // для counter метрики - прирост счетчика за интервал
+	Count uint64    `json:"count"`
+}
+
+// rollupsResponse - ответ на запрос агрегатов истории метрики
+type rollupsResponse struct {
+	Name       string        `json:"name"`
+	Type       string        `json:"type"`
+	Resolution float64       `json:"resolution"` // разрешение в секундах
+	Points     []rollupPoint `json:"points"`
+}
+
+// Rollups returns downsampled metric history: per-minute or per-hour
+// min/max/avg/last of gauge values and sum of counter increments.
+// Hourly rollups appear after the hour is over and compaction has run.
+// Labels of the series are passed as label.* parameters, as for /value/.
+// GET http://localhost:8080/api/v1/rollups?type=gauge&name=HeapAlloc&resolution=1h&from=1700000000&to=1700086400
+func (mh *MetricHandlers) Rollups(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	metricType := params.Get("type")
+
+	if params.Get("name") == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	metricName, err := seriesKey(params.Get("name"), params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if metricType != "gauge" && metricType != "counter" {
+		http.Error(w, "No such metric type", http.StatusBadRequest)
+		return
+	}
+
+	resolution := memstorage.MinuteResolution
+	if res := params.Get("resolution"); res != "" {
+		if resolution, err = parseQueryStep(res); err != nil {
+			http.Error(w, "invalid resolution: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if resolution != memstorage.MinuteResolution && resolution != memstorage.HourResolution {
+		http.Error(w, "resolution must be 1m or 1h", http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now()
+	if v := params.Get("to"); v != "" {
+		if to, err = parseQueryTime(v); err != nil {
+			http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	from := to.Add(-defaultRollupsDuration)
+	if v := params.Get("from"); v != "" {
+		if from, err = parseQueryTime(v); err != nil {
+			http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if to.Before(from) {
+		http.Error(w, "to must not be before from", http.StatusBadRequest)
+		return
+	}
+
+	rollups, err := mh.Storager.GetRollups(r.Context(), metricType, metricName, resolution, from, to)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	points := make([]rollupPoint, 0, len(rollups))
+	for _, ru := range rollups {
+		points = append(points, rollupPoint{
+			Start: ru.Start,
+			Min:   ru.Min,
+			Max:   ru.Max,
+			Avg:   ru.Avg(),
+			Last:  ru.Last,
+			Sum:   ru.Sum,
+			Count: ru.Count,
+		})
+	}
+
+	resp, err := json.Marshal(rollupsResponse{
+		Name:       metricName,
+		Type:       metricType,
+		Resolution: resolution.Seconds(),
+		Points:     points,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// значения по умолчанию для запроса истории: последний час с шагом в минуту
+const (
+	defaultRangeDuration = time.Hour
+	defaultRangeStep     = time.Minute
+)
+
+func parseRangeQuery(from, to, step string) (service.RangeQuery, error) {
+	var err error
+	q := service.RangeQuery{
+		To:   time.Now(),
+		Step: defaultRangeStep,
+	}
+
+	if to != "" {
+		if q.To, err = parseQueryTime(to); err != nil {
+			return q, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	q.From = q.To.Add(-defaultRangeDuration)
+	if from != "" {
+		if q.From, err = parseQueryTime(from); err != nil {
+			return q, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if step != "" {
+		if q.Step, err = parseQueryStep(step); err != nil {
+			return q, fmt.Errorf("invalid step: %w", err)
+		}
+	}
+
+	return q, q.Validate()
+}
+
+// parseQueryTime принимает время в секундах unix (возможно дробных) либо в формате RFC3339
+func parseQueryTime(s string) (time.Time, error) {
+	if sec, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Unix(0, int64(sec*float64(time.Second))), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// parseQueryStep принимает шаг в секундах либо в формате time.Duration (15s, 1m)
+func parseQueryStep(s string) (time.Duration, error) {
+	if sec, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(sec * float64(time.Second)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// metricsListResponse - ответ на запрос списка метрик
+type metricsListResponse struct {
+	Total   int                 `json:"total"` // сколько всего метрик подходит под фильтр
+	Offset  int                 `json:"offset"`
+	Limit   int                 `json:"limit"`
+	Metrics []memstorage.Metric `json:"metrics"`
+}
+
+// ListMetrics returns a page of stored metrics as a JSON object, optionally
+// filtered by type and by a name pattern: match takes a glob (* and ?),
+// regex takes a regular expression that must match the whole name.
+// Metrics are sorted by name (default), type or value (gauge and counter only),
+// in ascending or descending order; limit and offset select the page.
+// GET http://localhost:8080/api/v1/metrics?type=gauge&match=CPU*&sort=value&order=desc&limit=10&offset=0
+func (mh *MetricHandlers) ListMetrics(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metrics, total, err := mh.Storager.ListMetrics(r.Context(), q)
+	if errors.Is(err, memstorage.ErrInvalidListQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println("error in listing metrics:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	for i := range metrics {
+		if metrics[i].Summary != nil {
+			quantiles := memstorage.NewSummaryValue(metrics[i].Summary)
+			metrics[i].Quantiles = &quantiles
+		}
+	}
+	if metrics == nil {
+		metrics = []memstorage.Metric{}
+	}
+
+	resp, err := json.Marshal(metricsListResponse{
+		Total:   total,
+		Offset:  q.Offset,
+		Limit:   q.Limit,
+		Metrics: metrics,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseListQuery разбирает параметры запроса списка метрик
+func parseListQuery(params url.Values) (memstorage.ListQuery, error) {
+	q := memstorage.ListQuery{
+		Type:   params.Get("type"),
+		Match:  params.Get("match"),
+		SortBy: params.Get("sort"),
+		Limit:  memstorage.DefaultListLimit,
+	}
+	if regex := params.Get("regex"); regex != "" {
+		if q.Match != "" {
+			return q, errors.New("match and regex are mutually exclusive")
+		}
+		q.Match, q.Regex = regex, true
+	}
+
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, errors.New("order must be asc or desc")
+	}
+
+	var err error
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 || q.Limit > memstorage.MaxListLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", memstorage.MaxListLimit)
+		}
+	}
+	if v := params.Get("offset"); v != "" {
+		if q.Offset, err = strconv.Atoi(v); err != nil || q.Offset < 0 {
+			return q, errors.New("offset must be a non-negative integer")
+		}
+	}
+
+	return q, q.Validate()
+}
+
+// используем интерфейс mh.Storager (Reporter), у кого есть GetAllCounterMetrics, GetAllGaugeMetrics
+func (mh *MetricHandlers) GetAllMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+	err := service.WriteMetricsReport(r.Context(), mh.Storager, w) // было mh *MetricHandlers
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// PrometheusMetrics renders all stored metrics in the Prometheus text format,
+// or in the OpenMetrics format if the client asks for it in the Accept header.
+// GET http://localhost:8080/metrics
+func (mh *MetricHandlers) PrometheusMetrics(w http.ResponseWriter, r *http.Request) {
+	openMetrics := acceptsOpenMetrics(r.Header.Values("Accept"))
+
+	var buf bytes.Buffer
+	err := service.WritePrometheusMetrics(r.Context(), mh.Storager, &buf, openMetrics)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if openMetrics {
+		w.Header().Set("Content-Type", service.OpenMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", service.PrometheusContentType)
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// acceptsOpenMetrics проверяет, указан ли в заголовках Accept формат OpenMetrics с ненулевым весом
+func acceptsOpenMetrics(accept []string) bool {
+	for _, header := range accept {
+		for _, part := range strings.Split(header, ",") {
+			params := strings.Split(part, ";")
+			if strings.TrimSpace(params[0]) != "application/openmetrics-text" {
+				continue
 			}
-			if !ok {
-				w.WriteHeader(http.StatusNotFound)
-				return
+			weight := 1.0
+			for _, param := range params[1:] {
+				key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if ok && key == "q" {
+					if q, err := strconv.ParseFloat(value, 64); err == nil {
+						weight = q
+					}
+				}
+			}
+			if weight > 0 {
+				return true
 			}
+		}
+	}
+	return false
+}
 
-		default:
+// ListAgents returns the agents that have reported metrics, with the time
+// they were last seen. With the silent parameter only agents that have not
+// reported for longer than the given duration are returned.
+// GET http://localhost:8080/api/v1/agents?silent=5m
+func (mh *MetricHandlers) ListAgents(w http.ResponseWriter, r *http.Request) {
+	list := mh.Agents.List()
+
+	if silent := r.URL.Query().Get("silent"); silent != "" {
+		period, err := parseQueryStep(silent)
+		if err != nil {
+			http.Error(w, "invalid silent: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		list = mh.Agents.Silent(period)
+	}
+
+	resp, err := json.Marshal(list)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (mh *MetricHandlers) CheckConnectionToDB(w http.ResponseWriter, r *http.Request) {
+	log.Println("Checking DB")
+	_, err := mh.DBCon.Connect() // db.ConnectWithRerties(mh.Config.DBParams)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// MetricsUpdate processes an HTTP POST request that contains a batch of
+// metrics ([]Metrics) in JSON format.
+func (mh *MetricHandlers) MetricsUpdate(w http.ResponseWriter, r *http.Request) {
+	if mh.Finalizing {
+		w.WriteHeader(http.StatusTeapot)
+		return
+	}
+
+	mh.Wg.Add(1)
+	defer mh.Wg.Done()
+
+	var err error
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var Metrics []memstorage.Metric
+	var buf bytes.Buffer
+
+	// читаем тело запроса
+	_, err = buf.ReadFrom(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if mh.Config.Key != "" {
+		// вычисляем хеш и сравниваем в HTTP-заголовке запроса с именем HashSHA256
+		hash := security.CreateSign(buf.String(), mh.Config.Key)
+		if !hmac.Equal([]byte(hash), []byte(r.Header.Get("HashSHA256"))) {
+			log.Println("The signature is incorrect")
 			w.WriteHeader(http.StatusBadRequest)
-			_, err = w.Write([]byte("No such metric"))
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		log.Println("The signature is authentic")
+	}
+
+	// десериализуем JSON в Metrric
+	if err = json.Unmarshal(buf.Bytes(), &Metrics); err != nil { //  decryptedBody
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, metric := range Metrics {
+		if err = metric.Validate(); err != nil {
+			if errors.Is(err, memstorage.ErrUnknownMetricType) {
+				w.WriteHeader(http.StatusBadRequest)
+				_, err = w.Write([]byte("No such metric"))
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
 				return
 			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 	}
+	agentID, err := requestAgentID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for i := range Metrics {
+		Metrics[i].Labels = agentid.Stamp(Metrics[i].Labels, mh.stampAgentID(agentID))
+	}
+
+	// пакет сохраняется целиком: либо все метрики, либо ни одной
+	if err = mh.Storager.AddMetrics(r.Context(), Metrics); err != nil {
+		log.Println("error in saving metrics:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	keys := make([]string, 0, len(Metrics))
+	for _, metric := range Metrics {
+		keys = append(keys, metric.Key())
+	}
+	mh.recordAgent(r, keys)
 
 	resp := []byte("{\"result\": \"ok\"}")
 	_, err = w.Write(resp)
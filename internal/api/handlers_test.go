@@ -1,19 +1,28 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/adettelle/go-metric-collector/internal/mocks"
 	"github.com/adettelle/go-metric-collector/internal/security"
+	"github.com/adettelle/go-metric-collector/internal/server/agents"
 	"github.com/adettelle/go-metric-collector/internal/server/config"
 	"github.com/adettelle/go-metric-collector/internal/server/service"
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/pkg/agentid"
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -77,7 +86,7 @@ func TestGetMetricByValueWithNoCounterMetric(t *testing.T) {
 	reqURL := fmt.Sprintf("/value/%s/%s", mc.Type, mc.Name)
 
 	m := mh.Storager.(*mocks.MockStorager)
-	m.EXPECT().GetCounterMetric(mc.Name).Return(mc.Value, mc.Exists, nil)
+	m.EXPECT().GetCounterMetric(gomock.Any(), mc.Name).Return(mc.Value, mc.Exists, nil)
 
 	request := CreateRequestWithPathValues(t, http.MethodGet, reqURL, nil, mc.Type, mc.Name)
 	response := httptest.NewRecorder()
@@ -96,7 +105,7 @@ func TestGetMetricByValueWithErrorInGettingCounterMetric(t *testing.T) {
 
 	reqURL := fmt.Sprintf("/value/%s/%s", mc.Type, mc.Name)
 
-	m.EXPECT().GetCounterMetric(mc.Name).Return(mc.Value, metricExists, fmt.Errorf("Error in getting counter metric"))
+	m.EXPECT().GetCounterMetric(gomock.Any(), mc.Name).Return(mc.Value, metricExists, fmt.Errorf("Error in getting counter metric"))
 
 	request := CreateRequestWithPathValues(t, http.MethodGet, reqURL, nil, mc.Type, mc.Name)
 	response := httptest.NewRecorder()
@@ -116,7 +125,7 @@ func TestGetMetricCounterByValue(t *testing.T) {
 	reqURL := fmt.Sprintf("/value/%s/%s", mc.Type, mc.Name)
 
 	// пишем, что хотим получить от заглушки
-	m.EXPECT().GetCounterMetric(mc.Name).Return(mc.Value, metricExists, nil)
+	m.EXPECT().GetCounterMetric(gomock.Any(), mc.Name).Return(mc.Value, metricExists, nil)
 
 	// тестируем хэндлер r.Get("/value/{metric_type}/{metric_name}", mware.WithLogging(mh.GetMetricByValue))
 	// 1. Создаем запрос для обработчика
@@ -147,7 +156,7 @@ func TestGetMetricByValueWithNoGaugeMetric(t *testing.T) {
 
 	reqURL := fmt.Sprintf("/value/%s/%s", mg.Type, mg.Name)
 
-	m.EXPECT().GetGaugeMetric(mg.Name).Return(mg.Value, metricExists, nil)
+	m.EXPECT().GetGaugeMetric(gomock.Any(), mg.Name).Return(mg.Value, metricExists, nil)
 
 	request := CreateRequestWithPathValues(t, http.MethodGet, reqURL, nil, mg.Type, mg.Name)
 	response := httptest.NewRecorder()
@@ -166,7 +175,7 @@ func TestGetMetricByValueWithErrorInGettingGaugeMetric(t *testing.T) {
 
 	reqURL := fmt.Sprintf("/value/%s/%s", mg.Type, mg.Name)
 
-	m.EXPECT().GetGaugeMetric(mg.Name).Return(mg.Value, metricExists, fmt.Errorf("Error in getting gauge metric"))
+	m.EXPECT().GetGaugeMetric(gomock.Any(), mg.Name).Return(mg.Value, metricExists, fmt.Errorf("Error in getting gauge metric"))
 
 	request := CreateRequestWithPathValues(t, http.MethodGet, reqURL, nil, mg.Type, mg.Name)
 	response := httptest.NewRecorder()
@@ -189,7 +198,7 @@ func TestGetMetricGaugeByValue(t *testing.T) {
 	for _, mg := range testTable {
 		reqURL := fmt.Sprintf("/value/%s/%s", mg.Type, mg.Name)
 
-		m.EXPECT().GetGaugeMetric(mg.Name).Return(mg.Value, mExists, nil) // !!!!!!!!!!!!
+		m.EXPECT().GetGaugeMetric(gomock.Any(), mg.Name).Return(mg.Value, mExists, nil) // !!!!!!!!!!!!
 
 		request := CreateRequestWithPathValues(t, http.MethodGet, reqURL, nil, mg.Type, mg.Name)
 		response := httptest.NewRecorder()
@@ -242,11 +251,19 @@ func TestGetAllMetrics(t *testing.T) {
     
                 <tr>
                     <td>g1</td>
+                    <td></td>
                     <td>1.1</td>
                 </tr>
     
+                <tr>
+                    <td>g1</td>
+                    <td>{host=&#34;a&#34;}</td>
+                    <td>3.3</td>
+                </tr>
+    
                 <tr>
                     <td>g2</td>
+                    <td></td>
                     <td>2.2</td>
                 </tr>
     
@@ -257,11 +274,13 @@ func TestGetAllMetrics(t *testing.T) {
     
                 <tr>
                     <td>c1</td>
+                    <td></td>
                     <td>1</td>
                 </tr>
     
                 <tr>
                     <td>c2</td>
+                    <td></td>
                     <td>10</td>
                 </tr>
     
@@ -270,11 +289,13 @@ func TestGetAllMetrics(t *testing.T) {
                                 
     </html>`
 
-	m.EXPECT().GetAllGaugeMetrics().Return(map[string]float64{"g1": 1.1, "g2": 2.2}, nil)
-	m.EXPECT().GetAllCounterMetrics().Return(map[string]int64{"c1": 1, "c2": 10}, nil)
+	m.EXPECT().GetAllGaugeMetrics(gomock.Any()).Return(map[string]float64{"g1": 1.1, `g1{host="a"}`: 3.3, "g2": 2.2}, nil)
+	m.EXPECT().GetAllCounterMetrics(gomock.Any()).Return(map[string]int64{"c1": 1, "c2": 10}, nil)
+	m.EXPECT().GetAllHistogramMetrics(gomock.Any()).Return(map[string]memstorage.Histogram{}, nil)
+	m.EXPECT().GetAllSummaryMetrics(gomock.Any()).Return(map[string]*ddsketch.Sketch{}, nil)
 	response := httptest.NewRecorder()
 
-	err := service.WriteMetricsReport(m, response)
+	err := service.WriteMetricsReport(context.Background(), m, response)
 	require.NoError(t, err)
 
 	contentType := response.Header().Get("Content-type")
@@ -330,8 +351,10 @@ func TestGetAllMetricsHandler(t *testing.T) {
                                 
     </html>`
 
-	m.EXPECT().GetAllGaugeMetrics().Return(map[string]float64{"g1": 1.1, "g2": 2.2}, nil)
-	m.EXPECT().GetAllCounterMetrics().Return(map[string]int64{"c1": 1, "c2": 10}, nil)
+	m.EXPECT().GetAllGaugeMetrics(gomock.Any()).Return(map[string]float64{"g1": 1.1, "g2": 2.2}, nil)
+	m.EXPECT().GetAllCounterMetrics(gomock.Any()).Return(map[string]int64{"c1": 1, "c2": 10}, nil)
+	m.EXPECT().GetAllHistogramMetrics(gomock.Any()).Return(map[string]memstorage.Histogram{}, nil)
+	m.EXPECT().GetAllSummaryMetrics(gomock.Any()).Return(map[string]*ddsketch.Sketch{}, nil)
 	request, err := http.NewRequest(http.MethodGet, reqURL, nil)
 	require.NoError(t, err)
 
@@ -419,7 +442,7 @@ func TestCreateMetricCounterTypeFail(t *testing.T) {
 	mc := CounterMetric("c1", 100)
 	reqURL := fmt.Sprintf("/update/%s/%s/%d", mc.Type, mc.Name, mc.Value)
 
-	m.EXPECT().AddCounterMetric(mc.Name, mc.Value).Return(fmt.Errorf("Error in adding counter metric"))
+	m.EXPECT().AddCounterMetric(gomock.Any(), mc.Name, mc.Value).Return(fmt.Errorf("Error in adding counter metric"))
 
 	request := CreateRequestWithPathValues(t, http.MethodPost, reqURL, nil, mc.Type, mc.Name)
 	request.SetPathValue("metric_value", strconv.FormatInt(mc.Value, 10))
@@ -447,6 +470,20 @@ func TestCreateMetricCounterTypeWrongValue(t *testing.T) {
 	require.Equal(t, http.StatusBadRequest, response.Code)
 }
 
+func TestCreateMetricReservedName(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	// имя с метками в ключе не должно совпадать с метрикой c1{host="a"}
+	mName := `c1{host="a"}`
+	request := CreateRequestWithPathValues(t, http.MethodPost, "/update/counter/c1/5", nil, "counter", mName)
+	request.SetPathValue("metric_value", "5")
+	response := httptest.NewRecorder()
+
+	mh.CreateMetric(response, request)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+}
+
 func TestCreateMetricCounterType(t *testing.T) {
 	mh, cleanup := CreateMetricHandlers(t)
 	cleanup()
@@ -455,7 +492,7 @@ func TestCreateMetricCounterType(t *testing.T) {
 	mc := CounterMetric("c1", 100)
 	reqURL := fmt.Sprintf("/update/%s/%s/%d", mc.Type, mc.Name, mc.Value)
 
-	m.EXPECT().AddCounterMetric(mc.Name, mc.Value).Return(nil)
+	m.EXPECT().AddCounterMetric(gomock.Any(), mc.Name, mc.Value).Return(nil)
 
 	request := CreateRequestWithPathValues(t, http.MethodPost, reqURL, nil, mc.Type, mc.Name)
 	request.SetPathValue("metric_value", strconv.FormatInt(mc.Value, 10))
@@ -474,7 +511,7 @@ func TestCreateMetricGaugeTypeFail(t *testing.T) {
 	mg := GaugeMetric("g1", 100.111)
 	reqURL := fmt.Sprintf("/update/%s/%s/%f", mg.Type, mg.Name, mg.Value)
 
-	m.EXPECT().AddGaugeMetric(mg.Name, mg.Value).Return(fmt.Errorf("Error in adding gauge metric"))
+	m.EXPECT().AddGaugeMetric(gomock.Any(), mg.Name, mg.Value).Return(fmt.Errorf("Error in adding gauge metric"))
 
 	request := CreateRequestWithPathValues(t, http.MethodPost, reqURL, nil, mg.Type, mg.Name)
 	request.SetPathValue("metric_value", fmt.Sprintf("%f", mg.Value))
@@ -510,7 +547,7 @@ func TestCreateMetricGaugeType(t *testing.T) {
 	mg := GaugeMetric("g1", 100.111)
 	reqURL := fmt.Sprintf("/update/%s/%s/%f", mg.Type, mg.Name, mg.Value)
 
-	m.EXPECT().AddGaugeMetric(mg.Name, mg.Value).Return(nil)
+	m.EXPECT().AddGaugeMetric(gomock.Any(), mg.Name, mg.Value).Return(nil)
 
 	request := CreateRequestWithPathValues(t, http.MethodPost, reqURL, nil, mg.Type, mg.Name)
 	request.SetPathValue("metric_value", fmt.Sprintf("%f", mg.Value))
@@ -531,8 +568,8 @@ func TestMetricUpdateCounterMetric(t *testing.T) {
 	reqURL := "/update/"
 	reqBody := `{"id":"c1", "type":"counter", "delta":123}`
 
-	m.EXPECT().AddCounterMetric(mc.Name, mc.Value).Return(nil)
-	m.EXPECT().GetCounterMetric(mc.Name).Return(mc.Value, true, nil)
+	m.EXPECT().AddCounterMetric(gomock.Any(), mc.Name, mc.Value).Return(nil)
+	m.EXPECT().GetCounterMetric(gomock.Any(), mc.Name).Return(mc.Value, true, nil)
 
 	request, err := http.NewRequest(http.MethodPost, reqURL, strings.NewReader(reqBody))
 	require.NoError(t, err)
@@ -562,6 +599,19 @@ func TestMetricUpdateIncorrectMetricFail(t *testing.T) {
 	assert.Equal(t, "No such metric", string(resBody))
 }
 
+func TestMetricUpdateReservedName(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+
+	reqBody := `{"id":"c1{host=\"a\"}", "type":"counter", "delta":5}`
+	request, err := http.NewRequest(http.MethodPost, "/update/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.MetricUpdate(response, request)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+}
+
 func TestMetricUpdateCounterMetricInvalidJSONFail(t *testing.T) {
 	mh, cleanup := CreateMetricHandlers(t)
 	cleanup()
@@ -586,8 +636,8 @@ func TestMetricUpdateGaugeMetric(t *testing.T) {
 	reqURL := "/update/"
 	reqBody := `{"id":"G1", "type":"gauge", "value":111.333}`
 
-	m.EXPECT().AddGaugeMetric(mg.Name, mg.Value).Return(nil)
-	m.EXPECT().GetGaugeMetric(mg.Name).Return(mg.Value, true, nil)
+	m.EXPECT().AddGaugeMetric(gomock.Any(), mg.Name, mg.Value).Return(nil)
+	m.EXPECT().GetGaugeMetric(gomock.Any(), mg.Name).Return(mg.Value, true, nil)
 
 	request, err := http.NewRequest(http.MethodPost, reqURL, strings.NewReader(reqBody))
 	require.NoError(t, err)
@@ -609,7 +659,7 @@ func TestMetricUpdateAddCounterMetricFail(t *testing.T) {
 	reqURL := "/update/"
 	reqBody := `{"id":"C1", "type":"counter", "delta":123}`
 
-	m.EXPECT().AddCounterMetric(mc.Name, mc.Value).Return(fmt.Errorf("Error in adding counter metric"))
+	m.EXPECT().AddCounterMetric(gomock.Any(), mc.Name, mc.Value).Return(fmt.Errorf("Error in adding counter metric"))
 
 	request, err := http.NewRequest(http.MethodPost, reqURL, strings.NewReader(reqBody))
 	require.NoError(t, err)
@@ -627,8 +677,8 @@ func TestMetricUpdateGetCounterMetricFail(t *testing.T) {
 	reqURL := "/update/"
 	reqBody := `{"id":"C1", "type":"counter", "delta":123}`
 
-	m.EXPECT().AddCounterMetric(mc.Name, mc.Value).Return(nil)
-	m.EXPECT().GetCounterMetric(mc.Name).Return(mc.Value, true, fmt.Errorf("Error in getting counter metric"))
+	m.EXPECT().AddCounterMetric(gomock.Any(), mc.Name, mc.Value).Return(nil)
+	m.EXPECT().GetCounterMetric(gomock.Any(), mc.Name).Return(mc.Value, true, fmt.Errorf("Error in getting counter metric"))
 
 	request, err := http.NewRequest(http.MethodPost, reqURL, strings.NewReader(reqBody))
 	require.NoError(t, err)
@@ -647,8 +697,8 @@ func TestMetricUpdateGetCounterMetricNotOK(t *testing.T) {
 	reqURL := "/update/"
 	reqBody := `{"id":"C1", "type":"counter", "delta":123}`
 
-	m.EXPECT().AddCounterMetric(mc.Name, mc.Value).Return(nil)
-	m.EXPECT().GetCounterMetric(mc.Name).Return(mc.Value, false, nil)
+	m.EXPECT().AddCounterMetric(gomock.Any(), mc.Name, mc.Value).Return(nil)
+	m.EXPECT().GetCounterMetric(gomock.Any(), mc.Name).Return(mc.Value, false, nil)
 
 	request, err := http.NewRequest(http.MethodPost, reqURL, strings.NewReader(reqBody))
 	require.NoError(t, err)
@@ -667,7 +717,7 @@ func TestMetricUpdateAddGaugeMetricFail(t *testing.T) {
 	reqURL := "/update/"
 	reqBody := `{"id":"G1", "type":"gauge", "value":123.111}`
 
-	m.EXPECT().AddGaugeMetric(mg.Name, mg.Value).Return(fmt.Errorf("Error in adding gauge metric"))
+	m.EXPECT().AddGaugeMetric(gomock.Any(), mg.Name, mg.Value).Return(fmt.Errorf("Error in adding gauge metric"))
 
 	request, err := http.NewRequest(http.MethodPost, reqURL, strings.NewReader(reqBody))
 	require.NoError(t, err)
@@ -686,8 +736,8 @@ func TestMetricUpdateGetGaugeMetricFail(t *testing.T) {
 	reqURL := "/update/"
 	reqBody := `{"id":"G1", "type":"gauge", "value":123.111}`
 
-	m.EXPECT().AddGaugeMetric(mg.Name, mg.Value).Return(nil)
-	m.EXPECT().GetGaugeMetric(mg.Name).Return(mg.Value, true, fmt.Errorf("Error in getting gauge metric"))
+	m.EXPECT().AddGaugeMetric(gomock.Any(), mg.Name, mg.Value).Return(nil)
+	m.EXPECT().GetGaugeMetric(gomock.Any(), mg.Name).Return(mg.Value, true, fmt.Errorf("Error in getting gauge metric"))
 
 	request, err := http.NewRequest(http.MethodPost, reqURL, strings.NewReader(reqBody))
 	require.NoError(t, err)
@@ -705,8 +755,8 @@ func TestMetricUpdateGetGaugeMetricNotOK(t *testing.T) {
 	reqURL := "/update/"
 	reqBody := `{"id":"G1", "type":"gauge", "value":123.111}`
 
-	m.EXPECT().AddGaugeMetric(mg.Name, mg.Value).Return(nil)
-	m.EXPECT().GetGaugeMetric(mg.Name).Return(mg.Value, false, nil)
+	m.EXPECT().AddGaugeMetric(gomock.Any(), mg.Name, mg.Value).Return(nil)
+	m.EXPECT().GetGaugeMetric(gomock.Any(), mg.Name).Return(mg.Value, false, nil)
 
 	request, err := http.NewRequest(http.MethodPost, reqURL, strings.NewReader(reqBody))
 	require.NoError(t, err)
@@ -726,7 +776,7 @@ func TestMetricValueCounterMetric(t *testing.T) {
 	reqURL := "/value/"
 	reqBody := `{"id":"C1", "type":"counter"}`
 	expectedRespBody := `{"id":"C1", "type":"counter", "delta":123}`
-	m.EXPECT().GetCounterMetric(mc.Name).Return(mc.Value, true, nil)
+	m.EXPECT().GetCounterMetric(gomock.Any(), mc.Name).Return(mc.Value, true, nil)
 
 	request, err := http.NewRequest(http.MethodPost, reqURL, strings.NewReader(reqBody))
 	require.NoError(t, err)
@@ -749,12 +799,146 @@ func TestMetricValueGaugeMetric(t *testing.T) {
 	reqURL := "/value/"
 	reqBody := `{"id":"G1", "type":"gauge"}`
 	expectedRespBody := `{"id":"G1", "type":"gauge", "value":111.333}`
-	m.EXPECT().GetGaugeMetric(mg.Name).Return(mg.Value, true, nil)
+	m.EXPECT().GetGaugeMetric(gomock.Any(), mg.Name).Return(mg.Value, true, nil)
+
+	request, err := http.NewRequest(http.MethodPost, reqURL, strings.NewReader(reqBody))
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.MetricValue(response, request)
+	resBody, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, expectedRespBody, string(resBody))
+}
+
+// метрики с одинаковым именем и разными метками хранятся под разными ключами
+func TestMetricUpdateGaugeMetricWithLabels(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	reqURL := "/update/"
+	reqBody := `{"id":"HeapAlloc", "type":"gauge", "value":1.5, "labels":{"host":"a", "env":"prod"}}`
+
+	m.EXPECT().AddGaugeMetric(gomock.Any(), `HeapAlloc{env="prod",host="a"}`, 1.5).Return(nil)
+	m.EXPECT().GetGaugeMetric(gomock.Any(), `HeapAlloc{env="prod",host="a"}`).Return(1.5, true, nil)
 
 	request, err := http.NewRequest(http.MethodPost, reqURL, strings.NewReader(reqBody))
 	require.NoError(t, err)
 	response := httptest.NewRecorder()
 
+	mh.MetricUpdate(response, request)
+	resBody, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, reqBody, string(resBody))
+}
+
+func TestMetricUpdateInvalidLabelFail(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+
+	reqBody := `{"id":"HeapAlloc", "type":"gauge", "value":1.5, "labels":{"host-name":"a"}}`
+
+	request, err := http.NewRequest(http.MethodPost, "/update/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.MetricUpdate(response, request)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestMetricValueCounterMetricWithLabels(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	reqBody := `{"id":"PollCount", "type":"counter", "labels":{"host":"b"}}`
+	expectedRespBody := `{"id":"PollCount", "type":"counter", "delta":7, "labels":{"host":"b"}}`
+	m.EXPECT().GetCounterMetric(gomock.Any(), `PollCount{host="b"}`).Return(int64(7), true, nil)
+
+	request, err := http.NewRequest(http.MethodPost, "/value/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.MetricValue(response, request)
+	resBody, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, expectedRespBody, string(resBody))
+}
+
+// метки в параметрах запроса GET /value/{metric_type}/{metric_name}
+func TestGetMetricGaugeByValueWithLabels(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().GetGaugeMetric(gomock.Any(), `G1{host="a"}`).Return(2.5, true, nil)
+
+	request := CreateRequestWithPathValues(t, http.MethodGet, "/value/gauge/G1?label.host=a&nocache=17", nil, "gauge", "G1")
+	response := httptest.NewRecorder()
+	mh.GetMetricByValue(response, request)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, "2.5", response.Body.String())
+}
+
+func TestMetricUpdateHistogramMetric(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	reqBody := `{"id":"Latency", "type":"histogram", "histogram":{"bounds":[0.1,1], "counts":[1,0,2], "sum":5.5, "count":3}}`
+	h := memstorage.Histogram{Bounds: []float64{0.1, 1}, Counts: []uint64{1, 0, 2}, Sum: 5.5, Count: 3}
+
+	m.EXPECT().AddHistogramMetric(gomock.Any(), "Latency", h).Return(nil)
+	m.EXPECT().GetHistogramMetric(gomock.Any(), "Latency").Return(h, true, nil)
+
+	request, err := http.NewRequest(http.MethodPost, "/update/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.MetricUpdate(response, request)
+	resBody, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, reqBody, string(resBody))
+}
+
+func TestMetricUpdateInvalidHistogramFail(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+
+	for _, reqBody := range []string{
+		`{"id":"Latency", "type":"histogram"}`,
+		`{"id":"Latency", "type":"histogram", "histogram":{"bounds":[1,0.1], "counts":[0,0,0]}}`,
+		`{"id":"Latency", "type":"histogram", "histogram":{"bounds":[0.1], "counts":[1,1], "count":3}}`,
+	} {
+		request, err := http.NewRequest(http.MethodPost, "/update/", strings.NewReader(reqBody))
+		require.NoError(t, err)
+		response := httptest.NewRecorder()
+
+		mh.MetricUpdate(response, request)
+		require.Equal(t, http.StatusBadRequest, response.Code, reqBody)
+	}
+}
+
+func TestMetricValueHistogramMetric(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	reqBody := `{"id":"Latency", "type":"histogram"}`
+	expectedRespBody := `{"id":"Latency", "type":"histogram", "histogram":{"bounds":[1], "counts":[2,1], "sum":4, "count":3}}`
+	m.EXPECT().GetHistogramMetric(gomock.Any(), "Latency").
+		Return(memstorage.Histogram{Bounds: []float64{1}, Counts: []uint64{2, 1}, Sum: 4, Count: 3}, true, nil)
+
+	request, err := http.NewRequest(http.MethodPost, "/value/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
 	mh.MetricValue(response, request)
 	resBody, err := io.ReadAll(response.Body)
 	require.NoError(t, err)
@@ -762,6 +946,180 @@ func TestMetricValueGaugeMetric(t *testing.T) {
 	assert.JSONEq(t, expectedRespBody, string(resBody))
 }
 
+// значение, присланное в пути, добавляется в корзины уже накопленной гистограммы
+func TestCreateMetricHistogramType(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().GetHistogramMetric(gomock.Any(), "Latency").
+		Return(memstorage.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 0}, Sum: 0.5, Count: 1}, true, nil)
+	m.EXPECT().AddHistogramMetric(gomock.Any(), "Latency",
+		memstorage.Histogram{Bounds: []float64{1, 2}, Counts: []uint64{0, 1, 0}, Sum: 1.5, Count: 1}).Return(nil)
+
+	request := CreateRequestWithPathValues(t, http.MethodPost, "/update/histogram/Latency/1.5", nil, "histogram", "Latency")
+	request.SetPathValue("metric_value", "1.5")
+	response := httptest.NewRecorder()
+
+	mh.CreateMetric(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, "Created", response.Body.String())
+}
+
+// NaN и бесконечности отклоняются до записи в хранилище
+func TestCreateMetricHistogramNonFiniteFail(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	for _, value := range []string{"NaN", "Inf", "-Inf"} {
+		request := CreateRequestWithPathValues(t, http.MethodPost, "/update/histogram/Latency/"+value, nil, "histogram", "Latency")
+		request.SetPathValue("metric_value", value)
+		response := httptest.NewRecorder()
+
+		mh.CreateMetric(response, request)
+		require.Equal(t, http.StatusBadRequest, response.Code, value)
+	}
+}
+
+func TestGetMetricHistogramByValue(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().GetHistogramMetric(gomock.Any(), "Latency").
+		Return(memstorage.Histogram{Bounds: []float64{1}, Counts: []uint64{0, 1}, Sum: 3, Count: 1}, true, nil)
+
+	request := CreateRequestWithPathValues(t, http.MethodGet, "/value/histogram/Latency", nil, "histogram", "Latency")
+	response := httptest.NewRecorder()
+	mh.GetMetricByValue(response, request)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"bounds":[1], "counts":[0,1], "sum":3, "count":1}`, response.Body.String())
+}
+
+func TestMetricUpdateSummaryMetric(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	sketch := ddsketch.New(ddsketch.DefaultAlpha)
+	sketch.Add(2)
+	sketch.Add(4)
+	data, err := json.Marshal(sketch)
+	require.NoError(t, err)
+	reqBody := fmt.Sprintf(`{"id":"Latency", "type":"summary", "summary":%s}`, data)
+
+	m.EXPECT().AddSummaryMetric(gomock.Any(), "Latency", sketch).Return(nil)
+	m.EXPECT().GetSummaryMetric(gomock.Any(), "Latency").Return(sketch, true, nil)
+
+	request, err := http.NewRequest(http.MethodPost, "/update/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.MetricUpdate(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+}
+
+func TestMetricUpdateInvalidSummaryFail(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+
+	for _, reqBody := range []string{
+		`{"id":"Latency", "type":"summary"}`,
+		`{"id":"Latency", "type":"summary", "summary":{"alpha":2, "count":0}}`,
+		`{"id":"Latency", "type":"summary", "summary":{"alpha":0.01, "positive":{"10":1}, "count":2}}`,
+	} {
+		request, err := http.NewRequest(http.MethodPost, "/update/", strings.NewReader(reqBody))
+		require.NoError(t, err)
+		response := httptest.NewRecorder()
+
+		mh.MetricUpdate(response, request)
+		require.Equal(t, http.StatusBadRequest, response.Code, reqBody)
+	}
+}
+
+// в ответе /value/ вместе со скетчем возвращаются квантили
+func TestMetricValueSummaryMetric(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	sketch := ddsketch.New(ddsketch.DefaultAlpha)
+	sketch.Add(3)
+	m.EXPECT().GetSummaryMetric(gomock.Any(), "Latency").Return(sketch, true, nil)
+
+	request, err := http.NewRequest(http.MethodPost, "/value/", strings.NewReader(`{"id":"Latency", "type":"summary"}`))
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.MetricValue(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var metric memstorage.Metric
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &metric))
+	require.Equal(t, sketch, metric.Summary)
+	require.Equal(t, &memstorage.SummaryValue{Count: 1, Sum: 3, P50: 3, P95: 3, P99: 3}, metric.Quantiles)
+}
+
+func TestCreateMetricSummaryType(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	expected := ddsketch.New(ddsketch.DefaultAlpha)
+	expected.Add(0.25)
+	m.EXPECT().GetSummaryMetric(gomock.Any(), "Latency").Return(nil, false, nil)
+	m.EXPECT().AddSummaryMetric(gomock.Any(), "Latency", expected).Return(nil)
+
+	request := CreateRequestWithPathValues(t, http.MethodPost, "/update/summary/Latency/0.25", nil, "summary", "Latency")
+	request.SetPathValue("metric_value", "0.25")
+	response := httptest.NewRecorder()
+
+	mh.CreateMetric(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, "Created", response.Body.String())
+}
+
+// NaN и бесконечности отклоняются до записи в хранилище
+func TestCreateMetricSummaryNonFiniteFail(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	for _, value := range []string{"NaN", "Inf", "-Inf"} {
+		request := CreateRequestWithPathValues(t, http.MethodPost, "/update/summary/Latency/"+value, nil, "summary", "Latency")
+		request.SetPathValue("metric_value", value)
+		response := httptest.NewRecorder()
+
+		mh.CreateMetric(response, request)
+		require.Equal(t, http.StatusBadRequest, response.Code, value)
+	}
+}
+
+func TestGetMetricSummaryByValue(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	sketch := ddsketch.New(ddsketch.DefaultAlpha)
+	for i := 1; i <= 100; i++ {
+		sketch.Add(float64(i))
+	}
+	m.EXPECT().GetSummaryMetric(gomock.Any(), "Latency").Return(sketch, true, nil)
+
+	request := CreateRequestWithPathValues(t, http.MethodGet, "/value/summary/Latency", nil, "summary", "Latency")
+	response := httptest.NewRecorder()
+	mh.GetMetricByValue(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var value memstorage.SummaryValue
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &value))
+	require.Equal(t, uint64(100), value.Count)
+	require.Equal(t, 5050.0, value.Sum)
+	require.InEpsilon(t, 50, value.P50, 0.02)
+	require.InEpsilon(t, 95, value.P95, 0.02)
+	require.InEpsilon(t, 99, value.P99, 0.02)
+}
+
 // r.Post("/updates/", mware.WithLogging(mware.GzipMiddleware(mh.MetricsUpdate)))
 func TestMetricsUpdateCounterMetric(t *testing.T) {
 	mh, cleanup := CreateMetricHandlers(t)
@@ -777,12 +1135,11 @@ func TestMetricsUpdateCounterMetric(t *testing.T) {
 	mc1 := CounterMetric("c1", 5)
 	mc2 := CounterMetric("c2", 8)
 
-	metrics := []mertic[int64]{mc1, mc2}
-	for _, metric := range metrics {
-		mm := metric
-		m.EXPECT().AddCounterMetric(mm.Name, mm.Value).Return(nil)
-		m.EXPECT().GetCounterMetric(mm.Name).Return(mm.Value, true, nil)
-	}
+	// весь пакет сохраняется одним вызовом
+	m.EXPECT().AddMetrics(gomock.Any(), []memstorage.Metric{
+		{ID: mc1.Name, MType: mc1.Type, Delta: &mc1.Value},
+		{ID: mc2.Name, MType: mc2.Type, Delta: &mc2.Value},
+	}).Return(nil)
 	request, err := http.NewRequest(http.MethodPost, reqURL, strings.NewReader(reqBody))
 	require.NoError(t, err)
 	request.Header.Set("HashSHA256", hash)
@@ -811,12 +1168,10 @@ func TestMetricsUpdateGaugeMetric(t *testing.T) {
 	mg1 := GaugeMetric("g1", 1.1)
 	mg2 := GaugeMetric("g2", 2.222)
 
-	metrics := []mertic[float64]{mg1, mg2}
-	for _, metric := range metrics {
-		mm := metric
-		m.EXPECT().AddGaugeMetric(mm.Name, mm.Value).Return(nil)
-		m.EXPECT().GetGaugeMetric(mm.Name).Return(mm.Value, true, nil)
-	}
+	m.EXPECT().AddMetrics(gomock.Any(), []memstorage.Metric{
+		{ID: mg1.Name, MType: mg1.Type, Value: &mg1.Value},
+		{ID: mg2.Name, MType: mg2.Type, Value: &mg2.Value},
+	}).Return(nil)
 	request, err := http.NewRequest(http.MethodPost, reqURL, strings.NewReader(reqBody))
 	require.NoError(t, err)
 	request.Header.Set("HashSHA256", hash)
@@ -830,6 +1185,87 @@ func TestMetricsUpdateGaugeMetric(t *testing.T) {
 	assert.JSONEq(t, `{"result":"ok"}`, string(resBody))
 }
 
+func TestMetricsUpdateWithLabels(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+	mh.Config = &config.Config{}
+
+	m := mh.Storager.(*mocks.MockStorager)
+
+	// метрика без меток и две метрики с тем же именем с разных хостов
+	reqBody := `[{"id":"g1", "type":"gauge", "value":1}, 
+		{"id":"g1", "type":"gauge", "value":2, "labels":{"host":"a"}},
+		{"id":"g1", "type":"gauge", "value":3, "labels":{"host":"b"}}]`
+
+	var batch []memstorage.Metric
+	m.EXPECT().AddMetrics(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, metrics []memstorage.Metric) error {
+		batch = metrics
+		return nil
+	})
+	request, err := http.NewRequest(http.MethodPost, "/updates/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+
+	response := httptest.NewRecorder()
+
+	mh.MetricsUpdate(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	require.Len(t, batch, 3)
+	for i, key := range []string{"g1", `g1{host="a"}`, `g1{host="b"}`} {
+		require.Equal(t, key, batch[i].Key())
+		require.Equal(t, float64(i+1), *batch[i].Value)
+	}
+}
+
+// агент, приславший пакет метрик с заголовком X-Agent-ID, попадает в список агентов
+func TestMetricsUpdateRecordsAgent(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+	mh.Config = &config.Config{}
+	mh.Agents = agents.NewRegistry()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().AddMetrics(gomock.Any(), gomock.Any()).Return(nil)
+
+	reqBody := `[{"id":"PollCount", "type":"counter", "delta":5}, {"id":"Alloc", "type":"gauge", "value":1.5, "labels":{"host":"a"}}]`
+	request, err := http.NewRequest(http.MethodPost, "/updates/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+	request.Header.Set("X-Agent-ID", "web-1-agent")
+	request.Header.Set("X-Real-IP", "10.0.0.5")
+
+	response := httptest.NewRecorder()
+	mh.MetricsUpdate(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	request, err = http.NewRequest(http.MethodGet, "/api/v1/agents", nil)
+	require.NoError(t, err)
+	response = httptest.NewRecorder()
+	mh.ListAgents(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var list []agents.Agent
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	require.Equal(t, "web-1-agent", list[0].ID)
+	require.Equal(t, "10.0.0.5", list[0].Addr)
+	require.Equal(t, []string{`Alloc{host="a"}`, "PollCount"}, list[0].Metrics)
+	require.WithinDuration(t, time.Now(), list[0].LastSeen, time.Minute)
+
+	// агент только что прислал метрики, поэтому молчащих агентов нет
+	request, err = http.NewRequest(http.MethodGet, "/api/v1/agents?silent=5m", nil)
+	require.NoError(t, err)
+	response = httptest.NewRecorder()
+	mh.ListAgents(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `[]`, response.Body.String())
+
+	request, err = http.NewRequest(http.MethodGet, "/api/v1/agents?silent=abc", nil)
+	require.NoError(t, err)
+	response = httptest.NewRecorder()
+	mh.ListAgents(response, request)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+}
+
 func TestMetricsUpdateCounterMetricIncorrectSignatureFail(t *testing.T) {
 	mh, cleanup := CreateMetricHandlers(t)
 	cleanup()
@@ -851,3 +1287,688 @@ func TestMetricsUpdateCounterMetricIncorrectSignatureFail(t *testing.T) {
 
 	require.Equal(t, http.StatusBadRequest, response.Code)
 }
+
+// при ошибке хранилища пакет не сохраняется и агент не отмечается
+func TestMetricsUpdateStorageFail(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+	mh.Config = &config.Config{}
+	mh.Agents = agents.NewRegistry()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().AddMetrics(gomock.Any(), gomock.Any()).Return(errors.New("tx aborted"))
+
+	reqBody := `[{"id":"c1", "type":"counter", "delta":5}, {"id":"g1", "type":"gauge", "value":1.5}]`
+	request, err := http.NewRequest(http.MethodPost, "/updates/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+	request.Header.Set("X-Agent-ID", "web-1-agent")
+
+	response := httptest.NewRecorder()
+	mh.MetricsUpdate(response, request)
+	require.Equal(t, http.StatusInternalServerError, response.Code)
+	require.Empty(t, mh.Agents.List())
+}
+
+// метки agent_id включаются в конфигурации; по умолчанию ключи метрик агента не меняются
+func TestMetricsUpdateStampAgentID(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+	mh.Config = &config.Config{StampAgentID: true}
+
+	var batch []memstorage.Metric
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().AddMetrics(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, metrics []memstorage.Metric) error {
+		batch = metrics
+		return nil
+	})
+
+	reqBody := `[{"id":"PollCount", "type":"counter", "delta":5}, {"id":"Alloc", "type":"gauge", "value":1.5, "labels":{"host":"a"}}]`
+	request, err := http.NewRequest(http.MethodPost, "/updates/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+	request.Header.Set("X-Agent-ID", "web-1-agent")
+
+	response := httptest.NewRecorder()
+	mh.MetricsUpdate(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Len(t, batch, 2)
+	require.Equal(t, `PollCount{agent_id="web-1-agent"}`, batch[0].Key())
+	require.Equal(t, `Alloc{agent_id="web-1-agent",host="a"}`, batch[1].Key())
+}
+
+func TestMetricsUpdateLongAgentIDFail(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+	mh.Config = &config.Config{}
+
+	reqBody := `[{"id":"c1", "type":"counter", "delta":5}]`
+	request, err := http.NewRequest(http.MethodPost, "/updates/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+	request.Header.Set("X-Agent-ID", strings.Repeat("a", agentid.MaxLen+1))
+
+	response := httptest.NewRecorder()
+	mh.MetricsUpdate(response, request)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+// хранилище получает контекст запроса: если клиент ушел, запись прерывается
+func TestMetricsUpdateCanceledRequest(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+	mh.Config = &config.Config{}
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().AddMetrics(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, _ []memstorage.Metric) error {
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reqBody := `[{"id":"c1", "type":"counter", "delta":5}]`
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, "/updates/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+
+	response := httptest.NewRecorder()
+	mh.MetricsUpdate(response, request)
+	require.Equal(t, http.StatusInternalServerError, response.Code)
+}
+
+// пакет с некорректной метрикой отклоняется целиком, до обращения к хранилищу
+func TestMetricsUpdateInvalidMetricFail(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	cleanup()
+	mh.Config = &config.Config{}
+
+	for _, reqBody := range []string{
+		`[{"id":"c1", "type":"counter", "delta":5}, {"id":"g1", "type":"gauge"}]`,
+		`[{"id":"c1", "type":"counter", "delta":5}, {"id":"x1", "type":"unknown", "value":1}]`,
+		`[{"id":"c1", "type":"counter", "delta":5, "labels":{"1host":"a"}}]`,
+	} {
+		request, err := http.NewRequest(http.MethodPost, "/updates/", strings.NewReader(reqBody))
+		require.NoError(t, err)
+
+		response := httptest.NewRecorder()
+		mh.MetricsUpdate(response, request)
+		require.Equal(t, http.StatusBadRequest, response.Code, reqBody)
+	}
+}
+
+// r.Get("/api/v1/query_range", mware.WithLogging(mware.GzipMiddleware(mh.QueryRange)))
+
+// ------- Хендлер: DELETE /value/{metric_type}/{metric_name}
+func TestDeleteMetric(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().DeleteMetric(gomock.Any(), "gauge", "G1").Return(true, nil)
+
+	request := CreateRequestWithPathValues(t, http.MethodDelete, "/value/gauge/G1", nil, "gauge", "G1")
+	response := httptest.NewRecorder()
+	mh.DeleteMetric(response, request)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, "Deleted", response.Body.String())
+}
+
+func TestDeleteMetricWithLabels(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().DeleteMetric(gomock.Any(), "counter", `C1{host="a"}`).Return(true, nil)
+
+	request := CreateRequestWithPathValues(t, http.MethodDelete, "/value/counter/C1?label.host=a", nil, "counter", "C1")
+	response := httptest.NewRecorder()
+	mh.DeleteMetric(response, request)
+
+	require.Equal(t, http.StatusOK, response.Code)
+}
+
+func TestDeleteMetricNotFound(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().DeleteMetric(gomock.Any(), "gauge", "G1").Return(false, nil)
+
+	request := CreateRequestWithPathValues(t, http.MethodDelete, "/value/gauge/G1", nil, "gauge", "G1")
+	response := httptest.NewRecorder()
+	mh.DeleteMetric(response, request)
+
+	require.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestDeleteMetricUnknownType(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	request := CreateRequestWithPathValues(t, http.MethodDelete, "/value/unknown/G1", nil, "unknown", "G1")
+	response := httptest.NewRecorder()
+	mh.DeleteMetric(response, request)
+
+	require.Equal(t, http.StatusNotFound, response.Code)
+	require.Equal(t, "No such metric type", response.Body.String())
+}
+
+func TestDeleteMetricSigned(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+	mh.Config = &config.Config{Key: "secret"}
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().DeleteMetric(gomock.Any(), "gauge", "G1").Return(true, nil)
+
+	request := CreateRequestWithPathValues(t, http.MethodDelete, "/value/gauge/G1", nil, "gauge", "G1")
+	request.Header.Set("HashSHA256", security.CreateSign("/value/gauge/G1", mh.Config.Key))
+	response := httptest.NewRecorder()
+	mh.DeleteMetric(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	// подпись другого пути не подходит
+	request = CreateRequestWithPathValues(t, http.MethodDelete, "/value/gauge/G2", nil, "gauge", "G2")
+	request.Header.Set("HashSHA256", security.CreateSign("/value/gauge/G1", mh.Config.Key))
+	response = httptest.NewRecorder()
+	mh.DeleteMetric(response, request)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestDeleteMetricFinalizing(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+	mh.Finalizing = true
+
+	request := CreateRequestWithPathValues(t, http.MethodDelete, "/value/gauge/G1", nil, "gauge", "G1")
+	response := httptest.NewRecorder()
+	mh.DeleteMetric(response, request)
+	require.Equal(t, http.StatusTeapot, response.Code)
+}
+
+// ------- Хендлер: POST /delete/
+func TestMetricsDelete(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+	mh.Config = &config.Config{Key: "secret"}
+
+	m := mh.Storager.(*mocks.MockStorager)
+	// пакет передается хранилищу одним вызовом
+	m.EXPECT().DeleteMetrics(gomock.Any(), []memstorage.Metric{
+		{ID: "g1", MType: "gauge", Labels: memstorage.Labels{"host": "a"}},
+		{ID: "c1", MType: "counter"},
+	}).Return(1, nil)
+
+	reqBody := `[{"id":"g1", "type":"gauge", "labels":{"host":"a"}}, {"id":"c1", "type":"counter"}]`
+	request, err := http.NewRequest(http.MethodPost, "/delete/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+	request.Header.Set("HashSHA256", security.CreateSign(reqBody, mh.Config.Key))
+
+	response := httptest.NewRecorder()
+	mh.MetricsDelete(response, request)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"deleted":1}`, response.Body.String())
+}
+
+func TestMetricsDeleteUnknownTypeFail(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	reqBody := `[{"id":"g1", "type":"gauge"}, {"id":"x1", "type":"unknown"}]`
+	request, err := http.NewRequest(http.MethodPost, "/delete/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+
+	response := httptest.NewRecorder()
+	mh.MetricsDelete(response, request)
+
+	require.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestMetricsDeleteIncorrectSignatureFail(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+	mh.Config = &config.Config{Key: "secret"}
+
+	reqBody := `[{"id":"g1", "type":"gauge"}]`
+	request, err := http.NewRequest(http.MethodPost, "/delete/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+	request.Header.Set("HashSHA256", "wrong")
+
+	response := httptest.NewRecorder()
+	mh.MetricsDelete(response, request)
+
+	require.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestMetricsValue(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+	mh.Config = &config.Config{Key: "secret"}
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().GetGaugeMetric(gomock.Any(), `g1{host="a"}`).Return(1.5, true, nil)
+	m.EXPECT().GetCounterMetric(gomock.Any(), "c1").Return(int64(0), false, nil)
+	m.EXPECT().GetCounterMetric(gomock.Any(), "c2").Return(int64(7), true, nil)
+
+	reqBody := `[{"id":"g1", "type":"gauge", "labels":{"host":"a"}}, {"id":"c1", "type":"counter"}, {"id":"c2", "type":"counter"}]`
+	request, err := http.NewRequest(http.MethodPost, "/values/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+	request.Header.Set("HashSHA256", security.CreateSign(reqBody, mh.Config.Key))
+
+	response := httptest.NewRecorder()
+	mh.MetricsValue(response, request)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, "application/json", response.Header().Get("Content-Type"))
+	assert.JSONEq(t, `[{"value":1.5, "id":"g1", "type":"gauge", "labels":{"host":"a"}},`+
+		`{"id":"c1", "type":"counter", "not_found":true},`+
+		`{"delta":7, "id":"c2", "type":"counter"}]`, response.Body.String())
+}
+
+func TestMetricsValueUnknownTypeFail(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	reqBody := `[{"id":"g1", "type":"gauge"}, {"id":"x1", "type":"unknown"}]`
+	request, err := http.NewRequest(http.MethodPost, "/values/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+
+	response := httptest.NewRecorder()
+	mh.MetricsValue(response, request)
+
+	require.Equal(t, http.StatusBadRequest, response.Code)
+	require.Equal(t, "No such metric\n", response.Body.String())
+}
+
+func TestMetricsValueIncorrectSignatureFail(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+	mh.Config = &config.Config{Key: "secret"}
+
+	reqBody := `[{"id":"g1", "type":"gauge"}]`
+	request, err := http.NewRequest(http.MethodPost, "/values/", strings.NewReader(reqBody))
+	require.NoError(t, err)
+	request.Header.Set("HashSHA256", "wrong")
+
+	response := httptest.NewRecorder()
+	mh.MetricsValue(response, request)
+
+	require.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestMetricsValueStorageFail(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().GetGaugeMetric(gomock.Any(), "g1").Return(0.0, false, errors.New("connection refused"))
+
+	request, err := http.NewRequest(http.MethodPost, "/values/", strings.NewReader(`[{"id":"g1", "type":"gauge"}]`))
+	require.NoError(t, err)
+
+	response := httptest.NewRecorder()
+	mh.MetricsValue(response, request)
+
+	require.Equal(t, http.StatusInternalServerError, response.Code)
+}
+
+func TestQueryRangeGaugeMetric(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	start := time.Unix(1699999980, 0)
+
+	m.EXPECT().GetGaugeHistory(gomock.Any(), "g1", start.Add(-2*time.Minute), start.Add(2*time.Minute)).
+		Return([]memstorage.Sample{
+			{Timestamp: start.Add(10 * time.Second), Value: 1.5},
+			{Timestamp: start.Add(50 * time.Second), Value: 2.5},
+			{Timestamp: start.Add(90 * time.Second), Value: 3.5},
+		}, nil)
+
+	reqURL := "/api/v1/query_range?type=gauge&name=g1&from=1699999980&to=1700000100&step=60"
+	request, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.QueryRange(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var res rangeQueryResponse
+	err = json.Unmarshal(response.Body.Bytes(), &res)
+	require.NoError(t, err)
+	require.Equal(t, "last", res.Fn)
+	require.Equal(t, float64(60), res.Step)
+	require.Len(t, res.Points, 2)
+	require.True(t, start.Add(time.Minute).Equal(res.Points[0].Timestamp))
+	require.Equal(t, 2.5, res.Points[0].Value)
+	require.Equal(t, 3.5, res.Points[1].Value)
+}
+
+func TestQueryRangeCounterMetricRate(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	start := time.Unix(1699999980, 0)
+
+	m.EXPECT().GetCounterHistory(gomock.Any(), "c1", gomock.Any(), gomock.Any()).
+		Return([]memstorage.Sample{
+			{Timestamp: start, Value: 100},
+			{Timestamp: start.Add(30 * time.Second), Value: 160},
+		}, nil)
+
+	reqURL := "/api/v1/query_range?type=counter&name=c1&fn=rate&from=1699999980&to=1700000040&step=1m"
+	request, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.QueryRange(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var res rangeQueryResponse
+	err = json.Unmarshal(response.Body.Bytes(), &res)
+	require.NoError(t, err)
+	require.Equal(t, "rate", res.Fn)
+	require.Len(t, res.Points, 2)
+	require.Equal(t, float64(0), res.Points[0].Value)
+	require.Equal(t, float64(1), res.Points[1].Value)
+}
+
+// метки серии передаются в параметрах label.*, как для /value/
+func TestQueryRangeLabeledSeries(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	start := time.Unix(1699999980, 0)
+
+	m.EXPECT().GetGaugeHistory(gomock.Any(), `g1{env="prod",host="a"}`, gomock.Any(), gomock.Any()).
+		Return([]memstorage.Sample{{Timestamp: start.Add(10 * time.Second), Value: 1.5}}, nil)
+
+	reqURL := "/api/v1/query_range?type=gauge&name=g1&label.host=a&label.env=prod&from=1699999980&to=1700000040&step=60"
+	request, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.QueryRange(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var res rangeQueryResponse
+	err = json.Unmarshal(response.Body.Bytes(), &res)
+	require.NoError(t, err)
+	require.Equal(t, `g1{env="prod",host="a"}`, res.Name)
+	require.Len(t, res.Points, 1)
+}
+
+func TestQueryRangeBadRequest(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	reqURLs := []string{
+		"/api/v1/query_range?type=gauge",
+		"/api/v1/query_range?type=wrongType&name=g1",
+		"/api/v1/query_range?type=gauge&name=g1&fn=rate",
+		"/api/v1/query_range?type=gauge&name=g1&step=abc",
+		"/api/v1/query_range?type=gauge&name=g1&from=1700000060&to=1700000000",
+		"/api/v1/query_range?type=gauge&name=g%7Bhost%3D%22a%22%7D",
+		"/api/v1/query_range?type=gauge&name=g1&label.1host=a",
+	}
+	for _, reqURL := range reqURLs {
+		request, err := http.NewRequest(http.MethodGet, reqURL, nil)
+		require.NoError(t, err)
+		response := httptest.NewRecorder()
+
+		mh.QueryRange(response, request)
+		require.Equal(t, http.StatusBadRequest, response.Code, reqURL)
+	}
+}
+
+// r.Get("/metrics", mware.WithLogging(mware.GzipMiddleware(mh.PrometheusMetrics)))
+func TestRollupsGaugeMetric(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	start := time.Unix(1699999200, 0)
+
+	m.EXPECT().GetRollups(gomock.Any(), "gauge", "g1", time.Hour, start, start.Add(2*time.Hour)).
+		Return([]memstorage.Rollup{
+			{Start: start, Min: 1, Max: 3, Sum: 6, Count: 3, Last: 2},
+		}, nil)
+
+	reqURL := "/api/v1/rollups?type=gauge&name=g1&resolution=1h&from=1699999200&to=1700006400"
+	request, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.Rollups(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var res rollupsResponse
+	err = json.Unmarshal(response.Body.Bytes(), &res)
+	require.NoError(t, err)
+	require.Equal(t, float64(3600), res.Resolution)
+	require.Len(t, res.Points, 1)
+	require.True(t, start.Equal(res.Points[0].Start))
+	require.Equal(t, 2.0, res.Points[0].Avg)
+	require.Equal(t, 3.0, res.Points[0].Max)
+}
+
+func TestRollupsLabeledSeries(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().GetRollups(gomock.Any(), "counter", `c1{host="a"}`, time.Minute, gomock.Any(), gomock.Any()).
+		Return([]memstorage.Rollup{}, nil)
+
+	reqURL := "/api/v1/rollups?type=counter&name=c1&label.host=a"
+	request, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.Rollups(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var res rollupsResponse
+	err = json.Unmarshal(response.Body.Bytes(), &res)
+	require.NoError(t, err)
+	require.Equal(t, `c1{host="a"}`, res.Name)
+}
+
+func TestRollupsBadRequest(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	for _, reqURL := range []string{
+		"/api/v1/rollups?type=gauge",
+		"/api/v1/rollups?type=histogram&name=h1",
+		"/api/v1/rollups?type=gauge&name=g1&resolution=5m",
+		"/api/v1/rollups?type=counter&name=c1&from=1700006400&to=1699999200",
+		"/api/v1/rollups?type=gauge&name=g%7Bhost%3D%22a%22%7D",
+		"/api/v1/rollups?type=gauge&name=g1&label.1host=a",
+	} {
+		request, err := http.NewRequest(http.MethodGet, reqURL, nil)
+		require.NoError(t, err)
+		response := httptest.NewRecorder()
+
+		mh.Rollups(response, request)
+		require.Equal(t, http.StatusBadRequest, response.Code, reqURL)
+	}
+}
+
+func TestListMetrics(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	v := 95.5
+	sketch := ddsketch.New(ddsketch.DefaultAlpha)
+	sketch.Add(2)
+
+	m.EXPECT().ListMetrics(gomock.Any(), memstorage.ListQuery{
+		Type: "gauge", Match: "CPU*", SortBy: "value", Desc: true, Offset: 10, Limit: 5,
+	}).Return([]memstorage.Metric{
+		{ID: "CPUutilization1", MType: "gauge", Value: &v, Labels: memstorage.Labels{"host": "a"}},
+	}, 11, nil)
+	m.EXPECT().ListMetrics(gomock.Any(), memstorage.ListQuery{Match: "^s[0-9]+", Regex: true, Limit: memstorage.DefaultListLimit}).
+		Return([]memstorage.Metric{{ID: "s1", MType: "summary", Summary: sketch}}, 1, nil)
+
+	reqURL := "/api/v1/metrics?type=gauge&match=CPU*&sort=value&order=desc&limit=5&offset=10"
+	request, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.ListMetrics(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, "application/json", response.Header().Get("Content-Type"))
+	require.JSONEq(t, `{"total":11,"offset":10,"limit":5,"metrics":[`+
+		`{"value":95.5,"id":"CPUutilization1","type":"gauge","labels":{"host":"a"}}]}`, response.Body.String())
+
+	request, err = http.NewRequest(http.MethodGet, "/api/v1/metrics?regex="+url.QueryEscape("^s[0-9]+"), nil)
+	require.NoError(t, err)
+	response = httptest.NewRecorder()
+
+	mh.ListMetrics(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+	var res metricsListResponse
+	err = json.Unmarshal(response.Body.Bytes(), &res)
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Total)
+	require.Len(t, res.Metrics, 1)
+	require.NotNil(t, res.Metrics[0].Quantiles)
+	require.Equal(t, uint64(1), res.Metrics[0].Quantiles.Count)
+}
+
+func TestListMetricsEmpty(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().ListMetrics(gomock.Any(), gomock.Any()).Return(nil, 0, nil)
+
+	request, err := http.NewRequest(http.MethodGet, "/api/v1/metrics?match=none*", nil)
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.ListMetrics(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+	require.JSONEq(t, `{"total":0,"offset":0,"limit":100,"metrics":[]}`, response.Body.String())
+}
+
+func TestListMetricsBadRequest(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	for _, reqURL := range []string{
+		"/api/v1/metrics?type=unknown",
+		"/api/v1/metrics?match=CPU*&regex=CPU.*",
+		"/api/v1/metrics?regex=(",
+		"/api/v1/metrics?sort=value",
+		"/api/v1/metrics?sort=size",
+		"/api/v1/metrics?order=up",
+		"/api/v1/metrics?limit=0",
+		"/api/v1/metrics?limit=1001",
+		"/api/v1/metrics?offset=-1",
+		"/api/v1/metrics?match=" + strings.Repeat("a", memstorage.MaxListMatchLen+1),
+	} {
+		request, err := http.NewRequest(http.MethodGet, reqURL, nil)
+		require.NoError(t, err)
+		response := httptest.NewRecorder()
+
+		mh.ListMetrics(response, request)
+		require.Equal(t, http.StatusBadRequest, response.Code, reqURL)
+	}
+}
+
+func TestListMetricsStorageFail(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().ListMetrics(gomock.Any(), gomock.Any()).Return(nil, 0, errors.New("connection refused"))
+
+	request, err := http.NewRequest(http.MethodGet, "/api/v1/metrics", nil)
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.ListMetrics(response, request)
+	require.Equal(t, http.StatusInternalServerError, response.Code)
+}
+
+func TestListMetricsStorageInvalidQuery(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().ListMetrics(gomock.Any(), gomock.Any()).Return(nil, 0, fmt.Errorf("%w: bad pattern", memstorage.ErrInvalidListQuery))
+
+	request, err := http.NewRequest(http.MethodGet, "/api/v1/metrics?regex=a", nil)
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.ListMetrics(response, request)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().GetAllGaugeMetrics(gomock.Any()).Return(map[string]float64{"g1": 1.1}, nil)
+	m.EXPECT().GetAllCounterMetrics(gomock.Any()).Return(map[string]int64{"c1": 10}, nil)
+	m.EXPECT().GetAllHistogramMetrics(gomock.Any()).Return(map[string]memstorage.Histogram{}, nil)
+	m.EXPECT().GetAllSummaryMetrics(gomock.Any()).Return(map[string]*ddsketch.Sketch{}, nil)
+
+	request, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.PrometheusMetrics(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, service.PrometheusContentType, response.Header().Get("Content-Type"))
+	require.Equal(t, "# TYPE g1 gauge\ng1 1.1\n# TYPE c1 counter\nc1 10\n", response.Body.String())
+}
+
+func TestPrometheusMetricsOpenMetrics(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().GetAllGaugeMetrics(gomock.Any()).Return(map[string]float64{}, nil)
+	m.EXPECT().GetAllCounterMetrics(gomock.Any()).Return(map[string]int64{"c1": 10}, nil)
+	m.EXPECT().GetAllHistogramMetrics(gomock.Any()).Return(map[string]memstorage.Histogram{}, nil)
+	m.EXPECT().GetAllSummaryMetrics(gomock.Any()).Return(map[string]*ddsketch.Sketch{}, nil)
+
+	request, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+	require.NoError(t, err)
+	request.Header.Set("Accept", "application/openmetrics-text;version=1.0.0;q=0.5,text/plain;q=0.4")
+	response := httptest.NewRecorder()
+
+	mh.PrometheusMetrics(response, request)
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, service.OpenMetricsContentType, response.Header().Get("Content-Type"))
+	require.Equal(t, "# TYPE c1 counter\nc1_total 10\n# EOF\n", response.Body.String())
+}
+
+func TestPrometheusMetricsFail(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+
+	m := mh.Storager.(*mocks.MockStorager)
+	m.EXPECT().GetAllGaugeMetrics(gomock.Any()).Return(nil, fmt.Errorf("Error in getting gauge metrics"))
+
+	request, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+
+	mh.PrometheusMetrics(response, request)
+	require.Equal(t, http.StatusInternalServerError, response.Code)
+}
+
+func TestAcceptsOpenMetrics(t *testing.T) {
+	require.False(t, acceptsOpenMetrics(nil))
+	require.False(t, acceptsOpenMetrics([]string{"text/plain;version=0.0.4"}))
+	require.False(t, acceptsOpenMetrics([]string{"application/openmetrics-text;q=0"}))
+	require.True(t, acceptsOpenMetrics([]string{"text/plain", "application/openmetrics-text; version=1.0.0"}))
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/internal/server/stream"
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+)
+
+// NotifyingStorager - хранилище, которое после успешной записи gauge и counter метрик
+// рассылает их новые значения подписчикам hub. Оборачивает хранилище сервера целиком,
+// поэтому изменения видны независимо от того, откуда пришли метрики (HTTP, gRPC, StatsD и т.д.).
+type NotifyingStorager struct {
+	Storager
+	hub *stream.Hub
+	now func() time.Time
+}
+
+func NewNotifyingStorager(s Storager, hub *stream.Hub) *NotifyingStorager {
+	return &NotifyingStorager{Storager: s, hub: hub, now: time.Now}
+}
+
+func (s *NotifyingStorager) AddGaugeMetric(ctx context.Context, name string, value float64) error {
+	if err := s.Storager.AddGaugeMetric(ctx, name, value); err != nil {
+		return err
+	}
+	id, labels := memstorage.SplitSeriesKey(name)
+	if s.hub.Wants("gauge", id) {
+		s.hub.Publish(s.event(memstorage.Metric{ID: id, MType: "gauge", Labels: labels, Value: &value}))
+	}
+	return nil
+}
+
+// AddCounterMetric рассылает накопленное значение счетчика, а не приращение
+func (s *NotifyingStorager) AddCounterMetric(ctx context.Context, name string, value int64) error {
+	if err := s.Storager.AddCounterMetric(ctx, name, value); err != nil {
+		return err
+	}
+	if e, ok := s.counterEvent(ctx, name); ok {
+		s.hub.Publish(e)
+	}
+	return nil
+}
+
+// AddMetrics рассылает изменения gauge и counter метрик пакета после его записи;
+// если метрика встречается в пакете несколько раз, рассылается одно итоговое значение
+func (s *NotifyingStorager) AddMetrics(ctx context.Context, metrics []memstorage.Metric) error {
+	if err := s.Storager.AddMetrics(ctx, metrics); err != nil {
+		return err
+	}
+
+	var keys []memstorage.Metric
+	gauges := make(map[string]float64)
+	counters := make(map[string]bool)
+	for _, m := range metrics {
+		key := m.Key()
+		switch {
+		case m.MType == "gauge" && m.Value != nil:
+			if _, seen := gauges[key]; !seen {
+				keys = append(keys, m)
+			}
+			gauges[key] = *m.Value
+		case m.MType == "counter" && m.Delta != nil:
+			if !counters[key] {
+				keys = append(keys, m)
+			}
+			counters[key] = true
+		}
+	}
+
+	var events []stream.Event
+	for _, m := range keys {
+		if m.MType == "counter" {
+			if e, ok := s.counterEvent(ctx, m.Key()); ok {
+				events = append(events, e)
+			}
+			continue
+		}
+		if s.hub.Wants("gauge", m.ID) {
+			value := gauges[m.Key()]
+			events = append(events, s.event(memstorage.Metric{ID: m.ID, MType: "gauge", Labels: m.Labels, Value: &value}))
+		}
+	}
+	if len(events) > 0 {
+		s.hub.Publish(events...)
+	}
+	return nil
+}
+
+// counterEvent читает накопленное значение счетчика, если на него есть подписчики
+func (s *NotifyingStorager) counterEvent(ctx context.Context, name string) (stream.Event, bool) {
+	id, labels := memstorage.SplitSeriesKey(name)
+	if !s.hub.Wants("counter", id) {
+		return stream.Event{}, false
+	}
+	delta, ok, err := s.Storager.GetCounterMetric(ctx, name)
+	if err != nil || !ok {
+		// значение уже записано, подписчики просто не узнают об этом изменении
+		log.Println("unable to read counter for subscribers:", name, err)
+		return stream.Event{}, false
+	}
+	return s.event(memstorage.Metric{ID: id, MType: "counter", Labels: labels, Delta: &delta}), true
+}
+
+func (s *NotifyingStorager) event(m memstorage.Metric) stream.Event {
+	return stream.Event{Metric: m, Time: s.now().UTC()}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/internal/mocks"
+	"github.com/adettelle/go-metric-collector/internal/server/stream"
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func newNotifyingMemStorage(t *testing.T) (*NotifyingStorager, *stream.Hub) {
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+	hub := stream.NewHub()
+	s := NewNotifyingStorager(ms, hub)
+	s.now = func() time.Time { return time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC) }
+	return s, hub
+}
+
+func pendingEvents(sub *stream.Subscription) []stream.Event {
+	var res []stream.Event
+	for {
+		select {
+		case e := <-sub.Events():
+			res = append(res, e)
+		default:
+			return res
+		}
+	}
+}
+
+// подписчики получают новые значения gauge и накопленные значения counter метрик
+func TestNotifyingStorager(t *testing.T) {
+	ctx := context.Background()
+	s, hub := newNotifyingMemStorage(t)
+	sub, err := hub.Subscribe(nil)
+	require.NoError(t, err)
+
+	require.NoError(t, s.AddGaugeMetric(ctx, `Alloc{host="a"}`, 1.5))
+	require.NoError(t, s.AddCounterMetric(ctx, "PollCount", 2))
+	require.NoError(t, s.AddCounterMetric(ctx, "PollCount", 3))
+	// histogram и summary метрики не рассылаются
+	require.NoError(t, s.AddHistogramMetric(ctx, "h1", memstorage.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Sum: 0.5, Count: 1}))
+
+	events := pendingEvents(sub)
+	require.Len(t, events, 3)
+	require.Equal(t, "Alloc", events[0].ID)
+	require.Equal(t, memstorage.Labels{"host": "a"}, events[0].Labels)
+	require.Equal(t, 1.5, *events[0].Value)
+	require.Equal(t, time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC), events[0].Time)
+	require.Equal(t, int64(2), *events[1].Delta)
+	require.Equal(t, int64(5), *events[2].Delta)
+}
+
+// пакет рассылается после записи, по одному итоговому значению на метрику
+func TestNotifyingStoragerAddMetrics(t *testing.T) {
+	ctx := context.Background()
+	s, hub := newNotifyingMemStorage(t)
+	filter, err := stream.NewFilter("", []string{"Poll*", "Alloc"}, false)
+	require.NoError(t, err)
+	sub, err := hub.Subscribe(filter)
+	require.NoError(t, err)
+
+	require.NoError(t, s.AddCounterMetric(ctx, "PollCount", 10))
+	pendingEvents(sub)
+
+	one, two, three := int64(1), int64(2), 3.5
+	value, other := 1.5, 7.0
+	require.NoError(t, s.AddMetrics(ctx, []memstorage.Metric{
+		{ID: "PollCount", MType: "counter", Delta: &one},
+		{ID: "Alloc", MType: "gauge", Value: &value},
+		{ID: "PollCount", MType: "counter", Delta: &two},
+		{ID: "Alloc", MType: "gauge", Value: &three},
+		{ID: "HeapAlloc", MType: "gauge", Value: &other},
+	}))
+
+	events := pendingEvents(sub)
+	require.Len(t, events, 2)
+	require.Equal(t, "PollCount", events[0].ID)
+	require.Equal(t, int64(13), *events[0].Delta)
+	require.Equal(t, "Alloc", events[1].ID)
+	require.Equal(t, 3.5, *events[1].Value)
+
+	// неудачный пакет не рассылается
+	require.Error(t, s.AddMetrics(ctx, []memstorage.Metric{
+		{ID: "Alloc", MType: "gauge", Value: &value},
+		{ID: "PollCount", MType: "foo"},
+	}))
+	require.Empty(t, pendingEvents(sub))
+}
+
+// без подписчиков накопленное значение счетчика не читается из хранилища
+func TestNotifyingStoragerWithoutSubscribers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := mocks.NewMockStorager(ctrl)
+	hub := stream.NewHub()
+	s := NewNotifyingStorager(m, hub)
+
+	m.EXPECT().AddCounterMetric(gomock.Any(), "PollCount", int64(1)).Return(nil)
+	require.NoError(t, s.AddCounterMetric(context.Background(), "PollCount", 1))
+
+	filter, err := stream.NewFilter("gauge", nil, false)
+	require.NoError(t, err)
+	_, err = hub.Subscribe(filter)
+	require.NoError(t, err)
+
+	m.EXPECT().AddCounterMetric(gomock.Any(), "PollCount", int64(1)).Return(nil)
+	require.NoError(t, s.AddCounterMetric(context.Background(), "PollCount", 1))
+}
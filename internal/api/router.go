@@ -3,6 +3,9 @@
 package api
 
 import (
+	"github.com/adettelle/go-metric-collector/internal/ingest/influx"
+	"github.com/adettelle/go-metric-collector/internal/ingest/otlp"
+	"github.com/adettelle/go-metric-collector/internal/ingest/promremote"
 	"github.com/adettelle/go-metric-collector/pkg/mware"
 	"github.com/go-chi/chi/v5"
 )
@@ -14,8 +17,29 @@ func NewMetricRouter(ms Storager, mh *MetricHandlers) *chi.Mux { // ms *memstora
 	// POST http://localhost:8080/update/counter/someMetric/123
 	r.Post("/update/{metric_type}/{metric_name}/{metric_value}", mware.WithLogging(mh.CreateMetric))
 	r.Get("/value/{metric_type}/{metric_name}", mware.WithLogging(mh.GetMetricByValue))
+	// удаление метрики вместе с историей: DELETE http://localhost:8080/value/gauge/CPUutilization8
+	r.Delete("/value/{metric_type}/{metric_name}", mware.WithLogging(mware.GetIPMiddleware(mh.DeleteMetric, mh.Config.TrustedSubnet)))
+
+	// история метрики, выровненная по шагу:
+	// GET http://localhost:8080/api/v1/query_range?type=gauge&name=HeapAlloc&from=...&to=...&step=...
+	r.Get("/api/v1/query_range", mware.WithLogging(mware.GzipMiddleware(mh.QueryRange)))
+	// агрегаты истории за минуту или час:
+	// GET http://localhost:8080/api/v1/rollups?type=gauge&name=HeapAlloc&resolution=1h&from=...&to=...
+	r.Get("/api/v1/rollups", mware.WithLogging(mware.GzipMiddleware(mh.Rollups)))
+
+	// список метрик с фильтром по типу и шаблону имени, сортировкой и страницей:
+	// GET http://localhost:8080/api/v1/metrics?type=gauge&match=CPU*&sort=value&order=desc&limit=10
+	r.Get("/api/v1/metrics", mware.WithLogging(mware.GzipMiddleware(mh.ListMetrics)))
+
+	// изменения gauge и counter метрик в реальном времени (без gzip: ответ отдается по частям):
+	// GET http://localhost:8080/api/v1/stream?type=gauge&match=CPU* (Server-Sent Events)
+	// GET ws://localhost:8080/api/v1/ws?type=gauge&match=CPU* (WebSocket)
+	r.Get("/api/v1/stream", mware.WithLogging(mh.StreamSSE))
+	r.Get("/api/v1/ws", mware.WithLogging(mh.StreamWebSocket))
 
 	r.Get("/", mware.WithLogging(mware.GzipMiddleware(mh.GetAllMetrics)))
+	// все метрики в текстовом формате Prometheus/OpenMetrics для сбора Prometheus'ом
+	r.Get("/metrics", mware.WithLogging(mware.GzipMiddleware(mh.PrometheusMetrics)))
 
 	// метод получает метрику на вход для обновления и для добавления
 	// GzipMiddleware смотрит на HTTP-заголовка Content-Encoding
@@ -28,10 +52,27 @@ func NewMetricRouter(ms Storager, mh *MetricHandlers) *chi.Mux { // ms *memstora
 	// GzipMiddleware смотрит на заголовок Accept-Encoding
 	// и если он gzip, то перед записью ответа сжимает его
 	r.Post("/value/", mware.WithLogging(mware.GzipMiddleware(mh.MetricValue)))
+	// значения пакета метрик: в теле запроса список [{"id", "type", "labels"}] в виде json
+	r.Post("/values/", mware.WithLogging(mware.GzipMiddleware(mh.MetricsValue)))
 	r.Get("/ping", mware.WithLogging(mware.GzipMiddleware(mh.CheckConnectionToDB)))
 
+	// агенты, приславшие метрики, и время их последнего пакета
+	r.Get("/api/v1/agents", mware.WithLogging(mware.GzipMiddleware(mh.ListAgents)))
+
 	// принимает в теле запроса множество метрик в формате: []Metrics (списка метрик) в виде json
 	r.Post("/updates/", mware.WithLogging(mware.GetIPMiddleware(mware.GzipMiddleware(mh.MetricsUpdate), mh.Config.TrustedSubnet)))
+	// пакетное удаление метрик: в теле запроса список [{"id", "type", "labels"}] в виде json
+	r.Post("/delete/", mware.WithLogging(mware.GetIPMiddleware(mware.GzipMiddleware(mh.MetricsDelete), mh.Config.TrustedSubnet)))
+
+	// принимает метрики по протоколу Prometheus remote_write (protobuf, сжатый snappy)
+	r.Post("/api/v1/write", mware.WithLogging(mware.GetIPMiddleware(promremote.NewReceiver(ms).ServeHTTP, mh.Config.TrustedSubnet)))
+
+	// принимает метрики в формате InfluxDB line protocol (например, от Telegraf)
+	r.Post("/write", mware.WithLogging(mware.GetIPMiddleware(mware.GzipMiddleware(
+		influx.NewReceiver(ms, mh.Config.InfluxIntegerCounters).ServeHTTP), mh.Config.TrustedSubnet)))
+
+	// принимает метрики по протоколу OTLP/HTTP (protobuf или JSON, сжатие gzip обрабатывается в приемнике)
+	r.Post("/v1/metrics", mware.WithLogging(mware.GetIPMiddleware(otlp.NewReceiver(ms).ServeHTTP, mh.Config.TrustedSubnet)))
 
 	return r
 }
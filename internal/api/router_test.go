@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adettelle/go-metric-collector/internal/server/config"
+	"github.com/stretchr/testify/require"
+)
+
+// запросы на запись и удаление метрик принимаются только из доверенной подсети
+func TestRouterTrustedSubnet(t *testing.T) {
+	mh, cleanup := CreateMetricHandlers(t)
+	defer cleanup()
+	mh.Config = &config.Config{TrustedSubnet: "10.0.0.0/8"}
+	r := NewMetricRouter(mh.Storager, mh)
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodPost, "/updates/"},
+		{http.MethodPost, "/delete/"},
+		{http.MethodDelete, "/value/gauge/G1"},
+		{http.MethodPost, "/api/v1/write"},
+		{http.MethodPost, "/write"},
+		{http.MethodPost, "/v1/metrics"},
+	} {
+		request := httptest.NewRequest(req.method, req.path, strings.NewReader(""))
+		request.Header.Set("X-Real-IP", "192.168.1.1")
+		response := httptest.NewRecorder()
+		r.ServeHTTP(response, request)
+		require.Equal(t, http.StatusForbidden, response.Code, req.path)
+	}
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/internal/server/stream"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+const (
+	// как часто в поток пишется пустое сообщение, чтобы соединение не закрывали прокси
+	streamHeartbeat = 15 * time.Second
+	// сколько ждать записи одного сообщения клиенту, прежде чем отключить его
+	streamWriteTimeout = 10 * time.Second
+)
+
+// streamMessage - сообщение WebSocket потока метрик
+type streamMessage struct {
+	Event   string        `json:"event"` // "metric" или "dropped"
+	Metric  *stream.Event `json:"metric,omitempty"`
+	Dropped uint64        `json:"dropped,omitempty"`
+}
+
+// subscribe разбирает фильтр из параметров запроса и подписывается на изменения метрик;
+// при ошибке ответ клиенту уже записан
+func (mh *MetricHandlers) subscribe(w http.ResponseWriter, r *http.Request) (*stream.Subscription, bool) {
+	if mh.Hub == nil {
+		http.Error(w, "metric streaming is not available", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	filter, err := stream.ParseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	sub, err := mh.Hub.Subscribe(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return nil, false
+	}
+	return sub, true
+}
+
+// StreamSSE streams changes of gauge and counter metrics as Server-Sent Events
+// until the client disconnects. Each change is a "metric" event with the metric
+// in JSON (counters carry the accumulated value) and the time of the change.
+// A client that does not keep up loses events: it gets a "dropped" event with
+// the number of lost events, and is disconnected with an "error" event if it
+// falls too far behind. Metrics are filtered by type (gauge or counter) and by
+// name: match takes a glob and regex a regular expression, both may be repeated.
+// GET http://localhost:8080/api/v1/stream?type=gauge&match=CPU*&match=HeapAlloc
+func (mh *MetricHandlers) StreamSSE(w http.ResponseWriter, r *http.Request) {
+	sub, ok := mh.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer mh.Hub.Unsubscribe(sub)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx не должен буферизовать поток
+	w.WriteHeader(http.StatusOK)
+
+	send := func(format string, args ...any) error {
+		// ResponseRecorder в тестах не поддерживает дедлайн записи, это не ошибка
+		if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	if err := send(": subscribed\n\n"); err != nil {
+		log.Println("unable to start metric stream:", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.Done():
+			send("event: error\ndata: %s\n\n", sub.Err())
+			return
+		case <-heartbeat.C:
+			err = send(": ping\n\n")
+		case e := <-sub.Events():
+			if dropped := sub.TakeDropped(); dropped > 0 {
+				if err = send("event: dropped\ndata: {\"dropped\":%d}\n\n", dropped); err != nil {
+					break
+				}
+			}
+			var data []byte
+			if data, err = json.Marshal(e); err == nil {
+				err = send("event: metric\ndata: %s\n\n", data)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// StreamWebSocket streams changes of gauge and counter metrics over a WebSocket
+// connection. Messages are JSON objects: {"event":"metric","metric":{...}} for a
+// change, {"event":"dropped","dropped":N} when the client did not keep up and
+// lost N changes. A client that falls too far behind is disconnected with the
+// policy violation status. Filters are the same as for StreamSSE.
+// GET ws://localhost:8080/api/v1/ws?type=counter&regex=Poll.*
+func (mh *MetricHandlers) StreamWebSocket(w http.ResponseWriter, r *http.Request) {
+	sub, ok := mh.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer mh.Hub.Unsubscribe(sub)
+
+	c, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		log.Println("unable to accept websocket:", err)
+		return
+	}
+	defer c.CloseNow()
+	// сообщения от клиента не нужны; контекст отменяется, когда клиент закрывает соединение
+	ctx := c.CloseRead(r.Context())
+
+	send := func(ctx context.Context, msg streamMessage) error {
+		ctx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+		defer cancel()
+		return wsjson.Write(ctx, c, msg)
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.Done():
+			if errors.Is(sub.Err(), stream.ErrSlowConsumer) {
+				c.Close(websocket.StatusPolicyViolation, sub.Err().Error())
+			} else {
+				c.Close(websocket.StatusGoingAway, sub.Err().Error())
+			}
+			return
+		case <-heartbeat.C:
+			pingCtx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+			err = c.Ping(pingCtx)
+			cancel()
+		case e := <-sub.Events():
+			if dropped := sub.TakeDropped(); dropped > 0 {
+				if err = send(ctx, streamMessage{Event: "dropped", Dropped: dropped}); err != nil {
+					break
+				}
+			}
+			err = send(ctx, streamMessage{Event: "metric", Metric: &e})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/internal/server/stream"
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/pkg/mware"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/stretchr/testify/require"
+)
+
+// startStreamServer запускает сервер с обработчиками потоков метрик поверх MemStorage
+func startStreamServer(t *testing.T) (*httptest.Server, *NotifyingStorager, *stream.Hub) {
+	s, hub := newNotifyingMemStorage(t)
+	mh := &MetricHandlers{Storager: s, Hub: hub}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/stream", mware.WithLogging(mh.StreamSSE))
+	mux.HandleFunc("/api/v1/ws", mware.WithLogging(mh.StreamWebSocket))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, s, hub
+}
+
+// readSSE читает из потока следующее событие: его тип и данные; комментарии пропускаются
+func readSSE(t *testing.T, r *bufio.Reader) (string, string) {
+	var event, data string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event != "":
+			return event, data
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestStreamSSE(t *testing.T) {
+	srv, s, hub := startStreamServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v1/stream?type=counter&match=Poll*", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	body := bufio.NewReader(resp.Body)
+	line, err := body.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, ": subscribed\n", line) // подписка создана до первого сообщения
+
+	require.NoError(t, s.AddGaugeMetric(ctx, "PollGauge", 1))
+	require.NoError(t, s.AddCounterMetric(ctx, "RandomCount", 1))
+	require.NoError(t, s.AddCounterMetric(ctx, "PollCount", 2))
+	require.NoError(t, s.AddCounterMetric(ctx, "PollCount", 3))
+
+	for _, want := range []int64{2, 5} {
+		event, data := readSSE(t, body)
+		require.Equal(t, "metric", event)
+		var e stream.Event
+		require.NoError(t, json.Unmarshal([]byte(data), &e))
+		require.Equal(t, "PollCount", e.ID)
+		require.Equal(t, "counter", e.MType)
+		require.Equal(t, want, *e.Delta)
+	}
+
+	// при остановке сервера поток завершается сообщением с причиной
+	hub.Close()
+	event, data := readSSE(t, body)
+	require.Equal(t, "error", event)
+	require.Equal(t, stream.ErrHubClosed.Error(), data)
+}
+
+func TestStreamBadRequest(t *testing.T) {
+	srv, _, _ := startStreamServer(t)
+	for _, path := range []string{"/api/v1/stream?type=summary", "/api/v1/ws?regex=("} {
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+	}
+
+	mh, finish := CreateMetricHandlers(t)
+	defer finish()
+	w := httptest.NewRecorder()
+	mh.StreamSSE(w, httptest.NewRequest(http.MethodGet, "/api/v1/stream", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	srv, s, hub := startStreamServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/api/v1/ws?type=gauge", nil)
+	require.NoError(t, err)
+	defer c.CloseNow()
+
+	// подписка создается до установки соединения
+	require.True(t, hub.Wants("gauge", "Alloc"))
+
+	require.NoError(t, s.AddGaugeMetric(ctx, `Alloc{host="a"}`, 1.5))
+	var msg streamMessage
+	require.NoError(t, wsjson.Read(ctx, c, &msg))
+	require.Equal(t, "metric", msg.Event)
+	require.Equal(t, "Alloc", msg.Metric.ID)
+	require.Equal(t, memstorage.Labels{"host": "a"}, msg.Metric.Labels)
+	require.Equal(t, 1.5, *msg.Metric.Value)
+
+	hub.Close()
+	_, _, err = c.Read(ctx)
+	require.Equal(t, websocket.StatusGoingAway, websocket.CloseStatus(err))
+}
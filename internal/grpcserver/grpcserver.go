@@ -2,19 +2,37 @@ package grpcserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"time"
 
 	"github.com/adettelle/go-metric-collector/internal/api"
+	"github.com/adettelle/go-metric-collector/internal/server/agents"
+	"github.com/adettelle/go-metric-collector/internal/server/service"
+	"github.com/adettelle/go-metric-collector/internal/server/stream"
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/pkg/agentid"
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
 	pb "github.com/adettelle/go-metric-collector/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 // MetricsServer поддерживает все необходимые методы сервера.
 type GRPCMetricServerServer struct {
 	pb.UnimplementedMetricsServer
 	Storager api.Storager
+	Agents   *agents.Registry // агенты, приславшие метрики (по метаданным x-agent-id)
+	Hub      *stream.Hub      // подписчики на изменения метрик (см. api.NotifyingStorager); nil - Watch недоступен
+	// сохранять метрики агентов с меткой agent_id (см. config.Config.StampAgentID)
+	StampAgentID bool
 }
 
 // UpdatesMetric реализует интерфейс обновления метрик.
@@ -22,47 +40,381 @@ func (ms *GRPCMetricServerServer) UpdateMetrics(ctx context.Context, in *pb.Upda
 	var resp pb.UpdateMetricsResponse
 	log.Println("resieved metrics: ", in.Metrics)
 
-	for _, metric := range in.Metrics {
-		switch {
-		case metric.Type == "gauge":
-			if err := ms.Storager.AddGaugeMetric(metric.Name, metric.Value); err != nil {
-				resp.Error = err.Error()
-				return &resp, err
-			}
+	agentID, err := agentIDFromContext(ctx)
+	if err != nil {
+		resp.Error = err.Error()
+		return &resp, err
+	}
+	metrics, err := metricsFromProto(in.Metrics, ms.stampAgentID(agentID))
+	if err != nil {
+		resp.Error = err.Error()
+		return &resp, err
+	}
+
+	// пакет сохраняется целиком: либо все метрики, либо ни одной
+	if err := ms.Storager.AddMetrics(ctx, metrics); err != nil {
+		resp.Error = err.Error()
+		return &resp, err
+	}
+
+	ms.recordAgent(ctx, agentID, metrics)
+
+	resp.Error = ""
+	return &resp, nil
+}
+
+// StreamMetrics принимает пакеты метрик в одном потоке, сохраняет каждый из них целиком, как UpdateMetrics,
+// и подтверждает ответом. Недопустимый пакет завершает поток с кодом InvalidArgument, ошибка хранилища - с кодом Internal.
+func (ms *GRPCMetricServerServer) StreamMetrics(srv grpc.BidiStreamingServer[pb.UpdateMetricsRequest, pb.StreamMetricsResponse]) error {
+	// заголовки отправляются сразу: клиент знает, что поток принят, еще до первого пакета
+	if err := srv.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	agentID, err := agentIDFromContext(srv.Context())
+	if err != nil {
+		return err
+	}
+
+	var received uint64
+	for {
+		in, err := srv.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		metrics, err := metricsFromProto(in.Metrics, ms.stampAgentID(agentID))
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "chunk %d: %v", received+1, err)
+		}
+		if err = ms.Storager.AddMetrics(srv.Context(), metrics); err != nil {
+			return status.Errorf(codes.Internal, "chunk %d: %v", received+1, err)
+		}
+		ms.recordAgent(srv.Context(), agentID, metrics)
+		received++
+		if err = srv.Send(&pb.StreamMetricsResponse{Received: received}); err != nil {
+			return err
+		}
+	}
+}
+
+// metricsFromProto переводит пакет метрик из запроса в memstorage.Metric и проверяет их;
+// если stampID не пустой, метрики отмечаются меткой agent_id (см. agentid.Stamp)
+func metricsFromProto(in []*pb.Metric, stampID string) ([]memstorage.Metric, error) {
+	metrics := make([]memstorage.Metric, 0, len(in))
+	for _, metric := range in {
+		m, err := metricFromProto(metric)
+		if err != nil {
+			return nil, err
+		}
+		if err = m.Validate(); err != nil {
+			return nil, err
+		}
+		m.Labels = agentid.Stamp(m.Labels, stampID)
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+// GetMetricValues возвращает текущие значения пакета метрик в порядке запроса;
+// метрики, которых нет в хранилище, отмечаются not_found.
+func (ms *GRPCMetricServerServer) GetMetricValues(ctx context.Context, in *pb.GetMetricValuesRequest) (*pb.GetMetricValuesResponse, error) {
+	requested := make([]memstorage.Metric, 0, len(in.Metrics))
+	for _, id := range in.Metrics {
+		requested = append(requested, memstorage.Metric{ID: id.Name, MType: id.Type, Labels: id.Labels})
+	}
+	if err := service.ValidateLookup(requested); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	values, err := service.LookupMetrics(ctx, ms.Storager, requested)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &pb.GetMetricValuesResponse{Values: make([]*pb.MetricValue, 0, len(values))}
+	for _, v := range values {
+		resp.Values = append(resp.Values, &pb.MetricValue{Metric: metricToProto(v.Metric), NotFound: v.NotFound})
+	}
+	return resp, nil
+}
+
+// GetMetric возвращает текущее значение метрики; если метрики нет - код NotFound.
+func (ms *GRPCMetricServerServer) GetMetric(ctx context.Context, in *pb.GetMetricRequest) (*pb.Metric, error) {
+	if in.Metric == nil {
+		return nil, status.Error(codes.InvalidArgument, "metric is required")
+	}
+	requested := []memstorage.Metric{{ID: in.Metric.Name, MType: in.Metric.Type, Labels: in.Metric.Labels}}
+	if err := service.ValidateLookup(requested); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 
-		case metric.Type == "counter":
-			if err := ms.Storager.AddCounterMetric(metric.Name, metric.Delta); err != nil {
-				resp.Error = err.Error()
-				return &resp, err
+	values, err := service.LookupMetrics(ctx, ms.Storager, requested)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if values[0].NotFound {
+		return nil, status.Errorf(codes.NotFound, "metric %s %s not found", in.Metric.Type, requested[0].Key())
+	}
+	return metricToProto(values[0].Metric), nil
+}
+
+// ListMetrics возвращает страницу метрик, выбранных по типу и шаблону имени, и общее количество подходящих метрик.
+func (ms *GRPCMetricServerServer) ListMetrics(ctx context.Context, in *pb.ListMetricsRequest) (*pb.ListMetricsResponse, error) {
+	q := memstorage.ListQuery{
+		Type:   in.Type,
+		Match:  in.Match,
+		SortBy: in.Sort,
+		Desc:   in.Desc,
+		Offset: int(in.Offset),
+		Limit:  int(in.Limit),
+	}
+	if in.Regex != "" {
+		if in.Match != "" {
+			return nil, status.Error(codes.InvalidArgument, "match and regex are mutually exclusive")
+		}
+		q.Match, q.Regex = in.Regex, true
+	}
+	if q.Limit == 0 {
+		q.Limit = memstorage.DefaultListLimit
+	}
+	if q.Limit > memstorage.MaxListLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must not exceed %d", memstorage.MaxListLimit)
+	}
+	if err := q.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	metrics, total, err := ms.Storager.ListMetrics(ctx, q)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	resp := &pb.ListMetricsResponse{Metrics: make([]*pb.Metric, 0, len(metrics)), Total: uint32(total)}
+	for _, m := range metrics {
+		resp.Metrics = append(resp.Metrics, metricToProto(m))
+	}
+	return resp, nil
+}
+
+// Watch отправляет клиенту новые значения gauge и накопленные значения counter метрик, подходящих под фильтр,
+// по мере их записи, пока клиент не отменит вызов. Изменения, которые клиент не успевает читать, пропускаются;
+// слишком отставший клиент отключается с кодом ResourceExhausted, при остановке сервера - Unavailable.
+func (ms *GRPCMetricServerServer) Watch(in *pb.WatchRequest, srv grpc.ServerStreamingServer[pb.Metric]) error {
+	if ms.Hub == nil {
+		return status.Error(codes.Unavailable, "metric streaming is not available")
+	}
+	if len(in.Match) > 0 && len(in.Regex) > 0 {
+		return status.Error(codes.InvalidArgument, "match and regex are mutually exclusive")
+	}
+	patterns, regex := in.Match, false
+	if len(in.Regex) > 0 {
+		patterns, regex = in.Regex, true
+	}
+	filter, err := stream.NewFilter(in.Type, patterns, regex)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	sub, err := ms.Hub.Subscribe(filter)
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	defer ms.Hub.Unsubscribe(sub)
+	// заголовки отправляются сразу: клиент знает, что подписка создана, еще до первого изменения
+	if err = srv.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-srv.Context().Done():
+			return status.FromContextError(srv.Context().Err()).Err()
+		case <-sub.Done():
+			if errors.Is(sub.Err(), stream.ErrSlowConsumer) {
+				return status.Error(codes.ResourceExhausted, sub.Err().Error())
+			}
+			return status.Error(codes.Unavailable, sub.Err().Error())
+		case e := <-sub.Events():
+			if err = srv.Send(metricToProto(e.Metric)); err != nil {
+				return err
 			}
+		}
+	}
+}
 
-		default:
-			resp.Error = "No such metric"
-			return &resp, fmt.Errorf("err %v", resp.Error)
+// metricFromProto переводит метрику из запроса в memstorage.Metric
+func metricFromProto(metric *pb.Metric) (memstorage.Metric, error) {
+	m := memstorage.Metric{ID: metric.Name, MType: metric.Type, Labels: metric.Labels}
+
+	switch metric.Type {
+	case "gauge":
+		value := metric.Value
+		m.Value = &value
+	case "counter":
+		delta := metric.Delta
+		m.Delta = &delta
+	case "histogram":
+		if metric.Histogram == nil {
+			return m, fmt.Errorf("histogram metric has no histogram value")
+		}
+		m.Histogram = &memstorage.Histogram{
+			Bounds: metric.Histogram.Bounds,
+			Counts: metric.Histogram.Counts,
+			Sum:    metric.Histogram.Sum,
+			Count:  metric.Histogram.Count,
 		}
+	case "summary":
+		if metric.Summary == nil {
+			return m, fmt.Errorf("summary metric has no summary value")
+		}
+		m.Summary = summaryFromProto(metric.Summary)
 	}
+	// метрику неизвестного типа отклоняет memstorage.Metric.Validate
+	return m, nil
+}
 
-	resp.Error = ""
-	return &resp, nil
+func summaryFromProto(s *pb.Summary) *ddsketch.Sketch {
+	sketch := &ddsketch.Sketch{
+		Alpha: s.Alpha,
+		Zero:  s.Zero,
+		Sum:   s.Sum,
+		Count: s.Count,
+		Min:   s.Min,
+		Max:   s.Max,
+	}
+	if len(s.Positive) > 0 {
+		sketch.Positive = make(map[int]uint64, len(s.Positive))
+		for k, c := range s.Positive {
+			sketch.Positive[int(k)] = c
+		}
+	}
+	if len(s.Negative) > 0 {
+		sketch.Negative = make(map[int]uint64, len(s.Negative))
+		for k, c := range s.Negative {
+			sketch.Negative[int(k)] = c
+		}
+	}
+	return sketch
 }
 
-func StartServer(storager api.Storager, port string) error {
+// metricToProto переводит метрику из хранилища в метрику ответа
+func metricToProto(m memstorage.Metric) *pb.Metric {
+	metric := &pb.Metric{Name: m.ID, Type: m.MType, Labels: m.Labels}
+	switch {
+	case m.Value != nil:
+		metric.Value = *m.Value
+	case m.Delta != nil:
+		metric.Delta = *m.Delta
+	case m.Histogram != nil:
+		metric.Histogram = &pb.Histogram{
+			Bounds: m.Histogram.Bounds,
+			Counts: m.Histogram.Counts,
+			Sum:    m.Histogram.Sum,
+			Count:  m.Histogram.Count,
+		}
+	case m.Summary != nil:
+		metric.Summary = summaryToProto(m.Summary)
+	}
+	return metric
+}
+
+func summaryToProto(sketch *ddsketch.Sketch) *pb.Summary {
+	s := &pb.Summary{
+		Alpha: sketch.Alpha,
+		Zero:  sketch.Zero,
+		Sum:   sketch.Sum,
+		Count: sketch.Count,
+		Min:   sketch.Min,
+		Max:   sketch.Max,
+	}
+	if len(sketch.Positive) > 0 {
+		s.Positive = make(map[int32]uint64, len(sketch.Positive))
+		for k, c := range sketch.Positive {
+			s.Positive[int32(k)] = c
+		}
+	}
+	if len(sketch.Negative) > 0 {
+		s.Negative = make(map[int32]uint64, len(sketch.Negative))
+		for k, c := range sketch.Negative {
+			s.Negative[int32(k)] = c
+		}
+	}
+	return s
+}
+
+// agentIDFromContext возвращает ID агента из метаданных запроса; пустая строка - запрос не от агента
+func agentIDFromContext(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", nil
+	}
+	ids := md.Get(agentid.HeaderName)
+	if len(ids) == 0 {
+		return "", nil
+	}
+	if err := agentid.Validate(ids[0]); err != nil {
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	}
+	return ids[0], nil
+}
+
+// stampAgentID возвращает ID агента, которым отмечаются его метрики, или пустую строку, если это выключено
+func (ms *GRPCMetricServerServer) stampAgentID(agentID string) string {
+	if !ms.StampAgentID {
+		return ""
+	}
+	return agentID
+}
+
+// recordAgent отмечает в реестре агента agentID, приславшего метрики
+func (ms *GRPCMetricServerServer) recordAgent(ctx context.Context, agentID string, metrics []memstorage.Metric) {
+	if agentID == "" || ms.Agents == nil {
+		return
+	}
+
+	var addr string
+	if p, ok := peer.FromContext(ctx); ok {
+		addr, _, _ = net.SplitHostPort(p.Addr.String())
+	}
+
+	keys := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		keys = append(keys, metric.Key())
+	}
+	ms.Agents.Seen(agentID, addr, keys)
+}
+
+// как часто клиенты могут проверять соединение ping'ами; чаще - сервер разрывает соединение
+const keepaliveMinTime = 10 * time.Second
+
+// StartServer открывает порт и запускает gRPC-сервер в отдельной горутине;
+// остановить сервер можно через GracefulStop или Stop
+func StartServer(storager api.Storager, registry *agents.Registry, hub *stream.Hub, port string, stampAgentID bool) (*grpc.Server, error) {
 	// определяем порт для сервера
 	listen, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// создаём gRPC-сервер без зарегистрированной службы
-	s := grpc.NewServer()
+	// создаём gRPC-сервер без зарегистрированной службы;
+	// агенты держат соединение открытым и проверяют его ping'ами (см. metricservice.GrpcClient)
+	s := grpc.NewServer(grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+		MinTime:             keepaliveMinTime,
+		PermitWithoutStream: true,
+	}))
 
 	// регистрируем сервис
-	pb.RegisterMetricsServer(s, &GRPCMetricServerServer{Storager: storager})
+	pb.RegisterMetricsServer(s, &GRPCMetricServerServer{Storager: storager, Agents: registry, Hub: hub, StampAgentID: stampAgentID})
 	log.Printf("Starting grpc server on port: %s", port)
 
 	// получаем запрос gRPC
-	if err := s.Serve(listen); err != nil {
-		return err
-	}
-	return nil
+	go func() {
+		if err := s.Serve(listen); err != nil {
+			log.Println("error in serving grpc:", err)
+		}
+	}()
+	return s, nil
 }
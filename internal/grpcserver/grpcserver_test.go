@@ -1,13 +1,28 @@
 package grpcserver
 
 import (
+	"context"
+	"io"
 	"testing"
 	"time"
 
+	"github.com/adettelle/go-metric-collector/internal/agent/metrics"
 	"github.com/adettelle/go-metric-collector/internal/agent/metricservice"
+	"github.com/adettelle/go-metric-collector/internal/api"
 	"github.com/adettelle/go-metric-collector/internal/mocks"
+	"github.com/adettelle/go-metric-collector/internal/server/agents"
+	"github.com/adettelle/go-metric-collector/internal/server/stream"
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/pkg/agentid"
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
+	pb "github.com/adettelle/go-metric-collector/proto"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func TestGrpcServer(t *testing.T) {
@@ -16,23 +31,275 @@ func TestGrpcServer(t *testing.T) {
 	// создаём объект-заглушку
 	m := mocks.NewMockStorager(ctrl)
 
-	go func() {
-		_ = StartServer(m, "3333")
-	}()
-
-	time.Sleep(100 * time.Millisecond)
-	sender := metricservice.NewGrpcSender("localhost:3333")
+	registry := agents.NewRegistry()
+	srv, err := StartServer(m, registry, nil, "3333", false)
+	require.NoError(t, err)
+	defer srv.Stop()
+	sender := metricservice.NewGrpcSender("localhost:3333", "agent-1", 1)
 
-	m.EXPECT().AddCounterMetric(gomock.Any(), gomock.Any())
-	m.EXPECT().AddGaugeMetric(gomock.Any(), gomock.Any())
+	sketch := ddsketch.New(ddsketch.DefaultAlpha)
+	sketch.Add(-1)
+	sketch.Add(0)
+	sketch.Add(2.5)
+	// весь пакет сохраняется одним вызовом
+	var batch []memstorage.Metric
+	m.EXPECT().AddMetrics(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, metrics []memstorage.Metric) error {
+		batch = metrics
+		return nil
+	})
 
 	delta := int64(1)
 	value := 11.22
 
-	err := sender.SendMetricsChunk(1, []metricservice.MetricRequest{
+	err = sender.SendMetricsChunk(1, []metricservice.MetricRequest{
 		{ID: "m1", MType: "counter", Delta: &delta},
 		{ID: "m2", MType: "gauge", Value: &value},
+		{ID: "m2", MType: "gauge", Value: &value, Labels: map[string]string{"host": "a", "env": "prod"}},
+		{ID: "m4", MType: "summary", Summary: sketch},
+		{ID: "m3", MType: "histogram", Histogram: &metrics.Histogram{Bounds: []float64{1}, Counts: []uint64{2, 1}, Sum: 3.5, Count: 3}},
 	})
 	require.NoError(t, err)
+	// пакет передан в поток; Close дожидается, пока сервер его сохранит
+	require.NoError(t, sender.Close())
+
+	require.Len(t, batch, 5)
+	require.Equal(t, "m1", batch[0].Key())
+	require.Equal(t, int64(1), *batch[0].Delta)
+	require.Equal(t, "m2", batch[1].Key())
+	require.Equal(t, 11.22, *batch[1].Value)
+	// метрика с метками сохраняется под ключом с метками
+	require.Equal(t, `m2{env="prod",host="a"}`, batch[2].Key())
+	require.Equal(t, "summary", batch[3].MType)
+	require.Equal(t, sketch, batch[3].Summary)
+	require.Equal(t, &memstorage.Histogram{Bounds: []float64{1}, Counts: []uint64{2, 1}, Sum: 3.5, Count: 3}, batch[4].Histogram)
+
+	// сервер запомнил агента и метрики из пакета
+	list := registry.List()
+	require.Len(t, list, 1)
+	require.Equal(t, "agent-1", list[0].ID)
+	require.Equal(t, "127.0.0.1", list[0].Addr)
+	require.Equal(t, []string{"m1", "m2", `m2{env="prod",host="a"}`, "m3", "m4"}, list[0].Metrics)
+}
+
+// метки agent_id включаются в настройках сервера; реестр агентов ведется в любом случае
+func TestUpdateMetricsStampAgentID(t *testing.T) {
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+	in := &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{{Name: "Alloc", Type: "gauge", Value: 1.5}}}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(agentid.HeaderName, "agent-1"))
+
+	srv := &GRPCMetricServerServer{Storager: ms, Agents: agents.NewRegistry()}
+	_, err = srv.UpdateMetrics(ctx, in)
+	require.NoError(t, err)
+	_, ok, err := ms.GetGaugeMetric(ctx, "Alloc")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, []string{"Alloc"}, srv.Agents.List()[0].Metrics)
+
+	srv.StampAgentID = true
+	_, err = srv.UpdateMetrics(ctx, in)
+	require.NoError(t, err)
+	_, ok, err = ms.GetGaugeMetric(ctx, `Alloc{agent_id="agent-1"}`)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestGetMetricValues(t *testing.T) {
+	ctx := context.Background()
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+	sketch := ddsketch.New(ddsketch.DefaultAlpha)
+	sketch.Add(-1)
+	sketch.Add(2.5)
+	require.NoError(t, ms.AddGaugeMetric(ctx, `g1{host="a"}`, 1.5))
+	require.NoError(t, ms.AddCounterMetric(ctx, "c1", 3))
+	require.NoError(t, ms.AddSummaryMetric(ctx, "s1", sketch))
+
+	srv, err := StartServer(ms, nil, nil, "3334", false)
+	require.NoError(t, err)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("localhost:3334", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewMetricsClient(conn)
+
+	resp, err := client.GetMetricValues(ctx, &pb.GetMetricValuesRequest{Metrics: []*pb.MetricID{
+		{Name: "g1", Type: "gauge", Labels: map[string]string{"host": "a"}},
+		{Name: "c1", Type: "counter"},
+		{Name: "c2", Type: "counter"},
+		{Name: "s1", Type: "summary"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, resp.Values, 4)
+	require.Equal(t, 1.5, resp.Values[0].Metric.Value)
+	require.Equal(t, map[string]string{"host": "a"}, resp.Values[0].Metric.Labels)
+	require.Equal(t, int64(3), resp.Values[1].Metric.Delta)
+	require.False(t, resp.Values[1].NotFound)
+	require.True(t, resp.Values[2].NotFound)
+	require.Equal(t, "c2", resp.Values[2].Metric.Name)
+	require.Equal(t, sketch, summaryFromProto(resp.Values[3].Metric.Summary))
+
+	_, err = client.GetMetricValues(ctx, &pb.GetMetricValuesRequest{Metrics: []*pb.MetricID{{Name: "x", Type: "unknown"}}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGetMetricAndListMetrics(t *testing.T) {
+	ctx := context.Background()
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+	require.NoError(t, ms.AddGaugeMetric(ctx, `Alloc{host="a"}`, 1.5))
+	require.NoError(t, ms.AddGaugeMetric(ctx, "HeapAlloc", 3))
+	require.NoError(t, ms.AddGaugeMetric(ctx, "CPUutilization1", 0.5))
+	require.NoError(t, ms.AddCounterMetric(ctx, "PollCount", 7))
+
+	srv, err := StartServer(ms, nil, nil, "3335", false)
+	require.NoError(t, err)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("localhost:3335", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewMetricsClient(conn)
+
+	m, err := client.GetMetric(ctx, &pb.GetMetricRequest{Metric: &pb.MetricID{Name: "Alloc", Type: "gauge", Labels: map[string]string{"host": "a"}}})
+	require.NoError(t, err)
+	require.Equal(t, 1.5, m.Value)
+	m, err = client.GetMetric(ctx, &pb.GetMetricRequest{Metric: &pb.MetricID{Name: "PollCount", Type: "counter"}})
+	require.NoError(t, err)
+	require.Equal(t, int64(7), m.Delta)
+
+	_, err = client.GetMetric(ctx, &pb.GetMetricRequest{Metric: &pb.MetricID{Name: "Alloc", Type: "gauge"}})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.GetMetric(ctx, &pb.GetMetricRequest{Metric: &pb.MetricID{Name: "Alloc", Type: "unknown"}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.GetMetric(ctx, &pb.GetMetricRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	list, err := client.ListMetrics(ctx, &pb.ListMetricsRequest{Type: "gauge", Match: "*Alloc", Sort: "value", Desc: true})
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), list.Total)
+	require.Equal(t, "HeapAlloc", list.Metrics[0].Name)
+	require.Equal(t, "Alloc", list.Metrics[1].Name)
+	require.Equal(t, map[string]string{"host": "a"}, list.Metrics[1].Labels)
+
+	list, err = client.ListMetrics(ctx, &pb.ListMetricsRequest{Regex: "[A-Z].*", Offset: 1, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, uint32(4), list.Total)
+	require.Len(t, list.Metrics, 2)
+	require.Equal(t, "CPUutilization1", list.Metrics[0].Name)
+
+	for _, in := range []*pb.ListMetricsRequest{
+		{Match: "a", Regex: "b"},
+		{Sort: "value"},
+		{Type: "foo"},
+		{Limit: 1001},
+		{Regex: "("},
+	} {
+		_, err = client.ListMetrics(ctx, in)
+		require.Equal(t, codes.InvalidArgument, status.Code(err), in.String())
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+	hub := stream.NewHub()
+	storager := api.NewNotifyingStorager(ms, hub)
+
+	srv, err := StartServer(storager, nil, hub, "3336", false)
+	require.NoError(t, err)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("localhost:3336", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewMetricsClient(conn)
+
+	watch, err := client.Watch(ctx, &pb.WatchRequest{Match: []string{"Poll*", "Alloc"}})
+	require.NoError(t, err)
+	// заголовки приходят после создания подписки
+	_, err = watch.Header()
+	require.NoError(t, err)
+
+	require.NoError(t, storager.AddGaugeMetric(ctx, "HeapAlloc", 1))
+	require.NoError(t, storager.AddGaugeMetric(ctx, `Alloc{host="a"}`, 2.5))
+	require.NoError(t, storager.AddCounterMetric(ctx, "PollCount", 2))
+	require.NoError(t, storager.AddCounterMetric(ctx, "PollCount", 3))
+
+	m, err := watch.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "Alloc", m.Name)
+	require.Equal(t, 2.5, m.Value)
+	require.Equal(t, map[string]string{"host": "a"}, m.Labels)
+	for _, want := range []int64{2, 5} {
+		m, err = watch.Recv()
+		require.NoError(t, err)
+		require.Equal(t, "PollCount", m.Name)
+		require.Equal(t, want, m.Delta)
+	}
+
+	// при остановке сервера поток завершается
+	hub.Close()
+	_, err = watch.Recv()
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	bad, err := client.Watch(ctx, &pb.WatchRequest{Type: "histogram"})
+	require.NoError(t, err)
+	_, err = bad.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestStreamMetrics(t *testing.T) {
+	ctx := context.Background()
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+
+	srv, err := StartServer(ms, nil, nil, "3337", false)
+	require.NoError(t, err)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("localhost:3337", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewMetricsClient(conn)
 
+	stream, err := client.StreamMetrics(ctx)
+	require.NoError(t, err)
+	// каждый пакет подтверждается после сохранения
+	for i := 0; i < 3; i++ {
+		require.NoError(t, stream.Send(&pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+			{Name: "PollCount", Type: "counter", Delta: 2},
+			{Name: "Alloc", Type: "gauge", Value: float64(i)},
+		}}))
+		resp, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, uint64(i+1), resp.Received)
+	}
+	require.NoError(t, stream.CloseSend())
+	_, err = stream.Recv()
+	require.ErrorIs(t, err, io.EOF)
+
+	delta, _, err := ms.GetCounterMetric(ctx, "PollCount")
+	require.NoError(t, err)
+	require.Equal(t, int64(6), delta)
+	value, _, err := ms.GetGaugeMetric(ctx, "Alloc")
+	require.NoError(t, err)
+	require.Equal(t, 2.0, value)
+
+	// недопустимый пакет завершает поток, предыдущие пакеты сохранены
+	stream, err = client.StreamMetrics(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.UpdateMetricsRequest{Metrics: []*pb.Metric{{Name: "PollCount", Type: "counter", Delta: 1}}}))
+	_, err = stream.Recv()
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.UpdateMetricsRequest{Metrics: []*pb.Metric{{Name: "x", Type: "unknown"}}}))
+	_, err = stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	delta, _, err = ms.GetCounterMetric(ctx, "PollCount")
+	require.NoError(t, err)
+	require.Equal(t, int64(7), delta)
 }
@@ -0,0 +1,178 @@
+// Package graphite implements a TCP listener for the Graphite plaintext protocol:
+// one "path value timestamp" line per metric.
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/internal/ingest"
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+)
+
+// Sample - одна разобранная строка протокола
+type Sample struct {
+	Name      string
+	Value     float64
+	Timestamp time.Time
+}
+
+// ParseLine разбирает строку "path value timestamp". Путь нормализуется
+// (см. NormalizePath); timestamp, равный -1 или N, означает текущее время.
+func ParseLine(line string, now time.Time) (Sample, error) {
+	var s Sample
+
+	parts := strings.Fields(line)
+	if len(parts) != 3 {
+		return s, fmt.Errorf("invalid graphite line %q: expected path, value and timestamp", line)
+	}
+
+	s.Name = NormalizePath(parts[0])
+	if s.Name == "" {
+		return s, fmt.Errorf("invalid graphite line %q: empty path", line)
+	}
+	if err := memstorage.ValidateMetricName(s.Name); err != nil {
+		return s, fmt.Errorf("invalid graphite line %q: %w", line, err)
+	}
+
+	value, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return s, fmt.Errorf("invalid graphite line %q: %w", line, err)
+	}
+	s.Value = value
+
+	switch parts[2] {
+	case "-1", "N":
+		s.Timestamp = now
+	default:
+		ts, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil {
+			return s, fmt.Errorf("invalid graphite line %q: invalid timestamp", line)
+		}
+		s.Timestamp = time.Unix(0, int64(ts*float64(time.Second)))
+	}
+
+	return s, nil
+}
+
+// NormalizePath приводит путь к виду, в котором его хранит carbon:
+// убирает пустые сегменты (повторяющиеся, начальные и конечные точки)
+func NormalizePath(path string) string {
+	segments := strings.FieldsFunc(path, func(r rune) bool { return r == '.' })
+	return strings.Join(segments, ".")
+}
+
+// Server принимает TCP соединения и записывает каждое значение
+// как gauge метрику с именем, равным нормализованному пути.
+type Server struct {
+	addr     string
+	writer   ingest.MetricWriter
+	listener net.Listener
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewServer(addr string, writer ingest.MetricWriter) *Server {
+	return &Server{
+		addr:   addr,
+		writer: writer,
+		done:   make(chan struct{}),
+	}
+}
+
+// Start открывает TCP порт и запускает прием соединений в отдельной горутине
+func (s *Server) Start() error {
+	var err error
+
+	s.listener, err = net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Starting graphite server on %s", s.addr)
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return nil
+}
+
+// Addr возвращает фактический адрес (полезно, если был указан порт 0)
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Shutdown закрывает порт и открытые соединения и дожидается их обработки
+func (s *Server) Shutdown() error {
+	close(s.done)
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Println("error in accepting graphite connection:", err)
+			continue
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+		}()
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	// при остановке сервера закрываем соединение, чтобы прервать чтение
+	closed := make(chan struct{})
+	defer close(closed)
+	go func() {
+		select {
+		case <-s.done:
+			conn.Close()
+		case <-closed:
+		}
+	}()
+
+	// запись принятой строки не прерывается при остановке сервера
+	ctx := context.Background()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		sample, err := ParseLine(line, time.Now())
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if math.IsNaN(sample.Value) {
+			continue
+		}
+
+		if err = s.writer.AddGaugeMetric(ctx, sample.Name, sample.Value); err != nil {
+			log.Println("error in writing graphite metric:", err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package graphite
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	s, err := ParseLine("servers.web01.cpu.user 12.5 1699999990", now)
+	require.NoError(t, err)
+	require.Equal(t, Sample{Name: "servers.web01.cpu.user", Value: 12.5, Timestamp: time.Unix(1699999990, 0)}, s)
+
+	s, err = ParseLine(".cron..backup.duration.  300 -1", now)
+	require.NoError(t, err)
+	require.Equal(t, Sample{Name: "cron.backup.duration", Value: 300, Timestamp: now}, s)
+
+	for _, line := range []string{
+		"servers.web01.cpu 12.5",
+		"... 1 1700000000",
+		"servers.web01.cpu abc 1700000000",
+		"servers.web01.cpu 1 yesterday",
+		`servers{host="a"} 1 1700000000`,
+	} {
+		_, err = ParseLine(line, now)
+		require.Error(t, err, line)
+	}
+}
+
+func TestServer(t *testing.T) {
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+
+	srv := NewServer("127.0.0.1:0", ms)
+	require.NoError(t, srv.Start())
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = fmt.Fprint(conn, "jobs.backup.duration 300 1700000000\nbroken\njobs.backup.size 1024 N\njobs.backup.duration 310 1700000060\n")
+	require.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, srv.Shutdown())
+
+	gMetrics, err := ms.GetAllGaugeMetrics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{"jobs.backup.duration": 310, "jobs.backup.size": 1024}, gMetrics)
+}
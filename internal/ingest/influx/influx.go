@@ -0,0 +1,123 @@
+package influx
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+
+	"github.com/adettelle/go-metric-collector/internal/ingest"
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+)
+
+// Receiver принимает строки протокола InfluxDB и сохраняет каждое числовое поле
+// как метрику с именем <measurement>_<field>. Поля записываются как gauge метрики,
+// а если integerAsCounter = true, то целочисленные поля (суффикс i) считаются
+// накопленными значениями счетчиков и записываются как counter метрики.
+// Теги точки становятся метками метрики (см. memstorage.SeriesKey),
+// строковые и логические поля пропускаются.
+type Receiver struct {
+	writer           ingest.MetricWriter
+	counters         *ingest.CumulativeCounters
+	integerAsCounter bool
+}
+
+func NewReceiver(writer ingest.MetricWriter, integerAsCounter bool) *Receiver {
+	return &Receiver{
+		writer:           writer,
+		counters:         ingest.NewCumulativeCounters(),
+		integerAsCounter: integerAsCounter,
+	}
+}
+
+// ServeHTTP handles POST requests with line protocol in the body;
+// the optional precision parameter sets the unit of timestamps.
+// POST http://localhost:8080/write?precision=s
+func (rc *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	precision, err := ParsePrecision(r.URL.Query().Get("precision"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body, err := ingest.ReadBody(w, r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), ingest.BodyErrorStatus(err))
+		return
+	}
+
+	points, err := ParsePoints(string(body), precision)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = rc.Write(r.Context(), points)
+	if errors.Is(err, memstorage.ErrInvalidMetricName) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println("error in writing influx metrics:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Write записывает числовые поля точек в хранилище.
+// Если имя хотя бы одной метрики некорректно, ничего не записывается.
+func (rc *Receiver) Write(ctx context.Context, points []Point) error {
+	for _, p := range points {
+		for _, f := range p.Fields {
+			if !f.IsNumeric() {
+				continue
+			}
+			if err := memstorage.ValidateMetricName(p.Measurement + "_" + f.Key); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, p := range points {
+		labels := seriesLabels(p)
+		for _, f := range p.Fields {
+			if !f.IsNumeric() {
+				continue
+			}
+			key := memstorage.SeriesKey(p.Measurement+"_"+f.Key, labels)
+
+			if rc.integerAsCounter && f.Type == FieldInteger {
+				delta := rc.counters.Delta(key, f.Int)
+				if err := rc.writer.AddCounterMetric(ctx, key, delta); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if math.IsNaN(f.Value) {
+				continue
+			}
+			if err := rc.writer.AddGaugeMetric(ctx, key, f.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// seriesLabels возвращает теги точки в виде меток метрики
+func seriesLabels(p Point) memstorage.Labels {
+	labels := make(memstorage.Labels, len(p.Tags))
+	for k, v := range p.Tags {
+		labels[ingest.LabelName(k)] = v
+	}
+	return labels
+}
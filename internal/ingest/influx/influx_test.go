@@ -0,0 +1,112 @@
+package influx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/stretchr/testify/require"
+)
+
+func postLines(t *testing.T, rc *Receiver, url string, body string) *httptest.ResponseRecorder {
+	request, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	require.NoError(t, err)
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	response := httptest.NewRecorder()
+
+	rc.ServeHTTP(response, request)
+	return response
+}
+
+func TestWriteGauges(t *testing.T) {
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+	rc := NewReceiver(ms, false)
+
+	body := "cpu,host=a usage_idle=97.5,cores=8i,model=\"x86\" 1700000000\nmem,host=a used=1024u 1700000000\n"
+	response := postLines(t, rc, "/write?precision=s", body)
+	require.Equal(t, http.StatusNoContent, response.Code)
+
+	gMetrics, err := ms.GetAllGaugeMetrics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{
+		`cpu_usage_idle{host="a"}`: 97.5,
+		`cpu_cores{host="a"}`:      8,
+		`mem_used{host="a"}`:       1024,
+	}, gMetrics)
+
+	cMetrics, err := ms.GetAllCounterMetrics(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, cMetrics)
+}
+
+func TestWriteIntegerCounters(t *testing.T) {
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+	rc := NewReceiver(ms, true)
+
+	response := postLines(t, rc, "/write", "net,iface=eth0 bytes_recv=100i\nnet,iface=eth1 bytes_recv=50i\n")
+	require.Equal(t, http.StatusNoContent, response.Code)
+
+	// первые значения - точка отсчета: накопленное до этого не прибавляется
+	delta, ok, err := ms.GetCounterMetric(context.Background(), `net_bytes_recv{iface="eth0"}`)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(0), delta)
+
+	// накопленные значения переводятся в приращения отдельно для каждого набора тегов
+	response = postLines(t, rc, "/write", "net,iface=eth0 bytes_recv=130i\nnet,iface=eth1 bytes_recv=60i\n")
+	require.Equal(t, http.StatusNoContent, response.Code)
+
+	delta, ok, err = ms.GetCounterMetric(context.Background(), `net_bytes_recv{iface="eth0"}`)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(30), delta)
+
+	delta, ok, err = ms.GetCounterMetric(context.Background(), `net_bytes_recv{iface="eth1"}`)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(10), delta)
+}
+
+// ключи тегов приводятся к допустимым именам меток
+func TestWriteTagNames(t *testing.T) {
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+	rc := NewReceiver(ms, false)
+
+	response := postLines(t, rc, "/write", "disk,host.name=a,mount\\ point=/data free=1\n")
+	require.Equal(t, http.StatusNoContent, response.Code)
+
+	value, ok, err := ms.GetGaugeMetric(context.Background(), `disk_free{host_name="a",mount_point="/data"}`)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, float64(1), value)
+}
+
+func TestWriteBadRequest(t *testing.T) {
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+	rc := NewReceiver(ms, false)
+
+	response := postLines(t, rc, "/write", "cpu usage=1\ncpu usage=\n")
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	// при ошибке в запросе ничего не записывается
+	gMetrics, err := ms.GetAllGaugeMetrics(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, gMetrics)
+
+	response = postLines(t, rc, "/write?precision=days", "cpu usage=1\n")
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	// имя метрики не должно совпадать с ключом метрики с метками
+	response = postLines(t, rc, "/write", "cpu usage=1\ncpu{a=\"b\"} usage=1\n")
+	require.Equal(t, http.StatusBadRequest, response.Code)
+	gMetrics, err = ms.GetAllGaugeMetrics(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, gMetrics)
+}
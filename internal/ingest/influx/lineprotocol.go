@@ -0,0 +1,217 @@
+// Package influx implements an HTTP receiver for the InfluxDB line protocol,
+// so Telegraf and other Influx clients can write metrics into the server storage.
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldType - тип значения поля
+type FieldType int
+
+const (
+	FieldFloat FieldType = iota
+	FieldInteger
+	FieldUnsigned
+	FieldString
+	FieldBoolean
+)
+
+type Field struct {
+	Key   string
+	Value float64 // числовое значение (для boolean: 1 или 0)
+	Int   int64   // точное значение целочисленного поля
+	Str   string  // значение строкового поля
+	Type  FieldType
+}
+
+// IsNumeric - можно ли сохранить поле как метрику
+func (f Field) IsNumeric() bool {
+	return f.Type == FieldFloat || f.Type == FieldInteger || f.Type == FieldUnsigned
+}
+
+// Point - одна строка протокола:
+// measurement[,tag=value...] field=value[,field=value...] [timestamp]
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      []Field
+	Timestamp   time.Time // нулевое значение, если время не указано
+}
+
+// ParsePoints разбирает тело запроса; пустые строки и комментарии (#) пропускаются
+func ParsePoints(body string, precision time.Duration) ([]Point, error) {
+	var points []Point
+	for i, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := ParseLine(line, precision)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// ParseLine разбирает одну строку; precision - единица измерения времени в строке
+func ParseLine(line string, precision time.Duration) (Point, error) {
+	var p Point
+
+	sections := splitUnescaped(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return p, errors.New("expected measurement, fields and optional timestamp")
+	}
+
+	keyParts := splitUnescaped(sections[0], ',', false)
+	p.Measurement = unescape(keyParts[0])
+	if p.Measurement == "" {
+		return p, errors.New("missing measurement")
+	}
+
+	p.Tags = make(map[string]string)
+	for _, tag := range keyParts[1:] {
+		kv := splitUnescaped(tag, '=', false)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return p, fmt.Errorf("invalid tag %q", tag)
+		}
+		p.Tags[unescape(kv[0])] = unescape(kv[1])
+	}
+
+	for _, rawField := range splitUnescaped(sections[1], ',', true) {
+		f, err := parseField(rawField)
+		if err != nil {
+			return p, err
+		}
+		p.Fields = append(p.Fields, f)
+	}
+
+	if len(sections) == 3 {
+		ts, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return p, fmt.Errorf("invalid timestamp %q", sections[2])
+		}
+		p.Timestamp = time.Unix(0, ts*int64(precision))
+	}
+
+	return p, nil
+}
+
+func parseField(rawField string) (Field, error) {
+	var f Field
+
+	key, value, ok := cutUnescaped(rawField, '=')
+	if !ok || key == "" || value == "" {
+		return f, fmt.Errorf("invalid field %q", rawField)
+	}
+	f.Key = unescape(key)
+
+	var err error
+	switch {
+	case strings.HasPrefix(value, `"`):
+		if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+			return f, fmt.Errorf("invalid string field %q", rawField)
+		}
+		f.Type = FieldString
+		f.Str = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(value[1 : len(value)-1])
+	case strings.HasSuffix(value, "i"):
+		f.Type = FieldInteger
+		f.Int, err = strconv.ParseInt(value[:len(value)-1], 10, 64)
+		f.Value = float64(f.Int)
+	case strings.HasSuffix(value, "u"):
+		f.Type = FieldUnsigned
+		var v uint64
+		v, err = strconv.ParseUint(value[:len(value)-1], 10, 64)
+		f.Value = float64(v)
+	default:
+		switch value {
+		case "t", "T", "true", "True", "TRUE":
+			f.Type = FieldBoolean
+			f.Value = 1
+		case "f", "F", "false", "False", "FALSE":
+			f.Type = FieldBoolean
+		default:
+			f.Type = FieldFloat
+			f.Value, err = strconv.ParseFloat(value, 64)
+		}
+	}
+	if err != nil {
+		return f, fmt.Errorf("invalid field %q: %w", rawField, err)
+	}
+	return f, nil
+}
+
+// ParsePrecision переводит параметр precision (как в API InfluxDB v1 и v2) в единицу времени
+func ParsePrecision(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	}
+	return 0, fmt.Errorf("unknown precision %q", precision)
+}
+
+// splitUnescaped делит строку по символу sep, не экранированному обратной косой чертой;
+// если inQuotes = true, sep внутри двойных кавычек тоже не учитывается
+func splitUnescaped(s string, sep byte, inQuotes bool) []string {
+	var res []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"' && inQuotes:
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			res = append(res, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(res, s[start:])
+}
+
+func cutUnescaped(s string, sep byte) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+// unescape убирает обратную косую черту перед экранированными символами
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case ',', '=', ' ', '\\', '"':
+				i++
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
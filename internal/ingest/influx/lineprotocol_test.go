@@ -0,0 +1,62 @@
+package influx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	line := `cpu\ load,host=server\ 01,region=us-west usage_idle=97.5,cores=8i,free=3u,up=true,msg="hello, \"world\"" 1700000000`
+
+	p, err := ParseLine(line, time.Second)
+	require.NoError(t, err)
+
+	require.Equal(t, "cpu load", p.Measurement)
+	require.Equal(t, map[string]string{"host": "server 01", "region": "us-west"}, p.Tags)
+	require.Equal(t, []Field{
+		{Key: "usage_idle", Value: 97.5, Type: FieldFloat},
+		{Key: "cores", Value: 8, Int: 8, Type: FieldInteger},
+		{Key: "free", Value: 3, Type: FieldUnsigned},
+		{Key: "up", Value: 1, Type: FieldBoolean},
+		{Key: "msg", Str: `hello, "world"`, Type: FieldString},
+	}, p.Fields)
+	require.Equal(t, time.Unix(1700000000, 0), p.Timestamp)
+}
+
+func TestParseLineWithoutTimestamp(t *testing.T) {
+	p, err := ParseLine("mem used=1024", time.Nanosecond)
+	require.NoError(t, err)
+	require.Equal(t, "mem", p.Measurement)
+	require.Empty(t, p.Tags)
+	require.True(t, p.Timestamp.IsZero())
+}
+
+func TestParseLineInvalid(t *testing.T) {
+	lines := []string{
+		"mem",
+		",host=a used=1",
+		"mem,host used=1",
+		"mem used=",
+		"mem used=abc",
+		"mem used=1.5i",
+		`mem msg="unterminated`,
+		"mem used=1 notatime",
+	}
+	for _, line := range lines {
+		_, err := ParseLine(line, time.Nanosecond)
+		require.Error(t, err, line)
+	}
+}
+
+func TestParsePoints(t *testing.T) {
+	body := "# comment\ncpu usage=1\n\nmem used=2i 1000\n"
+	points, err := ParsePoints(body, time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	require.Equal(t, time.Unix(1, 0), points[1].Timestamp)
+
+	_, err = ParsePoints("cpu usage=1\nbroken\n", time.Nanosecond)
+	require.ErrorContains(t, err, "line 2")
+}
@@ -0,0 +1,89 @@
+// Package ingest contains shared parts of the receivers that accept metrics
+// in third-party formats and write them into the server storage.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// MaxBodySize ограничивает размер тела запроса (после распаковки), которое читают приемники
+const MaxBodySize = 32 << 20
+
+// MetricWriter - хранилище, в которое приемники записывают принятые метрики
+// (ему удовлетворяет api.Storager).
+type MetricWriter interface {
+	AddGaugeMetric(ctx context.Context, name string, value float64) error
+	AddCounterMetric(ctx context.Context, name string, value int64) error
+}
+
+// CumulativeCounters переводит накопленные значения счетчиков, которые присылают
+// внешние источники, в приращения, с которыми работает AddCounterMetric.
+// Последнее значение запоминается отдельно для каждого ряда (series).
+type CumulativeCounters struct {
+	mu   sync.Mutex
+	last map[string]int64
+}
+
+func NewCumulativeCounters() *CumulativeCounters {
+	return &CumulativeCounters{last: make(map[string]int64)}
+}
+
+// Delta возвращает приращение ряда series с момента предыдущего значения.
+// Первое значение ряда только запоминается как точка отсчета (приращение 0):
+// иначе после перезапуска сервера с сохраненными метриками накопленное источником
+// значение прибавилось бы к ним еще раз. После сброса счетчика (значение уменьшилось)
+// приращением считается само значение.
+func (c *CumulativeCounters) Delta(series string, value int64) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last, ok := c.last[series]
+	c.last[series] = value
+
+	switch {
+	case !ok:
+		return 0
+	case value < last:
+		return value
+	}
+	return value - last
+}
+
+// ReadBody читает тело запроса, но не больше MaxBodySize байт
+func ReadBody(w http.ResponseWriter, body io.ReadCloser) ([]byte, error) {
+	return io.ReadAll(http.MaxBytesReader(w, body, MaxBodySize))
+}
+
+// BodyErrorStatus возвращает код ответа на ошибку ReadBody
+func BodyErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// LabelName приводит имя метки, тега или атрибута внешнего источника к виду [a-zA-Z_][a-zA-Z0-9_]*,
+// который допускает memstorage.ValidateLabels: прочие символы заменяются на _,
+// перед цифрой в начале имени добавляется _
+func LabelName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+		default:
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
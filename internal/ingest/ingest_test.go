@@ -0,0 +1,40 @@
+package ingest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCumulativeCounters(t *testing.T) {
+	c := NewCumulativeCounters()
+
+	require.Equal(t, int64(0), c.Delta("a", 10)) // первое значение ряда - точка отсчета
+	require.Equal(t, int64(5), c.Delta("a", 15))
+	require.Equal(t, int64(0), c.Delta("a", 15))
+	require.Equal(t, int64(3), c.Delta("a", 3)) // сброс счетчика
+	require.Equal(t, int64(0), c.Delta("b", 7)) // ряды учитываются отдельно
+	require.Equal(t, int64(2), c.Delta("b", 9))
+}
+
+func TestReadBody(t *testing.T) {
+	body, err := ReadBody(httptest.NewRecorder(), io.NopCloser(strings.NewReader("cpu usage=1")))
+	require.NoError(t, err)
+	require.Equal(t, "cpu usage=1", string(body))
+
+	_, err = ReadBody(httptest.NewRecorder(), io.NopCloser(strings.NewReader(strings.Repeat("x", MaxBodySize+1))))
+	require.Error(t, err)
+	require.Equal(t, http.StatusRequestEntityTooLarge, BodyErrorStatus(err))
+}
+
+func TestLabelName(t *testing.T) {
+	require.Equal(t, "instance", LabelName("instance"))
+	require.Equal(t, "service_name", LabelName("service.name"))
+	require.Equal(t, "data_center_1", LabelName("data-center 1"))
+	require.Equal(t, "_2xx", LabelName("2xx"))
+	require.Equal(t, "host_", LabelName("hostя"))
+}
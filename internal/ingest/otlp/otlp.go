@@ -0,0 +1,232 @@
+// Package otlp implements an OpenTelemetry OTLP/HTTP metrics receiver
+// accepting both binary protobuf and JSON encoded export requests.
+package otlp
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/adettelle/go-metric-collector/internal/ingest"
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	pkg "github.com/adettelle/go-metric-collector/pkg/compressor"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrNoMetricName - в запросе есть метрика без имени
+var ErrNoMetricName = errors.New("metric without name")
+
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+)
+
+// Receiver принимает запросы экспорта метрик OTLP/HTTP и сопоставляет их модели gauge/counter:
+//   - Gauge и немонотонные Sum - gauge метрики;
+//   - монотонные Sum - counter метрики (накопленные значения переводятся в приращения,
+//     значения с delta temporality записываются как есть).
+//
+// Атрибуты ресурса и точки становятся метками метрики (см. memstorage.SeriesKey;
+// при совпадении ключей атрибут точки важнее), атрибуты-массивы и вложенные
+// атрибуты пропускаются. Histogram, ExponentialHistogram и Summary пропускаются.
+type Receiver struct {
+	writer   ingest.MetricWriter
+	counters *ingest.CumulativeCounters
+}
+
+func NewReceiver(writer ingest.MetricWriter) *Receiver {
+	return &Receiver{
+		writer:   writer,
+		counters: ingest.NewCumulativeCounters(),
+	}
+}
+
+// ServeHTTP handles OTLP/HTTP export requests; the response is encoded
+// the same way as the request.
+// POST http://localhost:8080/v1/metrics
+func (rc *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (contentType != contentTypeProtobuf && contentType != contentTypeJSON) {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		cr, err := pkg.NewCompressReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer cr.Close()
+		body = cr
+	}
+
+	data, err := ingest.ReadBody(w, body)
+	if err != nil {
+		http.Error(w, err.Error(), ingest.BodyErrorStatus(err))
+		return
+	}
+
+	var req colmetricspb.ExportMetricsServiceRequest
+	if contentType == contentTypeJSON {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, &req)
+	} else {
+		err = proto.Unmarshal(data, &req)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = rc.Write(r.Context(), &req)
+	if errors.Is(err, ErrNoMetricName) || errors.Is(err, memstorage.ErrInvalidMetricName) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println("error in writing otlp metrics:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var resp []byte
+	if contentType == contentTypeJSON {
+		resp, err = protojson.Marshal(&colmetricspb.ExportMetricsServiceResponse{})
+	} else {
+		resp, err = proto.Marshal(&colmetricspb.ExportMetricsServiceResponse{})
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// Write записывает точки Gauge и Sum метрик в хранилище.
+// Запрос с метрикой без имени или с некорректным именем отклоняется целиком до записи.
+func (rc *Receiver) Write(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) error {
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.Name == "" {
+					return ErrNoMetricName
+				}
+				if err := memstorage.ValidateMetricName(m.Name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, rm := range req.ResourceMetrics {
+		resource := rm.GetResource().GetAttributes()
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if err := rc.writeMetric(ctx, resource, m); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (rc *Receiver) writeMetric(ctx context.Context, resource []*commonpb.KeyValue, m *metricspb.Metric) error {
+	switch data := m.Data.(type) {
+	case *metricspb.Metric_Gauge:
+		return rc.writeGauge(ctx, m.Name, resource, data.Gauge.DataPoints)
+
+	case *metricspb.Metric_Sum:
+		if !data.Sum.IsMonotonic {
+			return rc.writeGauge(ctx, m.Name, resource, data.Sum.DataPoints)
+		}
+		cumulative := data.Sum.AggregationTemporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+		for _, dp := range data.Sum.DataPoints {
+			value, ok := pointValue(dp)
+			if !ok {
+				continue
+			}
+			key := memstorage.SeriesKey(m.Name, pointLabels(resource, dp.Attributes))
+			delta := int64(math.Round(value))
+			if cumulative {
+				delta = rc.counters.Delta(key, delta)
+			}
+			if err := rc.writer.AddCounterMetric(ctx, key, delta); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (rc *Receiver) writeGauge(ctx context.Context, name string, resource []*commonpb.KeyValue, points []*metricspb.NumberDataPoint) error {
+	for _, dp := range points {
+		value, ok := pointValue(dp)
+		if !ok {
+			continue
+		}
+		key := memstorage.SeriesKey(name, pointLabels(resource, dp.Attributes))
+		if err := rc.writer.AddGaugeMetric(ctx, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pointValue возвращает значение точки; точки без значения и NaN пропускаются
+func pointValue(dp *metricspb.NumberDataPoint) (float64, bool) {
+	if dp.Flags&uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0 {
+		return 0, false
+	}
+	switch v := dp.Value.(type) {
+	case *metricspb.NumberDataPoint_AsDouble:
+		return v.AsDouble, !math.IsNaN(v.AsDouble)
+	case *metricspb.NumberDataPoint_AsInt:
+		return float64(v.AsInt), true
+	}
+	return 0, false
+}
+
+// pointLabels возвращает метки точки: атрибуты ресурса и точки
+func pointLabels(resource, attrs []*commonpb.KeyValue) memstorage.Labels {
+	labels := make(memstorage.Labels, len(resource)+len(attrs))
+	for _, list := range [][]*commonpb.KeyValue{resource, attrs} {
+		for _, kv := range list {
+			if value, ok := attributeValue(kv.GetValue()); ok {
+				labels[ingest.LabelName(kv.Key)] = value
+			}
+		}
+	}
+	return labels
+}
+
+// attributeValue возвращает значение атрибута-скаляра в виде строки
+func attributeValue(v *commonpb.AnyValue) (string, bool) {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue, true
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue), true
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10), true
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'g', -1, 64), true
+	}
+	return "", false
+}
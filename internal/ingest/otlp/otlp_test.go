@@ -0,0 +1,186 @@
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func gauge(name string, value float64) *metricspb.Metric {
+	return &metricspb.Metric{
+		Name: name,
+		Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: []*metricspb.NumberDataPoint{{Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: value}}},
+		}},
+	}
+}
+
+func sum(name string, value int64, monotonic bool, temporality metricspb.AggregationTemporality, host string) *metricspb.Metric {
+	return &metricspb.Metric{
+		Name: name,
+		Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			IsMonotonic:            monotonic,
+			AggregationTemporality: temporality,
+			DataPoints: []*metricspb.NumberDataPoint{{
+				Value: &metricspb.NumberDataPoint_AsInt{AsInt: value},
+				Attributes: []*commonpb.KeyValue{{
+					Key:   "host",
+					Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: host}},
+				}},
+			}},
+		}},
+	}
+}
+
+func exportRequest(metrics ...*metricspb.Metric) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: metrics}},
+		}},
+	}
+}
+
+func post(t *testing.T, rc *Receiver, contentType string, body []byte, gzipped bool) *httptest.ResponseRecorder {
+	if gzipped {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write(body)
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		body = buf.Bytes()
+	}
+
+	request, err := http.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(body))
+	require.NoError(t, err)
+	request.Header.Set("Content-Type", contentType)
+	if gzipped {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+	response := httptest.NewRecorder()
+
+	rc.ServeHTTP(response, request)
+	return response
+}
+
+func postProto(t *testing.T, rc *Receiver, req *colmetricspb.ExportMetricsServiceRequest, gzipped bool) *httptest.ResponseRecorder {
+	body, err := proto.Marshal(req)
+	require.NoError(t, err)
+	return post(t, rc, "application/x-protobuf", body, gzipped)
+}
+
+func TestExportProtobuf(t *testing.T) {
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+	rc := NewReceiver(ms)
+
+	cumulative := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	delta := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+
+	response := postProto(t, rc, exportRequest(
+		gauge("HeapAlloc", 1024.5),
+		sum("requests", 10, true, cumulative, "a"),
+		sum("requests", 5, true, cumulative, "b"),
+		sum("errors", 2, true, delta, "a"),
+		sum("queue_size", 7, false, cumulative, "a"),
+	), false)
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, "application/x-protobuf", response.Header().Get("Content-Type"))
+
+	var resp colmetricspb.ExportMetricsServiceResponse
+	require.NoError(t, proto.Unmarshal(response.Body.Bytes(), &resp))
+
+	gMetrics, err := ms.GetAllGaugeMetrics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{"HeapAlloc": 1024.5, `queue_size{host="a"}`: 7}, gMetrics)
+
+	cMetrics, err := ms.GetAllCounterMetrics(context.Background())
+	require.NoError(t, err)
+	// первые накопленные значения - точка отсчета; ряды с разными атрибутами хранятся отдельно
+	require.Equal(t, map[string]int64{`requests{host="a"}`: 0, `requests{host="b"}`: 0, `errors{host="a"}`: 2}, cMetrics)
+
+	// накопленные значения переводятся в приращения (с учетом сброса), delta значения прибавляются
+	response = postProto(t, rc, exportRequest(
+		sum("requests", 12, true, cumulative, "a"),
+		sum("requests", 1, true, cumulative, "b"),
+		sum("errors", 3, true, delta, "a"),
+	), true)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	cMetrics, err = ms.GetAllCounterMetrics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{`requests{host="a"}`: 2, `requests{host="b"}`: 1, `errors{host="a"}`: 5}, cMetrics)
+}
+
+func TestExportJSON(t *testing.T) {
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+	rc := NewReceiver(ms)
+
+	body := `{"resourceMetrics":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"app"}}]},
+		"scopeMetrics":[{"scope":{"name":"test"},"metrics":[
+		{"name":"temperature","unit":"C","gauge":{"dataPoints":[{"asDouble":21.5,"timeUnixNano":"1700000000000000000"}]}},
+		{"name":"hits","sum":{"aggregationTemporality":2,"isMonotonic":true,"dataPoints":[{"asInt":"42",
+			"attributes":[{"key":"code","value":{"intValue":"200"}},{"key":"tags","value":{"arrayValue":{}}}]}]}},
+		{"name":"latency","histogram":{"aggregationTemporality":2,"dataPoints":[{"count":"1","sum":3}]}}
+		]}]}]}`
+
+	response := post(t, rc, "application/json", []byte(body), true)
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, "application/json", response.Header().Get("Content-Type"))
+	require.JSONEq(t, `{}`, response.Body.String())
+
+	// атрибуты ресурса и точки - метки метрики, атрибуты-массивы пропускаются
+	value, ok, err := ms.GetGaugeMetric(context.Background(), `temperature{service_name="app"}`)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 21.5, value)
+
+	hits, ok, err := ms.GetCounterMetric(context.Background(), `hits{code="200",service_name="app"}`)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(0), hits) // первое накопленное значение - точка отсчета
+
+	// histogram пропускается
+	_, ok, err = ms.GetGaugeMetric(context.Background(), `latency{service_name="app"}`)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestExportBadRequest(t *testing.T) {
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+	rc := NewReceiver(ms)
+
+	response := post(t, rc, "text/plain", []byte("HeapAlloc 1"), false)
+	require.Equal(t, http.StatusUnsupportedMediaType, response.Code)
+
+	response = post(t, rc, "application/x-protobuf", []byte("not a protobuf payload"), false)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	response = post(t, rc, "application/json", []byte(`{"resourceMetrics":`), false)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	// метрика без имени отклоняет весь запрос
+	response = postProto(t, rc, exportRequest(gauge("HeapAlloc", 1), gauge("", 2)), false)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	_, ok, err := ms.GetGaugeMetric(context.Background(), "HeapAlloc")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	request, err := http.NewRequest(http.MethodGet, "/v1/metrics", nil)
+	require.NoError(t, err)
+	response = httptest.NewRecorder()
+	rc.ServeHTTP(response, request)
+	require.Equal(t, http.StatusMethodNotAllowed, response.Code)
+}
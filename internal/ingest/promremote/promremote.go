@@ -0,0 +1,203 @@
+// Package promremote implements a receiver for the Prometheus remote_write protocol:
+// snappy-compressed protobuf WriteRequest messages sent over HTTP.
+package promremote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/adettelle/go-metric-collector/internal/ingest"
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/proto/prompb"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxDecodedSize ограничивает размер распакованного тела запроса
+const maxDecodedSize = 32 << 20
+
+// ErrNoMetricName - в запросе есть ряд без метки __name__
+var ErrNoMetricName = errors.New("time series without __name__ label")
+
+// Receiver принимает запросы remote_write и записывает последнее значение каждого ряда:
+// ряды counter метрик (по метаданным или по суффиксу _total) - через AddCounterMetric
+// в виде приращения, остальные - через AddGaugeMetric.
+// Ряд сохраняется под ключом из имени (метка __name__) и остальных меток (см. memstorage.SeriesKey),
+// метки с пустым значением пропускаются, как и в Prometheus.
+type Receiver struct {
+	writer   ingest.MetricWriter
+	counters *ingest.CumulativeCounters
+
+	mu    sync.RWMutex
+	types map[string]prompb.MetricMetadata_MetricType // тип семейства метрик из метаданных
+}
+
+func NewReceiver(writer ingest.MetricWriter) *Receiver {
+	return &Receiver{
+		writer:   writer,
+		counters: ingest.NewCumulativeCounters(),
+		types:    make(map[string]prompb.MetricMetadata_MetricType),
+	}
+}
+
+// ServeHTTP handles POST requests with a remote_write payload.
+// POST http://localhost:8080/api/v1/write
+func (rc *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	compressed, err := ingest.ReadBody(w, r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), ingest.BodyErrorStatus(err))
+		return
+	}
+
+	req, err := DecodeWriteRequest(compressed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = rc.Write(r.Context(), req)
+	if errors.Is(err, ErrNoMetricName) || errors.Is(err, memstorage.ErrInvalidMetricName) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println("error in writing remote_write metrics:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DecodeWriteRequest распаковывает (snappy, блочный формат) и разбирает WriteRequest
+func DecodeWriteRequest(compressed []byte) (*prompb.WriteRequest, error) {
+	size, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxDecodedSize {
+		return nil, fmt.Errorf("decoded size %d exceeds limit %d", size, maxDecodedSize)
+	}
+
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, err
+	}
+
+	var req prompb.WriteRequest
+	if err = proto.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// EncodeWriteRequest сериализует и сжимает WriteRequest так же, как это делает Prometheus
+func EncodeWriteRequest(req *prompb.WriteRequest) ([]byte, error) {
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return snappy.Encode(nil, data), nil
+}
+
+// Write записывает последнее значение каждого ряда в хранилище.
+// Если хотя бы у одного ряда нет имени или оно некорректно, ничего не записывается.
+func (rc *Receiver) Write(ctx context.Context, req *prompb.WriteRequest) error {
+	for _, ts := range req.Timeseries {
+		name := metricName(ts.Labels)
+		if name == "" {
+			return ErrNoMetricName
+		}
+		if err := memstorage.ValidateMetricName(name); err != nil {
+			return err
+		}
+	}
+
+	rc.mu.Lock()
+	for _, md := range req.Metadata {
+		rc.types[md.MetricFamilyName] = md.Type
+	}
+	rc.mu.Unlock()
+
+	for _, ts := range req.Timeseries {
+		name := metricName(ts.Labels)
+		sample, ok := latestSample(ts.Samples)
+		if !ok {
+			continue
+		}
+		key := memstorage.SeriesKey(name, seriesLabels(ts.Labels))
+
+		if rc.isCounter(name) {
+			delta := rc.counters.Delta(key, int64(math.Round(sample.Value)))
+			if err := rc.writer.AddCounterMetric(ctx, key, delta); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := rc.writer.AddGaugeMetric(ctx, key, sample.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rc *Receiver) isCounter(name string) bool {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+
+	if t, ok := rc.types[name]; ok {
+		return t == prompb.MetricMetadata_COUNTER
+	}
+	if t, ok := rc.types[strings.TrimSuffix(name, "_total")]; ok {
+		return t == prompb.MetricMetadata_COUNTER
+	}
+	return strings.HasSuffix(name, "_total")
+}
+
+// latestSample возвращает значение ряда с наибольшим временем,
+// пропуская NaN (в том числе маркеры устаревания рядов)
+func latestSample(samples []*prompb.Sample) (*prompb.Sample, bool) {
+	var res *prompb.Sample
+	for _, s := range samples {
+		if math.IsNaN(s.Value) {
+			continue
+		}
+		if res == nil || s.Timestamp >= res.Timestamp {
+			res = s
+		}
+	}
+	return res, res != nil
+}
+
+func metricName(labels []*prompb.Label) string {
+	for _, l := range labels {
+		if l.Name == "__name__" {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+// seriesLabels возвращает метки ряда, кроме __name__ и меток с пустым значением
+func seriesLabels(labels []*prompb.Label) memstorage.Labels {
+	res := make(memstorage.Labels)
+	for _, l := range labels {
+		if l.Name == "__name__" || l.Value == "" {
+			continue
+		}
+		res[ingest.LabelName(l.Name)] = l.Value
+	}
+	return res
+}
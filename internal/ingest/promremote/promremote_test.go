@@ -0,0 +1,155 @@
+package promremote
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/proto/prompb"
+	"github.com/stretchr/testify/require"
+)
+
+func series(name string, value float64, timestamp int64, labels ...string) *prompb.TimeSeries {
+	ts := &prompb.TimeSeries{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: name}},
+		Samples: []*prompb.Sample{{Value: value, Timestamp: timestamp}},
+	}
+	for i := 0; i+1 < len(labels); i += 2 {
+		ts.Labels = append(ts.Labels, &prompb.Label{Name: labels[i], Value: labels[i+1]})
+	}
+	return ts
+}
+
+func postWriteRequest(t *testing.T, rc *Receiver, req *prompb.WriteRequest) *httptest.ResponseRecorder {
+	body, err := EncodeWriteRequest(req)
+	require.NoError(t, err)
+
+	request, err := http.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body))
+	require.NoError(t, err)
+	request.Header.Set("Content-Encoding", "snappy")
+	request.Header.Set("Content-Type", "application/x-protobuf")
+	response := httptest.NewRecorder()
+
+	rc.ServeHTTP(response, request)
+	return response
+}
+
+func TestRemoteWrite(t *testing.T) {
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+	rc := NewReceiver(ms)
+
+	req := &prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{
+			series("HeapAlloc", 1024, 1000),
+			series("http_requests_total", 10, 1000, "instance", "a"),
+			series("http_requests_total", 5, 1000, "instance", "b"),
+			series("queue_size", 3, 1000),
+		},
+		Metadata: []*prompb.MetricMetadata{
+			{MetricFamilyName: "queue_size", Type: prompb.MetricMetadata_COUNTER},
+		},
+	}
+	req.Timeseries[0].Samples = append(req.Timeseries[0].Samples, &prompb.Sample{Value: 2048, Timestamp: 2000})
+
+	response := postWriteRequest(t, rc, req)
+	require.Equal(t, http.StatusNoContent, response.Code)
+
+	value, ok, err := ms.GetGaugeMetric(context.Background(), "HeapAlloc")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, float64(2048), value)
+
+	cMetrics, err := ms.GetAllCounterMetrics(context.Background())
+	require.NoError(t, err)
+	// первые накопленные значения - точка отсчета; ряды с разными метками хранятся отдельно
+	require.Equal(t, map[string]int64{
+		`http_requests_total{instance="a"}`: 0,
+		`http_requests_total{instance="b"}`: 0,
+		"queue_size":                        0,
+	}, cMetrics)
+
+	// накопленные значения счетчиков переводятся в приращения, сброс счетчика учитывается
+	response = postWriteRequest(t, rc, &prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{
+			series("http_requests_total", 12, 3000, "instance", "a"),
+			series("http_requests_total", 1, 3000, "instance", "b"),
+			series("HeapAlloc", math.NaN(), 3000),
+		},
+	})
+	require.Equal(t, http.StatusNoContent, response.Code)
+
+	delta, ok, err := ms.GetCounterMetric(context.Background(), `http_requests_total{instance="a"}`)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(2), delta)
+
+	delta, ok, err = ms.GetCounterMetric(context.Background(), `http_requests_total{instance="b"}`)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(1), delta)
+
+	value, _, err = ms.GetGaugeMetric(context.Background(), "HeapAlloc")
+	require.NoError(t, err)
+	require.Equal(t, float64(2048), value)
+}
+
+func TestRemoteWriteLabels(t *testing.T) {
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+	rc := NewReceiver(ms)
+
+	response := postWriteRequest(t, rc, &prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{
+			series("up", 1, 1000, "job", "api", "zone", ""),
+		},
+	})
+	require.Equal(t, http.StatusNoContent, response.Code)
+
+	// метка с пустым значением не входит в ключ
+	value, ok, err := ms.GetGaugeMetric(context.Background(), `up{job="api"}`)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, float64(1), value)
+}
+
+func TestRemoteWriteBadRequest(t *testing.T) {
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+	rc := NewReceiver(ms)
+
+	// тело не сжато snappy
+	request, err := http.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader([]byte("not a snappy payload")))
+	require.NoError(t, err)
+	response := httptest.NewRecorder()
+	rc.ServeHTTP(response, request)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	// ряд без имени метрики
+	response = postWriteRequest(t, rc, &prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{{
+			Labels:  []*prompb.Label{{Name: "instance", Value: "a"}},
+			Samples: []*prompb.Sample{{Value: 1}},
+		}},
+	})
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	// имя метрики с символами, которыми в ключе записываются метки
+	response = postWriteRequest(t, rc, &prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{{
+			Labels:  []*prompb.Label{{Name: "__name__", Value: `up{job="a"}`}},
+			Samples: []*prompb.Sample{{Value: 1}},
+		}},
+	})
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	request, err = http.NewRequest(http.MethodGet, "/api/v1/write", nil)
+	require.NoError(t, err)
+	response = httptest.NewRecorder()
+	rc.ServeHTTP(response, request)
+	require.Equal(t, http.StatusMethodNotAllowed, response.Code)
+}
@@ -0,0 +1,119 @@
+package statsd
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/adettelle/go-metric-collector/internal/ingest"
+)
+
+// Aggregator накапливает значения между сбросами (flush):
+//   - counter: сумма значений с учетом sample rate, записывается как приращение counter метрики;
+//   - gauge: последнее значение (значения со знаком +/- меняют его);
+//   - timer и histogram: записываются gauge метрики <name>.p50, <name>.p90, <name>.max и <name>.count;
+//   - set: количество уникальных значений записывается gauge метрикой <name>.count.
+type Aggregator struct {
+	mu       sync.Mutex
+	counters map[string]float64
+	gauges   map[string]float64 // последние значения gauge метрик, хранятся между сбросами
+	updated  map[string]bool    // gauge метрики, изменившиеся с прошлого сброса
+	timers   map[string][]float64
+	sets     map[string]map[string]struct{}
+}
+
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		counters: make(map[string]float64),
+		gauges:   make(map[string]float64),
+		updated:  make(map[string]bool),
+		timers:   make(map[string][]float64),
+		sets:     make(map[string]map[string]struct{}),
+	}
+}
+
+func (a *Aggregator) Add(s Sample) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch s.Type {
+	case TypeCounter:
+		a.counters[s.Name] += s.Value / s.SampleRate
+	case TypeGauge:
+		if s.Relative {
+			a.gauges[s.Name] += s.Value
+		} else {
+			a.gauges[s.Name] = s.Value
+		}
+		a.updated[s.Name] = true
+	case TypeTimer, TypeHisto:
+		a.timers[s.Name] = append(a.timers[s.Name], s.Value)
+	case TypeSet:
+		if _, ok := a.sets[s.Name]; !ok {
+			a.sets[s.Name] = make(map[string]struct{})
+		}
+		a.sets[s.Name][s.SetValue] = struct{}{}
+	}
+}
+
+// Flush записывает накопленные значения в хранилище и начинает новый интервал
+func (a *Aggregator) Flush(ctx context.Context, writer ingest.MetricWriter) error {
+	a.mu.Lock()
+	counters := a.counters
+	timers := a.timers
+	sets := a.sets
+	gauges := make(map[string]float64, len(a.updated))
+	for name := range a.updated {
+		gauges[name] = a.gauges[name]
+	}
+	a.counters = make(map[string]float64)
+	a.timers = make(map[string][]float64)
+	a.sets = make(map[string]map[string]struct{})
+	a.updated = make(map[string]bool)
+	a.mu.Unlock()
+
+	for name, value := range counters {
+		if err := writer.AddCounterMetric(ctx, name, int64(math.Round(value))); err != nil {
+			return err
+		}
+	}
+
+	for name, value := range gauges {
+		if err := writer.AddGaugeMetric(ctx, name, value); err != nil {
+			return err
+		}
+	}
+
+	for name, values := range timers {
+		sort.Float64s(values)
+		stats := map[string]float64{
+			name + ".p50":   percentile(values, 50),
+			name + ".p90":   percentile(values, 90),
+			name + ".max":   values[len(values)-1],
+			name + ".count": float64(len(values)),
+		}
+		for statName, value := range stats {
+			if err := writer.AddGaugeMetric(ctx, statName, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name, values := range sets {
+		if err := writer.AddGaugeMetric(ctx, name+".count", float64(len(values))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// percentile считает перцентиль отсортированных значений методом ближайшего ранга
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,72 @@
+package statsd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParse(t *testing.T, lines ...string) []Sample {
+	var res []Sample
+	for _, line := range lines {
+		s, err := ParseLine(line)
+		require.NoError(t, err)
+		res = append(res, s)
+	}
+	return res
+}
+
+func TestAggregatorFlush(t *testing.T) {
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+
+	a := NewAggregator()
+	for _, s := range mustParse(t,
+		"requests:1|c",
+		"requests:2|c|@0.5",
+		"temperature:20|g",
+		"temperature:+5|g",
+		"users:alice|s",
+		"users:bob|s",
+		"users:alice|s",
+	) {
+		a.Add(s)
+	}
+	for i := 1; i <= 10; i++ {
+		a.Add(Sample{Name: "latency", Type: TypeTimer, Value: float64(i * 10), SampleRate: 1})
+	}
+
+	err = a.Flush(context.Background(), ms)
+	require.NoError(t, err)
+
+	cMetrics, err := ms.GetAllCounterMetrics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"requests": 5}, cMetrics)
+
+	gMetrics, err := ms.GetAllGaugeMetrics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{
+		"temperature":   25,
+		"latency.p50":   50,
+		"latency.p90":   90,
+		"latency.max":   100,
+		"latency.count": 10,
+		"users.count":   2,
+	}, gMetrics)
+
+	// после сброса накопленные значения не записываются повторно,
+	// а относительные изменения gauge применяются к последнему значению
+	a.Add(Sample{Name: "temperature", Type: TypeGauge, Value: -10, SampleRate: 1, Relative: true})
+	err = a.Flush(context.Background(), ms)
+	require.NoError(t, err)
+
+	cMetrics, err = ms.GetAllCounterMetrics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"requests": 5}, cMetrics)
+
+	value, _, err := ms.GetGaugeMetric(context.Background(), "temperature")
+	require.NoError(t, err)
+	require.Equal(t, float64(15), value)
+}
@@ -0,0 +1,84 @@
+// Package statsd implements a StatsD listener: it parses StatsD lines received
+// over UDP and TCP, aggregates them during the flush interval and writes
+// the results into the server storage.
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+)
+
+// типы метрик StatsD
+const (
+	TypeCounter = "c"
+	TypeGauge   = "g"
+	TypeTimer   = "ms"
+	TypeHisto   = "h" // гистограммы обрабатываются так же, как таймеры
+	TypeSet     = "s"
+)
+
+// Sample - одна разобранная строка протокола StatsD: name:value|type[|@rate][|#tags]
+type Sample struct {
+	Name       string
+	Type       string
+	Value      float64
+	SetValue   string  // значение для типа s (элемент множества)
+	SampleRate float64 // доля отправленных значений, 1 если не указана
+	Relative   bool    // для gauge: значение со знаком +/- меняет текущее значение
+}
+
+// ParseLine разбирает строку протокола StatsD. Теги (|#tag:value) пропускаются.
+func ParseLine(line string) (Sample, error) {
+	s := Sample{SampleRate: 1}
+
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return s, fmt.Errorf("invalid statsd line %q: no metric name", line)
+	}
+	if err := memstorage.ValidateMetricName(name); err != nil {
+		return s, fmt.Errorf("invalid statsd line %q: %w", line, err)
+	}
+	s.Name = name
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return s, fmt.Errorf("invalid statsd line %q: no metric type", line)
+	}
+	rawValue := parts[0]
+	s.Type = parts[1]
+
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return s, fmt.Errorf("invalid statsd line %q: invalid sample rate", line)
+			}
+			s.SampleRate = rate
+		case strings.HasPrefix(part, "#"):
+		default:
+			return s, fmt.Errorf("invalid statsd line %q: unknown section %q", line, part)
+		}
+	}
+
+	switch s.Type {
+	case TypeSet:
+		s.SetValue = rawValue
+		return s, nil
+	case TypeCounter, TypeGauge, TypeTimer, TypeHisto:
+	default:
+		return s, fmt.Errorf("invalid statsd line %q: unknown metric type %q", line, s.Type)
+	}
+
+	value, err := strconv.ParseFloat(rawValue, 64)
+	if err != nil {
+		return s, fmt.Errorf("invalid statsd line %q: %w", line, err)
+	}
+	s.Value = value
+	s.Relative = s.Type == TypeGauge && (strings.HasPrefix(rawValue, "+") || strings.HasPrefix(rawValue, "-"))
+
+	return s, nil
+}
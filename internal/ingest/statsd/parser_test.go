@@ -0,0 +1,45 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected Sample
+	}{
+		{"requests:1|c", Sample{Name: "requests", Type: TypeCounter, Value: 1, SampleRate: 1}},
+		{"requests:3|c|@0.1", Sample{Name: "requests", Type: TypeCounter, Value: 3, SampleRate: 0.1}},
+		{"cpu.load:12.3|g", Sample{Name: "cpu.load", Type: TypeGauge, Value: 12.3, SampleRate: 1}},
+		{"cpu.load:-2|g", Sample{Name: "cpu.load", Type: TypeGauge, Value: -2, SampleRate: 1, Relative: true}},
+		{"latency:320|ms|#env:prod", Sample{Name: "latency", Type: TypeTimer, Value: 320, SampleRate: 1}},
+		{"size:5|h", Sample{Name: "size", Type: TypeHisto, Value: 5, SampleRate: 1}},
+		{"users:alice|s", Sample{Name: "users", Type: TypeSet, SetValue: "alice", SampleRate: 1}},
+	}
+
+	for _, test := range tests {
+		res, err := ParseLine(test.line)
+		require.NoError(t, err, test.line)
+		require.Equal(t, test.expected, res, test.line)
+	}
+}
+
+func TestParseLineInvalid(t *testing.T) {
+	lines := []string{
+		"requests",
+		":1|c",
+		"requests:1",
+		"requests:abc|c",
+		"requests:1|x",
+		"requests:1|c|@2",
+		"requests:1|c|junk",
+		`requests{host="a"}:1|c`,
+	}
+	for _, line := range lines {
+		_, err := ParseLine(line)
+		require.Error(t, err, line)
+	}
+}
@@ -0,0 +1,179 @@
+package statsd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/internal/ingest"
+)
+
+// maxPacketSize - максимальный размер UDP пакета
+const maxPacketSize = 65535
+
+// Server слушает StatsD по UDP и TCP на одном адресе и раз в flushInterval
+// записывает накопленные значения в хранилище.
+type Server struct {
+	addr          string
+	flushInterval time.Duration
+	writer        ingest.MetricWriter
+	aggregator    *Aggregator
+
+	udpConn     net.PacketConn
+	tcpListener net.Listener
+	done        chan struct{}
+	wg          sync.WaitGroup
+}
+
+func NewServer(addr string, flushInterval time.Duration, writer ingest.MetricWriter) *Server {
+	return &Server{
+		addr:          addr,
+		flushInterval: flushInterval,
+		writer:        writer,
+		aggregator:    NewAggregator(),
+		done:          make(chan struct{}),
+	}
+}
+
+// Start открывает UDP и TCP порты и запускает обработку в отдельных горутинах
+func (s *Server) Start() error {
+	var err error
+
+	s.udpConn, err = net.ListenPacket("udp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.tcpListener, err = net.Listen("tcp", s.addr)
+	if err != nil {
+		s.udpConn.Close()
+		return err
+	}
+	log.Printf("Starting statsd server on %s", s.addr)
+
+	s.wg.Add(3)
+	go s.serveUDP()
+	go s.serveTCP()
+	go s.flushLoop()
+
+	return nil
+}
+
+// UDPAddr и TCPAddr возвращают фактические адреса (полезно, если был указан порт 0)
+func (s *Server) UDPAddr() net.Addr {
+	return s.udpConn.LocalAddr()
+}
+
+func (s *Server) TCPAddr() net.Addr {
+	return s.tcpListener.Addr()
+}
+
+// Shutdown закрывает порты, дожидается завершения обработки и записывает
+// в хранилище значения, накопленные с последнего сброса
+func (s *Server) Shutdown() error {
+	close(s.done)
+	s.udpConn.Close()
+	s.tcpListener.Close()
+	s.wg.Wait()
+
+	// накопленные значения уже приняты, поэтому их сброс не отменяется
+	return s.aggregator.Flush(context.Background(), s.writer)
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := s.udpConn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Println("error in reading statsd packet:", err)
+			continue
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			s.handleLine(line)
+		}
+	}
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+
+	var conns sync.WaitGroup
+	defer conns.Wait()
+
+	for {
+		conn, err := s.tcpListener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Println("error in accepting statsd connection:", err)
+			continue
+		}
+
+		conns.Add(1)
+		go func() {
+			defer conns.Done()
+			s.serveConn(conn)
+		}()
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	// при остановке сервера закрываем соединение, чтобы прервать чтение
+	closed := make(chan struct{})
+	defer close(closed)
+	go func() {
+		select {
+		case <-s.done:
+			conn.Close()
+		case <-closed:
+		}
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		s.handleLine(scanner.Text())
+	}
+}
+
+func (s *Server) handleLine(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	sample, err := ParseLine(line)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	s.aggregator.Add(sample)
+}
+
+func (s *Server) flushLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.aggregator.Flush(context.Background(), s.writer); err != nil {
+				log.Println("error in flushing statsd metrics:", err)
+			}
+		}
+	}
+}
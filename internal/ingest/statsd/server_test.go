@@ -0,0 +1,46 @@
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+
+	srv := NewServer("127.0.0.1:0", time.Hour, ms)
+	require.NoError(t, srv.Start())
+
+	udpConn, err := net.Dial("udp", srv.UDPAddr().String())
+	require.NoError(t, err)
+	defer udpConn.Close()
+	_, err = fmt.Fprint(udpConn, "requests:1|c\nrequests:2|c\ntemperature:21.5|g")
+	require.NoError(t, err)
+
+	tcpConn, err := net.Dial("tcp", srv.TCPAddr().String())
+	require.NoError(t, err)
+	defer tcpConn.Close()
+	_, err = fmt.Fprint(tcpConn, "requests:4|c\nbroken line\n")
+	require.NoError(t, err)
+
+	// даем серверу время прочитать данные; Shutdown записывает накопленное в хранилище
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, srv.Shutdown())
+
+	delta, ok, err := ms.GetCounterMetric(context.Background(), "requests")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(7), delta)
+
+	value, ok, err := ms.GetGaugeMetric(context.Background(), "temperature")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 21.5, value)
+}
@@ -0,0 +1 @@
+drop table metric_sample;
\ No newline at end of file
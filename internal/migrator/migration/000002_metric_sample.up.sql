@@ -0,0 +1,8 @@
+create table metric_sample
+(id bigserial primary key,
+metric_type text not null,
+metric_id varchar(30) not null,
+value double precision not null,
+created_at timestamptz not null default now());
+
+create index metric_sample_lookup_idx on metric_sample (metric_type, metric_id, created_at);
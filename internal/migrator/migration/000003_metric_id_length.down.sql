@@ -0,0 +1,2 @@
+alter table metric_sample alter column metric_id type varchar(30);
+alter table metric alter column metric_id type varchar(30);
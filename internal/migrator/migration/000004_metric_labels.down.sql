@@ -0,0 +1,9 @@
+drop index metric_sample_lookup_idx;
+delete from metric_sample where labels <> '{}';
+alter table metric_sample drop column labels;
+create index metric_sample_lookup_idx on metric_sample (metric_type, metric_id, created_at);
+
+delete from metric where labels <> '{}';
+alter table metric drop constraint metric_metric_id_metric_type_labels_key;
+alter table metric add constraint metric_metric_id_metric_type_key unique (metric_id, metric_type);
+alter table metric drop column labels;
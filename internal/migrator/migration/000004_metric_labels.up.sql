@@ -0,0 +1,7 @@
+alter table metric add column labels jsonb not null default '{}';
+alter table metric drop constraint metric_metric_id_metric_type_key;
+alter table metric add constraint metric_metric_id_metric_type_labels_key unique (metric_id, metric_type, labels);
+
+alter table metric_sample add column labels jsonb not null default '{}';
+drop index metric_sample_lookup_idx;
+create index metric_sample_lookup_idx on metric_sample (metric_type, metric_id, labels, created_at);
@@ -0,0 +1,2 @@
+delete from metric where metric_type = 'histogram';
+alter table metric drop column histogram;
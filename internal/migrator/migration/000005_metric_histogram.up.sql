@@ -0,0 +1 @@
+alter table metric add column histogram jsonb;
@@ -0,0 +1,2 @@
+delete from metric where metric_type = 'summary';
+alter table metric drop column summary;
@@ -0,0 +1 @@
+alter table metric add column summary jsonb;
@@ -0,0 +1,2 @@
+drop index metric_updated_at_idx;
+alter table metric drop column updated_at;
@@ -0,0 +1,2 @@
+alter table metric add column updated_at timestamptz not null default now();
+create index metric_updated_at_idx on metric (updated_at);
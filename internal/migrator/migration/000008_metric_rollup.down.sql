@@ -0,0 +1,2 @@
+drop index metric_sample_created_at_idx;
+drop table metric_rollup;
@@ -0,0 +1,15 @@
+create table metric_rollup
+(metric_type text not null,
+metric_id varchar(255) not null,
+labels jsonb not null default '{}',
+resolution integer not null,
+bucket timestamptz not null,
+min double precision not null,
+max double precision not null,
+sum double precision not null,
+count bigint not null,
+last double precision not null,
+primary key (metric_type, metric_id, labels, resolution, bucket));
+
+create index metric_rollup_bucket_idx on metric_rollup (resolution, bucket);
+create index metric_sample_created_at_idx on metric_sample (created_at);
@@ -5,8 +5,12 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
+	time "time"
 
+	memstorage "github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	ddsketch "github.com/adettelle/go-metric-collector/pkg/ddsketch"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -34,81 +38,227 @@ func (m *MockStorager) EXPECT() *MockStoragerMockRecorder {
 }
 
 // AddCounterMetric mocks base method.
-func (m *MockStorager) AddCounterMetric(arg0 string, arg1 int64) error {
+func (m *MockStorager) AddCounterMetric(arg0 context.Context, arg1 string, arg2 int64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddCounterMetric", arg0, arg1)
+	ret := m.ctrl.Call(m, "AddCounterMetric", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // AddCounterMetric indicates an expected call of AddCounterMetric.
-func (mr *MockStoragerMockRecorder) AddCounterMetric(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockStoragerMockRecorder) AddCounterMetric(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddCounterMetric", reflect.TypeOf((*MockStorager)(nil).AddCounterMetric), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddCounterMetric", reflect.TypeOf((*MockStorager)(nil).AddCounterMetric), arg0, arg1, arg2)
 }
 
 // AddGaugeMetric mocks base method.
-func (m *MockStorager) AddGaugeMetric(arg0 string, arg1 float64) error {
+func (m *MockStorager) AddGaugeMetric(arg0 context.Context, arg1 string, arg2 float64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddGaugeMetric", arg0, arg1)
+	ret := m.ctrl.Call(m, "AddGaugeMetric", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // AddGaugeMetric indicates an expected call of AddGaugeMetric.
-func (mr *MockStoragerMockRecorder) AddGaugeMetric(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockStoragerMockRecorder) AddGaugeMetric(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddGaugeMetric", reflect.TypeOf((*MockStorager)(nil).AddGaugeMetric), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddGaugeMetric", reflect.TypeOf((*MockStorager)(nil).AddGaugeMetric), arg0, arg1, arg2)
+}
+
+// AddHistogramMetric mocks base method.
+func (m *MockStorager) AddHistogramMetric(arg0 context.Context, arg1 string, arg2 memstorage.Histogram) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddHistogramMetric", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddHistogramMetric indicates an expected call of AddHistogramMetric.
+func (mr *MockStoragerMockRecorder) AddHistogramMetric(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddHistogramMetric", reflect.TypeOf((*MockStorager)(nil).AddHistogramMetric), arg0, arg1, arg2)
+}
+
+// AddMetrics mocks base method.
+func (m *MockStorager) AddMetrics(arg0 context.Context, arg1 []memstorage.Metric) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddMetrics", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddMetrics indicates an expected call of AddMetrics.
+func (mr *MockStoragerMockRecorder) AddMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddMetrics", reflect.TypeOf((*MockStorager)(nil).AddMetrics), arg0, arg1)
+}
+
+// AddSummaryMetric mocks base method.
+func (m *MockStorager) AddSummaryMetric(arg0 context.Context, arg1 string, arg2 *ddsketch.Sketch) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddSummaryMetric", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddSummaryMetric indicates an expected call of AddSummaryMetric.
+func (mr *MockStoragerMockRecorder) AddSummaryMetric(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddSummaryMetric", reflect.TypeOf((*MockStorager)(nil).AddSummaryMetric), arg0, arg1, arg2)
+}
+
+// Compact mocks base method.
+func (m *MockStorager) Compact(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Compact", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Compact indicates an expected call of Compact.
+func (mr *MockStoragerMockRecorder) Compact(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Compact", reflect.TypeOf((*MockStorager)(nil).Compact), arg0)
+}
+
+// DeleteMetric mocks base method.
+func (m *MockStorager) DeleteMetric(arg0 context.Context, arg1, arg2 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMetric", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteMetric indicates an expected call of DeleteMetric.
+func (mr *MockStoragerMockRecorder) DeleteMetric(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMetric", reflect.TypeOf((*MockStorager)(nil).DeleteMetric), arg0, arg1, arg2)
+}
+
+// DeleteMetrics mocks base method.
+func (m *MockStorager) DeleteMetrics(arg0 context.Context, arg1 []memstorage.Metric) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMetrics", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteMetrics indicates an expected call of DeleteMetrics.
+func (mr *MockStoragerMockRecorder) DeleteMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMetrics", reflect.TypeOf((*MockStorager)(nil).DeleteMetrics), arg0, arg1)
+}
+
+// DeleteStaleMetrics mocks base method.
+func (m *MockStorager) DeleteStaleMetrics(arg0 context.Context, arg1 time.Duration) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteStaleMetrics", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteStaleMetrics indicates an expected call of DeleteStaleMetrics.
+func (mr *MockStoragerMockRecorder) DeleteStaleMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteStaleMetrics", reflect.TypeOf((*MockStorager)(nil).DeleteStaleMetrics), arg0, arg1)
 }
 
 // Finalize mocks base method.
-func (m *MockStorager) Finalize() error {
+func (m *MockStorager) Finalize(arg0 context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Finalize")
+	ret := m.ctrl.Call(m, "Finalize", arg0)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Finalize indicates an expected call of Finalize.
-func (mr *MockStoragerMockRecorder) Finalize() *gomock.Call {
+func (mr *MockStoragerMockRecorder) Finalize(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Finalize", reflect.TypeOf((*MockStorager)(nil).Finalize))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Finalize", reflect.TypeOf((*MockStorager)(nil).Finalize), arg0)
 }
 
 // GetAllCounterMetrics mocks base method.
-func (m *MockStorager) GetAllCounterMetrics() (map[string]int64, error) {
+func (m *MockStorager) GetAllCounterMetrics(arg0 context.Context) (map[string]int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllCounterMetrics")
+	ret := m.ctrl.Call(m, "GetAllCounterMetrics", arg0)
 	ret0, _ := ret[0].(map[string]int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAllCounterMetrics indicates an expected call of GetAllCounterMetrics.
-func (mr *MockStoragerMockRecorder) GetAllCounterMetrics() *gomock.Call {
+func (mr *MockStoragerMockRecorder) GetAllCounterMetrics(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllCounterMetrics", reflect.TypeOf((*MockStorager)(nil).GetAllCounterMetrics))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllCounterMetrics", reflect.TypeOf((*MockStorager)(nil).GetAllCounterMetrics), arg0)
 }
 
 // GetAllGaugeMetrics mocks base method.
-func (m *MockStorager) GetAllGaugeMetrics() (map[string]float64, error) {
+func (m *MockStorager) GetAllGaugeMetrics(arg0 context.Context) (map[string]float64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllGaugeMetrics")
+	ret := m.ctrl.Call(m, "GetAllGaugeMetrics", arg0)
 	ret0, _ := ret[0].(map[string]float64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAllGaugeMetrics indicates an expected call of GetAllGaugeMetrics.
-func (mr *MockStoragerMockRecorder) GetAllGaugeMetrics() *gomock.Call {
+func (mr *MockStoragerMockRecorder) GetAllGaugeMetrics(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllGaugeMetrics", reflect.TypeOf((*MockStorager)(nil).GetAllGaugeMetrics), arg0)
+}
+
+// GetAllHistogramMetrics mocks base method.
+func (m *MockStorager) GetAllHistogramMetrics(arg0 context.Context) (map[string]memstorage.Histogram, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllHistogramMetrics", arg0)
+	ret0, _ := ret[0].(map[string]memstorage.Histogram)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAllHistogramMetrics indicates an expected call of GetAllHistogramMetrics.
+func (mr *MockStoragerMockRecorder) GetAllHistogramMetrics(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllHistogramMetrics", reflect.TypeOf((*MockStorager)(nil).GetAllHistogramMetrics), arg0)
+}
+
+// GetAllSummaryMetrics mocks base method.
+func (m *MockStorager) GetAllSummaryMetrics(arg0 context.Context) (map[string]*ddsketch.Sketch, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllSummaryMetrics", arg0)
+	ret0, _ := ret[0].(map[string]*ddsketch.Sketch)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAllSummaryMetrics indicates an expected call of GetAllSummaryMetrics.
+func (mr *MockStoragerMockRecorder) GetAllSummaryMetrics(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllGaugeMetrics", reflect.TypeOf((*MockStorager)(nil).GetAllGaugeMetrics))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllSummaryMetrics", reflect.TypeOf((*MockStorager)(nil).GetAllSummaryMetrics), arg0)
+}
+
+// GetCounterHistory mocks base method.
+func (m *MockStorager) GetCounterHistory(arg0 context.Context, arg1 string, arg2, arg3 time.Time) ([]memstorage.Sample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCounterHistory", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]memstorage.Sample)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCounterHistory indicates an expected call of GetCounterHistory.
+func (mr *MockStoragerMockRecorder) GetCounterHistory(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCounterHistory", reflect.TypeOf((*MockStorager)(nil).GetCounterHistory), arg0, arg1, arg2, arg3)
 }
 
 // GetCounterMetric mocks base method.
-func (m *MockStorager) GetCounterMetric(arg0 string) (int64, bool, error) {
+func (m *MockStorager) GetCounterMetric(arg0 context.Context, arg1 string) (int64, bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetCounterMetric", arg0)
+	ret := m.ctrl.Call(m, "GetCounterMetric", arg0, arg1)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(bool)
 	ret2, _ := ret[2].(error)
@@ -116,15 +266,30 @@ func (m *MockStorager) GetCounterMetric(arg0 string) (int64, bool, error) {
 }
 
 // GetCounterMetric indicates an expected call of GetCounterMetric.
-func (mr *MockStoragerMockRecorder) GetCounterMetric(arg0 interface{}) *gomock.Call {
+func (mr *MockStoragerMockRecorder) GetCounterMetric(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCounterMetric", reflect.TypeOf((*MockStorager)(nil).GetCounterMetric), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCounterMetric", reflect.TypeOf((*MockStorager)(nil).GetCounterMetric), arg0, arg1)
+}
+
+// GetGaugeHistory mocks base method.
+func (m *MockStorager) GetGaugeHistory(arg0 context.Context, arg1 string, arg2, arg3 time.Time) ([]memstorage.Sample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGaugeHistory", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]memstorage.Sample)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGaugeHistory indicates an expected call of GetGaugeHistory.
+func (mr *MockStoragerMockRecorder) GetGaugeHistory(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGaugeHistory", reflect.TypeOf((*MockStorager)(nil).GetGaugeHistory), arg0, arg1, arg2, arg3)
 }
 
 // GetGaugeMetric mocks base method.
-func (m *MockStorager) GetGaugeMetric(arg0 string) (float64, bool, error) {
+func (m *MockStorager) GetGaugeMetric(arg0 context.Context, arg1 string) (float64, bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetGaugeMetric", arg0)
+	ret := m.ctrl.Call(m, "GetGaugeMetric", arg0, arg1)
 	ret0, _ := ret[0].(float64)
 	ret1, _ := ret[1].(bool)
 	ret2, _ := ret[2].(error)
@@ -132,7 +297,70 @@ func (m *MockStorager) GetGaugeMetric(arg0 string) (float64, bool, error) {
 }
 
 // GetGaugeMetric indicates an expected call of GetGaugeMetric.
-func (mr *MockStoragerMockRecorder) GetGaugeMetric(arg0 interface{}) *gomock.Call {
+func (mr *MockStoragerMockRecorder) GetGaugeMetric(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGaugeMetric", reflect.TypeOf((*MockStorager)(nil).GetGaugeMetric), arg0, arg1)
+}
+
+// GetHistogramMetric mocks base method.
+func (m *MockStorager) GetHistogramMetric(arg0 context.Context, arg1 string) (memstorage.Histogram, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistogramMetric", arg0, arg1)
+	ret0, _ := ret[0].(memstorage.Histogram)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetHistogramMetric indicates an expected call of GetHistogramMetric.
+func (mr *MockStoragerMockRecorder) GetHistogramMetric(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistogramMetric", reflect.TypeOf((*MockStorager)(nil).GetHistogramMetric), arg0, arg1)
+}
+
+// GetRollups mocks base method.
+func (m *MockStorager) GetRollups(arg0 context.Context, arg1, arg2 string, arg3 time.Duration, arg4, arg5 time.Time) ([]memstorage.Rollup, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRollups", arg0, arg1, arg2, arg3, arg4, arg5)
+	ret0, _ := ret[0].([]memstorage.Rollup)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRollups indicates an expected call of GetRollups.
+func (mr *MockStoragerMockRecorder) GetRollups(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRollups", reflect.TypeOf((*MockStorager)(nil).GetRollups), arg0, arg1, arg2, arg3, arg4, arg5)
+}
+
+// GetSummaryMetric mocks base method.
+func (m *MockStorager) GetSummaryMetric(arg0 context.Context, arg1 string) (*ddsketch.Sketch, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSummaryMetric", arg0, arg1)
+	ret0, _ := ret[0].(*ddsketch.Sketch)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetSummaryMetric indicates an expected call of GetSummaryMetric.
+func (mr *MockStoragerMockRecorder) GetSummaryMetric(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSummaryMetric", reflect.TypeOf((*MockStorager)(nil).GetSummaryMetric), arg0, arg1)
+}
+
+// ListMetrics mocks base method.
+func (m *MockStorager) ListMetrics(arg0 context.Context, arg1 memstorage.ListQuery) ([]memstorage.Metric, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMetrics", arg0, arg1)
+	ret0, _ := ret[0].([]memstorage.Metric)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListMetrics indicates an expected call of ListMetrics.
+func (mr *MockStoragerMockRecorder) ListMetrics(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGaugeMetric", reflect.TypeOf((*MockStorager)(nil).GetGaugeMetric), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMetrics", reflect.TypeOf((*MockStorager)(nil).ListMetrics), arg0, arg1)
 }
@@ -0,0 +1,95 @@
+// Package agents keeps track of the agents that report metrics to the server:
+// when each agent was last seen, from which address and which metrics it sent.
+package agents
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Agent - сведения об агенте, полученные с последним пакетом метрик
+type Agent struct {
+	ID       string    `json:"id"`
+	Addr     string    `json:"addr"`      // адрес, с которого пришел пакет
+	LastSeen time.Time `json:"last_seen"` // время последнего пакета
+	Metrics  []string  `json:"metrics"`   // ключи метрик из последнего пакета, упорядоченные по имени
+}
+
+// MaxAgents - сколько агентов хранит Registry, созданный NewRegistry
+const MaxAgents = 10000
+
+// Registry хранит сведения об агентах в памяти сервера.
+// Агентов не больше limit: при переполнении забывается агент, который молчит дольше всех.
+type Registry struct {
+	mu     sync.RWMutex
+	agents map[string]Agent
+	limit  int
+	now    func() time.Time
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		agents: make(map[string]Agent),
+		limit:  MaxAgents,
+		now:    time.Now,
+	}
+}
+
+// Seen отмечает, что агент id прислал пакет с метриками metrics с адреса addr
+func (r *Registry) Seen(id string, addr string, metrics []string) {
+	sorted := make([]string, len(metrics))
+	copy(sorted, metrics)
+	sort.Strings(sorted)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.agents[id]; !ok && len(r.agents) >= r.limit {
+		r.evictOldest()
+	}
+	r.agents[id] = Agent{
+		ID:       id,
+		Addr:     addr,
+		LastSeen: r.now(),
+		Metrics:  sorted,
+	}
+}
+
+// evictOldest удаляет агента с самым давним пакетом; вызывается под r.mu
+func (r *Registry) evictOldest() {
+	var oldest Agent
+	found := false
+	for _, a := range r.agents {
+		if !found || a.LastSeen.Before(oldest.LastSeen) {
+			oldest, found = a, true
+		}
+	}
+	delete(r.agents, oldest.ID)
+}
+
+// List возвращает всех агентов, упорядоченных по ID
+func (r *Registry) List() []Agent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]Agent, 0, len(r.agents))
+	for _, a := range r.agents {
+		res = append(res, a)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// Silent возвращает агентов, от которых не было пакетов дольше, чем period
+func (r *Registry) Silent(period time.Duration) []Agent {
+	deadline := r.now().Add(-period)
+
+	res := []Agent{}
+	for _, a := range r.List() {
+		if a.LastSeen.Before(deadline) {
+			res = append(res, a)
+		}
+	}
+	return res
+}
@@ -0,0 +1,54 @@
+package agents
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	now := time.Unix(1700000000, 0)
+	r.now = func() time.Time { return now }
+
+	r.Seen("b", "10.0.0.2", []string{"PollCount", "HeapAlloc"})
+	now = now.Add(time.Minute)
+	r.Seen("a", "10.0.0.1", []string{"Alloc"})
+
+	require.Equal(t, []Agent{
+		{ID: "a", Addr: "10.0.0.1", LastSeen: time.Unix(1700000060, 0), Metrics: []string{"Alloc"}},
+		{ID: "b", Addr: "10.0.0.2", LastSeen: time.Unix(1700000000, 0), Metrics: []string{"HeapAlloc", "PollCount"}},
+	}, r.List())
+
+	// агент b молчит дольше 30 секунд
+	silent := r.Silent(30 * time.Second)
+	require.Len(t, silent, 1)
+	require.Equal(t, "b", silent[0].ID)
+
+	// новый пакет обновляет время и список метрик
+	r.Seen("b", "10.0.0.3", []string{"Alloc"})
+	require.Empty(t, r.Silent(30*time.Second))
+	require.Equal(t, "10.0.0.3", r.List()[1].Addr)
+}
+
+func TestRegistryLimit(t *testing.T) {
+	r := NewRegistry()
+	r.limit = 2
+	now := time.Unix(1700000000, 0)
+	r.now = func() time.Time { return now }
+
+	r.Seen("a", "10.0.0.1", nil)
+	now = now.Add(time.Minute)
+	r.Seen("b", "10.0.0.2", nil)
+	now = now.Add(time.Minute)
+	r.Seen("a", "10.0.0.1", nil) // известный агент не вытесняет других
+
+	// новый агент вытесняет агента, который молчит дольше всех
+	now = now.Add(time.Minute)
+	r.Seen("c", "10.0.0.3", nil)
+	list := r.List()
+	require.Len(t, list, 2)
+	require.Equal(t, "a", list[0].ID)
+	require.Equal(t, "c", list[1].ID)
+}
@@ -10,6 +10,7 @@ import (
 	"strconv"
 
 	"github.com/adettelle/go-metric-collector/internal/helpers"
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
 )
 
 const (
@@ -18,6 +19,14 @@ const (
 	defaultStoragePath  = "/tmp/metrics-db.json"
 	defaultRestore      = true
 	defaultDBParams     = "host=localhost port=5433 user=postgres password=password dbname=metrics-test sslmode=disable"
+	// как часто накопленные StatsD метрики записываются в хранилище, сек
+	defaultStatsdFlushInterval = 10
+	// как часто пересчитываются агрегаты истории и удаляется устаревшая история, сек
+	defaultCompactionInterval = 60
+	// сколько может длиться один запрос к хранилищу, сек
+	defaultQueryTimeout = 10
+	// слепки по умолчанию не сжимаются
+	defaultSnapshotCompression = string(memstorage.CompressionNone)
 )
 
 type Config struct {
@@ -30,8 +39,33 @@ type Config struct {
 	Cert          string `json:"cert"`           // путь до сертификата шифрования
 	TrustedSubnet string `json:"trusted_subnet"` // строковое представление бесклассовой адресации (CIDR)
 	GrpcPort      string `json:"grpc_port"`      // порт, на котором старует grpc сервер
-	StoreInterval int    `json:"store_interval"` // по умолчанию 300 сек
-	Restore       bool   `json:"restore"`        // по умолчанию true
+	// путь до файла встроенной базы bbolt; если задан, метрики хранятся в нем, а не в Postgres или в памяти
+	EmbeddedDBPath string `json:"embedded_db_file"`
+	// адрес, на котором слушается StatsD по UDP и TCP (если не указан, StatsD не запускается)
+	StatsdAddress string `json:"statsd_address"`
+	// адрес, на котором по TCP принимается протокол Graphite (если не указан, прием не запускается)
+	GraphiteAddress     string `json:"graphite_address"`
+	StoreInterval       int    `json:"store_interval"`        // по умолчанию 300 сек
+	StatsdFlushInterval int    `json:"statsd_flush_interval"` // по умолчанию 10 сек
+	Restore             bool   `json:"restore"`               // по умолчанию true
+	// сохранять целочисленные поля протокола InfluxDB как counter метрики, а не как gauge
+	InfluxIntegerCounters bool `json:"influx_integer_counters"`
+	// через сколько секунд без обновлений метрика удаляется из хранилища (0 - не удаляется)
+	MetricTTL int `json:"metric_ttl"`
+	// сроки хранения истории в секундах: исходных значений, минутных и часовых агрегатов
+	// (0 - по умолчанию сутки, 30 дней и год соответственно)
+	RetentionRaw       int `json:"retention_raw"`
+	RetentionMinute    int `json:"retention_minute"`
+	RetentionHour      int `json:"retention_hour"`
+	CompactionInterval int `json:"compaction_interval"` // по умолчанию 60 сек
+	// ограничение времени одного запроса к БД в секундах (по умолчанию 10 сек);
+	// кроме того, запрос отменяется вместе с запросом клиента
+	QueryTimeout int `json:"query_timeout"`
+	// сжатие файла слепка: none, gzip или zstd (по умолчанию none)
+	SnapshotCompression string `json:"snapshot_compression"`
+	// сохранять метрики агентов с меткой agent_id (по умолчанию выключено: метки меняют ключи метрик,
+	// и клиенты, читающие метрики без меток, перестают их находить)
+	StampAgentID bool `json:"stamp_agent_id"`
 }
 
 func initFlags() *Config {
@@ -43,9 +77,22 @@ func initFlags() *Config {
 	flagKey := flag.String("k", "", "secret key")
 	flagCryptoKey := flag.String("crypto-key", "", "path to file with private key")
 	flagCert := flag.String("cert", "", "path to file with certificate")
+	flagEmbeddedDBPath := flag.String("embedded-db", "", "embedded bbolt database file path")
 	flagConfig := flag.String("config", "", "path to file with config parametrs")
 	flagTrustedSubnet := flag.String("t", "", "classless inter-domain routing")
 	flagGrpcPort := flag.String("grpcport", "3200", "grpc server port")
+	flagStatsdAddress := flag.String("statsd", "", "statsd listen address host:port (udp and tcp)")
+	flagStatsdFlushInterval := flag.Int("statsd-flush", 0, "statsd flush interval, seconds")
+	flagGraphiteAddress := flag.String("graphite", "", "graphite plaintext listen address host:port (tcp)")
+	flagMetricTTL := flag.Int("ttl", 0, "delete metrics not updated for this many seconds (0 disables expiry)")
+	flagRetentionRaw := flag.Int("retention-raw", 0, "raw history retention, seconds")
+	flagRetentionMinute := flag.Int("retention-1m", 0, "1-minute rollups retention, seconds")
+	flagRetentionHour := flag.Int("retention-1h", 0, "1-hour rollups retention, seconds")
+	flagCompactionInterval := flag.Int("compaction-interval", 0, "history compaction interval, seconds")
+	flagQueryTimeout := flag.Int("query-timeout", 0, "storage query timeout, seconds")
+	flagSnapshotCompression := flag.String("snapshot-compression", "", "file storage snapshot compression: none, gzip or zstd")
+	flagInfluxIntegerCounters := flag.Bool("influx-int-counters", false, "store integer influx fields as counters")
+	flagStampAgentID := flag.Bool("stamp-agent-id", false, "store agent metrics with the agent_id label")
 
 	flag.Parse()
 
@@ -61,6 +108,24 @@ func initFlags() *Config {
 		Config:        getConfig(flagConfig),
 		TrustedSubnet: getTrustedSubnet(flagTrustedSubnet),
 		GrpcPort:      getGrpcPort(flagGrpcPort),
+
+		StatsdAddress:       getStatsdAddress(flagStatsdAddress),
+		StatsdFlushInterval: getStatsdFlushInterval(flagStatsdFlushInterval),
+		GraphiteAddress:     getGraphiteAddress(flagGraphiteAddress),
+
+		EmbeddedDBPath: getEmbeddedDBPath(flagEmbeddedDBPath),
+
+		InfluxIntegerCounters: getInfluxIntegerCounters(flagInfluxIntegerCounters),
+		MetricTTL:             getMetricTTL(flagMetricTTL),
+
+		RetentionRaw:       getRetentionRaw(flagRetentionRaw),
+		RetentionMinute:    getRetentionMinute(flagRetentionMinute),
+		RetentionHour:      getRetentionHour(flagRetentionHour),
+		CompactionInterval: getCompactionInterval(flagCompactionInterval),
+		QueryTimeout:       getQueryTimeout(flagQueryTimeout),
+
+		SnapshotCompression: getSnapshotCompression(flagSnapshotCompression),
+		StampAgentID:        getStampAgentID(flagStampAgentID),
 	}
 	return &cfg
 }
@@ -100,12 +165,51 @@ func New(ignoreFlags bool, jsonPath string) (*Config, error) {
 		if cfg.DBParams == "" {
 			cfg.DBParams = cfgFromJSON.DBParams
 		}
+		if cfg.EmbeddedDBPath == "" {
+			cfg.EmbeddedDBPath = cfgFromJSON.EmbeddedDBPath
+		}
 		if cfg.Key == "" {
 			cfg.Key = cfgFromJSON.Key
 		}
 		if cfg.CryptoKey == "" {
 			cfg.CryptoKey = cfgFromJSON.CryptoKey
 		}
+		if cfg.StatsdAddress == "" {
+			cfg.StatsdAddress = cfgFromJSON.StatsdAddress
+		}
+		if cfg.StatsdFlushInterval == 0 {
+			cfg.StatsdFlushInterval = cfgFromJSON.StatsdFlushInterval
+		}
+		if cfg.GraphiteAddress == "" {
+			cfg.GraphiteAddress = cfgFromJSON.GraphiteAddress
+		}
+		if !cfg.InfluxIntegerCounters {
+			cfg.InfluxIntegerCounters = cfgFromJSON.InfluxIntegerCounters
+		}
+		if cfg.MetricTTL == 0 {
+			cfg.MetricTTL = cfgFromJSON.MetricTTL
+		}
+		if cfg.RetentionRaw == 0 {
+			cfg.RetentionRaw = cfgFromJSON.RetentionRaw
+		}
+		if cfg.RetentionMinute == 0 {
+			cfg.RetentionMinute = cfgFromJSON.RetentionMinute
+		}
+		if cfg.RetentionHour == 0 {
+			cfg.RetentionHour = cfgFromJSON.RetentionHour
+		}
+		if cfg.CompactionInterval == 0 {
+			cfg.CompactionInterval = cfgFromJSON.CompactionInterval
+		}
+		if cfg.QueryTimeout == 0 {
+			cfg.QueryTimeout = cfgFromJSON.QueryTimeout
+		}
+		if cfg.SnapshotCompression == "" {
+			cfg.SnapshotCompression = cfgFromJSON.SnapshotCompression
+		}
+		if !cfg.StampAgentID {
+			cfg.StampAgentID = cfgFromJSON.StampAgentID
+		}
 	}
 
 	if cfg.Address == "" {
@@ -122,6 +226,21 @@ func New(ignoreFlags bool, jsonPath string) (*Config, error) {
 	if cfg.DBParams == "" {
 		cfg.DBParams = defaultDBParams
 	}
+	if cfg.StatsdFlushInterval == 0 {
+		cfg.StatsdFlushInterval = defaultStatsdFlushInterval
+	}
+	if cfg.CompactionInterval == 0 {
+		cfg.CompactionInterval = defaultCompactionInterval
+	}
+	if cfg.QueryTimeout == 0 {
+		cfg.QueryTimeout = defaultQueryTimeout
+	}
+	if cfg.SnapshotCompression == "" {
+		cfg.SnapshotCompression = defaultSnapshotCompression
+	}
+	if _, err := memstorage.ParseCompression(cfg.SnapshotCompression); err != nil {
+		return nil, err
+	}
 
 	log.Printf("config: %+v\n", cfg)
 	return cfg, nil
@@ -143,6 +262,116 @@ func getGrpcPort(flagGrpcPort *string) string {
 	return *flagGrpcPort
 }
 
+func getStatsdAddress(flagStatsdAddress *string) string {
+	statsdAddress := os.Getenv("STATSD_ADDRESS")
+	if statsdAddress != "" {
+		return statsdAddress
+	}
+	return *flagStatsdAddress
+}
+
+func getStatsdFlushInterval(flagStatsdFlushInterval *int) int {
+	envStatsdFlushInterval := os.Getenv("STATSD_FLUSH_INTERVAL")
+	if envStatsdFlushInterval != "" {
+		return parseIntOrPanic(envStatsdFlushInterval)
+	}
+	return *flagStatsdFlushInterval
+}
+
+func getGraphiteAddress(flagGraphiteAddress *string) string {
+	graphiteAddress := os.Getenv("GRAPHITE_ADDRESS")
+	if graphiteAddress != "" {
+		return graphiteAddress
+	}
+	return *flagGraphiteAddress
+}
+
+func getInfluxIntegerCounters(flagInfluxIntegerCounters *bool) bool {
+	envInfluxIntegerCounters := os.Getenv("INFLUX_INTEGER_COUNTERS")
+	if envInfluxIntegerCounters == "true" {
+		return true
+	} else if envInfluxIntegerCounters == "false" {
+		return false
+	}
+
+	return *flagInfluxIntegerCounters
+}
+
+func getStampAgentID(flagStampAgentID *bool) bool {
+	envStampAgentID := os.Getenv("STAMP_AGENT_ID")
+	if envStampAgentID == "true" {
+		return true
+	} else if envStampAgentID == "false" {
+		return false
+	}
+
+	return *flagStampAgentID
+}
+
+func getMetricTTL(flagMetricTTL *int) int {
+	envMetricTTL := os.Getenv("METRIC_TTL")
+	if envMetricTTL != "" {
+		return parseIntOrPanic(envMetricTTL)
+	}
+	return *flagMetricTTL
+}
+
+func getEmbeddedDBPath(flagEmbeddedDBPath *string) string {
+	envEmbeddedDBPath := os.Getenv("EMBEDDED_DB_FILE")
+	if envEmbeddedDBPath != "" {
+		return envEmbeddedDBPath
+	}
+	return *flagEmbeddedDBPath
+}
+
+func getRetentionRaw(flagRetentionRaw *int) int {
+	envRetentionRaw := os.Getenv("RETENTION_RAW")
+	if envRetentionRaw != "" {
+		return parseIntOrPanic(envRetentionRaw)
+	}
+	return *flagRetentionRaw
+}
+
+func getRetentionMinute(flagRetentionMinute *int) int {
+	envRetentionMinute := os.Getenv("RETENTION_MINUTE")
+	if envRetentionMinute != "" {
+		return parseIntOrPanic(envRetentionMinute)
+	}
+	return *flagRetentionMinute
+}
+
+func getRetentionHour(flagRetentionHour *int) int {
+	envRetentionHour := os.Getenv("RETENTION_HOUR")
+	if envRetentionHour != "" {
+		return parseIntOrPanic(envRetentionHour)
+	}
+	return *flagRetentionHour
+}
+
+func getCompactionInterval(flagCompactionInterval *int) int {
+	envCompactionInterval := os.Getenv("COMPACTION_INTERVAL")
+	if envCompactionInterval != "" {
+		return parseIntOrPanic(envCompactionInterval)
+	}
+	return *flagCompactionInterval
+}
+
+func getQueryTimeout(flagQueryTimeout *int) int {
+	envQueryTimeout := os.Getenv("QUERY_TIMEOUT")
+	if envQueryTimeout != "" {
+		return parseIntOrPanic(envQueryTimeout)
+	}
+	return *flagQueryTimeout
+}
+
+func getSnapshotCompression(flagSnapshotCompression *string) string {
+	envSnapshotCompression := os.Getenv("SNAPSHOT_COMPRESSION")
+	if envSnapshotCompression != "" {
+		return envSnapshotCompression
+	}
+	return *flagSnapshotCompression
+}
+
 func getTrustedSubnet(flagTrustedSubnet *string) string {
 	trustedSubnet := os.Getenv("TRUSTED_SUBNET")
 	if trustedSubnet != "" {
@@ -261,7 +490,12 @@ func (config *Config) ShouldRestore() bool {
 		return false
 	}
 
-	fileStoragePath, err := os.Stat(config.StoragePath)
+	// восстанавливать есть что, если непустой слепок или журнал изменений после него
+	return nonEmptyFile(config.StoragePath) || nonEmptyFile(memstorage.WALFileName(config.StoragePath))
+}
+
+func nonEmptyFile(path string) bool {
+	fileStoragePath, err := os.Stat(path)
 
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -270,7 +504,7 @@ func (config *Config) ShouldRestore() bool {
 		log.Fatal(err)
 	}
 
-	// в этом месте мы знаем, что файл существует, и что Restore = true,
+	// в этом месте мы знаем, что файл существует,
 	// значит надо убедится в размере файла
 	return fileStoragePath.Size() > 0
 }
@@ -2,8 +2,10 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -23,6 +25,14 @@ func TestConfigFromJSON(t *testing.T) {
 		GrpcPort:      "",
 		StoreInterval: 1,
 		Restore:       true,
+		MetricTTL:     3600,
+
+		StatsdFlushInterval: 10,
+		RetentionRaw:        7200,
+		CompactionInterval:  60,
+		QueryTimeout:        5,
+		EmbeddedDBPath:      "/tmp/metrics.db",
+		SnapshotCompression: "zstd",
 	}
 	assert.Equal(t, cfg, &expectedCfg)
 }
@@ -39,9 +49,23 @@ func TestDefaultConfig(t *testing.T) {
 		DBParams:      "host=localhost port=5433 user=postgres password=password dbname=metrics-test sslmode=disable",
 		Key:           "",
 		GrpcPort:      "3200",
+
+		StatsdFlushInterval: 10,
+		CompactionInterval:  60,
+		QueryTimeout:        10,
+		SnapshotCompression: "none",
 	}, cfg)
 }
 
+func TestUnknownSnapshotCompression(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cfg.json")
+	err := os.WriteFile(path, []byte(`{"store_file": "`+filepath.Join(t.TempDir(), "metrics-db.json")+`", "snapshot_compression": "lz4"}`), 0600)
+	require.NoError(t, err)
+
+	_, err = New(true, path)
+	require.ErrorIs(t, err, memstorage.ErrUnknownCompression)
+}
+
 func TestShouldRestoreFileNotExists(t *testing.T) {
 	cfg := &Config{
 		Address:       "localhost:8080",
@@ -88,3 +112,18 @@ func TestShouldRestoreFileExists(t *testing.T) {
 
 	require.True(t, cfg.ShouldRestore())
 }
+
+// слепок пуст, но после него записан журнал изменений
+func TestShouldRestoreWALExists(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "testfile.json")
+	require.NoError(t, err)
+	err = os.WriteFile(memstorage.WALFileName(file.Name()), []byte("{}\n"), 0600)
+	require.NoError(t, err)
+
+	cfg := &Config{
+		StoragePath: file.Name(),
+		Restore:     true,
+	}
+
+	require.True(t, cfg.ShouldRestore())
+}
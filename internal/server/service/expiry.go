@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// minExpiryInterval - чаще этого интервала устаревшие метрики не ищутся
+const minExpiryInterval = time.Second
+
+// Expirer удаляет метрики, которые не обновлялись дольше ttl
+type Expirer interface {
+	DeleteStaleMetrics(ctx context.Context, ttl time.Duration) (int, error)
+}
+
+// StartExpiryLoop периодически (раз в ttl/2) удаляет устаревшие метрики, пока не отменен ctx
+func StartExpiryLoop(ctx context.Context, exp Expirer, ttl time.Duration) {
+	interval := ttl / 2
+	if interval < minExpiryInterval {
+		interval = minExpiryInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := exp.DeleteStaleMetrics(ctx, ttl)
+			if err != nil {
+				log.Println("unable to delete stale metrics:", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("deleted %d stale metrics", deleted)
+			}
+		}
+	}
+}
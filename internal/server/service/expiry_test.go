@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type expirerStub struct {
+	calls atomic.Int32
+	ttl   atomic.Int64
+}
+
+func (e *expirerStub) DeleteStaleMetrics(_ context.Context, ttl time.Duration) (int, error) {
+	e.calls.Add(1)
+	e.ttl.Store(int64(ttl))
+	return 1, nil
+}
+
+func TestStartExpiryLoop(t *testing.T) {
+	exp := &expirerStub{}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		StartExpiryLoop(ctx, exp, 2*time.Second)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return exp.calls.Load() > 0 }, 3*time.Second, 10*time.Millisecond)
+	require.Equal(t, int64(2*time.Second), exp.ttl.Load())
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expiry loop did not stop after cancel")
+	}
+}
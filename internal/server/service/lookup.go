@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
+)
+
+// MaxLookupBatch - сколько метрик можно запросить одним пакетом
+const MaxLookupBatch = 1000
+
+// ValueReader читает текущее значение метрики по ключу (см. memstorage.SeriesKey)
+type ValueReader interface {
+	GetGaugeMetric(ctx context.Context, name string) (float64, bool, error)
+	GetCounterMetric(ctx context.Context, name string) (int64, bool, error)
+	GetHistogramMetric(ctx context.Context, name string) (memstorage.Histogram, bool, error)
+	GetSummaryMetric(ctx context.Context, name string) (*ddsketch.Sketch, bool, error)
+}
+
+// MetricValue - метрика из пакетного запроса значений: с текущим значением
+// либо, если такой метрики нет, только с именем, типом и метками и с признаком NotFound
+type MetricValue struct {
+	memstorage.Metric
+	NotFound bool `json:"not_found,omitempty"`
+}
+
+// ValidateLookup проверяет пакет запрошенных метрик: размер, типы и метки
+func ValidateLookup(requested []memstorage.Metric) error {
+	if len(requested) > MaxLookupBatch {
+		return fmt.Errorf("too many metrics in batch: %d, max %d", len(requested), MaxLookupBatch)
+	}
+	for _, m := range requested {
+		if !memstorage.ValidMetricType(m.MType) {
+			return fmt.Errorf("%w: %s", memstorage.ErrUnknownMetricType, m.MType)
+		}
+		if err := memstorage.ValidateLabels(m.Labels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LookupMetrics возвращает текущие значения запрошенных метрик в порядке запроса;
+// значения, присланные в запросе, не учитываются. У summary метрик вычисляются квантили.
+// Пакет должен быть проверен ValidateLookup.
+func LookupMetrics(ctx context.Context, r ValueReader, requested []memstorage.Metric) ([]MetricValue, error) {
+	res := make([]MetricValue, 0, len(requested))
+	for _, req := range requested {
+		m := memstorage.Metric{ID: req.ID, MType: req.MType, Labels: req.Labels}
+		var ok bool
+		var err error
+
+		switch m.MType {
+		case "gauge":
+			var value float64
+			if value, ok, err = r.GetGaugeMetric(ctx, m.Key()); ok {
+				m.Value = &value
+			}
+		case "counter":
+			var delta int64
+			if delta, ok, err = r.GetCounterMetric(ctx, m.Key()); ok {
+				m.Delta = &delta
+			}
+		case "histogram":
+			var h memstorage.Histogram
+			if h, ok, err = r.GetHistogramMetric(ctx, m.Key()); ok {
+				m.Histogram = &h
+			}
+		case "summary":
+			var sketch *ddsketch.Sketch
+			if sketch, ok, err = r.GetSummaryMetric(ctx, m.Key()); ok {
+				quantiles := memstorage.NewSummaryValue(sketch)
+				m.Summary = sketch
+				m.Quantiles = &quantiles
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s", memstorage.ErrUnknownMetricType, m.MType)
+		}
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, MetricValue{Metric: m, NotFound: !ok})
+	}
+	return res, nil
+}
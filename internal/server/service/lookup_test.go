@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupMetrics(t *testing.T) {
+	ctx := context.Background()
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+
+	sketch := ddsketch.New(ddsketch.DefaultAlpha)
+	sketch.Add(2)
+	require.NoError(t, ms.AddGaugeMetric(ctx, `g1{host="a"}`, 1.5))
+	require.NoError(t, ms.AddCounterMetric(ctx, "c1", 3))
+	require.NoError(t, ms.AddSummaryMetric(ctx, "s1", sketch))
+
+	sentValue := 100.0
+	requested := []memstorage.Metric{
+		{ID: "c1", MType: "counter"},
+		{ID: "g1", MType: "gauge", Labels: memstorage.Labels{"host": "a"}, Value: &sentValue},
+		{ID: "g1", MType: "gauge"},
+		{ID: "s1", MType: "summary"},
+		{ID: "h1", MType: "histogram"},
+	}
+	require.NoError(t, ValidateLookup(requested))
+
+	values, err := LookupMetrics(ctx, ms, requested)
+	require.NoError(t, err)
+	require.Len(t, values, 5)
+
+	require.False(t, values[0].NotFound)
+	require.Equal(t, int64(3), *values[0].Delta)
+	// значение из запроса заменяется значением из хранилища
+	require.False(t, values[1].NotFound)
+	require.Equal(t, 1.5, *values[1].Value)
+	require.Equal(t, memstorage.Labels{"host": "a"}, values[1].Labels)
+	// метрика без меток - другая метрика
+	require.True(t, values[2].NotFound)
+	require.Nil(t, values[2].Value)
+	require.Equal(t, uint64(1), values[3].Quantiles.Count)
+	require.True(t, values[4].NotFound)
+	require.Equal(t, "h1", values[4].ID)
+}
+
+func TestValidateLookup(t *testing.T) {
+	err := ValidateLookup([]memstorage.Metric{{ID: "x", MType: "unknown"}})
+	require.ErrorIs(t, err, memstorage.ErrUnknownMetricType)
+
+	err = ValidateLookup([]memstorage.Metric{{ID: "x", MType: "gauge", Labels: memstorage.Labels{"": "a"}}})
+	require.Error(t, err)
+
+	err = ValidateLookup(make([]memstorage.Metric, MaxLookupBatch+1))
+	require.Error(t, err)
+}
+
+type failingReader struct {
+	ValueReader
+}
+
+func (failingReader) GetCounterMetric(_ context.Context, _ string) (int64, bool, error) {
+	return 0, false, errors.New("connection refused")
+}
+
+func TestLookupMetricsStorageFail(t *testing.T) {
+	_, err := LookupMetrics(context.Background(), failingReader{}, []memstorage.Metric{{ID: "c1", MType: "counter"}})
+	require.Error(t, err)
+}
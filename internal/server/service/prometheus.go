@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
+)
+
+const (
+	// PrometheusContentType - текстовый формат Prometheus версии 0.0.4
+	PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+	// OpenMetricsContentType - текстовый формат OpenMetrics 1.0.0
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// WritePrometheusMetrics пишет все метрики в текстовом формате Prometheus,
+// а если openMetrics = true, то в формате OpenMetrics (суффикс _total у counter
+// метрик и завершающая строка # EOF).
+// Метрики с одинаковым именем и разными метками выводятся одним семейством.
+// Метрики, имена которых после приведения к допустимому виду совпали
+// с уже записанными, пропускаются.
+func WritePrometheusMetrics(ctx context.Context, rep Reporter, w io.Writer, openMetrics bool) error {
+	gaugeMetrics, err := rep.GetAllGaugeMetrics(ctx)
+	if err != nil {
+		return err
+	}
+	counterMetrics, err := rep.GetAllCounterMetrics(ctx)
+	if err != nil {
+		return err
+	}
+
+	written := make(map[string]bool)
+
+	gaugeSeries := groupSeries(gaugeMetrics)
+	for _, name := range sortedKeys(gaugeSeries) {
+		family := SanitizeMetricName(name)
+		if written[family] {
+			log.Printf("skipping gauge metric %s: name %s is already used", name, family)
+			continue
+		}
+		written[family] = true
+
+		_, err = fmt.Fprintf(w, "# TYPE %s gauge\n", family)
+		if err != nil {
+			return err
+		}
+		for _, s := range gaugeSeries[name] {
+			_, err = fmt.Fprintf(w, "%s%s %s\n", family, formatLabels(s.labels), formatFloat(gaugeMetrics[s.key]))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	counterSeries := groupSeries(counterMetrics)
+	for _, name := range sortedKeys(counterSeries) {
+		family := SanitizeMetricName(name)
+		sample := family
+		if openMetrics {
+			// в OpenMetrics имя семейства counter метрик не содержит _total, а имя значения - содержит
+			family = strings.TrimSuffix(family, "_total")
+			sample = family + "_total"
+		}
+		if written[family] {
+			log.Printf("skipping counter metric %s: name %s is already used", name, family)
+			continue
+		}
+		written[family] = true
+
+		_, err = fmt.Fprintf(w, "# TYPE %s counter\n", family)
+		if err != nil {
+			return err
+		}
+		for _, s := range counterSeries[name] {
+			_, err = fmt.Fprintf(w, "%s%s %d\n", sample, formatLabels(s.labels), counterMetrics[s.key])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	histogramMetrics, err := rep.GetAllHistogramMetrics(ctx)
+	if err != nil {
+		return err
+	}
+	histogramSeries := groupSeries(histogramMetrics)
+	for _, name := range sortedKeys(histogramSeries) {
+		family := SanitizeMetricName(name)
+		if written[family] {
+			log.Printf("skipping histogram metric %s: name %s is already used", name, family)
+			continue
+		}
+		written[family] = true
+
+		_, err = fmt.Fprintf(w, "# TYPE %s histogram\n", family)
+		if err != nil {
+			return err
+		}
+		for _, s := range histogramSeries[name] {
+			if err = writeHistogram(w, family, s.labels, histogramMetrics[s.key]); err != nil {
+				return err
+			}
+		}
+	}
+
+	summaryMetrics, err := rep.GetAllSummaryMetrics(ctx)
+	if err != nil {
+		return err
+	}
+	summarySeries := groupSeries(summaryMetrics)
+	for _, name := range sortedKeys(summarySeries) {
+		family := SanitizeMetricName(name)
+		if written[family] {
+			log.Printf("skipping summary metric %s: name %s is already used", name, family)
+			continue
+		}
+		written[family] = true
+
+		_, err = fmt.Fprintf(w, "# TYPE %s summary\n", family)
+		if err != nil {
+			return err
+		}
+		for _, s := range summarySeries[name] {
+			if err = writeSummary(w, family, s.labels, summaryMetrics[s.key]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if openMetrics {
+		_, err = io.WriteString(w, "# EOF\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeHistogram пишет ряды гистограммы: накопленные количества по корзинам
+// (name_bucket с меткой le), сумму (name_sum) и количество (name_count)
+func writeHistogram(w io.Writer, family string, labels memstorage.Labels, h memstorage.Histogram) error {
+	bucketLabels := make(memstorage.Labels, len(labels)+1)
+	for k, v := range labels {
+		bucketLabels[k] = v
+	}
+
+	var cumulative uint64
+	for i, c := range h.Counts {
+		cumulative += c
+		bucketLabels["le"] = "+Inf"
+		if i < len(h.Bounds) {
+			bucketLabels["le"] = formatFloat(h.Bounds[i])
+		}
+		_, err := fmt.Fprintf(w, "%s_bucket%s %d\n", family, formatLabels(bucketLabels), cumulative)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%s_sum%s %s\n", family, formatLabels(labels), formatFloat(h.Sum))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s_count%s %d\n", family, formatLabels(labels), h.Count)
+	return err
+}
+
+// writeSummary пишет ряды summary метрики: квантили (с меткой quantile),
+// сумму (name_sum) и количество (name_count); у пустого скетча квантили не выводятся
+func writeSummary(w io.Writer, family string, labels memstorage.Labels, sketch *ddsketch.Sketch) error {
+	quantileLabels := make(memstorage.Labels, len(labels)+1)
+	for k, v := range labels {
+		quantileLabels[k] = v
+	}
+
+	for _, q := range memstorage.ReportedQuantiles {
+		v, err := sketch.Quantile(q)
+		if err != nil {
+			break
+		}
+		quantileLabels["quantile"] = formatFloat(q)
+		_, err = fmt.Fprintf(w, "%s%s %s\n", family, formatLabels(quantileLabels), formatFloat(v))
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%s_sum%s %s\n", family, formatLabels(labels), formatFloat(sketch.Sum))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s_count%s %d\n", family, formatLabels(labels), sketch.Count)
+	return err
+}
+
+// series - ряд метрики: ключ в хранилище и метки
+type series struct {
+	key    string
+	labels memstorage.Labels
+}
+
+// groupSeries группирует ключи метрик по имени; ряды внутри имени упорядочены по меткам
+func groupSeries[T any](metrics map[string]T) map[string][]series {
+	res := make(map[string][]series)
+	for _, key := range sortedKeys(metrics) {
+		name, labels := memstorage.SplitSeriesKey(key)
+		res[name] = append(res[name], series{key: key, labels: labels})
+	}
+	return res
+}
+
+// formatLabels записывает метки в виде {name="value",...}; имена меток приводятся
+// к допустимому виду, значения экранируются
+func formatLabels(labels memstorage.Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	sanitized := make(memstorage.Labels, len(labels))
+	for name, value := range labels {
+		sanitized[strings.ReplaceAll(SanitizeMetricName(name), ":", "_")] = value
+	}
+	return sanitized.String()
+}
+
+// SanitizeMetricName приводит имя метрики к виду [a-zA-Z_:][a-zA-Z0-9_:]*,
+// заменяя недопустимые символы на '_'
+func SanitizeMetricName(name string) string {
+	if name == "" {
+		return "_"
+	}
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
+	"github.com/stretchr/testify/require"
+)
+
+type reporterStub struct {
+	gauge     map[string]float64
+	counter   map[string]int64
+	histogram map[string]memstorage.Histogram
+	summary   map[string]*ddsketch.Sketch
+}
+
+func (r reporterStub) GetAllGaugeMetrics(_ context.Context) (map[string]float64, error) {
+	return r.gauge, nil
+}
+
+func (r reporterStub) GetAllCounterMetrics(_ context.Context) (map[string]int64, error) {
+	return r.counter, nil
+}
+
+func (r reporterStub) GetAllHistogramMetrics(_ context.Context) (map[string]memstorage.Histogram, error) {
+	return r.histogram, nil
+}
+
+func (r reporterStub) GetAllSummaryMetrics(_ context.Context) (map[string]*ddsketch.Sketch, error) {
+	return r.summary, nil
+}
+
+func TestWritePrometheusMetrics(t *testing.T) {
+	rep := reporterStub{
+		gauge:   map[string]float64{"HeapAlloc": 1024, "CPUutilization1": 12.5, "Random.Value": math.Inf(1)},
+		counter: map[string]int64{"PollCount": 7},
+	}
+
+	var buf bytes.Buffer
+	err := WritePrometheusMetrics(context.Background(), rep, &buf, false)
+	require.NoError(t, err)
+
+	expected := `# TYPE CPUutilization1 gauge
+CPUutilization1 12.5
+# TYPE HeapAlloc gauge
+HeapAlloc 1024
+# TYPE Random_Value gauge
+Random_Value +Inf
+# TYPE PollCount counter
+PollCount 7
+`
+	require.Equal(t, expected, buf.String())
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	rep := reporterStub{
+		gauge:   map[string]float64{"g1": 1.5},
+		counter: map[string]int64{"PollCount": 7, "requests_total": 3},
+	}
+
+	var buf bytes.Buffer
+	err := WritePrometheusMetrics(context.Background(), rep, &buf, true)
+	require.NoError(t, err)
+
+	expected := `# TYPE g1 gauge
+g1 1.5
+# TYPE PollCount counter
+PollCount_total 7
+# TYPE requests counter
+requests_total 3
+# EOF
+`
+	require.Equal(t, expected, buf.String())
+}
+
+func TestWritePrometheusMetricsSkipsDuplicates(t *testing.T) {
+	rep := reporterStub{
+		gauge:   map[string]float64{"a.b": 1, "a_b": 2},
+		counter: map[string]int64{"a-b": 3},
+	}
+
+	var buf bytes.Buffer
+	err := WritePrometheusMetrics(context.Background(), rep, &buf, false)
+	require.NoError(t, err)
+	require.Equal(t, "# TYPE a_b gauge\na_b 1\n", buf.String())
+}
+
+func TestWritePrometheusMetricsWithLabels(t *testing.T) {
+	rep := reporterStub{
+		gauge: map[string]float64{
+			`HeapAlloc{host="b"}`:    2,
+			`HeapAlloc{host="a"}`:    1,
+			"HeapAlloc":              3,
+			"HeapAlloc_max":          4,
+			`Info{v="say \"hi\"\n"}`: 1,
+		},
+		counter: map[string]int64{`requests_total{env="prod"}`: 5},
+	}
+
+	var buf bytes.Buffer
+	err := WritePrometheusMetrics(context.Background(), rep, &buf, true)
+	require.NoError(t, err)
+
+	expected := `# TYPE HeapAlloc gauge
+HeapAlloc 3
+HeapAlloc{host="a"} 1
+HeapAlloc{host="b"} 2
+# TYPE HeapAlloc_max gauge
+HeapAlloc_max 4
+# TYPE Info gauge
+Info{v="say \"hi\"\n"} 1
+# TYPE requests counter
+requests_total{env="prod"} 5
+# EOF
+`
+	require.Equal(t, expected, buf.String())
+}
+
+func TestWritePrometheusHistogram(t *testing.T) {
+	rep := reporterStub{
+		histogram: map[string]memstorage.Histogram{
+			`ReportLatency{host="a"}`: {Bounds: []float64{0.1, 1}, Counts: []uint64{3, 1, 2}, Sum: 7.25, Count: 6},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := WritePrometheusMetrics(context.Background(), rep, &buf, true)
+	require.NoError(t, err)
+
+	expected := `# TYPE ReportLatency histogram
+ReportLatency_bucket{host="a",le="0.1"} 3
+ReportLatency_bucket{host="a",le="1"} 4
+ReportLatency_bucket{host="a",le="+Inf"} 6
+ReportLatency_sum{host="a"} 7.25
+ReportLatency_count{host="a"} 6
+# EOF
+`
+	require.Equal(t, expected, buf.String())
+}
+
+func TestWritePrometheusSummary(t *testing.T) {
+	// одинаковые значения: квантили ограничены точными min и max
+	sketch := ddsketch.New(ddsketch.DefaultAlpha)
+	sketch.Add(5)
+	sketch.Add(5)
+	rep := reporterStub{
+		summary: map[string]*ddsketch.Sketch{
+			"RequestDuration": sketch,
+			"Empty":           ddsketch.New(ddsketch.DefaultAlpha),
+		},
+	}
+
+	var buf bytes.Buffer
+	err := WritePrometheusMetrics(context.Background(), rep, &buf, false)
+	require.NoError(t, err)
+
+	expected := `# TYPE Empty summary
+Empty_sum 0
+Empty_count 0
+# TYPE RequestDuration summary
+RequestDuration{quantile="0.5"} 5
+RequestDuration{quantile="0.95"} 5
+RequestDuration{quantile="0.99"} 5
+RequestDuration_sum 10
+RequestDuration_count 2
+`
+	require.Equal(t, expected, buf.String())
+}
+
+func TestSanitizeMetricName(t *testing.T) {
+	require.Equal(t, "CPUutilization1", SanitizeMetricName("CPUutilization1"))
+	require.Equal(t, "host_cpu_load", SanitizeMetricName("host.cpu-load"))
+	require.Equal(t, "_1metric", SanitizeMetricName("1metric"))
+	require.Equal(t, "_", SanitizeMetricName(""))
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+)
+
+// maxRangePoints ограничивает количество точек в ответе на один запрос
+const maxRangePoints = 11000
+
+// RangeQuery описывает период и шаг, с которым история метрики выравнивается в точки
+type RangeQuery struct {
+	From time.Time
+	To   time.Time
+	Step time.Duration
+}
+
+func (q RangeQuery) Validate() error {
+	if q.Step <= 0 {
+		return errors.New("step must be positive")
+	}
+	if q.To.Before(q.From) {
+		return errors.New("to must not be before from")
+	}
+	if q.To.Sub(q.From)/q.Step >= maxRangePoints {
+		return errors.New("too many points, increase step or shorten the range")
+	}
+	return nil
+}
+
+// HistoryFrom - начало периода, за который нужно запросить историю метрики:
+// кроме самого периода захватываются еще два шага до него, чтобы у первой точки
+// был интервал целиком и база для подсчета прироста счетчика
+func (q RangeQuery) HistoryFrom() time.Time {
+	return q.From.Add(-2 * q.Step)
+}
+
+// Steps возвращает моменты времени, для которых считаются точки:
+// первый момент - ближайший к from кратный step, далее с шагом step до to включительно
+func (q RangeQuery) Steps() []time.Time {
+	var res []time.Time
+	t := q.From.Truncate(q.Step)
+	if t.Before(q.From) {
+		t = t.Add(q.Step)
+	}
+	for ; !t.After(q.To); t = t.Add(q.Step) {
+		res = append(res, t)
+	}
+	return res
+}
+
+// LastInStep для каждого шага берет последнее значение, записанное в интервале (t-step, t].
+// Шаги без значений пропускаются.
+func LastInStep(samples []memstorage.Sample, q RangeQuery) []memstorage.Sample {
+	res := []memstorage.Sample{}
+	i := 0
+	for _, t := range q.Steps() {
+		var last *memstorage.Sample
+		for ; i < len(samples) && !samples[i].Timestamp.After(t); i++ {
+			if samples[i].Timestamp.After(t.Add(-q.Step)) {
+				last = &samples[i]
+			}
+		}
+		if last != nil {
+			res = append(res, memstorage.Sample{Timestamp: t, Value: last.Value})
+		}
+	}
+	return res
+}
+
+// Increase для каждого шага считает прирост счетчика в интервале (t-step, t].
+// За базу берется последнее значение до начала интервала (а если его нет,
+// то первое значение в интервале); уменьшение значения считается сбросом счетчика.
+func Increase(samples []memstorage.Sample, q RangeQuery) []memstorage.Sample {
+	res := []memstorage.Sample{}
+	i := 0
+	var base *memstorage.Sample
+	for _, t := range q.Steps() {
+		start := t.Add(-q.Step)
+		for ; i < len(samples) && !samples[i].Timestamp.After(start); i++ {
+			base = &samples[i]
+		}
+
+		prev := base
+		var inc float64
+		seen := base != nil
+		for ; i < len(samples) && !samples[i].Timestamp.After(t); i++ {
+			s := samples[i]
+			switch {
+			case prev == nil:
+			case s.Value >= prev.Value:
+				inc += s.Value - prev.Value
+			default:
+				inc += s.Value
+			}
+			prev = &samples[i]
+			seen = true
+		}
+		base = prev
+
+		if seen {
+			res = append(res, memstorage.Sample{Timestamp: t, Value: inc})
+		}
+	}
+	return res
+}
+
+// Rate - прирост счетчика в интервале шага, деленный на длительность шага в секундах
+func Rate(samples []memstorage.Sample, q RangeQuery) []memstorage.Sample {
+	res := Increase(samples, q)
+	for i := range res {
+		res[i].Value /= q.Step.Seconds()
+	}
+	return res
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/stretchr/testify/require"
+)
+
+var rangeStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func at(sec int) time.Time {
+	return rangeStart.Add(time.Duration(sec) * time.Second)
+}
+
+func TestSteps(t *testing.T) {
+	q := RangeQuery{From: at(5), To: at(40), Step: 10 * time.Second}
+	require.Equal(t, []time.Time{at(10), at(20), at(30), at(40)}, q.Steps())
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, RangeQuery{From: at(0), To: at(60), Step: time.Second}.Validate())
+	require.Error(t, RangeQuery{From: at(0), To: at(60), Step: 0}.Validate())
+	require.Error(t, RangeQuery{From: at(60), To: at(0), Step: time.Second}.Validate())
+	require.Error(t, RangeQuery{From: at(0), To: at(100000), Step: time.Second}.Validate())
+}
+
+func TestLastInStep(t *testing.T) {
+	samples := []memstorage.Sample{
+		{Timestamp: at(1), Value: 1},
+		{Timestamp: at(9), Value: 2},
+		{Timestamp: at(10), Value: 3},
+		{Timestamp: at(25), Value: 4},
+	}
+	q := RangeQuery{From: at(10), To: at(40), Step: 10 * time.Second}
+
+	// шаг 40 пропускается, так как в интервале (30, 40] нет значений
+	require.Equal(t, []memstorage.Sample{
+		{Timestamp: at(10), Value: 3},
+		{Timestamp: at(30), Value: 4},
+	}, LastInStep(samples, q))
+}
+
+func TestIncreaseAndRate(t *testing.T) {
+	samples := []memstorage.Sample{
+		{Timestamp: at(5), Value: 10},
+		{Timestamp: at(15), Value: 30},
+		{Timestamp: at(18), Value: 50},
+		{Timestamp: at(25), Value: 5}, // сброс счетчика
+		{Timestamp: at(28), Value: 15},
+	}
+	q := RangeQuery{From: at(20), To: at(40), Step: 10 * time.Second}
+
+	require.Equal(t, []memstorage.Sample{
+		{Timestamp: at(20), Value: 40},
+		{Timestamp: at(30), Value: 15},
+		{Timestamp: at(40), Value: 0},
+	}, Increase(samples, q))
+
+	require.Equal(t, []memstorage.Sample{
+		{Timestamp: at(20), Value: 4},
+		{Timestamp: at(30), Value: 1.5},
+		{Timestamp: at(40), Value: 0},
+	}, Rate(samples, q))
+}
+
+func TestIncreaseWithoutBase(t *testing.T) {
+	samples := []memstorage.Sample{
+		{Timestamp: at(12), Value: 100},
+		{Timestamp: at(18), Value: 130},
+	}
+	q := RangeQuery{From: at(0), To: at(20), Step: 10 * time.Second}
+
+	require.Equal(t, []memstorage.Sample{
+		{Timestamp: at(20), Value: 30},
+	}, Increase(samples, q))
+}
@@ -3,18 +3,27 @@
 package service
 
 import (
+	"context"
+	"fmt"
 	"html/template"
 	"io"
+	"sort"
+	"strings"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
 )
 
 type Reporter interface {
-	GetAllGaugeMetrics() (map[string]float64, error)
-	GetAllCounterMetrics() (map[string]int64, error)
+	GetAllGaugeMetrics(ctx context.Context) (map[string]float64, error)
+	GetAllCounterMetrics(ctx context.Context) (map[string]int64, error)
+	GetAllHistogramMetrics(ctx context.Context) (map[string]memstorage.Histogram, error)
+	GetAllSummaryMetrics(ctx context.Context) (map[string]*ddsketch.Sketch, error)
 }
 
 // функция использует любой объект, который имеет функции GetAllGaugeMetrics() и GetAllCounterMetrics()
 // то есть который удовлетворяет Reporter'у
-func WriteMetricsReport(rep Reporter, w io.Writer) error {
+func WriteMetricsReport(ctx context.Context, rep Reporter, w io.Writer) error {
 
 	const tmpl = `
 <html>
@@ -22,23 +31,49 @@ func WriteMetricsReport(rep Reporter, w io.Writer) error {
 	<body>
 		<h1>Gauge metrics</h1>
     	<table> 
-		{{range $key, $val := .Gauge}}
+		{{range .Gauge}}
      		<tr>
-				<td>{{$key}}</td>
-				<td>{{$val}}</td> 
+				<td>{{.Name}}</td>
+				{{if $.WithLabels}}<td>{{.Labels}}</td>{{end}}
+				<td>{{.Value}}</td> 
 			</tr>
 		{{end}}
 		</table>
 
 		<h1>Counter metrics</h1>
     	<table> 
-		{{range $key, $val := .Counter}}
+		{{range .Counter}}
      		<tr>
-				<td>{{$key}}</td>
-				<td>{{$val}}</td> 
+				<td>{{.Name}}</td>
+				{{if $.WithLabels}}<td>{{.Labels}}</td>{{end}}
+				<td>{{.Value}}</td> 
 			</tr>
 		{{end}}
 		</table>
+		{{if .Histogram}}
+		<h1>Histogram metrics</h1>
+    	<table> 
+		{{range .Histogram}}
+     		<tr>
+				<td>{{.Name}}</td>
+				{{if $.WithLabels}}<td>{{.Labels}}</td>{{end}}
+				<td>{{.Value}}</td> 
+			</tr>
+		{{end}}
+		</table>
+		{{end}}
+		{{if .Summary}}
+		<h1>Summary metrics</h1>
+    	<table> 
+		{{range .Summary}}
+     		<tr>
+				<td>{{.Name}}</td>
+				{{if $.WithLabels}}<td>{{.Labels}}</td>{{end}}
+				<td>{{.Value}}</td> 
+			</tr>
+		{{end}}
+		</table>
+		{{end}}
 	</body>
 
 </html>
@@ -46,21 +81,42 @@ func WriteMetricsReport(rep Reporter, w io.Writer) error {
 	t := template.Must(template.New("tmpl").Parse(tmpl))
 
 	type tmlParams struct {
-		Gauge   map[string]float64
-		Counter map[string]int64
+		Gauge   []reportRow
+		Counter []reportRow
+		// раздел с гистограммами выводится, только если они есть
+		Histogram []reportRow
+		Summary   []reportRow
+		// колонка с метками выводится, только если метки есть хотя бы у одной метрики
+		WithLabels bool
 	}
 
-	GaugeMetric, err := rep.GetAllGaugeMetrics()
+	GaugeMetric, err := rep.GetAllGaugeMetrics(ctx)
+	if err != nil {
+		return err
+	}
+	CounterMetric, err := rep.GetAllCounterMetrics(ctx)
+	if err != nil {
+		return err
+	}
+	HistogramMetric, err := rep.GetAllHistogramMetrics(ctx)
 	if err != nil {
 		return err
 	}
-	CounterMetric, err := rep.GetAllCounterMetrics()
+	SummaryMetric, err := rep.GetAllSummaryMetrics(ctx)
 	if err != nil {
 		return err
 	}
 	m := tmlParams{
-		Gauge:   GaugeMetric,
-		Counter: CounterMetric,
+		Gauge:     reportRows(GaugeMetric),
+		Counter:   reportRows(CounterMetric),
+		Histogram: histogramReportRows(HistogramMetric),
+		Summary:   summaryReportRows(SummaryMetric),
+	}
+	rows := append(append(m.Gauge, m.Counter...), m.Histogram...)
+	for _, row := range append(rows, m.Summary...) {
+		if row.Labels != "" {
+			m.WithLabels = true
+		}
 	}
 	err = t.Execute(w, m)
 	if err != nil {
@@ -68,3 +124,69 @@ func WriteMetricsReport(rep Reporter, w io.Writer) error {
 	}
 	return nil
 }
+
+// reportRow - строка отчета: имя метрики, ее метки и значение
+type reportRow struct {
+	Name   string
+	Labels string
+	Value  any
+}
+
+// reportRows раскладывает ключи метрик на имя и метки;
+// строки упорядочены по имени, а затем по меткам
+func reportRows[T int64 | float64](metrics map[string]T) []reportRow {
+	rows := make([]reportRow, 0, len(metrics))
+	for key, value := range metrics {
+		name, labels := memstorage.SplitSeriesKey(key)
+		rows = append(rows, reportRow{Name: name, Labels: labels.String(), Value: value})
+	}
+	sortReportRows(rows)
+	return rows
+}
+
+// histogramReportRows - строки отчета для гистограмм; значение - количество,
+// сумма и накопленные количества по корзинам: count=3 sum=1.5 le=0.5:1 le=1:2 le=+Inf:3
+func histogramReportRows(metrics map[string]memstorage.Histogram) []reportRow {
+	rows := make([]reportRow, 0, len(metrics))
+	for key, h := range metrics {
+		name, labels := memstorage.SplitSeriesKey(key)
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "count=%d sum=%s", h.Count, formatFloat(h.Sum))
+		var cumulative uint64
+		for i, c := range h.Counts {
+			cumulative += c
+			le := "+Inf"
+			if i < len(h.Bounds) {
+				le = formatFloat(h.Bounds[i])
+			}
+			fmt.Fprintf(&b, " le=%s:%d", le, cumulative)
+		}
+		rows = append(rows, reportRow{Name: name, Labels: labels.String(), Value: b.String()})
+	}
+	sortReportRows(rows)
+	return rows
+}
+
+// summaryReportRows - строки отчета для summary метрик: count=10 sum=55 p50=5 p95=9.5 p99=9.9
+func summaryReportRows(metrics map[string]*ddsketch.Sketch) []reportRow {
+	rows := make([]reportRow, 0, len(metrics))
+	for key, sketch := range metrics {
+		name, labels := memstorage.SplitSeriesKey(key)
+		v := memstorage.NewSummaryValue(sketch)
+		value := fmt.Sprintf("count=%d sum=%s p50=%s p95=%s p99=%s", v.Count, formatFloat(v.Sum),
+			formatFloat(v.P50), formatFloat(v.P95), formatFloat(v.P99))
+		rows = append(rows, reportRow{Name: name, Labels: labels.String(), Value: value})
+	}
+	sortReportRows(rows)
+	return rows
+}
+
+func sortReportRows(rows []reportRow) {
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Name != rows[j].Name {
+			return rows[i].Name < rows[j].Name
+		}
+		return rows[i].Labels < rows[j].Labels
+	})
+}
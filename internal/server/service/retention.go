@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Compactor пересчитывает агрегаты истории и удаляет историю старше сроков хранения
+type Compactor interface {
+	Compact(ctx context.Context) error
+}
+
+// StartCompactionLoop запускает компакцию истории раз в interval, пока не отменен ctx
+func StartCompactionLoop(ctx context.Context, c Compactor, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Compact(ctx); err != nil {
+				log.Println("unable to compact metric history:", err)
+			}
+		}
+	}
+}
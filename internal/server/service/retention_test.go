@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type compactorStub struct {
+	calls atomic.Int32
+}
+
+func (c *compactorStub) Compact(_ context.Context) error {
+	c.calls.Add(1)
+	return nil
+}
+
+func TestStartCompactionLoop(t *testing.T) {
+	c := &compactorStub{}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		StartCompactionLoop(ctx, c, 10*time.Millisecond)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return c.calls.Load() >= 2 }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("compaction loop did not stop after cancel")
+	}
+}
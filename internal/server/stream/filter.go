@@ -0,0 +1,71 @@
+package stream
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+)
+
+// Filter - какие метрики нужны подписчику: тип и шаблоны имени (без меток).
+// Метрика подходит, если соответствует любому из шаблонов; nil фильтр пропускает все метрики.
+// Создается NewFilter или ParseFilter.
+type Filter struct {
+	metricType string // пустой - все типы
+	matches    []func(name string) bool
+}
+
+// NewFilter проверяет тип и компилирует шаблоны имени: glob (см. memstorage.ListQuery)
+// или, при regex, регулярные выражения, которым должно соответствовать все имя
+func NewFilter(metricType string, match []string, regex bool) (*Filter, error) {
+	f := &Filter{metricType: metricType}
+	if metricType != "" && metricType != "gauge" && metricType != "counter" {
+		return nil, fmt.Errorf("%w: only gauge and counter metrics are streamed, got %q",
+			memstorage.ErrInvalidListQuery, metricType)
+	}
+	for _, pattern := range match {
+		q := memstorage.ListQuery{Match: pattern, Regex: regex}
+		if err := q.Validate(); err != nil {
+			return nil, err
+		}
+		m, err := q.Matcher()
+		if err != nil {
+			return nil, err
+		}
+		f.matches = append(f.matches, m)
+	}
+	return f, nil
+}
+
+// ParseFilter разбирает фильтр из параметров запроса:
+// type - тип метрик, match - glob шаблон имени (можно повторять), regex - регулярное выражение имени (можно повторять).
+// Шаблоны match и regex одновременно не допускаются.
+func ParseFilter(values url.Values) (*Filter, error) {
+	match, regex := values["match"], values["regex"]
+	if len(match) > 0 && len(regex) > 0 {
+		return nil, fmt.Errorf("%w: match and regex are mutually exclusive", memstorage.ErrInvalidListQuery)
+	}
+	if len(regex) > 0 {
+		return NewFilter(values.Get("type"), regex, true)
+	}
+	return NewFilter(values.Get("type"), match, false)
+}
+
+// Matches проверяет, подходит ли метрика под фильтр
+func (f *Filter) Matches(metricType, name string) bool {
+	if f == nil {
+		return true
+	}
+	if f.metricType != "" && f.metricType != metricType {
+		return false
+	}
+	if len(f.matches) == 0 {
+		return true
+	}
+	for _, m := range f.matches {
+		if m(name) {
+			return true
+		}
+	}
+	return false
+}
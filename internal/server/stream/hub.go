@@ -0,0 +1,185 @@
+// Package stream рассылает изменения метрик подписчикам: клиентам, которые следят за метриками
+// в реальном времени (SSE и WebSocket, см. api.StreamSSE и api.StreamWebSocket).
+package stream
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+)
+
+const (
+	// DefaultBuffer - сколько событий может ждать отправки подписчику
+	DefaultBuffer = 256
+	// DefaultMaxLag - сколько событий подряд можно пропустить из-за переполненного буфера,
+	// прежде чем подписчик будет отключен как слишком медленный
+	DefaultMaxLag = 4096
+)
+
+var (
+	// ErrHubClosed - рассылка остановлена (сервер завершает работу)
+	ErrHubClosed = errors.New("stream hub closed")
+	// ErrSlowConsumer - подписчик не успевал забирать события и был отключен
+	ErrSlowConsumer = errors.New("slow consumer")
+)
+
+// Event - изменение метрики: новое значение gauge или накопленное значение counter метрики
+type Event struct {
+	memstorage.Metric
+	Time time.Time `json:"time"`
+}
+
+// Hub - рассылка изменений метрик подписчикам.
+// Publish никогда не блокируется: если подписчик не успевает забирать события и его буфер полон,
+// новые события для него отбрасываются и учитываются в Dropped, а после MaxLag пропущенных
+// подряд событий подписка закрывается с ErrSlowConsumer.
+type Hub struct {
+	Buffer int // размер буфера новых подписок
+	MaxLag int // 0 - медленные подписчики не отключаются
+
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		Buffer: DefaultBuffer,
+		MaxLag: DefaultMaxLag,
+		subs:   make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscription - подписка на изменения метрик, подходящих под фильтр.
+// Подписчик читает события из Events до закрытия Done, после чего должен вызвать Hub.Unsubscribe.
+type Subscription struct {
+	filter *Filter
+	events chan Event
+	done   chan struct{}
+	once   sync.Once
+	err    error
+
+	dropped atomic.Uint64 // пропущено событий с последнего вызова TakeDropped
+	lag     atomic.Int64  // пропущено событий подряд
+}
+
+// Events - события для подписчика
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Done закрывается, когда подписка прекращена хабом; причину возвращает Err
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err возвращает ErrHubClosed или ErrSlowConsumer после закрытия Done, до этого - nil
+func (s *Subscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// TakeDropped возвращает количество событий, пропущенных с прошлого вызова, и сбрасывает его
+func (s *Subscription) TakeDropped() uint64 {
+	return s.dropped.Swap(0)
+}
+
+func (s *Subscription) close(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.done)
+	})
+}
+
+// Subscribe создает подписку на изменения метрик, подходящих под filter (nil - все метрики)
+func (h *Hub) Subscribe(filter *Filter) (*Subscription, error) {
+	buffer := h.Buffer
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	sub := &Subscription{
+		filter: filter,
+		events: make(chan Event, buffer),
+		done:   make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, ErrHubClosed
+	}
+	h.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// Unsubscribe удаляет подписку; повторный вызов ничего не делает
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	delete(h.subs, sub)
+	h.mu.Unlock()
+	sub.close(ErrHubClosed)
+}
+
+// Wants сообщает, есть ли подписчики на метрику; позволяет не готовить события, которые никому не нужны
+func (h *Hub) Wants(metricType, name string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subs {
+		if sub.filter.Matches(metricType, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish рассылает события подходящим подписчикам без ожидания
+func (h *Hub) Publish(events ...Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subs {
+		for _, e := range events {
+			if sub.filter.Matches(e.MType, e.ID) {
+				h.deliver(sub, e)
+			}
+		}
+	}
+}
+
+func (h *Hub) deliver(sub *Subscription, e Event) {
+	select {
+	case <-sub.done:
+		return
+	default:
+	}
+
+	select {
+	case sub.events <- e:
+		sub.lag.Store(0)
+	default:
+		sub.dropped.Add(1)
+		if lag := sub.lag.Add(1); h.MaxLag > 0 && lag >= int64(h.MaxLag) {
+			sub.close(ErrSlowConsumer)
+		}
+	}
+}
+
+// Close закрывает все подписки с ErrHubClosed; новые подписки после этого не создаются
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subs {
+		sub.close(ErrHubClosed)
+		delete(h.subs, sub)
+	}
+}
@@ -0,0 +1,138 @@
+package stream
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/stretchr/testify/require"
+)
+
+func gaugeEvent(name string, value float64) Event {
+	return Event{Metric: memstorage.Metric{ID: name, MType: "gauge", Value: &value}}
+}
+
+func counterEvent(name string, delta int64) Event {
+	return Event{Metric: memstorage.Metric{ID: name, MType: "counter", Delta: &delta}}
+}
+
+// получить все события, уже отправленные подписчику
+func received(sub *Subscription) []Event {
+	var res []Event
+	for {
+		select {
+		case e := <-sub.Events():
+			res = append(res, e)
+		default:
+			return res
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		query string
+		want  map[string]bool // "тип/имя" -> подходит ли
+	}{
+		{"", map[string]bool{"gauge/Alloc": true, "counter/PollCount": true}},
+		{"type=gauge", map[string]bool{"gauge/Alloc": true, "counter/PollCount": false}},
+		{"match=CPU*&match=Alloc", map[string]bool{"gauge/CPUutilization1": true, "gauge/Alloc": true, "gauge/HeapAlloc": false}},
+		{"regex=Poll.*|Random.*&type=counter", map[string]bool{"counter/PollCount": true, "gauge/RandomValue": false, "counter/Alloc": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+			f, err := ParseFilter(values)
+			require.NoError(t, err)
+			for key, want := range tt.want {
+				mType, name, _ := strings.Cut(key, "/")
+				require.Equal(t, want, f.Matches(mType, name), key)
+			}
+		})
+	}
+
+	for _, query := range []string{"type=histogram", "type=foo", "regex=(", "match=a&regex=b"} {
+		values, err := url.ParseQuery(query)
+		require.NoError(t, err)
+		_, err = ParseFilter(values)
+		require.ErrorIs(t, err, memstorage.ErrInvalidListQuery, query)
+	}
+}
+
+func TestPublishFiltersSubscribers(t *testing.T) {
+	hub := NewHub()
+	gauges, err := NewFilter("gauge", nil, false)
+	require.NoError(t, err)
+	cpu, err := NewFilter("", []string{"CPU*"}, false)
+	require.NoError(t, err)
+
+	all, err := hub.Subscribe(nil)
+	require.NoError(t, err)
+	gaugeSub, err := hub.Subscribe(gauges)
+	require.NoError(t, err)
+	cpuSub, err := hub.Subscribe(cpu)
+	require.NoError(t, err)
+
+	require.True(t, hub.Wants("counter", "PollCount"))
+	hub.Publish(gaugeEvent("Alloc", 1), counterEvent("PollCount", 5), gaugeEvent("CPUutilization1", 0.5))
+
+	require.Len(t, received(all), 3)
+	require.Equal(t, []Event{gaugeEvent("Alloc", 1), gaugeEvent("CPUutilization1", 0.5)}, received(gaugeSub))
+	require.Equal(t, []Event{gaugeEvent("CPUutilization1", 0.5)}, received(cpuSub))
+
+	hub.Unsubscribe(all)
+	hub.Unsubscribe(gaugeSub)
+	require.False(t, hub.Wants("counter", "PollCount"))
+	require.True(t, hub.Wants("counter", "CPUcount"))
+	require.ErrorIs(t, all.Err(), ErrHubClosed)
+	require.NoError(t, cpuSub.Err())
+}
+
+// медленный подписчик не задерживает рассылку: лишние события отбрасываются,
+// а после MaxLag пропущенных подряд событий подписка закрывается
+func TestSlowConsumer(t *testing.T) {
+	hub := NewHub()
+	hub.Buffer = 2
+	hub.MaxLag = 3
+
+	slow, err := hub.Subscribe(nil)
+	require.NoError(t, err)
+
+	hub.Publish(gaugeEvent("g1", 1), gaugeEvent("g2", 2), gaugeEvent("g3", 3))
+	require.Equal(t, uint64(1), slow.TakeDropped())
+	require.Equal(t, uint64(0), slow.TakeDropped())
+	require.NoError(t, slow.Err())
+
+	// подписчик забрал события: счетчик пропущенных подряд обнуляется
+	require.Len(t, received(slow), 2)
+	hub.Publish(gaugeEvent("g4", 4), gaugeEvent("g5", 5), gaugeEvent("g6", 6), gaugeEvent("g7", 7))
+	require.NoError(t, slow.Err())
+
+	hub.Publish(gaugeEvent("g8", 8))
+	<-slow.Done()
+	require.ErrorIs(t, slow.Err(), ErrSlowConsumer)
+	require.Equal(t, uint64(3), slow.TakeDropped())
+
+	// закрытой подписке события больше не отправляются
+	require.Len(t, received(slow), 2)
+	hub.Publish(gaugeEvent("g9", 9))
+	require.Empty(t, received(slow))
+	require.Equal(t, uint64(0), slow.TakeDropped())
+}
+
+func TestHubClose(t *testing.T) {
+	hub := NewHub()
+	sub, err := hub.Subscribe(nil)
+	require.NoError(t, err)
+
+	hub.Close()
+	<-sub.Done()
+	require.ErrorIs(t, sub.Err(), ErrHubClosed)
+	require.False(t, hub.Wants("gauge", "Alloc"))
+
+	_, err = hub.Subscribe(nil)
+	require.ErrorIs(t, err, ErrHubClosed)
+	hub.Unsubscribe(sub)
+}
@@ -0,0 +1,693 @@
+// Package boltstorage - хранилище метрик во встроенной базе bbolt (один файл на диске),
+// для небольших установок, которым нужна надежность без отдельного сервера Postgres.
+package boltstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/internal/api"
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	_ api.Storager = (*BoltStorage)(nil)
+)
+
+// бакеты верхнего уровня:
+// gauge, counter, histogram, summary - текущие значения (ключ - ключ метрики, см. memstorage.SeriesKey);
+// updated - время последнего обновления (ключ - seriesID);
+// samples - история значений, rollups_60 и rollups_3600 - агрегаты:
+// в них по вложенному бакету на метрику (имя - seriesID), ключи упорядочены по времени;
+// meta - служебные значения
+var (
+	bucketGauge     = []byte("gauge")
+	bucketCounter   = []byte("counter")
+	bucketHistogram = []byte("histogram")
+	bucketSummary   = []byte("summary")
+	bucketUpdated   = []byte("updated")
+	bucketSamples   = []byte("samples")
+	bucketMinutes   = []byte("rollups_60")
+	bucketHours     = []byte("rollups_3600")
+	bucketMeta      = []byte("meta")
+
+	// до этого момента часовые агрегаты уже посчитаны (см. Compact)
+	keyCompactedUntil = []byte("compacted_until")
+)
+
+// BoltStorage - имплементация интерфейса Storager на встроенной базе bbolt.
+// Семантика методов такая же, как у MemStorage и DBStorage.
+// Контекст вызова не используется: транзакции bbolt локальны и не отменяются.
+type BoltStorage struct {
+	db *bolt.DB
+	// сроки хранения истории; незаданные сроки берутся из memstorage.DefaultRetention
+	Retention memstorage.RetentionPolicy
+	now       func() time.Time
+}
+
+// New открывает (или создает) файл базы path
+func New(path string) (*BoltStorage, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketGauge, bucketCounter, bucketHistogram, bucketSummary,
+			bucketUpdated, bucketSamples, bucketMinutes, bucketHours, bucketMeta} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStorage{db: db, now: time.Now}, nil
+}
+
+// seriesID - ключ метрики с учетом типа (имена метрик разных типов могут совпадать)
+func seriesID(metricType, name string) []byte {
+	return []byte(metricType + "\x00" + name)
+}
+
+func timeKey(t time.Time) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(t.UnixNano()))
+	return b
+}
+
+func keyTime(b []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b[:8])))
+}
+
+func float64Bytes(v float64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, math.Float64bits(v))
+	return b
+}
+
+func bytesFloat64(b []byte) float64 {
+	return math.Float64frombits(binary.BigEndian.Uint64(b))
+}
+
+func (s *BoltStorage) GetGaugeMetric(_ context.Context, name string) (float64, bool, error) {
+	var value float64
+	var ok bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketGauge).Get([]byte(name)); v != nil {
+			value, ok = bytesFloat64(v), true
+		}
+		return nil
+	})
+	return value, ok, err
+}
+
+func (s *BoltStorage) GetCounterMetric(_ context.Context, name string) (int64, bool, error) {
+	var value int64
+	var ok bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketCounter).Get([]byte(name)); v != nil {
+			value, ok = int64(binary.BigEndian.Uint64(v)), true
+		}
+		return nil
+	})
+	return value, ok, err
+}
+
+func (s *BoltStorage) AddGaugeMetric(_ context.Context, name string, value float64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.addGauge(tx, name, value)
+	})
+}
+
+func (s *BoltStorage) addGauge(tx *bolt.Tx, name string, value float64) error {
+	if err := tx.Bucket(bucketGauge).Put([]byte(name), float64Bytes(value)); err != nil {
+		return err
+	}
+	// вместе с текущим значением дописываем точку в историю метрики и в минутный агрегат
+	return s.recordSample(tx, "gauge", name, value, value)
+}
+
+func (s *BoltStorage) AddCounterMetric(_ context.Context, name string, delta int64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.addCounter(tx, name, delta)
+	})
+}
+
+func (s *BoltStorage) addCounter(tx *bolt.Tx, name string, delta int64) error {
+	b := tx.Bucket(bucketCounter)
+	value := delta
+	if v := b.Get([]byte(name)); v != nil {
+		value += int64(binary.BigEndian.Uint64(v))
+	}
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, uint64(value))
+	if err := b.Put([]byte(name), data); err != nil {
+		return err
+	}
+	// в историю пишется накопленное значение счетчика, а в минутный агрегат - приращение
+	return s.recordSample(tx, "counter", name, float64(value), float64(delta))
+}
+
+// recordSample дописывает значение в историю метрики, приращение - в минутный агрегат
+// и запоминает время обновления
+func (s *BoltStorage) recordSample(tx *bolt.Tx, metricType, name string, value, rollupValue float64) error {
+	now := s.now()
+	id := seriesID(metricType, name)
+
+	samples, err := tx.Bucket(bucketSamples).CreateBucketIfNotExists(id)
+	if err != nil {
+		return err
+	}
+	// значения с одинаковым временем различаются порядковым номером
+	seq, err := samples.NextSequence()
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 16)
+	copy(key, timeKey(now))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	if err = samples.Put(key, float64Bytes(value)); err != nil {
+		return err
+	}
+
+	minutes, err := tx.Bucket(bucketMinutes).CreateBucketIfNotExists(id)
+	if err != nil {
+		return err
+	}
+	start := now.Truncate(memstorage.MinuteResolution)
+	r := memstorage.Rollup{Start: start}
+	if data := minutes.Get(timeKey(start)); data != nil {
+		if err = json.Unmarshal(data, &r); err != nil {
+			return err
+		}
+	}
+	r.Observe(rollupValue)
+	if err = putJSON(minutes, timeKey(start), r); err != nil {
+		return err
+	}
+
+	return s.touch(tx, metricType, name)
+}
+
+// touch запоминает время обновления метрики
+func (s *BoltStorage) touch(tx *bolt.Tx, metricType, name string) error {
+	return tx.Bucket(bucketUpdated).Put(seriesID(metricType, name), timeKey(s.now()))
+}
+
+func putJSON(b *bolt.Bucket, key []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+func (s *BoltStorage) GetAllGaugeMetrics(_ context.Context) (map[string]float64, error) {
+	res := make(map[string]float64)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketGauge).ForEach(func(k, v []byte) error {
+			res[string(k)] = bytesFloat64(v)
+			return nil
+		})
+	})
+	return res, err
+}
+
+func (s *BoltStorage) GetAllCounterMetrics(_ context.Context) (map[string]int64, error) {
+	res := make(map[string]int64)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketCounter).ForEach(func(k, v []byte) error {
+			res[string(k)] = int64(binary.BigEndian.Uint64(v))
+			return nil
+		})
+	})
+	return res, err
+}
+
+func (s *BoltStorage) GetHistogramMetric(_ context.Context, name string) (memstorage.Histogram, bool, error) {
+	var h memstorage.Histogram
+	var ok bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketHistogram).Get([]byte(name))
+		if data == nil {
+			return nil
+		}
+		ok = true
+		return json.Unmarshal(data, &h)
+	})
+	return h, ok, err
+}
+
+// AddHistogramMetric прибавляет к накопленной гистограмме приращение h (см. memstorage.MergeHistograms)
+func (s *BoltStorage) AddHistogramMetric(_ context.Context, name string, h memstorage.Histogram) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.addHistogram(tx, name, h)
+	})
+}
+
+func (s *BoltStorage) addHistogram(tx *bolt.Tx, name string, h memstorage.Histogram) error {
+	b := tx.Bucket(bucketHistogram)
+	var stored memstorage.Histogram
+	data := b.Get([]byte(name))
+	if data != nil {
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+	}
+	if err := putJSON(b, []byte(name), memstorage.MergeHistograms(stored, data != nil, h)); err != nil {
+		return err
+	}
+	return s.touch(tx, "histogram", name)
+}
+
+func (s *BoltStorage) GetAllHistogramMetrics(_ context.Context) (map[string]memstorage.Histogram, error) {
+	res := make(map[string]memstorage.Histogram)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketHistogram).ForEach(func(k, v []byte) error {
+			var h memstorage.Histogram
+			if err := json.Unmarshal(v, &h); err != nil {
+				return err
+			}
+			res[string(k)] = h
+			return nil
+		})
+	})
+	return res, err
+}
+
+func (s *BoltStorage) GetSummaryMetric(_ context.Context, name string) (*ddsketch.Sketch, bool, error) {
+	var sketch *ddsketch.Sketch
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketSummary).Get([]byte(name))
+		if data == nil {
+			return nil
+		}
+		sketch = &ddsketch.Sketch{}
+		return json.Unmarshal(data, sketch)
+	})
+	return sketch, sketch != nil, err
+}
+
+// AddSummaryMetric объединяет накопленный скетч с присланным (см. memstorage.MergeSummaries)
+func (s *BoltStorage) AddSummaryMetric(_ context.Context, name string, sketch *ddsketch.Sketch) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.addSummary(tx, name, sketch)
+	})
+}
+
+func (s *BoltStorage) addSummary(tx *bolt.Tx, name string, sketch *ddsketch.Sketch) error {
+	b := tx.Bucket(bucketSummary)
+	var stored *ddsketch.Sketch
+	if data := b.Get([]byte(name)); data != nil {
+		stored = &ddsketch.Sketch{}
+		if err := json.Unmarshal(data, stored); err != nil {
+			return err
+		}
+	}
+	if err := putJSON(b, []byte(name), memstorage.MergeSummaries(stored, sketch)); err != nil {
+		return err
+	}
+	return s.touch(tx, "summary", name)
+}
+
+// AddMetrics записывает пакет метрик в одной транзакции bolt: при ошибке не сохраняется ни одна метрика пакета
+func (s *BoltStorage) AddMetrics(_ context.Context, metrics []memstorage.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	for _, metric := range metrics {
+		if err := metric.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, metric := range metrics {
+			var err error
+			switch metric.MType {
+			case "gauge":
+				err = s.addGauge(tx, metric.Key(), *metric.Value)
+			case "counter":
+				err = s.addCounter(tx, metric.Key(), *metric.Delta)
+			case "histogram":
+				err = s.addHistogram(tx, metric.Key(), *metric.Histogram)
+			case "summary":
+				err = s.addSummary(tx, metric.Key(), metric.Summary)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStorage) GetAllSummaryMetrics(_ context.Context) (map[string]*ddsketch.Sketch, error) {
+	res := make(map[string]*ddsketch.Sketch)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSummary).ForEach(func(k, v []byte) error {
+			sketch := &ddsketch.Sketch{}
+			if err := json.Unmarshal(v, sketch); err != nil {
+				return err
+			}
+			res[string(k)] = sketch
+			return nil
+		})
+	})
+	return res, err
+}
+
+// ListMetrics возвращает страницу метрик, выбранных по q, и общее количество подходящих метрик
+// (метрики читаются в одной транзакции и отбираются так же, как в MemStorage)
+func (s *BoltStorage) ListMetrics(_ context.Context, q memstorage.ListQuery) ([]memstorage.Metric, int, error) {
+	if err := q.Validate(); err != nil {
+		return nil, 0, err
+	}
+
+	var metrics []memstorage.Metric
+	err := s.db.View(func(tx *bolt.Tx) error {
+		for _, metricType := range []string{"gauge", "counter", "histogram", "summary"} {
+			if q.Type != "" && q.Type != metricType {
+				continue
+			}
+			err := tx.Bucket([]byte(metricType)).ForEach(func(k, v []byte) error {
+				name, labels := memstorage.SplitSeriesKey(string(k))
+				m := memstorage.Metric{ID: name, MType: metricType, Labels: labels}
+				switch metricType {
+				case "gauge":
+					value := bytesFloat64(v)
+					m.Value = &value
+				case "counter":
+					delta := int64(binary.BigEndian.Uint64(v))
+					m.Delta = &delta
+				case "histogram":
+					m.Histogram = &memstorage.Histogram{}
+					if err := json.Unmarshal(v, m.Histogram); err != nil {
+						return err
+					}
+				case "summary":
+					m.Summary = &ddsketch.Sketch{}
+					if err := json.Unmarshal(v, m.Summary); err != nil {
+						return err
+					}
+				}
+				metrics = append(metrics, m)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return memstorage.SelectMetrics(metrics, q)
+}
+
+// GetGaugeHistory возвращает значения gauge метрики, записанные с from по to включительно
+func (s *BoltStorage) GetGaugeHistory(_ context.Context, name string, from, to time.Time) ([]memstorage.Sample, error) {
+	return s.getHistory("gauge", name, from, to)
+}
+
+// GetCounterHistory возвращает накопленные значения counter метрики,
+// записанные с from по to включительно
+func (s *BoltStorage) GetCounterHistory(_ context.Context, name string, from, to time.Time) ([]memstorage.Sample, error) {
+	return s.getHistory("counter", name, from, to)
+}
+
+func (s *BoltStorage) getHistory(metricType, name string, from, to time.Time) ([]memstorage.Sample, error) {
+	res := []memstorage.Sample{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketSamples).Bucket(seriesID(metricType, name))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Seek(timeKey(from)); k != nil; k, v = c.Next() {
+			t := keyTime(k)
+			if t.After(to) {
+				break
+			}
+			res = append(res, memstorage.Sample{Timestamp: t, Value: bytesFloat64(v)})
+		}
+		return nil
+	})
+	return res, err
+}
+
+// GetRollups возвращает агрегаты gauge или counter метрики с разрешением resolution,
+// начавшиеся с from по to включительно. Часовые агрегаты появляются после компакции (см. Compact)
+// по окончании часа.
+func (s *BoltStorage) GetRollups(_ context.Context, metricType, name string, resolution time.Duration,
+	from, to time.Time) ([]memstorage.Rollup, error) {
+
+	if metricType != "gauge" && metricType != "counter" {
+		return nil, memstorage.ErrUnknownMetricType
+	}
+	bucket := bucketMinutes
+	switch resolution {
+	case memstorage.MinuteResolution:
+	case memstorage.HourResolution:
+		bucket = bucketHours
+	default:
+		return nil, memstorage.ErrUnknownResolution
+	}
+
+	res := []memstorage.Rollup{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket).Bucket(seriesID(metricType, name))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Seek(timeKey(from)); k != nil && !keyTime(k).After(to); k, v = c.Next() {
+			var r memstorage.Rollup
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			res = append(res, r)
+		}
+		return nil
+	})
+	return res, err
+}
+
+// Compact пересчитывает часовые агрегаты из минутных для закончившихся часов
+// и удаляет историю и агрегаты старше сроков хранения (см. Retention)
+func (s *BoltStorage) Compact(_ context.Context) error {
+	p := s.Retention.WithDefaults()
+	now := s.now()
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(bucketMeta)
+		var since time.Time
+		if v := meta.Get(keyCompactedUntil); v != nil {
+			since = keyTime(v)
+		}
+
+		from, to := p.HourWindow(since, now)
+		if from.Before(to) {
+			hours := tx.Bucket(bucketHours)
+			err := tx.Bucket(bucketMinutes).ForEachBucket(func(id []byte) error {
+				return compactSeries(tx.Bucket(bucketMinutes).Bucket(id), hours, id, from, to)
+			})
+			if err != nil {
+				return err
+			}
+			if err = meta.Put(keyCompactedUntil, timeKey(to)); err != nil {
+				return err
+			}
+		}
+
+		for bucket, retention := range map[string]time.Duration{
+			string(bucketSamples): p.Raw,
+			string(bucketMinutes): p.Minute,
+			string(bucketHours):   p.Hour,
+		} {
+			if err := pruneSeries(tx.Bucket([]byte(bucket)), now.Add(-retention)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// compactSeries пересчитывает часовые агрегаты одной метрики из ее минутных агрегатов в интервале [from, to)
+func compactSeries(minutes, hours *bolt.Bucket, id []byte, from, to time.Time) error {
+	var hour *memstorage.Rollup
+	flush := func() error {
+		if hour == nil {
+			return nil
+		}
+		b, err := hours.CreateBucketIfNotExists(id)
+		if err != nil {
+			return err
+		}
+		return putJSON(b, timeKey(hour.Start), hour)
+	}
+
+	c := minutes.Cursor()
+	for k, v := c.Seek(timeKey(from)); k != nil && keyTime(k).Before(to); k, v = c.Next() {
+		var m memstorage.Rollup
+		if err := json.Unmarshal(v, &m); err != nil {
+			return err
+		}
+		start := m.Start.Truncate(memstorage.HourResolution)
+		if hour == nil || !hour.Start.Equal(start) {
+			if err := flush(); err != nil {
+				return err
+			}
+			hour = &memstorage.Rollup{Start: start}
+		}
+		hour.Merge(m)
+	}
+	return flush()
+}
+
+// pruneSeries удаляет из вложенных бакетов метрик записи старше before,
+// а опустевшие бакеты удаляет целиком
+func pruneSeries(b *bolt.Bucket, before time.Time) error {
+	// бакет нельзя изменять во время обхода, поэтому сначала собираем ключи метрик
+	var ids [][]byte
+	err := b.ForEachBucket(func(id []byte) error {
+		ids = append(ids, append([]byte(nil), id...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	limit := timeKey(before)
+	for _, id := range ids {
+		c := b.Bucket(id).Cursor()
+		k, _ := c.First()
+		for ; k != nil && bytes.Compare(k[:8], limit) < 0; k, _ = c.First() {
+			if err = c.Delete(); err != nil {
+				return err
+			}
+		}
+		if k == nil {
+			if err = b.DeleteBucket(id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteMetric удаляет метрику вместе с ее историей и агрегатами; возвращает false, если метрики не было
+func (s *BoltStorage) DeleteMetric(_ context.Context, metricType, name string) (bool, error) {
+	if !memstorage.ValidMetricType(metricType) {
+		return false, memstorage.ErrUnknownMetricType
+	}
+
+	var exists bool
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		exists, err = deleteMetric(tx, seriesID(metricType, name))
+		return err
+	})
+	return exists, err
+}
+
+// DeleteMetrics удаляет пакет метрик в одной транзакции; возвращает количество удаленных метрик
+func (s *BoltStorage) DeleteMetrics(_ context.Context, metrics []memstorage.Metric) (int, error) {
+	for _, metric := range metrics {
+		if !memstorage.ValidMetricType(metric.MType) {
+			return 0, memstorage.ErrUnknownMetricType
+		}
+	}
+
+	deleted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, metric := range metrics {
+			exists, err := deleteMetric(tx, seriesID(metric.MType, metric.Key()))
+			if err != nil {
+				return err
+			}
+			if exists {
+				deleted++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// DeleteStaleMetrics удаляет метрики, которые не обновлялись дольше ttl;
+// возвращает количество удаленных метрик
+func (s *BoltStorage) DeleteStaleMetrics(_ context.Context, ttl time.Duration) (int, error) {
+	before := timeKey(s.now().Add(-ttl))
+
+	deleted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var stale [][]byte
+		err := tx.Bucket(bucketUpdated).ForEach(func(id, updated []byte) error {
+			if bytes.Compare(updated, before) < 0 {
+				stale = append(stale, append([]byte(nil), id...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range stale {
+			exists, err := deleteMetric(tx, id)
+			if err != nil {
+				return err
+			}
+			if exists {
+				deleted++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// deleteMetric удаляет значение, историю, агрегаты и время обновления метрики с ключом id (см. seriesID)
+func deleteMetric(tx *bolt.Tx, id []byte) (bool, error) {
+	metricType, name, _ := bytes.Cut(id, []byte{0})
+
+	values := tx.Bucket(metricType)
+	if values == nil {
+		return false, memstorage.ErrUnknownMetricType
+	}
+	exists := values.Get(name) != nil
+	if err := values.Delete(name); err != nil {
+		return false, err
+	}
+
+	for _, bucket := range [][]byte{bucketSamples, bucketMinutes, bucketHours} {
+		err := tx.Bucket(bucket).DeleteBucket(id)
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return false, err
+		}
+	}
+	return exists, tx.Bucket(bucketUpdated).Delete(id)
+}
+
+// Finalize закрывает файл базы
+func (s *BoltStorage) Finalize(_ context.Context) error {
+	return s.db.Close()
+}
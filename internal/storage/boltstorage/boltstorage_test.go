@@ -0,0 +1,111 @@
+package boltstorage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltStorage(t *testing.T) {
+	s, err := New(filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, err)
+
+	// общий для всех хранилищ набор проверок
+	storagetest.Run(t, s)
+
+	err = s.Finalize(context.Background())
+	require.NoError(t, err)
+}
+
+// метрики и их история сохраняются в файле и доступны после повторного открытия
+func TestBoltStorageReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+
+	s, err := New(path)
+	require.NoError(t, err)
+	require.NoError(t, s.AddGaugeMetric(context.Background(), "g1", 1.5))
+	require.NoError(t, s.AddCounterMetric(context.Background(), `c1{host="a"}`, 3))
+	require.NoError(t, s.AddCounterMetric(context.Background(), `c1{host="a"}`, 4))
+	require.NoError(t, s.Finalize(context.Background()))
+
+	s, err = New(path)
+	require.NoError(t, err)
+	defer s.Finalize(context.Background())
+
+	gMetrics, err := s.GetAllGaugeMetrics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{"g1": 1.5}, gMetrics)
+
+	cValue, ok, err := s.GetCounterMetric(context.Background(), `c1{host="a"}`)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(7), cValue)
+
+	cHistory, err := s.GetCounterHistory(context.Background(), `c1{host="a"}`, time.Now().Add(-time.Hour), time.Now())
+	require.NoError(t, err)
+	require.Len(t, cHistory, 2)
+	require.Equal(t, float64(7), cHistory[1].Value)
+}
+
+// файл базы нельзя открыть дважды
+func TestBoltStorageLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+
+	s, err := New(path)
+	require.NoError(t, err)
+	defer s.Finalize(context.Background())
+
+	_, err = New(path)
+	require.Error(t, err)
+}
+
+func TestBoltStorageCompact(t *testing.T) {
+	s, err := New(filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, err)
+	defer s.Finalize(context.Background())
+	s.Retention = memstorage.RetentionPolicy{Raw: time.Hour, Minute: 3 * time.Hour, Hour: 5 * time.Hour}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	current := start
+	s.now = func() time.Time { return current }
+
+	for i := 0; i < 8; i++ {
+		current = start.Add(time.Duration(i) * time.Hour)
+		require.NoError(t, s.AddGaugeMetric(context.Background(), "g1", float64(i)))
+		require.NoError(t, s.AddGaugeMetric(context.Background(), "g1", float64(i)+0.5))
+		require.NoError(t, s.Compact(context.Background()))
+	}
+
+	current = start.Add(8 * time.Hour)
+	require.NoError(t, s.Compact(context.Background()))
+
+	// исходные значения хранятся час
+	raw, err := s.GetGaugeHistory(context.Background(), "g1", start, current)
+	require.NoError(t, err)
+	require.Len(t, raw, 2)
+	require.True(t, start.Add(7*time.Hour).Equal(raw[0].Timestamp))
+
+	// минутные агрегаты - три часа
+	minutes, err := s.GetRollups(context.Background(), "gauge", "g1", memstorage.MinuteResolution, start, current)
+	require.NoError(t, err)
+	require.Len(t, minutes, 3)
+
+	// часовые агрегаты - пять часов, каждый посчитан по окончании часа
+	hours, err := s.GetRollups(context.Background(), "gauge", "g1", memstorage.HourResolution, start, current)
+	require.NoError(t, err)
+	require.Len(t, hours, 5)
+	require.True(t, start.Add(3*time.Hour).Equal(hours[0].Start))
+	require.Equal(t, memstorage.Rollup{Start: hours[4].Start, Min: 7, Max: 7.5, Sum: 14.5, Count: 2, Last: 7.5}, hours[4])
+
+	// после удаления всех значений бакеты метрики удаляются
+	current = start.Add(24 * time.Hour)
+	require.NoError(t, s.Compact(context.Background()))
+	hours, err = s.GetRollups(context.Background(), "gauge", "g1", memstorage.HourResolution, start, current)
+	require.NoError(t, err)
+	require.Empty(t, hours)
+}
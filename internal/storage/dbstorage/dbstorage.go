@@ -3,30 +3,98 @@ package dbstorage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/adettelle/go-metric-collector/internal/api"
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 var (
 	_ api.Storager = (*DBStorage)(nil)
 )
 
-// DBStorage - это имплементация (или реализация) интерфейса Storage
+// DBStorage - это имплементация (или реализация) интерфейса Storage.
+// Ключ метрики с метками (см. memstorage.SeriesKey) хранится в виде имени
+// в metric_id и меток в колонке labels (jsonb, '{}' для метрики без меток).
 type DBStorage struct {
-	Ctx context.Context
-	DB  *sql.DB
+	DB *sql.DB
+	// ограничение времени одного вызова (0 - без ограничения, остается только отмена контекста запроса)
+	QueryTimeout time.Duration
+	// сроки хранения истории; незаданные сроки берутся из memstorage.DefaultRetention
+	Retention memstorage.RetentionPolicy
+	// до этого момента часовые агрегаты уже посчитаны (Compact вызывается из одной горутины)
+	compactedUntil time.Time
 }
 
-func (s *DBStorage) GetGaugeMetric(name string) (float64, bool, error) {
+// rollupUpsert дописывает значение $4 в минутный агрегат метрики, обновленной в CTE upserted
+const rollupUpsert = `insert into metric_rollup (metric_type, metric_id, labels, resolution, bucket, min, max, sum, count, last)
+		select metric_type, metric_id, labels, 60, date_trunc('minute', now()),
+		$4::double precision, $4::double precision, $4::double precision, 1, $4::double precision from upserted
+		on conflict (metric_type, metric_id, labels, resolution, bucket) do update set
+		min = least(metric_rollup.min, excluded.min), max = greatest(metric_rollup.max, excluded.max),
+		sum = metric_rollup.sum + excluded.sum, count = metric_rollup.count + 1, last = excluded.last`
 
-	sqlStatement := "SELECT value FROM metric WHERE metric_type = 'gauge' and metric_id = $1"
-	row := s.DB.QueryRowContext(s.Ctx, sqlStatement, name)
+// withTimeout ограничивает контекст вызова сроком QueryTimeout, если он задан
+func (s *DBStorage) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.QueryTimeout)
+}
+
+// querier - общие методы *sql.DB и *sql.Tx: запросы записи метрик выполняются
+// и по отдельности, и внутри транзакции пакетной записи (см. AddMetrics)
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// seriesParams раскладывает ключ метрики на имя и метки в формате json
+func seriesParams(key string) (string, string, error) {
+	name, labels := memstorage.SplitSeriesKey(key)
+	if len(labels) == 0 {
+		return name, "{}", nil
+	}
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return "", "", err
+	}
+	return name, string(data), nil
+}
+
+// seriesKey собирает ключ метрики из имени и меток, прочитанных из БД
+func seriesKey(name string, labelsJSON []byte) (string, error) {
+	var labels memstorage.Labels
+	if err := json.Unmarshal(labelsJSON, &labels); err != nil {
+		return "", err
+	}
+	return memstorage.SeriesKey(name, labels), nil
+}
+
+func (s *DBStorage) GetGaugeMetric(ctx context.Context, name string) (float64, bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	metricID, labels, err := seriesParams(name)
+	if err != nil {
+		return 0, false, err
+	}
+
+	sqlStatement := "SELECT value FROM metric WHERE metric_type = 'gauge' and metric_id = $1 and labels = $2::jsonb"
+	row := s.DB.QueryRowContext(ctx, sqlStatement, metricID, labels)
 
 	// переменная для чтения результата
 	var val float64
 
-	err := row.Scan(&val)
+	err = row.Scan(&val)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return 0, false, nil
@@ -37,15 +105,22 @@ func (s *DBStorage) GetGaugeMetric(name string) (float64, bool, error) {
 	return val, true, err
 }
 
-func (s *DBStorage) GetCounterMetric(name string) (int64, bool, error) {
+func (s *DBStorage) GetCounterMetric(ctx context.Context, name string) (int64, bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	sqlStatement := "SELECT delta FROM metric WHERE metric_type = 'counter' and metric_id = $1"
-	row := s.DB.QueryRowContext(s.Ctx, sqlStatement, name)
+	metricID, labels, err := seriesParams(name)
+	if err != nil {
+		return 0, false, err
+	}
+
+	sqlStatement := "SELECT delta FROM metric WHERE metric_type = 'counter' and metric_id = $1 and labels = $2::jsonb"
+	row := s.DB.QueryRowContext(ctx, sqlStatement, metricID, labels)
 
 	// переменная для чтения результата
 	var val int64
 
-	err := row.Scan(&val)
+	err = row.Scan(&val)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return 0, false, nil
@@ -56,13 +131,32 @@ func (s *DBStorage) GetCounterMetric(name string) (int64, bool, error) {
 	return val, true, err
 }
 
-func (s *DBStorage) AddGaugeMetric(name string, value float64) error {
+func (s *DBStorage) AddGaugeMetric(ctx context.Context, name string, value float64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.addGauge(ctx, s.DB, name, value)
+}
+
+func (s *DBStorage) addGauge(ctx context.Context, q querier, name string, value float64) error {
 	log.Println("Writing to DB")
 
-	sqlStatement := `insert into metric (metric_type, metric_id, value) 
-		values ('gauge', $1, $2) on conflict (metric_id, metric_type) do update set value = $2`
+	metricID, labels, err := seriesParams(name)
+	if err != nil {
+		return err
+	}
 
-	_, err := s.DB.ExecContext(s.Ctx, sqlStatement, name, value)
+	// вместе с текущим значением дописываем точку в историю метрики и в минутный агрегат
+	sqlStatement := `with upserted as (
+		insert into metric (metric_type, metric_id, labels, value) 
+		values ('gauge', $1, $3::jsonb, $2) on conflict (metric_id, metric_type, labels) do update set value = $2, updated_at = now()
+		returning metric_type, metric_id, labels, value),
+		sampled as (
+		insert into metric_sample (metric_type, metric_id, labels, value)
+		select metric_type, metric_id, labels, value from upserted)
+		` + rollupUpsert
+
+	_, err = q.ExecContext(ctx, sqlStatement, metricID, value, labels, value)
 	if err != nil {
 		log.Println("error in updating gauge metric:", err)
 		return err
@@ -72,15 +166,35 @@ func (s *DBStorage) AddGaugeMetric(name string, value float64) error {
 	return nil
 }
 
-func (s *DBStorage) AddCounterMetric(name string, delta int64) error {
+func (s *DBStorage) AddCounterMetric(ctx context.Context, name string, delta int64) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.addCounter(ctx, s.DB, name, delta)
+}
+
+func (s *DBStorage) addCounter(ctx context.Context, q querier, name string, delta int64) error {
 	log.Println("In AddCounterMetric")
 
-	sqlStatement := `insert into metric (metric_type, metric_id, delta)
-		values ('counter', $1, $2)
-		on conflict (metric_id, metric_type) do update set
-		delta = (select delta from metric where metric_type = 'counter' and metric_id = $1) + $2`
+	metricID, labels, err := seriesParams(name)
+	if err != nil {
+		return err
+	}
+
+	// в историю пишется накопленное значение счетчика после обновления,
+	// а в минутный агрегат - приращение
+	sqlStatement := `with upserted as (
+		insert into metric (metric_type, metric_id, labels, delta)
+		values ('counter', $1, $3::jsonb, $2)
+		on conflict (metric_id, metric_type, labels) do update set
+		delta = metric.delta + $2, updated_at = now()
+		returning metric_type, metric_id, labels, delta),
+		sampled as (
+		insert into metric_sample (metric_type, metric_id, labels, value)
+		select metric_type, metric_id, labels, delta from upserted)
+		` + rollupUpsert
 
-	_, err := s.DB.ExecContext(s.Ctx, sqlStatement, name, delta)
+	_, err = q.ExecContext(ctx, sqlStatement, metricID, delta, labels, float64(delta))
 	if err != nil {
 		log.Println("error in updating counter metric:", err)
 		return err
@@ -89,10 +203,13 @@ func (s *DBStorage) AddCounterMetric(name string, delta int64) error {
 	return nil
 }
 
-func (s *DBStorage) GetAllCounterMetrics() (map[string]int64, error) {
-	sqlStatement := "SELECT metric_id, delta FROM metric WHERE metric_type = 'counter'"
+func (s *DBStorage) GetAllCounterMetrics(ctx context.Context) (map[string]int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	rows, err := s.DB.QueryContext(s.Ctx, sqlStatement)
+	sqlStatement := "SELECT metric_id, labels, delta FROM metric WHERE metric_type = 'counter'"
+
+	rows, err := s.DB.QueryContext(ctx, sqlStatement)
 	if err != nil {
 		return nil, err
 	}
@@ -101,11 +218,16 @@ func (s *DBStorage) GetAllCounterMetrics() (map[string]int64, error) {
 	res := make(map[string]int64)
 	for rows.Next() {
 		var name string
+		var labels []byte
 		var d int64
-		if err = rows.Scan(&name, &d); err != nil {
+		if err = rows.Scan(&name, &labels, &d); err != nil {
+			return nil, err
+		}
+		key, err := seriesKey(name, labels)
+		if err != nil {
 			return nil, err
 		}
-		res[name] = d
+		res[key] = d
 	}
 	// проверяем на ошибки
 	err = rows.Err()
@@ -116,12 +238,15 @@ func (s *DBStorage) GetAllCounterMetrics() (map[string]int64, error) {
 	return res, nil
 }
 
-func (s *DBStorage) GetAllGaugeMetrics() (map[string]float64, error) {
+func (s *DBStorage) GetAllGaugeMetrics(ctx context.Context) (map[string]float64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	var err error
 
-	sqlStatement := "SELECT metric_id, value FROM metric WHERE metric_type = 'gauge'"
+	sqlStatement := "SELECT metric_id, labels, value FROM metric WHERE metric_type = 'gauge'"
 
-	rows, err := s.DB.QueryContext(s.Ctx, sqlStatement)
+	rows, err := s.DB.QueryContext(ctx, sqlStatement)
 	if err != nil {
 		return nil, err
 	}
@@ -130,12 +255,641 @@ func (s *DBStorage) GetAllGaugeMetrics() (map[string]float64, error) {
 	res := make(map[string]float64)
 	for rows.Next() {
 		var name string
+		var labels []byte
 		var v float64
-		if err = rows.Scan(&name, &v); err != nil {
+		if err = rows.Scan(&name, &labels, &v); err != nil {
+			return nil, err
+		}
+		key, err := seriesKey(name, labels)
+		if err != nil {
+			return nil, err
+		}
+
+		res[key] = v
+	}
+	// проверяем на ошибки
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *DBStorage) GetHistogramMetric(ctx context.Context, name string) (memstorage.Histogram, bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	metricID, labels, err := seriesParams(name)
+	if err != nil {
+		return memstorage.Histogram{}, false, err
+	}
+
+	sqlStatement := "SELECT histogram FROM metric WHERE metric_type = 'histogram' and metric_id = $1 and labels = $2::jsonb"
+	row := s.DB.QueryRowContext(ctx, sqlStatement, metricID, labels)
+
+	var data []byte
+	err = row.Scan(&data)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return memstorage.Histogram{}, false, nil
+		}
+		return memstorage.Histogram{}, false, err
+	}
+
+	var h memstorage.Histogram
+	if err = json.Unmarshal(data, &h); err != nil {
+		return memstorage.Histogram{}, false, err
+	}
+	return h, true, nil
+}
+
+// AddHistogramMetric прибавляет приращение h к гистограмме в БД.
+// Чтение и запись выполняются в одной транзакции с блокировкой строки,
+// чтобы одновременные обновления не потеряли приращения.
+func (s *DBStorage) AddHistogramMetric(ctx context.Context, name string, h memstorage.Histogram) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = s.addHistogram(ctx, tx, name, h); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *DBStorage) addHistogram(ctx context.Context, tx *sql.Tx, name string, h memstorage.Histogram) error {
+	metricID, labels, err := seriesParams(name)
+	if err != nil {
+		return err
+	}
+
+	data, err := lockMetricRow(ctx, tx, "histogram", metricID, labels)
+	if err != nil {
+		return err
+	}
+
+	var stored memstorage.Histogram
+	exists := data != nil
+	if exists {
+		if err = json.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+	}
+
+	data, err = json.Marshal(memstorage.MergeHistograms(stored, exists, h))
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := `update metric set histogram = $3::jsonb, updated_at = now()
+		where metric_type = 'histogram' and metric_id = $1 and labels = $2::jsonb`
+
+	_, err = tx.ExecContext(ctx, sqlStatement, metricID, labels, string(data))
+	if err != nil {
+		log.Println("error in updating histogram metric:", err)
+		return err
+	}
+
+	return nil
+}
+
+// lockMetricRow блокирует до конца транзакции tx строку histogram или summary метрики
+// и возвращает ее значение (nil, если метрики еще не было). Если строки нет, она сначала
+// создается без значения: SELECT ... FOR UPDATE не блокирует несуществующую строку,
+// и два одновременных первых обновления иначе перезаписали бы друг друга.
+func lockMetricRow(ctx context.Context, tx *sql.Tx, mType string, metricID string, labels string) ([]byte, error) {
+	sqlStatement := `insert into metric (metric_type, metric_id, labels) values ($1, $2, $3::jsonb)
+		on conflict (metric_id, metric_type, labels) do nothing`
+	if _, err := tx.ExecContext(ctx, sqlStatement, mType, metricID, labels); err != nil {
+		return nil, err
+	}
+
+	// mType - histogram или summary, и совпадает с именем столбца значения
+	sqlStatement = `SELECT ` + mType + ` FROM metric
+		WHERE metric_type = $1 and metric_id = $2 and labels = $3::jsonb FOR UPDATE`
+	var data []byte
+	if err := tx.QueryRowContext(ctx, sqlStatement, mType, metricID, labels).Scan(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *DBStorage) GetAllHistogramMetrics(ctx context.Context) (map[string]memstorage.Histogram, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	sqlStatement := "SELECT metric_id, labels, histogram FROM metric WHERE metric_type = 'histogram'"
+
+	rows, err := s.DB.QueryContext(ctx, sqlStatement)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[string]memstorage.Histogram)
+	for rows.Next() {
+		var name string
+		var labels, data []byte
+		if err = rows.Scan(&name, &labels, &data); err != nil {
+			return nil, err
+		}
+		key, err := seriesKey(name, labels)
+		if err != nil {
+			return nil, err
+		}
+		var h memstorage.Histogram
+		if err = json.Unmarshal(data, &h); err != nil {
+			return nil, err
+		}
+		res[key] = h
+	}
+	// проверяем на ошибки
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *DBStorage) GetSummaryMetric(ctx context.Context, name string) (*ddsketch.Sketch, bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	metricID, labels, err := seriesParams(name)
+	if err != nil {
+		return nil, false, err
+	}
+
+	sqlStatement := "SELECT summary FROM metric WHERE metric_type = 'summary' and metric_id = $1 and labels = $2::jsonb"
+	row := s.DB.QueryRowContext(ctx, sqlStatement, metricID, labels)
+
+	var data []byte
+	err = row.Scan(&data)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	var sketch ddsketch.Sketch
+	if err = json.Unmarshal(data, &sketch); err != nil {
+		return nil, false, err
+	}
+	return &sketch, true, nil
+}
+
+// AddSummaryMetric объединяет скетч sketch со скетчем в БД
+// в одной транзакции с блокировкой строки (как AddHistogramMetric).
+func (s *DBStorage) AddSummaryMetric(ctx context.Context, name string, sketch *ddsketch.Sketch) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = s.addSummary(ctx, tx, name, sketch); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *DBStorage) addSummary(ctx context.Context, tx *sql.Tx, name string, sketch *ddsketch.Sketch) error {
+	metricID, labels, err := seriesParams(name)
+	if err != nil {
+		return err
+	}
+
+	data, err := lockMetricRow(ctx, tx, "summary", metricID, labels)
+	if err != nil {
+		return err
+	}
+
+	var stored *ddsketch.Sketch
+	if data != nil {
+		stored = &ddsketch.Sketch{}
+		if err = json.Unmarshal(data, stored); err != nil {
+			return err
+		}
+	}
+
+	data, err = json.Marshal(memstorage.MergeSummaries(stored, sketch))
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := `update metric set summary = $3::jsonb, updated_at = now()
+		where metric_type = 'summary' and metric_id = $1 and labels = $2::jsonb`
+
+	_, err = tx.ExecContext(ctx, sqlStatement, metricID, labels, string(data))
+	if err != nil {
+		log.Println("error in updating summary metric:", err)
+		return err
+	}
+
+	return nil
+}
+
+// AddMetrics записывает пакет метрик в одной транзакции: при ошибке не сохраняется ни одна метрика пакета.
+// Обновления одной gauge или counter метрики сводятся в одно (последнее значение gauge, сумма приращений
+// counter), и все gauge и все counter метрики пакета записываются двумя многострочными запросами.
+// Строки обновляются в порядке ключа, чтобы одновременные пакеты блокировали их в одном порядке
+// и не попадали во взаимоблокировку.
+func (s *DBStorage) AddMetrics(ctx context.Context, metrics []memstorage.Metric) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if len(metrics) == 0 {
+		return nil
+	}
+	for _, metric := range metrics {
+		if err := metric.Validate(); err != nil {
+			return err
+		}
+	}
+
+	gauges, counters := newBatchUpdates(), newBatchUpdates()
+	var rest []memstorage.Metric // histogram и summary метрики объединяются с сохраненными по одной
+	for _, metric := range metrics {
+		switch metric.MType {
+		case "gauge":
+			gauges.observe(metric.Key(), *metric.Value)
+		case "counter":
+			counters.observeDelta(metric.Key(), *metric.Delta)
+		default:
+			rest = append(rest, metric)
+		}
+	}
+	sort.SliceStable(rest, func(i, j int) bool {
+		if rest[i].MType != rest[j].MType {
+			return rest[i].MType < rest[j].MType
+		}
+		return rest[i].Key() < rest[j].Key()
+	})
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = addCounterBatch(ctx, tx, counters); err != nil {
+		log.Println("error in updating counter metrics:", err)
+		return err
+	}
+	if err = addGaugeBatch(ctx, tx, gauges); err != nil {
+		log.Println("error in updating gauge metrics:", err)
+		return err
+	}
+	for _, metric := range rest {
+		switch metric.MType {
+		case "histogram":
+			err = s.addHistogram(ctx, tx, metric.Key(), *metric.Histogram)
+		case "summary":
+			err = s.addSummary(ctx, tx, metric.Key(), metric.Summary)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// batchUpdates - обновления gauge или counter метрик пакета, сведенные по ключу метрики:
+// минутный агрегат присланных значений и, для counter, точная сумма приращений
+type batchUpdates struct {
+	rollups map[string]*memstorage.Rollup
+	deltas  map[string]int64
+}
+
+func newBatchUpdates() *batchUpdates {
+	return &batchUpdates{rollups: make(map[string]*memstorage.Rollup), deltas: make(map[string]int64)}
+}
+
+func (b *batchUpdates) observe(key string, v float64) {
+	r, ok := b.rollups[key]
+	if !ok {
+		r = &memstorage.Rollup{}
+		b.rollups[key] = r
+	}
+	r.Observe(v)
+}
+
+func (b *batchUpdates) observeDelta(key string, delta int64) {
+	b.observe(key, float64(delta))
+	b.deltas[key] += delta
+}
+
+// args раскладывает обновления по массивам-параметрам запроса (см. batchRows) в порядке ключа
+func (b *batchUpdates) args(metricType string) ([]any, error) {
+	keys := make([]string, 0, len(b.rollups))
+	for key := range b.rollups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var ids, labels []string
+	var mins, maxs, sums, lasts []float64
+	var counts, deltas []int64
+	for _, key := range keys {
+		metricID, l, err := seriesParams(key)
+		if err != nil {
 			return nil, err
 		}
+		r := b.rollups[key]
+		ids = append(ids, metricID)
+		labels = append(labels, l)
+		mins = append(mins, r.Min)
+		maxs = append(maxs, r.Max)
+		sums = append(sums, r.Sum)
+		lasts = append(lasts, r.Last)
+		counts = append(counts, int64(r.Count))
+		deltas = append(deltas, b.deltas[key])
+	}
+	return []any{ids, labels, mins, maxs, sums, lasts, counts, deltas, metricType}, nil
+}
+
+// batchRows - строки пакета из массивов-параметров; batchRollupUpsert объединяет их агрегаты с минутными
+const (
+	batchRows = `with batch as (
+		select * from unnest($1::text[], $2::text[], $3::double precision[], $4::double precision[],
+			$5::double precision[], $6::double precision[], $7::bigint[], $8::bigint[])
+			as b(metric_id, labels, min, max, sum, last, count, delta)),`
+	batchRollupUpsert = `insert into metric_rollup (metric_type, metric_id, labels, resolution, bucket, min, max, sum, count, last)
+		select $9::text, metric_id, labels::jsonb, 60, date_trunc('minute', now()), min, max, sum, count, last from batch
+		on conflict (metric_type, metric_id, labels, resolution, bucket) do update set
+		min = least(metric_rollup.min, excluded.min), max = greatest(metric_rollup.max, excluded.max),
+		sum = metric_rollup.sum + excluded.sum, count = metric_rollup.count + excluded.count, last = excluded.last`
+)
+
+// addGaugeBatch записывает последние значения gauge метрик пакета одним запросом
+func addGaugeBatch(ctx context.Context, q querier, b *batchUpdates) error {
+	if len(b.rollups) == 0 {
+		return nil
+	}
+	args, err := b.args("gauge")
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := batchRows + `
+		upserted as (
+		insert into metric (metric_type, metric_id, labels, value)
+		select 'gauge', metric_id, labels::jsonb, last from batch
+		on conflict (metric_id, metric_type, labels) do update set value = excluded.value, updated_at = now()
+		returning metric_type, metric_id, labels, value),
+		sampled as (
+		insert into metric_sample (metric_type, metric_id, labels, value)
+		select metric_type, metric_id, labels, value from upserted)
+		` + batchRollupUpsert
+
+	_, err = q.ExecContext(ctx, sqlStatement, args...)
+	return err
+}
+
+// addCounterBatch прибавляет суммы приращений counter метрик пакета одним запросом
+func addCounterBatch(ctx context.Context, q querier, b *batchUpdates) error {
+	if len(b.rollups) == 0 {
+		return nil
+	}
+	args, err := b.args("counter")
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := batchRows + `
+		upserted as (
+		insert into metric (metric_type, metric_id, labels, delta)
+		select 'counter', metric_id, labels::jsonb, delta from batch
+		on conflict (metric_id, metric_type, labels) do update set delta = metric.delta + excluded.delta, updated_at = now()
+		returning metric_type, metric_id, labels, delta),
+		sampled as (
+		insert into metric_sample (metric_type, metric_id, labels, value)
+		select metric_type, metric_id, labels, delta from upserted)
+		` + batchRollupUpsert
+
+	_, err = q.ExecContext(ctx, sqlStatement, args...)
+	return err
+}
+
+func (s *DBStorage) GetAllSummaryMetrics(ctx context.Context) (map[string]*ddsketch.Sketch, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	sqlStatement := "SELECT metric_id, labels, summary FROM metric WHERE metric_type = 'summary'"
+
+	rows, err := s.DB.QueryContext(ctx, sqlStatement)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[string]*ddsketch.Sketch)
+	for rows.Next() {
+		var name string
+		var labels, data []byte
+		if err = rows.Scan(&name, &labels, &data); err != nil {
+			return nil, err
+		}
+		key, err := seriesKey(name, labels)
+		if err != nil {
+			return nil, err
+		}
+		var sketch ddsketch.Sketch
+		if err = json.Unmarshal(data, &sketch); err != nil {
+			return nil, err
+		}
+		res[key] = &sketch
+	}
+	// проверяем на ошибки
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ListMetrics возвращает страницу метрик, выбранных по q, и общее количество подходящих метрик.
+// Фильтр, сортировка и страница применяются в БД: glob шаблон переводится в LIKE,
+// а регулярное выражение - в оператор ~ (в синтаксисе, общем для RE2 и Postgres, см. ListQuery.Pattern).
+func (s *DBStorage) ListMetrics(ctx context.Context, q memstorage.ListQuery) ([]memstorage.Metric, int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if err := q.Validate(); err != nil {
+		return nil, 0, err
+	}
+
+	sqlStatement, args := listMetricsQuery(q)
+	rows, err := s.DB.QueryContext(ctx, sqlStatement, args...)
+	if err != nil {
+		return nil, 0, listQueryError(err)
+	}
+	defer rows.Close()
+
+	res := []memstorage.Metric{}
+	total := 0
+	for rows.Next() {
+		var m memstorage.Metric
+		var labels, histogram, summary []byte
+		var value float64
+		var delta int64
+		if err = rows.Scan(&m.MType, &m.ID, &labels, &value, &delta, &histogram, &summary, &total); err != nil {
+			return nil, 0, err
+		}
+		if err = json.Unmarshal(labels, &m.Labels); err != nil {
+			return nil, 0, err
+		}
+		if len(m.Labels) == 0 {
+			m.Labels = nil
+		}
+		switch m.MType {
+		case "gauge":
+			m.Value = &value
+		case "counter":
+			m.Delta = &delta
+		case "histogram":
+			m.Histogram = &memstorage.Histogram{}
+			err = json.Unmarshal(histogram, m.Histogram)
+		case "summary":
+			m.Summary = &ddsketch.Sketch{}
+			err = json.Unmarshal(summary, m.Summary)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		res = append(res, m)
+	}
+	// проверяем на ошибки
+	err = rows.Err()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(res) == 0 && q.Offset > 0 {
+		// страница за концом выборки: количество подходящих метрик считается отдельно
+		q.Offset, q.Limit, q.SortBy = 0, 0, ""
+		sqlStatement, args = listMetricsQuery(q)
+		sqlStatement = "SELECT count(*) FROM (" + sqlStatement + ") AS selected"
+		if err = s.DB.QueryRowContext(ctx, sqlStatement, args...).Scan(&total); err != nil {
+			return nil, 0, listQueryError(err)
+		}
+	}
+	return res, total, nil
+}
+
+// код ошибки Postgres invalid_regular_expression
+const invalidRegularExpression = "2201B"
+
+// listQueryError переводит ошибку Postgres в регулярном выражении (например, слишком сложное выражение)
+// в ErrInvalidListQuery
+func listQueryError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == invalidRegularExpression {
+		return fmt.Errorf("%w: %s", memstorage.ErrInvalidListQuery, pgErr.Message)
+	}
+	return err
+}
+
+// listMetricsQuery строит запрос выборки метрик; в последней колонке - общее количество подходящих метрик.
+// Порядок строк совпадает с порядком memstorage.SelectMetrics (имена сравниваются побайтово).
+func listMetricsQuery(q memstorage.ListQuery) (string, []any) {
+	var args []any
+	param := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var where []string
+	if q.Type != "" {
+		where = append(where, "metric_type = "+param(q.Type))
+	}
+	if q.Match != "" {
+		if q.Regex {
+			where = append(where, "metric_id ~ "+param(q.Pattern()))
+		} else {
+			where = append(where, "metric_id LIKE "+param(q.LikePattern())+` ESCAPE '\'`)
+		}
+	}
+
+	order := []string{`metric_id COLLATE "C"`, "labels <> '{}'::jsonb", `labels::text COLLATE "C"`, "metric_type"}
+	switch {
+	case q.SortBy == memstorage.ListSortType:
+		order = append([]string{"metric_type"}, order...)
+	case q.SortBy == memstorage.ListSortValue && q.Type == "gauge":
+		order = append([]string{"value"}, order...)
+	case q.SortBy == memstorage.ListSortValue && q.Type == "counter":
+		order = append([]string{"delta"}, order...)
+	}
+	if q.Desc {
+		for i := range order {
+			order[i] += " DESC"
+		}
+	}
+
+	sqlStatement := `SELECT metric_type, metric_id, labels, value, delta, histogram, summary, count(*) over() FROM metric`
+	if len(where) > 0 {
+		sqlStatement += " WHERE " + strings.Join(where, " and ")
+	}
+	sqlStatement += " ORDER BY " + strings.Join(order, ", ")
+	if q.Limit > 0 {
+		sqlStatement += " LIMIT " + param(q.Limit)
+	}
+	if q.Offset > 0 {
+		sqlStatement += " OFFSET " + param(q.Offset)
+	}
+	return sqlStatement, args
+}
+
+func (s *DBStorage) GetGaugeHistory(ctx context.Context, name string, from, to time.Time) ([]memstorage.Sample, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.getHistory(ctx, "gauge", name, from, to)
+}
+
+func (s *DBStorage) GetCounterHistory(ctx context.Context, name string, from, to time.Time) ([]memstorage.Sample, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.getHistory(ctx, "counter", name, from, to)
+}
 
-		res[name] = v
+func (s *DBStorage) getHistory(ctx context.Context, metricType string, name string, from, to time.Time) ([]memstorage.Sample, error) {
+	metricID, labels, err := seriesParams(name)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlStatement := `SELECT created_at, value FROM metric_sample 
+		WHERE metric_type = $1 and metric_id = $2 and labels = $5::jsonb and created_at between $3 and $4 
+		ORDER BY created_at, id`
+
+	rows, err := s.DB.QueryContext(ctx, sqlStatement, metricType, metricID, from, to, labels)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []memstorage.Sample{}
+	for rows.Next() {
+		var sample memstorage.Sample
+		if err = rows.Scan(&sample.Timestamp, &sample.Value); err != nil {
+			return nil, err
+		}
+		res = append(res, sample)
 	}
 	// проверяем на ошибки
 	err = rows.Err()
@@ -146,6 +900,223 @@ func (s *DBStorage) GetAllGaugeMetrics() (map[string]float64, error) {
 	return res, nil
 }
 
-func (s *DBStorage) Finalize() error {
+// DeleteMetric удаляет метрику, ее историю и агрегаты в одной транзакции
+func (s *DBStorage) DeleteMetric(ctx context.Context, metricType, name string) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if !memstorage.ValidMetricType(metricType) {
+		return false, memstorage.ErrUnknownMetricType
+	}
+	metricID, labels, err := seriesParams(name)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	sqlStatement := "delete from metric where metric_type = $1 and metric_id = $2 and labels = $3::jsonb"
+	res, err := tx.ExecContext(ctx, sqlStatement, metricType, metricID, labels)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	for _, table := range []string{"metric_sample", "metric_rollup"} {
+		sqlStatement = "delete from " + table + " where metric_type = $1 and metric_id = $2 and labels = $3::jsonb"
+		_, err = tx.ExecContext(ctx, sqlStatement, metricType, metricID, labels)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return deleted > 0, tx.Commit()
+}
+
+// DeleteMetrics удаляет пакет метрик, их историю и агрегаты в одной транзакции:
+// из каждой таблицы строки всех метрик пакета удаляются одним запросом
+func (s *DBStorage) DeleteMetrics(ctx context.Context, metrics []memstorage.Metric) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	types := make([]string, 0, len(metrics))
+	ids := make([]string, 0, len(metrics))
+	labels := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		if !memstorage.ValidMetricType(metric.MType) {
+			return 0, memstorage.ErrUnknownMetricType
+		}
+		metricID, metricLabels, err := seriesParams(metric.Key())
+		if err != nil {
+			return 0, err
+		}
+		types = append(types, metric.MType)
+		ids = append(ids, metricID)
+		labels = append(labels, metricLabels)
+	}
+	if len(metrics) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var deleted int64
+	for _, table := range []string{"metric", "metric_sample", "metric_rollup"} {
+		sqlStatement := "delete from " + table + ` where (metric_type, metric_id, labels) in (
+			select metric_type, metric_id, labels::jsonb
+			from unnest($1::text[], $2::text[], $3::text[]) as deleted(metric_type, metric_id, labels))`
+		res, err := tx.ExecContext(ctx, sqlStatement, types, ids, labels)
+		if err != nil {
+			return 0, err
+		}
+		if table == "metric" {
+			if deleted, err = res.RowsAffected(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return int(deleted), tx.Commit()
+}
+
+// DeleteStaleMetrics удаляет метрики, которые не обновлялись дольше ttl, вместе с их историей и агрегатами.
+// Время сравнивается на стороне БД, чтобы не зависеть от часового пояса сервера.
+func (s *DBStorage) DeleteStaleMetrics(ctx context.Context, ttl time.Duration) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	sqlStatement := `with deleted as (
+		delete from metric where updated_at < now() - make_interval(secs => $1)
+		returning metric_type, metric_id, labels),
+		samples as (
+		delete from metric_sample s using deleted d
+		where s.metric_type = d.metric_type and s.metric_id = d.metric_id and s.labels = d.labels),
+		rollups as (
+		delete from metric_rollup r using deleted d
+		where r.metric_type = d.metric_type and r.metric_id = d.metric_id and r.labels = d.labels)
+		select count(*) from deleted`
+
+	var deleted int
+	err := s.DB.QueryRowContext(ctx, sqlStatement, ttl.Seconds()).Scan(&deleted)
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// GetRollups возвращает агрегаты gauge или counter метрики с разрешением resolution,
+// начавшиеся с from по to включительно
+func (s *DBStorage) GetRollups(ctx context.Context, metricType, name string, resolution time.Duration,
+	from, to time.Time) ([]memstorage.Rollup, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if metricType != "gauge" && metricType != "counter" {
+		return nil, memstorage.ErrUnknownMetricType
+	}
+	if resolution != memstorage.MinuteResolution && resolution != memstorage.HourResolution {
+		return nil, memstorage.ErrUnknownResolution
+	}
+	metricID, labels, err := seriesParams(name)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlStatement := `SELECT bucket, min, max, sum, count, last FROM metric_rollup
+		WHERE metric_type = $1 and metric_id = $2 and labels = $3::jsonb and resolution = $4
+		and bucket between $5 and $6 ORDER BY bucket`
+
+	rows, err := s.DB.QueryContext(ctx, sqlStatement, metricType, metricID, labels,
+		int(resolution.Seconds()), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []memstorage.Rollup{}
+	for rows.Next() {
+		var r memstorage.Rollup
+		if err = rows.Scan(&r.Start, &r.Min, &r.Max, &r.Sum, &r.Count, &r.Last); err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Compact пересчитывает часовые агрегаты из минутных для закончившихся часов
+// и удаляет историю и агрегаты старше сроков хранения (см. Retention)
+func (s *DBStorage) Compact(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	p := s.Retention.WithDefaults()
+	from, to := p.HourWindow(s.compactedUntil, time.Now())
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if from.Before(to) {
+		// пересчет идемпотентен: часовой агрегат целиком заменяется агрегатом его минут
+		sqlStatement := `insert into metric_rollup (metric_type, metric_id, labels, resolution, bucket, min, max, sum, count, last)
+			select metric_type, metric_id, labels, 3600, date_trunc('hour', bucket),
+			min(min), max(max), sum(sum), sum(count), (array_agg(last order by bucket desc))[1]
+			from metric_rollup where resolution = 60 and bucket >= $1 and bucket < $2
+			group by metric_type, metric_id, labels, date_trunc('hour', bucket)
+			on conflict (metric_type, metric_id, labels, resolution, bucket) do update set
+			min = excluded.min, max = excluded.max, sum = excluded.sum, count = excluded.count, last = excluded.last`
+		_, err = tx.ExecContext(ctx, sqlStatement, from, to)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from metric_sample where created_at < now() - make_interval(secs => $1)",
+		p.Raw.Seconds())
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := "delete from metric_rollup where resolution = $1 and bucket < now() - make_interval(secs => $2)"
+	for _, r := range []time.Duration{memstorage.MinuteResolution, memstorage.HourResolution} {
+		retention := p.Minute
+		if r == memstorage.HourResolution {
+			retention = p.Hour
+		}
+		_, err = tx.ExecContext(ctx, sqlStatement, int(r.Seconds()), retention.Seconds())
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	if from.Before(to) {
+		s.compactedUntil = to
+	}
+	return nil
+}
+
+func (s *DBStorage) Finalize(ctx context.Context) error {
 	return nil
 }
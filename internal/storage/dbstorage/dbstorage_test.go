@@ -2,10 +2,14 @@ package dbstorage
 
 import (
 	"context"
+	"database/sql"
 	"testing"
+	"time"
 
 	database "github.com/adettelle/go-metric-collector/internal/db"
 	"github.com/adettelle/go-metric-collector/internal/migrator"
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/internal/storage/storagetest"
 	"github.com/google/uuid"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/stretchr/testify/require"
@@ -27,84 +31,13 @@ func TestDBStorage(t *testing.T) {
 	require.NoError(t, err)
 
 	sDB := &DBStorage{
-		Ctx: context.Background(),
-		DB:  db,
+		DB: db,
 	}
 
-	cm1Name := uuid.NewString()[:30]
-	cm2Name := uuid.NewString()[:30]
-
-	err = sDB.AddCounterMetric(cm1Name, 100)
-	require.NoError(t, err)
-
-	// получение существующей метрики
-	cm1Value, ok, err := sDB.GetCounterMetric(cm1Name)
-	require.NoError(t, err)
-	require.True(t, ok)
-	require.Equal(t, int64(100), cm1Value)
-
-	// получение несуществующей метрики
-	_, ok, err = sDB.GetCounterMetric("inexistentCounter")
-	require.NoError(t, err)
-	require.False(t, ok)
+	// общий для всех хранилищ набор проверок
+	storagetest.Run(t, sDB)
 
-	// добавление той же (существующей) counter метрики, должно сохранить сумму двух значений
-	err = sDB.AddCounterMetric(cm1Name, 111)
-	require.NoError(t, err)
-
-	// получение существующей метрики
-	cm1Value, ok, err = sDB.GetCounterMetric(cm1Name)
-	require.NoError(t, err)
-	require.True(t, ok)
-	require.Equal(t, int64(211), cm1Value)
-
-	// добавление другой counter метрики
-	err = sDB.AddCounterMetric(cm2Name, 200)
-	require.NoError(t, err)
-
-	// получение всех counter метрик
-	cMetrics, err := sDB.GetAllCounterMetrics()
-	require.NoError(t, err)
-	require.Equal(t, map[string]int64{cm1Name: 211, cm2Name: 200}, cMetrics)
-
-	// ------
-	gm1Name := uuid.NewString()[:30]
-	gm2Name := uuid.NewString()[:30]
-
-	err = sDB.AddGaugeMetric(gm1Name, 1.1)
-	require.NoError(t, err)
-
-	// получение существующей метрики
-	gm1Value, ok, err := sDB.GetGaugeMetric(gm1Name)
-	require.NoError(t, err)
-	require.True(t, ok)
-	require.Equal(t, 1.1, gm1Value)
-
-	// получение несуществующей метрики
-	_, ok, err = sDB.GetGaugeMetric("inexistentGauge")
-	require.NoError(t, err)
-	require.False(t, ok)
-
-	// добавление той же (существующей) gauge метрики, должно перезаписывать значение
-	err = sDB.AddGaugeMetric(gm1Name, 2.2)
-	require.NoError(t, err)
-
-	// получение существующей метрики
-	gm1Value, ok, err = sDB.GetGaugeMetric(gm1Name)
-	require.NoError(t, err)
-	require.True(t, ok)
-	require.Equal(t, 2.2, gm1Value)
-
-	// добавление другой counter метрики
-	err = sDB.AddGaugeMetric(gm2Name, 22.222)
-	require.NoError(t, err)
-
-	// получение всех gauge метрик
-	gMetrics, err := sDB.GetAllGaugeMetrics()
-	require.NoError(t, err)
-	require.Equal(t, map[string]float64{gm1Name: 2.2, gm2Name: 22.222}, gMetrics)
-
-	err = sDB.Finalize()
+	err = sDB.Finalize(context.Background())
 	require.NoError(t, err)
 }
 
@@ -115,71 +48,145 @@ func TestDBStorageNoDB(t *testing.T) {
 	require.NoError(t, err)
 
 	sDB := &DBStorage{
-		Ctx: context.Background(),
-		DB:  db,
+		DB: db,
 	}
 
 	cm1Name := uuid.NewString()[:30]
 	cm2Name := uuid.NewString()[:30]
 
-	err = sDB.AddCounterMetric(cm1Name, 100)
+	err = sDB.AddCounterMetric(context.Background(), cm1Name, 100)
 	require.Error(t, err)
 
 	// получение существующей метрики
-	_, _, err = sDB.GetCounterMetric(cm1Name)
+	_, _, err = sDB.GetCounterMetric(context.Background(), cm1Name)
 	require.Error(t, err)
 
 	// получение несуществующей метрики
-	_, _, err = sDB.GetCounterMetric("inexistentCounter")
+	_, _, err = sDB.GetCounterMetric(context.Background(), "inexistentCounter")
 	require.Error(t, err)
 
 	// добавление той же (существующей) counter метрики, должно сохранить сумму двух значений
-	err = sDB.AddCounterMetric(cm1Name, 111)
+	err = sDB.AddCounterMetric(context.Background(), cm1Name, 111)
 	require.Error(t, err)
 
 	// получение существующей метрики
-	_, _, err = sDB.GetCounterMetric(cm1Name)
+	_, _, err = sDB.GetCounterMetric(context.Background(), cm1Name)
 	require.Error(t, err)
 
 	// добавление другой counter метрики
-	err = sDB.AddCounterMetric(cm2Name, 200)
+	err = sDB.AddCounterMetric(context.Background(), cm2Name, 200)
 	require.Error(t, err)
 
 	// получение всех counter метрик
-	_, err = sDB.GetAllCounterMetrics()
+	_, err = sDB.GetAllCounterMetrics(context.Background())
 	require.Error(t, err)
 
 	// ------
 	gm1Name := uuid.NewString()[:30]
 	gm2Name := uuid.NewString()[:30]
 
-	err = sDB.AddGaugeMetric(gm1Name, 1.1)
+	err = sDB.AddGaugeMetric(context.Background(), gm1Name, 1.1)
 	require.Error(t, err)
 
 	// получение существующей метрики
-	_, _, err = sDB.GetGaugeMetric(gm1Name)
+	_, _, err = sDB.GetGaugeMetric(context.Background(), gm1Name)
 	require.Error(t, err)
 
 	// получение несуществующей метрики
-	_, _, err = sDB.GetGaugeMetric("inexistentGauge")
+	_, _, err = sDB.GetGaugeMetric(context.Background(), "inexistentGauge")
 	require.Error(t, err)
 
 	// добавление той же (существующей) gauge метрики, должно перезаписывать значение
-	err = sDB.AddGaugeMetric(gm1Name, 2.2)
+	err = sDB.AddGaugeMetric(context.Background(), gm1Name, 2.2)
 	require.Error(t, err)
 
 	// получение существующей метрики
-	_, _, err = sDB.GetGaugeMetric(gm1Name)
+	_, _, err = sDB.GetGaugeMetric(context.Background(), gm1Name)
 	require.Error(t, err)
 
 	// добавление другой counter метрики
-	err = sDB.AddGaugeMetric(gm2Name, 22.222)
+	err = sDB.AddGaugeMetric(context.Background(), gm2Name, 22.222)
 	require.Error(t, err)
 
 	// получение всех gauge метрик
-	_, err = sDB.GetAllGaugeMetrics()
+	_, err = sDB.GetAllGaugeMetrics(context.Background())
 	require.Error(t, err)
 
-	err = sDB.Finalize()
+	err = sDB.Finalize(context.Background())
 	require.NoError(t, err)
 }
+
+// запрос с отмененным контекстом не выполняется, а QueryTimeout ограничивает время вызова
+func TestDBStorageContext(t *testing.T) {
+	dbParams := "host=localhost port=9999 user=postgres password=123456 dbname=test_db sslmode=disable"
+
+	// sql.Open не подключается к БД, поэтому тест не требует Postgres
+	db, err := sql.Open("pgx", dbParams)
+	require.NoError(t, err)
+	defer db.Close()
+
+	sDB := &DBStorage{
+		DB:           db,
+		QueryTimeout: time.Second,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = sDB.GetGaugeMetric(ctx, "g1")
+	require.ErrorIs(t, err, context.Canceled)
+	err = sDB.AddMetrics(ctx, []memstorage.Metric{{ID: "c1", MType: "counter", Delta: new(int64)}})
+	require.ErrorIs(t, err, context.Canceled)
+
+	queryCtx, cancelQuery := sDB.withTimeout(context.Background())
+	defer cancelQuery()
+	deadline, ok := queryCtx.Deadline()
+	require.True(t, ok)
+	require.WithinDuration(t, time.Now().Add(time.Second), deadline, 100*time.Millisecond)
+
+	sDB.QueryTimeout = 0
+	queryCtx, cancelQuery = sDB.withTimeout(context.Background())
+	defer cancelQuery()
+	_, ok = queryCtx.Deadline()
+	require.False(t, ok)
+}
+
+// фильтр, сортировка и страница передаются в запрос, а не применяются после чтения
+func TestListMetricsQuery(t *testing.T) {
+	sqlStatement, args := listMetricsQuery(memstorage.ListQuery{
+		Type: "gauge", Match: "CPU_*", SortBy: memstorage.ListSortValue, Desc: true, Offset: 20, Limit: 10,
+	})
+	require.Equal(t, `SELECT metric_type, metric_id, labels, value, delta, histogram, summary, count(*) over() FROM metric`+
+		` WHERE metric_type = $1 and metric_id LIKE $2 ESCAPE '\'`+
+		` ORDER BY value DESC, metric_id COLLATE "C" DESC, labels <> '{}'::jsonb DESC, labels::text COLLATE "C" DESC, metric_type DESC`+
+		` LIMIT $3 OFFSET $4`, sqlStatement)
+	require.Equal(t, []any{"gauge", `CPU\_%`, 10, 20}, args)
+
+	// регулярное выражение передается в оператор ~ в синтаксисе, общем для RE2 и Postgres
+	sqlStatement, args = listMetricsQuery(memstorage.ListQuery{Match: `cpu\d|mem`, Regex: true})
+	require.Equal(t, `SELECT metric_type, metric_id, labels, value, delta, histogram, summary, count(*) over() FROM metric`+
+		` WHERE metric_id ~ $1`+
+		` ORDER BY metric_id COLLATE "C", labels <> '{}'::jsonb, labels::text COLLATE "C", metric_type`, sqlStatement)
+	require.Equal(t, []any{`^(?:(?:cpu[0-9]|mem))$`}, args)
+}
+
+// обновления одной метрики пакета сводятся в одну строку запроса, строки упорядочены по ключу
+func TestBatchUpdatesArgs(t *testing.T) {
+	b := newBatchUpdates()
+	b.observeDelta("c2", 5)
+	b.observeDelta(`c1{host="a"}`, 3)
+	b.observeDelta(`c1{host="a"}`, -1)
+
+	args, err := b.args("counter")
+	require.NoError(t, err)
+	require.Equal(t, []any{
+		[]string{"c1", "c2"},
+		[]string{`{"host":"a"}`, "{}"},
+		[]float64{-1, 5}, // min
+		[]float64{3, 5},  // max
+		[]float64{2, 5},  // sum
+		[]float64{-1, 5}, // last
+		[]int64{2, 1},    // count
+		[]int64{2, 5},    // delta
+		"counter",
+	}, args)
+}
@@ -0,0 +1,116 @@
+package memstorage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrUnknownMetricType - тип метрики не gauge, counter, histogram или summary
+var ErrUnknownMetricType = errors.New("unknown metric type")
+
+// ValidMetricType проверяет, что метрики типа metricType можно хранить в Storager
+func ValidMetricType(metricType string) bool {
+	switch metricType {
+	case "gauge", "counter", "histogram", "summary":
+		return true
+	}
+	return false
+}
+
+// metricKey - тип и ключ метрики (имена метрик разных типов могут совпадать)
+type metricKey struct {
+	mType string
+	name  string
+}
+
+// touch запоминает время обновления метрики; вызывается под блокировкой
+func (ms *MemStorage) touch(metricType, name string) {
+	ms.updated[metricKey{mType: metricType, name: name}] = ms.now()
+}
+
+// DeleteMetric удаляет метрику вместе с ее историей и агрегатами; возвращает false, если метрики не было
+func (ms *MemStorage) DeleteMetric(_ context.Context, metricType, name string) (bool, error) {
+	if !ValidMetricType(metricType) {
+		return false, ErrUnknownMetricType
+	}
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	if !ms.deleteMetric(metricType, name) {
+		return false, nil
+	}
+	return true, ms.logWAL(walRecord{Op: walOpDelete, Type: metricType, Key: name})
+}
+
+// DeleteMetrics удаляет пакет метрик вместе с историей и агрегатами под одной блокировкой;
+// удаления записываются в журнал одной записью. Возвращает количество удаленных метрик.
+func (ms *MemStorage) DeleteMetrics(_ context.Context, metrics []Metric) (int, error) {
+	for _, metric := range metrics {
+		if !ValidMetricType(metric.MType) {
+			return 0, ErrUnknownMetricType
+		}
+	}
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	var batch []walRecord
+	for _, metric := range metrics {
+		if ms.deleteMetric(metric.MType, metric.Key()) {
+			batch = append(batch, walRecord{Op: walOpDelete, Type: metric.MType, Key: metric.Key()})
+		}
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	return len(batch), ms.logWAL(walRecord{Op: walOpBatch, Batch: batch})
+}
+
+// DeleteStaleMetrics удаляет метрики, которые не обновлялись дольше ttl;
+// возвращает количество удаленных метрик
+func (ms *MemStorage) DeleteStaleMetrics(_ context.Context, ttl time.Duration) (int, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	before := ms.now().Add(-ttl)
+	deleted := 0
+	for key, updated := range ms.updated {
+		if !updated.Before(before) || !ms.deleteMetric(key.mType, key.name) {
+			continue
+		}
+		deleted++
+		err := ms.logWAL(walRecord{Op: walOpDelete, Type: key.mType, Key: key.name})
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// deleteMetric удаляет метрику под блокировкой
+func (ms *MemStorage) deleteMetric(metricType, name string) bool {
+	var exists bool
+	switch metricType {
+	case "gauge":
+		_, exists = ms.gauge[name]
+		delete(ms.gauge, name)
+		delete(ms.gaugeHistory, name)
+	case "counter":
+		_, exists = ms.counter[name]
+		delete(ms.counter, name)
+		delete(ms.counterHistory, name)
+	case "histogram":
+		_, exists = ms.histogram[name]
+		delete(ms.histogram, name)
+	case "summary":
+		_, exists = ms.summary[name]
+		delete(ms.summary, name)
+	}
+	key := metricKey{mType: metricType, name: name}
+	delete(ms.minuteRollups, key)
+	delete(ms.hourRollups, key)
+	delete(ms.updated, key)
+	return exists
+}
@@ -0,0 +1,81 @@
+package memstorage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteMetric(t *testing.T) {
+	ms, err := New(false, "")
+	require.NoError(t, err)
+
+	require.NoError(t, ms.AddGaugeMetric(context.Background(), "m1", 1.5))
+	require.NoError(t, ms.AddCounterMetric(context.Background(), "m1", 2))
+
+	// удаляется только метрика указанного типа
+	ok, err := ms.DeleteMetric(context.Background(), "gauge", "m1")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, exists, err := ms.GetGaugeMetric(context.Background(), "m1")
+	require.NoError(t, err)
+	require.False(t, exists)
+	history, err := ms.GetGaugeHistory(context.Background(), "m1", time.Time{}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, history)
+
+	_, exists, err = ms.GetCounterMetric(context.Background(), "m1")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	ok, err = ms.DeleteMetric(context.Background(), "gauge", "m1")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, err = ms.DeleteMetric(context.Background(), "unknown", "m1")
+	require.ErrorIs(t, err, ErrUnknownMetricType)
+}
+
+func TestDeleteStaleMetrics(t *testing.T) {
+	ms, err := New(false, "")
+	require.NoError(t, err)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	current := start
+	ms.now = func() time.Time { return current }
+
+	require.NoError(t, ms.AddGaugeMetric(context.Background(), "CPUutilization8", 10))
+	require.NoError(t, ms.AddHistogramMetric(context.Background(), "h1", NewHistogram([]float64{1})))
+	require.NoError(t, ms.AddSummaryMetric(context.Background(), "s1", ddsketch.New(ddsketch.DefaultAlpha)))
+	require.NoError(t, ms.AddCounterMetric(context.Background(), "PollCount", 1))
+
+	// PollCount продолжает обновляться, остальные метрики устаревают
+	current = start.Add(10 * time.Minute)
+	require.NoError(t, ms.AddCounterMetric(context.Background(), "PollCount", 1))
+
+	current = start.Add(12 * time.Minute)
+	deleted, err := ms.DeleteStaleMetrics(context.Background(), 5*time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, 3, deleted)
+
+	gauges, err := ms.GetAllGaugeMetrics(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, gauges)
+	histograms, err := ms.GetAllHistogramMetrics(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, histograms)
+	summaries, err := ms.GetAllSummaryMetrics(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, summaries)
+	counters, err := ms.GetAllCounterMetrics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"PollCount": 2}, counters)
+
+	deleted, err = ms.DeleteStaleMetrics(context.Background(), 5*time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, 0, deleted)
+}
@@ -1,34 +1,30 @@
 package memstorage
 
 import (
-	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"time"
 
 	"go.uber.org/zap"
 )
 
-// запись в файл слепка метрик
+// запись в файл слепка метрик (формат см. в snapshot.go), сжатого способом ms.SnapshotCompression.
+// Слепок пишется во временный файл рядом с fileName, сбрасывается на диск и переименовывается,
+// поэтому при сбое во время записи на диске остается предыдущий целый слепок.
+// Вызывается под блокировкой ms (или до того, как хранилище стало доступно другим горутинам).
 func WriteMetricsSnapshot(fileName string, ms *MemStorage) error {
-	// открываем файл для записи в конец
-	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
-	if err != nil {
-		return err
+	compression := ms.SnapshotCompression
+	if compression == "" {
+		compression = CompressionNone
 	}
-	defer file.Close()
-
-	allMetrics := MemStorageToAllMetrics(ms)
-
-	data, err := json.Marshal(allMetrics)
+	data, err := encodeSnapshot(ms, compression)
 	if err != nil {
 		return err
 	}
 
-	// добавляем перенос строки
-	data = append(data, '\n')
-
 	logger, err := zap.NewDevelopment()
 	if err != nil {
 		panic("cannot initialize zap")
@@ -37,11 +33,44 @@ func WriteMetricsSnapshot(fileName string, ms *MemStorage) error {
 	logger.Info("writing to file", zap.String("fileName", fileName))
 
 	log.Printf("writing to file: %s", fileName)
-	_, err = file.Write(data)
-	return err
+
+	dir := filepath.Dir(fileName)
+	file, err := os.CreateTemp(dir, filepath.Base(fileName)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// после успешного переименования временного файла уже нет, и Remove ничего не делает
+	defer os.Remove(file.Name())
+
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(file.Name(), fileName); err != nil {
+		return err
+	}
+	return syncDir(dir)
 }
 
-// читаем из файла и записываем в Storage
+// syncDir сбрасывает на диск каталог, чтобы переименование файла в нем пережило сбой питания
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// читаем из файла и записываем в Storage;
+// читаются как слепки с заголовком, так и слепки старого формата (json без заголовка)
 func ReadMetricsSnapshot(fileName string) (*MemStorage, error) {
 	// открываем файл для чтения
 	jsonFile, err := os.OpenFile(fileName, os.O_RDONLY|os.O_CREATE, 0666)
@@ -61,17 +90,11 @@ func ReadMetricsSnapshot(fileName string) (*MemStorage, error) {
 		return nil, err
 	}
 
-	// we initialize our AllMetrics array
-	var allMetrics AllMetrics
-
-	// we unmarshal our byteArray which contains our
-	// jsonFile's content into 'allMetrics' which we defined above
-	err = json.Unmarshal(byteValue, &allMetrics)
+	ms, err := decodeSnapshot(byteValue)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("reading %s: %w", fileName, err)
 	}
-
-	return AllMetricsToMemStorage(&allMetrics)
+	return ms, nil
 }
 
 func StartSaveLoop(storeInterval time.Duration, storagePath string, ms *MemStorage) {
@@ -81,7 +104,10 @@ func StartSaveLoop(storeInterval time.Duration, storagePath string, ms *MemStora
 
 	for range ticker.C {
 		log.Println("writing to file")
-		if err := WriteMetricsSnapshot(storagePath, ms); err != nil {
+		ms.Lock()
+		err := ms.writeSnapshot(storagePath)
+		ms.Unlock()
+		if err != nil {
 			log.Fatal(err)
 		}
 	}
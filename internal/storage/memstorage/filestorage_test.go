@@ -1,6 +1,7 @@
 package memstorage
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -13,17 +14,18 @@ func TestWriteMetricsSnapshot(t *testing.T) {
 	tmpFile, err := os.CreateTemp("", "metrics.json")
 	assert.NoError(t, err)
 	defer os.Remove(tmpFile.Name()) // Clean up the file after the test
+	defer os.Remove(WALFileName(tmpFile.Name()))
 
 	ms, err := New(false, tmpFile.Name())
 	assert.NoError(t, err)
 
-	err = ms.AddGaugeMetric("g1", 0.75)
+	err = ms.AddGaugeMetric(context.Background(), "g1", 0.75)
 	assert.NoError(t, err)
-	err = ms.AddGaugeMetric("g2", 0.123)
+	err = ms.AddGaugeMetric(context.Background(), "g2", 0.123)
 	assert.NoError(t, err)
-	err = ms.AddCounterMetric("c1", 1)
+	err = ms.AddCounterMetric(context.Background(), "c1", 1)
 	assert.NoError(t, err)
-	err = ms.AddCounterMetric("c2", 2)
+	err = ms.AddCounterMetric(context.Background(), "c2", 2)
 	assert.NoError(t, err)
 	allmetricsFromMs := MemStorageToAllMetrics(ms)
 
@@ -53,12 +55,12 @@ func TestReadMetricsSnapshot(t *testing.T) {
 	ms, err := New(false, tmpFile.Name())
 	assert.NoError(t, err)
 
-	err = ms.AddGaugeMetric("g1", 0.75)
+	err = ms.AddGaugeMetric(context.Background(), "g1", 0.75)
 	assert.NoError(t, err)
-	err = ms.AddGaugeMetric("g2", 0.123)
+	err = ms.AddGaugeMetric(context.Background(), "g2", 0.123)
 	assert.NoError(t, err)
 
-	gMetrics, err := ms.GetAllGaugeMetrics()
+	gMetrics, err := ms.GetAllGaugeMetrics(context.Background())
 	assert.NoError(t, err)
 	memStorageFromMs := MemStorageToAllMetrics(ms)
 
@@ -73,7 +75,7 @@ func TestReadMetricsSnapshot(t *testing.T) {
 	msRes, err := ReadMetricsSnapshot(tmpFile.Name())
 	assert.NoError(t, err)
 	msResAllMetrics := MemStorageToAllMetrics(msRes)
-	// gMetricsRes, err := ms.GetAllGaugeMetrics()
+	// gMetricsRes, err := ms.GetAllGaugeMetrics(context.Background())
 	// assert.NoError(t, err)
 	// assert.Equal(t, metricsData.Metrics, ms.Metrics)
 	assert.Equal(t, msResAllMetrics, memStorageFromMs)
@@ -89,9 +91,9 @@ func TestStartSaveLoop(t *testing.T) {
 	ms, err := New(false, tmpFile.Name())
 	assert.NoError(t, err)
 
-	err = ms.AddGaugeMetric("g1", 0.75)
+	err = ms.AddGaugeMetric(context.Background(), "g1", 0.75)
 	assert.NoError(t, err)
-	err = ms.AddGaugeMetric("g2", 0.123)
+	err = ms.AddGaugeMetric(context.Background(), "g2", 0.123)
 	assert.NoError(t, err)
 
 	// Set up a short duration and a channel to exit the loop
@@ -0,0 +1,121 @@
+package memstorage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DefaultBuckets - верхние границы корзин гистограммы по умолчанию (как в клиенте Prometheus)
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// ErrBoundsMismatch - гистограммы с разными границами корзин нельзя сложить
+var ErrBoundsMismatch = errors.New("histogram bounds mismatch")
+
+// Histogram - распределение значений по корзинам.
+// Counts[i] - количество значений v <= Bounds[i] (и больше предыдущей границы),
+// последний элемент Counts - количество значений больше последней границы (+Inf),
+// поэтому len(Counts) = len(Bounds) + 1.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"` // верхние границы корзин по возрастанию
+	Counts []uint64  `json:"counts"` // количество значений в каждой корзине (не накопленное)
+	Sum    float64   `json:"sum"`    // сумма всех значений
+	Count  uint64    `json:"count"`  // количество значений
+}
+
+// NewHistogram создает пустую гистограмму с границами bounds
+func NewHistogram(bounds []float64) Histogram {
+	b := make([]float64, len(bounds))
+	copy(b, bounds)
+	return Histogram{
+		Bounds: b,
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe добавляет в гистограмму значение v; NaN и бесконечности пропускаются
+func (h *Histogram) Observe(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	i := sort.SearchFloat64s(h.Bounds, v)
+	h.Counts[i]++
+	h.Sum += v
+	h.Count++
+}
+
+// Validate проверяет, что границы строго возрастают, сумма конечна,
+// а количество корзин и общее количество значений согласованы
+func (h Histogram) Validate() error {
+	if math.IsNaN(h.Sum) || math.IsInf(h.Sum, 0) {
+		return fmt.Errorf("invalid histogram sum %v", h.Sum)
+	}
+	for i, b := range h.Bounds {
+		if math.IsNaN(b) || math.IsInf(b, 0) {
+			return fmt.Errorf("invalid histogram bound %v", b)
+		}
+		if i > 0 && b <= h.Bounds[i-1] {
+			return errors.New("histogram bounds must be strictly increasing")
+		}
+	}
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("histogram has %d bounds and %d counts, expected %d counts",
+			len(h.Bounds), len(h.Counts), len(h.Bounds)+1)
+	}
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if total != h.Count {
+		return fmt.Errorf("histogram count %d does not match sum of bucket counts %d", h.Count, total)
+	}
+	return nil
+}
+
+// Merge прибавляет к гистограмме значения other; границы корзин должны совпадать
+func (h *Histogram) Merge(other Histogram) error {
+	if !equalBounds(h.Bounds, other.Bounds) || len(h.Counts) != len(other.Counts) {
+		return ErrBoundsMismatch
+	}
+	for i, c := range other.Counts {
+		h.Counts[i] += c
+	}
+	h.Sum += other.Sum
+	h.Count += other.Count
+	return nil
+}
+
+// Clone возвращает копию гистограммы, не разделяющую с ней память
+func (h Histogram) Clone() Histogram {
+	res := h
+	res.Bounds = append([]float64(nil), h.Bounds...)
+	res.Counts = append([]uint64(nil), h.Counts...)
+	return res
+}
+
+// MergeHistograms возвращает сумму накопленной гистограммы stored и приращения delta.
+// Если границы корзин изменились (например, в конфигурации агента),
+// накопленные значения отбрасываются и результатом становится delta.
+func MergeHistograms(stored Histogram, exists bool, delta Histogram) Histogram {
+	if !exists {
+		return delta.Clone()
+	}
+	res := stored.Clone()
+	if err := res.Merge(delta); err != nil {
+		return delta.Clone()
+	}
+	return res
+}
+
+func equalBounds(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
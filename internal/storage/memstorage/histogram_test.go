@@ -0,0 +1,96 @@
+package memstorage
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramObserve(t *testing.T) {
+	h := NewHistogram([]float64{1, 5, 10})
+	for _, v := range []float64{0.5, 1, 3, 7, 100} {
+		h.Observe(v)
+	}
+
+	// граница включается в свою корзину: 1 попадает в le=1
+	require.Equal(t, []uint64{2, 1, 1, 1}, h.Counts)
+	require.Equal(t, uint64(5), h.Count)
+	require.Equal(t, 111.5, h.Sum)
+	require.NoError(t, h.Validate())
+
+	// NaN и бесконечности не попадают в гистограмму
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		h.Observe(v)
+	}
+	require.Equal(t, uint64(5), h.Count)
+	require.Equal(t, 111.5, h.Sum)
+}
+
+func TestHistogramValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		h    Histogram
+	}{
+		{"not increasing", Histogram{Bounds: []float64{1, 1}, Counts: []uint64{0, 0, 0}}},
+		{"nan bound", Histogram{Bounds: []float64{math.NaN()}, Counts: []uint64{0, 0}}},
+		{"inf bound", Histogram{Bounds: []float64{math.Inf(1)}, Counts: []uint64{0, 0}}},
+		{"wrong counts length", Histogram{Bounds: []float64{1, 2}, Counts: []uint64{0, 0}}},
+		{"wrong count", Histogram{Bounds: []float64{1}, Counts: []uint64{1, 1}, Count: 3}},
+		{"nan sum", Histogram{Counts: []uint64{1}, Count: 1, Sum: math.NaN()}},
+		{"inf sum", Histogram{Counts: []uint64{1}, Count: 1, Sum: math.Inf(-1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Error(t, tt.h.Validate())
+		})
+	}
+
+	require.NoError(t, Histogram{Counts: []uint64{2}, Count: 2, Sum: 3}.Validate())
+}
+
+func TestMergeHistograms(t *testing.T) {
+	stored := Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 0, 1}, Sum: 3.5, Count: 2}
+	delta := Histogram{Bounds: []float64{1, 2}, Counts: []uint64{0, 1, 0}, Sum: 1.5, Count: 1}
+
+	res := MergeHistograms(stored, true, delta)
+	require.Equal(t, Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1, 1, 1}, Sum: 5, Count: 3}, res)
+	// исходная гистограмма не изменилась
+	require.Equal(t, []uint64{1, 0, 1}, stored.Counts)
+
+	// границы изменились - накопленное значение заменяется приращением
+	other := Histogram{Bounds: []float64{5}, Counts: []uint64{1, 0}, Sum: 4, Count: 1}
+	require.Equal(t, other, MergeHistograms(stored, true, other))
+	require.ErrorIs(t, stored.Merge(other), ErrBoundsMismatch)
+
+	require.Equal(t, delta, MergeHistograms(Histogram{}, false, delta))
+}
+
+func TestMemStorageHistogram(t *testing.T) {
+	ms, err := New(false, "")
+	require.NoError(t, err)
+
+	delta := Histogram{Bounds: []float64{1}, Counts: []uint64{1, 1}, Sum: 3, Count: 2}
+	require.NoError(t, ms.AddHistogramMetric(context.Background(), "latency", delta))
+	require.NoError(t, ms.AddHistogramMetric(context.Background(), "latency", delta))
+
+	h, ok, err := ms.GetHistogramMetric(context.Background(), "latency")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Histogram{Bounds: []float64{1}, Counts: []uint64{2, 2}, Sum: 6, Count: 4}, h)
+
+	// гистограмма попадает в слепок и восстанавливается из него
+	am := MemStorageToAllMetrics(ms)
+	restored, err := AllMetricsToMemStorage(&am)
+	require.NoError(t, err)
+	h, ok, err = restored.GetHistogramMetric(context.Background(), "latency")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(4), h.Count)
+
+	require.NoError(t, ms.Reset())
+	_, ok, err = ms.GetHistogramMetric(context.Background(), "latency")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,67 @@
+package memstorage
+
+import "time"
+
+// minSampleRingSize - начальный размер буфера истории метрики
+const minSampleRingSize = 16
+
+// Sample - значение метрики в определенный момент времени.
+// Для counter метрик Value содержит накопленное значение счетчика.
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// sampleRing - кольцевой буфер истории метрики в порядке добавления значений.
+// Количество значений не ограничено: буфер растет по мере надобности, а значения
+// старше срока хранения (RetentionPolicy.Raw) удаляются при добавлении и в Compact
+type sampleRing struct {
+	samples []Sample
+	start   int // индекс самого старого значения
+	size    int // количество заполненных элементов
+}
+
+// add удаляет значения, записанные раньше before, и добавляет s
+func (r *sampleRing) add(s Sample, before time.Time) {
+	r.dropBefore(before)
+	if r.size == len(r.samples) {
+		r.resize(max(2*len(r.samples), minSampleRingSize))
+	}
+	r.samples[(r.start+r.size)%len(r.samples)] = s
+	r.size++
+}
+
+// resize переносит значения в буфер размера capacity (не меньше r.size)
+func (r *sampleRing) resize(capacity int) {
+	samples := make([]Sample, capacity)
+	for i := 0; i < r.size; i++ {
+		samples[i] = r.samples[(r.start+i)%len(r.samples)]
+	}
+	r.samples, r.start = samples, 0
+}
+
+// between возвращает значения с from по to включительно в порядке их добавления
+func (r *sampleRing) between(from, to time.Time) []Sample {
+	res := []Sample{}
+	for i := 0; i < r.size; i++ {
+		s := r.samples[(r.start+i)%len(r.samples)]
+		if s.Timestamp.Before(from) || s.Timestamp.After(to) {
+			continue
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+// dropBefore удаляет самые старые значения, записанные раньше t
+func (r *sampleRing) dropBefore(t time.Time) {
+	for r.size > 0 && r.samples[r.start].Timestamp.Before(t) {
+		r.samples[r.start] = Sample{}
+		r.start = (r.start + 1) % len(r.samples)
+		r.size--
+	}
+	// после удаления большей части истории буфер уменьшается
+	if len(r.samples) > minSampleRingSize && r.size <= len(r.samples)/4 {
+		r.resize(len(r.samples) / 2)
+	}
+}
@@ -0,0 +1,97 @@
+package memstorage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// история хранится по сроку, а не по количеству значений
+func TestSampleRingKeepsRetention(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := &sampleRing{}
+
+	n := 5 * minSampleRingSize
+	for i := 0; i < n; i++ {
+		at := start.Add(time.Duration(i) * time.Second)
+		r.add(Sample{Timestamp: at, Value: float64(i)}, start)
+	}
+	res := r.between(start, start.Add(time.Hour))
+	require.Len(t, res, n)
+	require.Equal(t, 0.0, res[0].Value)
+	require.Equal(t, float64(n-1), res[n-1].Value)
+
+	// значения старше срока удаляются при добавлении, буфер уменьшается
+	last := start.Add(time.Duration(n) * time.Second)
+	r.add(Sample{Timestamp: last, Value: float64(n)}, last.Add(-2*time.Second))
+	require.Equal(t, []Sample{
+		{Timestamp: last.Add(-2 * time.Second), Value: float64(n - 2)},
+		{Timestamp: last.Add(-time.Second), Value: float64(n - 1)},
+		{Timestamp: last, Value: float64(n)},
+	}, r.between(start, last))
+	require.Less(t, len(r.samples), n)
+}
+
+func TestMetricHistoryRetention(t *testing.T) {
+	ms, err := New(false, "")
+	require.NoError(t, err)
+	ms.Retention = RetentionPolicy{Raw: 10 * time.Minute}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	current := start
+	ms.now = func() time.Time { return current }
+
+	for i := 0; i <= 2000; i++ {
+		current = start.Add(time.Duration(i) * time.Second)
+		require.NoError(t, ms.AddGaugeMetric(context.Background(), "g1", float64(i)))
+	}
+
+	res, err := ms.GetGaugeHistory(context.Background(), "g1", start, current)
+	require.NoError(t, err)
+	require.Len(t, res, 601)
+	require.True(t, current.Add(-10*time.Minute).Equal(res[0].Timestamp))
+}
+
+func TestMetricHistory(t *testing.T) {
+	ms, err := New(false, "")
+	require.NoError(t, err)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	current := start
+	ms.now = func() time.Time { return current }
+
+	for i := 0; i < 3; i++ {
+		current = start.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, ms.AddGaugeMetric(context.Background(), "g1", float64(i)+0.5))
+		require.NoError(t, ms.AddCounterMetric(context.Background(), "c1", 10))
+	}
+
+	// история gauge метрики в пределах периода
+	gHistory, err := ms.GetGaugeHistory(context.Background(), "g1", start.Add(time.Minute), start.Add(2*time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, []Sample{
+		{Timestamp: start.Add(time.Minute), Value: 1.5},
+		{Timestamp: start.Add(2 * time.Minute), Value: 2.5},
+	}, gHistory)
+
+	// в истории counter метрики хранится накопленное значение
+	cHistory, err := ms.GetCounterHistory(context.Background(), "c1", start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []Sample{
+		{Timestamp: start, Value: 10},
+		{Timestamp: start.Add(time.Minute), Value: 20},
+		{Timestamp: start.Add(2 * time.Minute), Value: 30},
+	}, cHistory)
+
+	// история несуществующей метрики
+	res, err := ms.GetGaugeHistory(context.Background(), "inexistentGauge", start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, res)
+
+	require.NoError(t, ms.Reset())
+	res, err = ms.GetCounterHistory(context.Background(), "c1", start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, res)
+}
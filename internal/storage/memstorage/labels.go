@@ -0,0 +1,149 @@
+package memstorage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Labels - набор меток метрики (например, host, agent_id, env).
+// Метрики с одинаковым именем, но разными метками, хранятся отдельно.
+type Labels map[string]string
+
+// String возвращает метки в виде {name="value",...}, упорядоченные по имени;
+// для пустого набора - пустую строку
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(l[name]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// ErrInvalidMetricName - имя метрики содержит символы, которыми в ключе записываются метки
+var ErrInvalidMetricName = errors.New("invalid metric name")
+
+// ValidateMetricName проверяет, что имя метрики не содержит символов {, } и ".
+// Иначе имя метрики без меток могло бы совпасть с ключом метрики с метками.
+func ValidateMetricName(name string) error {
+	if strings.ContainsAny(name, `{}"`) {
+		return fmt.Errorf("%w %q", ErrInvalidMetricName, name)
+	}
+	return nil
+}
+
+// ValidateSeries проверяет имя и метки метрики
+func ValidateSeries(name string, labels Labels) error {
+	if err := ValidateMetricName(name); err != nil {
+		return err
+	}
+	return ValidateLabels(labels)
+}
+
+// ValidateLabels проверяет, что имена меток имеют вид [a-zA-Z_][a-zA-Z0-9_]*
+func ValidateLabels(labels Labels) error {
+	for name := range labels {
+		if !isValidLabelName(name) {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+	}
+	return nil
+}
+
+func isValidLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// SeriesKey - ключ, под которым хранится метрика: имя и метки в виде name{label="value",...}.
+// Для метрики без меток ключ совпадает с именем, поэтому клиенты,
+// не передающие метки, работают с хранилищем как раньше.
+func SeriesKey(name string, labels Labels) string {
+	return name + labels.String()
+}
+
+// SplitSeriesKey разбирает ключ, полученный из SeriesKey, на имя и метки.
+// Если ключ не содержит корректного набора меток, он целиком считается именем.
+func SplitSeriesKey(key string) (string, Labels) {
+	start := strings.IndexByte(key, '{')
+	if start <= 0 || !strings.HasSuffix(key, "}") {
+		return key, nil
+	}
+
+	labels, ok := parseLabels(key[start+1 : len(key)-1])
+	if !ok {
+		return key, nil
+	}
+	return key[:start], labels
+}
+
+// parseLabels разбирает строку вида name="value",name="value"
+func parseLabels(s string) (Labels, bool) {
+	labels := make(Labels)
+	for s != "" {
+		name, rest, ok := strings.Cut(s, `="`)
+		if !ok || !isValidLabelName(name) {
+			return nil, false
+		}
+
+		var value strings.Builder
+		i := 0
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				i++
+				if rest[i] == 'n' {
+					value.WriteByte('\n')
+					continue
+				}
+			}
+			value.WriteByte(rest[i])
+		}
+		if i == len(rest) {
+			return nil, false
+		}
+		labels[name] = value.String()
+
+		s = rest[i+1:]
+		if s != "" {
+			if s[0] != ',' {
+				return nil, false
+			}
+			s = s[1:]
+		}
+	}
+	if len(labels) == 0 {
+		return nil, false
+	}
+	return labels, true
+}
@@ -0,0 +1,72 @@
+package memstorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeriesKey(t *testing.T) {
+	require.Equal(t, "HeapAlloc", SeriesKey("HeapAlloc", nil))
+	require.Equal(t, "HeapAlloc", SeriesKey("HeapAlloc", Labels{}))
+	require.Equal(t, `HeapAlloc{env="prod",host="a"}`, SeriesKey("HeapAlloc", Labels{"host": "a", "env": "prod"}))
+	require.Equal(t, `m{v="a\"b\\c\nd"}`, SeriesKey("m", Labels{"v": "a\"b\\c\nd"}))
+}
+
+func TestSplitSeriesKey(t *testing.T) {
+	labels := Labels{"host": "a", "env": "prod", "v": "a\"b\\c\nd,e=\"f\"}"}
+	name, parsed := SplitSeriesKey(SeriesKey("HeapAlloc", labels))
+	require.Equal(t, "HeapAlloc", name)
+	require.Equal(t, labels, parsed)
+
+	name, parsed = SplitSeriesKey("HeapAlloc")
+	require.Equal(t, "HeapAlloc", name)
+	require.Nil(t, parsed)
+
+	// некорректный набор меток считается частью имени
+	for _, key := range []string{"m{}", "{a=\"b\"}", "m{a=b}", "m{a=\"b\"", "m{1a=\"b\"}", "m{a=\"b\"c=\"d\"}"} {
+		name, parsed = SplitSeriesKey(key)
+		require.Equal(t, key, name)
+		require.Nil(t, parsed)
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	require.NoError(t, ValidateLabels(nil))
+	require.NoError(t, ValidateLabels(Labels{"host": "a", "_agent_id1": ""}))
+	require.Error(t, ValidateLabels(Labels{"": "a"}))
+	require.Error(t, ValidateLabels(Labels{"1host": "a"}))
+	require.Error(t, ValidateLabels(Labels{"host-name": "a"}))
+}
+
+func TestValidateMetricName(t *testing.T) {
+	require.NoError(t, ValidateMetricName("servers.web01.cpu_usage"))
+	for _, name := range []string{`HeapAlloc{host="a"}`, "m{", "m}", `m"`} {
+		require.ErrorIs(t, ValidateMetricName(name), ErrInvalidMetricName, name)
+	}
+
+	v := 1.0
+	require.Error(t, Metric{ID: `HeapAlloc{host="a"}`, MType: "gauge", Value: &v}.Validate())
+}
+
+func TestLabeledMetricsConversion(t *testing.T) {
+	v1 := 1.5
+	v2 := 2.5
+	d := int64(3)
+	allMs := AllMetrics{
+		AllMetrics: []Metric{
+			{ID: "HeapAlloc", MType: "gauge", Value: &v1, Labels: Labels{"host": "a"}},
+			{ID: "HeapAlloc", MType: "gauge", Value: &v2, Labels: Labels{"host": "b"}},
+			{ID: "PollCount", MType: "counter", Delta: &d},
+		},
+	}
+	ms, err := AllMetricsToMemStorage(&allMs)
+	require.NoError(t, err)
+
+	gMetrics, err := ms.GetAllGaugeMetrics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{`HeapAlloc{host="a"}`: 1.5, `HeapAlloc{host="b"}`: 2.5}, gMetrics)
+
+	require.ElementsMatch(t, allMs.AllMetrics, MemStorageToAllMetrics(ms).AllMetrics)
+}
@@ -0,0 +1,210 @@
+package memstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// порядок сортировки списка метрик (см. ListQuery)
+const (
+	ListSortName  = "name"  // по имени, метрики с одним именем - по меткам и типу
+	ListSortType  = "type"  // по типу, затем по имени
+	ListSortValue = "value" // по значению; только для gauge и counter метрик
+)
+
+// размер страницы списка метрик в API: по умолчанию и наибольший
+const (
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
+)
+
+// MaxListMatchLen - наибольшая длина шаблона имени в запросе списка метрик
+const MaxListMatchLen = 256
+
+var (
+	// ErrInvalidListQuery - недопустимые параметры запроса списка метрик
+	ErrInvalidListQuery = errors.New("invalid list query")
+)
+
+// ListQuery - выборка метрик: фильтр по типу и имени, сортировка и страница
+type ListQuery struct {
+	Type string // тип метрик; пустой - все типы
+	// шаблон имени метрики (без меток); пустой - все имена.
+	// По умолчанию glob: * - любая последовательность символов, ? - один символ, остальные символы
+	// сравниваются как есть; при Regex - регулярное выражение, которому должно соответствовать все имя
+	Match  string
+	Regex  bool
+	SortBy string // ListSortName (по умолчанию), ListSortType или ListSortValue
+	Desc   bool
+	Offset int
+	Limit  int // 0 - без ограничения
+}
+
+// Validate проверяет параметры выборки, в том числе синтаксис регулярного выражения:
+// допускается только подмножество RE2, которое можно выполнить и в Postgres (см. Pattern)
+func (q ListQuery) Validate() error {
+	if q.Type != "" && !ValidMetricType(q.Type) {
+		return fmt.Errorf("%w: %s", ErrUnknownMetricType, q.Type)
+	}
+	switch q.SortBy {
+	case "", ListSortName, ListSortType:
+	case ListSortValue:
+		if q.Type != "gauge" && q.Type != "counter" {
+			return fmt.Errorf("%w: sorting by value requires type gauge or counter", ErrInvalidListQuery)
+		}
+	default:
+		return fmt.Errorf("%w: unknown sort %q", ErrInvalidListQuery, q.SortBy)
+	}
+	if q.Offset < 0 || q.Limit < 0 {
+		return fmt.Errorf("%w: negative offset or limit", ErrInvalidListQuery)
+	}
+	if len(q.Match) > MaxListMatchLen {
+		return fmt.Errorf("%w: pattern longer than %d bytes", ErrInvalidListQuery, MaxListMatchLen)
+	}
+	if q.Regex {
+		if _, err := portableRegex(q.Match); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidListQuery, err)
+		}
+	}
+	return nil
+}
+
+// Pattern возвращает регулярное выражение, которому должно полностью соответствовать имя метрики.
+// Регулярное выражение Match переписывается в синтаксисе, общем для RE2 и Postgres,
+// поэтому результат одинаково работает в Go и в операторе ~ (для запросов, прошедших Validate)
+func (q ListQuery) Pattern() string {
+	if q.Regex {
+		if p, err := portableRegex(q.Match); err == nil {
+			return "^(?:" + p + ")$"
+		}
+		return "^(?:" + q.Match + ")$"
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range q.Match {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// LikePattern переводит glob шаблон Match в шаблон SQL LIKE (с экранированием \)
+func (q ListQuery) LikePattern() string {
+	var b strings.Builder
+	for _, r := range q.Match {
+		switch r {
+		case '*':
+			b.WriteRune('%')
+		case '?':
+			b.WriteRune('_')
+		case '%', '_', '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Matcher возвращает проверку имени метрики на соответствие шаблону
+func (q ListQuery) Matcher() (func(name string) bool, error) {
+	if q.Match == "" {
+		return func(string) bool { return true }, nil
+	}
+	re, err := regexp.Compile("(?s)" + q.Pattern())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidListQuery, err)
+	}
+	return re.MatchString, nil
+}
+
+// SelectMetrics выбирает из metrics метрики, подходящие под q, сортирует их и возвращает
+// страницу выборки вместе с общим количеством подходящих метрик.
+// Используется хранилищами, которые перебирают метрики в памяти процесса.
+func SelectMetrics(metrics []Metric, q ListQuery) ([]Metric, int, error) {
+	match, err := q.Matcher()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var res []Metric
+	for _, m := range metrics {
+		if (q.Type == "" || m.MType == q.Type) && match(m.ID) {
+			res = append(res, m)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		if q.Desc {
+			a, b = b, a
+		}
+		return lessMetric(a, b, q.SortBy)
+	})
+
+	total := len(res)
+	if q.Offset >= total {
+		return []Metric{}, total, nil
+	}
+	res = res[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(res) {
+		res = res[:q.Limit]
+	}
+	return res, total, nil
+}
+
+func lessMetric(a, b Metric, sortBy string) bool {
+	switch sortBy {
+	case ListSortType:
+		if a.MType != b.MType {
+			return a.MType < b.MType
+		}
+	case ListSortValue:
+		av, bv := metricNumber(a), metricNumber(b)
+		if av != bv {
+			return av < bv
+		}
+	}
+	if a.ID != b.ID {
+		return a.ID < b.ID
+	}
+	if ak, bk := a.Key(), b.Key(); ak != bk {
+		return ak < bk
+	}
+	return a.MType < b.MType
+}
+
+// metricNumber - значение gauge или counter метрики для сортировки
+func metricNumber(m Metric) float64 {
+	switch {
+	case m.Value != nil:
+		return *m.Value
+	case m.Delta != nil:
+		return float64(*m.Delta)
+	}
+	return 0
+}
+
+// ListMetrics возвращает страницу метрик, выбранных по q, и общее количество подходящих метрик
+func (ms *MemStorage) ListMetrics(_ context.Context, q ListQuery) ([]Metric, int, error) {
+	if err := q.Validate(); err != nil {
+		return nil, 0, err
+	}
+
+	ms.RLock()
+	defer ms.RUnlock()
+
+	return SelectMetrics(MemStorageToAllMetrics(ms).AllMetrics, q)
+}
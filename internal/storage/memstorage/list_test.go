@@ -0,0 +1,113 @@
+package memstorage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListQueryPatterns(t *testing.T) {
+	tests := []struct {
+		q       ListQuery
+		pattern string
+		like    string
+	}{
+		{ListQuery{Match: "CPU*"}, `^CPU.*$`, `CPU%`},
+		{ListQuery{Match: "cpu?.total"}, `^cpu.\.total$`, `cpu_.total`},
+		{ListQuery{Match: `50%_\`}, `^50%_\\$`, `50\%\_\\`},
+		{ListQuery{Match: "cpu|mem", Regex: true}, `^(?:(?:cpu|mem))$`, ""},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.pattern, tt.q.Pattern(), tt.q.Match)
+		if !tt.q.Regex {
+			require.Equal(t, tt.like, tt.q.LikePattern(), tt.q.Match)
+		}
+	}
+}
+
+func TestSelectMetrics(t *testing.T) {
+	v1, v2, d := 2.0, 1.0, int64(5)
+	metrics := []Metric{
+		{ID: "b", MType: "gauge", Value: &v1},
+		{ID: "a", MType: "gauge", Value: &v2, Labels: Labels{"host": "x"}},
+		{ID: "a", MType: "gauge", Value: &v1},
+		{ID: "a", MType: "counter", Delta: &d},
+		{ID: "ba", MType: "histogram", Histogram: &Histogram{Bounds: []float64{1}, Counts: []uint64{0, 0}}},
+	}
+	keys := func(metrics []Metric) []string {
+		var res []string
+		for _, m := range metrics {
+			res = append(res, m.MType+":"+m.Key())
+		}
+		return res
+	}
+
+	res, total, err := SelectMetrics(metrics, ListQuery{})
+	require.NoError(t, err)
+	require.Equal(t, 5, total)
+	require.Equal(t, []string{"counter:a", "gauge:a", `gauge:a{host="x"}`, "gauge:b", "histogram:ba"}, keys(res))
+
+	res, total, err = SelectMetrics(metrics, ListQuery{Match: "b*", Desc: true})
+	require.NoError(t, err)
+	require.Equal(t, 2, total)
+	require.Equal(t, []string{"histogram:ba", "gauge:b"}, keys(res))
+
+	res, total, err = SelectMetrics(metrics, ListQuery{Type: "gauge", SortBy: ListSortValue, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, 3, total)
+	require.Equal(t, []string{`gauge:a{host="x"}`, "gauge:a"}, keys(res))
+
+	res, total, err = SelectMetrics(metrics, ListQuery{SortBy: ListSortType, Offset: 3})
+	require.NoError(t, err)
+	require.Equal(t, 5, total)
+	require.Equal(t, []string{"gauge:b", "histogram:ba"}, keys(res))
+}
+
+func TestListQueryValidate(t *testing.T) {
+	require.NoError(t, ListQuery{Type: "counter", SortBy: ListSortValue, Match: "a|b", Regex: true}.Validate())
+	require.ErrorIs(t, ListQuery{Type: "unknown"}.Validate(), ErrUnknownMetricType)
+	require.ErrorIs(t, ListQuery{Type: "histogram", SortBy: ListSortValue}.Validate(), ErrInvalidListQuery)
+	require.ErrorIs(t, ListQuery{SortBy: "size"}.Validate(), ErrInvalidListQuery)
+	require.ErrorIs(t, ListQuery{Offset: -1}.Validate(), ErrInvalidListQuery)
+	require.ErrorIs(t, ListQuery{Match: "[", Regex: true}.Validate(), ErrInvalidListQuery)
+	require.ErrorIs(t, ListQuery{Match: strings.Repeat("a", MaxListMatchLen+1)}.Validate(), ErrInvalidListQuery)
+	for _, match := range []string{`cpu\b`, `\Bcpu`, `(?m)^cpu$`, `a{256}`, `\x00`, `[^\x00-\x{10FFFF}]`} {
+		require.ErrorIs(t, ListQuery{Match: match, Regex: true}.Validate(), ErrInvalidListQuery, match)
+	}
+}
+
+// регулярное выражение переписывается в синтаксисе, общем для RE2 и Postgres, без изменения смысла
+func TestPortableRegex(t *testing.T) {
+	tests := []struct {
+		match    string
+		portable string
+		names    []string // подходящие имена
+		other    []string // неподходящие имена
+	}{
+		{`cpu.total`, `cpu.total`, []string{"cpu.total", "cpu_total", "cpu\ntotal"}, []string{"cputotal"}},
+		{`(?-s)a.b`, "a[\x01-\t\v-\ud7ff\ue000-\U0010ffff]b", []string{"a.b", "aяb"}, []string{"a\nb"}},
+		{`(cpu|mem)_\d+`, `(?:(?:cpu|mem))_(?:[0-9])+`, []string{"cpu_1", "mem_20"}, []string{"cpu_", "disk_1"}},
+		{`a.b{2,3}\.c?`, `a.(?:b){2,3}\.(?:c)?`, []string{"axbb.", "a.bbb.c"}, []string{"axb.", "axbbbb."}},
+		{`(?i)cpu`, `[Cc][Pp][Uu]`, []string{"CPU", "cPu"}, []string{"cpx"}},
+		{`[\w-]+`, `(?:[\-0-9A-Z_a-z])+`, []string{"go-mem_1"}, []string{"go.mem"}},
+		{`^\$\[\\]`, `^\$\[\\\]`, []string{`$[\]`}, []string{`$[]`}},
+		{`х+`, `(?:х)+`, []string{"ххх"}, []string{"x"}},
+	}
+	for _, tt := range tests {
+		portable, err := portableRegex(tt.match)
+		require.NoError(t, err, tt.match)
+		require.Equal(t, tt.portable, portable, tt.match)
+
+		q := ListQuery{Match: tt.match, Regex: true}
+		require.NoError(t, q.Validate(), tt.match)
+		match, err := q.Matcher()
+		require.NoError(t, err, tt.match)
+		for _, name := range tt.names {
+			require.True(t, match(name), "%s ~ %q", tt.match, name)
+		}
+		for _, name := range tt.other {
+			require.False(t, match(name), "%s !~ %q", tt.match, name)
+		}
+	}
+}
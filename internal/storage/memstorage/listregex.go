@@ -0,0 +1,161 @@
+package memstorage
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// наибольшее число повторений {n,m}, которое понимают регулярные выражения Postgres
+const maxPortableRepeat = 255
+
+// portableRegex разбирает регулярное выражение RE2 и записывает его заново в синтаксисе,
+// который одинаково понимают RE2 и регулярные выражения Postgres (ARE): классы символов
+// раскрываются в диапазоны, группы становятся незахватывающими, знаки пунктуации экранируются.
+// Конструкции без общего смысла (границы слов, многострочные якоря) отклоняются.
+func portableRegex(pattern string) (string, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl|syntax.DotNL)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := writePortable(&b, re); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func writePortable(b *strings.Builder, re *syntax.Regexp) error {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		b.WriteString("(?:)")
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if r == 0 {
+				return fmt.Errorf("NUL character is not supported")
+			}
+			if re.Flags&syntax.FoldCase != 0 && unicode.SimpleFold(r) != r {
+				ranges := []rune{r, r}
+				for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+					ranges = append(ranges, f, f)
+				}
+				if err := writePortableClass(b, ranges); err != nil {
+					return err
+				}
+				continue
+			}
+			writePortableRune(b, r)
+		}
+	case syntax.OpCharClass:
+		return writePortableClass(b, re.Rune)
+	case syntax.OpAnyChar:
+		b.WriteString(".")
+	case syntax.OpAnyCharNotNL:
+		return writePortableClass(b, []rune{0, '\n' - 1, '\n' + 1, unicode.MaxRune})
+	case syntax.OpBeginText:
+		b.WriteString("^")
+	case syntax.OpEndText:
+		b.WriteString("$")
+	case syntax.OpCapture:
+		return writePortableGroup(b, re.Sub[0], "")
+	case syntax.OpStar:
+		return writePortableGroup(b, re.Sub[0], "*")
+	case syntax.OpPlus:
+		return writePortableGroup(b, re.Sub[0], "+")
+	case syntax.OpQuest:
+		return writePortableGroup(b, re.Sub[0], "?")
+	case syntax.OpRepeat:
+		if re.Min > maxPortableRepeat || re.Max > maxPortableRepeat {
+			return fmt.Errorf("repeat count exceeds %d", maxPortableRepeat)
+		}
+		suffix := "{" + strconv.Itoa(re.Min)
+		switch {
+		case re.Max < 0:
+			suffix += ",}"
+		case re.Max != re.Min:
+			suffix += "," + strconv.Itoa(re.Max) + "}"
+		default:
+			suffix += "}"
+		}
+		return writePortableGroup(b, re.Sub[0], suffix)
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if err := writePortable(b, sub); err != nil {
+				return err
+			}
+		}
+	case syntax.OpAlternate:
+		b.WriteString("(?:")
+		for i, sub := range re.Sub {
+			if i > 0 {
+				b.WriteString("|")
+			}
+			if err := writePortable(b, sub); err != nil {
+				return err
+			}
+		}
+		b.WriteString(")")
+	default:
+		return fmt.Errorf("unsupported regular expression construct %q", re.String())
+	}
+	return nil
+}
+
+// writePortableGroup записывает подвыражение в незахватывающей группе с квантификатором suffix.
+// Нежадные квантификаторы записываются жадными: для полного совпадения имени это не важно.
+func writePortableGroup(b *strings.Builder, sub *syntax.Regexp, suffix string) error {
+	b.WriteString("(?:")
+	if err := writePortable(b, sub); err != nil {
+		return err
+	}
+	b.WriteString(")")
+	b.WriteString(suffix)
+	return nil
+}
+
+// writePortableClass записывает класс символов по парам диапазонов ranges.
+// NUL и суррогатные половины UTF-16 пропускаются: в тексте Postgres их не бывает.
+func writePortableClass(b *strings.Builder, ranges []rune) error {
+	var out []rune
+	for i := 0; i+1 < len(ranges); i += 2 {
+		lo, hi := max(ranges[i], 1), ranges[i+1]
+		if lo < 0xD800 && hi > 0xDFFF {
+			out = append(out, lo, 0xD7FF, 0xE000, hi)
+			continue
+		}
+		if lo >= 0xD800 && lo <= 0xDFFF {
+			lo = 0xE000
+		}
+		if hi >= 0xD800 && hi <= 0xDFFF {
+			hi = 0xD7FF
+		}
+		if lo <= hi {
+			out = append(out, lo, hi)
+		}
+	}
+	if len(out) == 0 {
+		return fmt.Errorf("empty character class")
+	}
+	b.WriteString("[")
+	for i := 0; i < len(out); i += 2 {
+		writePortableRune(b, out[i])
+		if out[i+1] != out[i] {
+			b.WriteString("-")
+			writePortableRune(b, out[i+1])
+		}
+	}
+	b.WriteString("]")
+	return nil
+}
+
+// writePortableRune записывает символ; знаки пунктуации ASCII экранируются обратной косой чертой,
+// что в RE2 и в Postgres означает сам символ и вне класса, и внутри него.
+// Остальные символы записываются как есть: у \x и \u разный синтаксис в RE2 и Postgres.
+func writePortableRune(b *strings.Builder, r rune) {
+	if r > ' ' && r < unicode.MaxASCII && !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+		b.WriteRune('\\')
+	}
+	b.WriteRune(r)
+}
@@ -3,48 +3,159 @@
 package memstorage
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
+	"os"
 	"sync"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
 )
 
 type Metric struct {
-	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
-	ID    string   `json:"id"`              // имя метрики
-	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
+	Delta     *int64           `json:"delta,omitempty"`     // значение метрики в случае передачи counter
+	Value     *float64         `json:"value,omitempty"`     // значение метрики в случае передачи gauge
+	Histogram *Histogram       `json:"histogram,omitempty"` // значение метрики в случае передачи histogram
+	Summary   *ddsketch.Sketch `json:"summary,omitempty"`   // значение метрики в случае передачи summary
+	// квантили summary метрики, вычисленные по скетчу (только в ответе /value/)
+	Quantiles *SummaryValue `json:"quantiles,omitempty"`
+	ID        string        `json:"id"`               // имя метрики
+	MType     string        `json:"type"`             // параметр, принимающий значение gauge, counter, histogram или summary
+	Labels    Labels        `json:"labels,omitempty"` // метки метрики (необязательно)
+}
+
+// Key - ключ, под которым метрика хранится в Storager (см. SeriesKey)
+func (m Metric) Key() string {
+	return SeriesKey(m.ID, m.Labels)
+}
+
+// ErrNoMetricValue - у метрики не задано значение, соответствующее ее типу
+var ErrNoMetricValue = errors.New("metric has no value")
+
+// Validate проверяет тип, имя, метки и значение метрики перед записью в Storager
+func (m Metric) Validate() error {
+	if err := ValidateSeries(m.ID, m.Labels); err != nil {
+		return err
+	}
+	switch m.MType {
+	case "gauge":
+		if m.Value == nil {
+			return fmt.Errorf("gauge metric %s: %w", m.ID, ErrNoMetricValue)
+		}
+	case "counter":
+		if m.Delta == nil {
+			return fmt.Errorf("counter metric %s: %w", m.ID, ErrNoMetricValue)
+		}
+	case "histogram":
+		if m.Histogram == nil {
+			return fmt.Errorf("histogram metric %s: %w", m.ID, ErrNoMetricValue)
+		}
+		return m.Histogram.Validate()
+	case "summary":
+		if m.Summary == nil {
+			return fmt.Errorf("summary metric %s: %w", m.ID, ErrNoMetricValue)
+		}
+		return m.Summary.Validate()
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownMetricType, m.MType)
+	}
+	return nil
 }
 
 type AllMetrics struct {
 	AllMetrics []Metric `json:"metrics"`
+	// номер последней записи журнала изменений, учтенной в слепке (см. walRecord)
+	WALSeq uint64 `json:"wal_seq,omitempty"`
 }
 
 // MemStorage is used for storaging metrics
 // MemStorage - это имплементация интерфейса Storage
+// (контекст вызова не используется: все операции выполняются в памяти)
 type MemStorage struct {
 	gauge   map[string]float64 // имя метрики: ее значение
 	counter map[string]int64
+	// накопленные гистограммы: имя метрики: сумма присланных приращений
+	histogram map[string]Histogram
+	// накопленные скетчи summary метрик: имя метрики: объединение присланных скетчей
+	summary map[string]*ddsketch.Sketch
+	// история значений каждой метрики: имя метрики: кольцевой буфер
+	gaugeHistory   map[string]*sampleRing
+	counterHistory map[string]*sampleRing
+	// журнал изменений, который дописывается вместо перезаписи слепка (см. logWAL)
+	wal        *os.File
+	walRecords int    // количество записей в журнале после последнего слепка
+	walSeq     uint64 // номер последней записи журнала
+	walLimit   int
+	// минутные и часовые агрегаты истории gauge и counter метрик (см. Compact)
+	minuteRollups  map[metricKey]rollupSeries
+	hourRollups    map[metricKey]rollupSeries
+	compactedUntil time.Time // до этого момента часовые агрегаты уже посчитаны
+	// сроки хранения истории; незаданные сроки берутся из DefaultRetention
+	Retention RetentionPolicy
+	// время последнего обновления каждой метрики (для удаления устаревших, см. DeleteStaleMetrics)
+	updated map[metricKey]time.Time
+	now     func() time.Time
 	// если config.StoreInterval равен 0, то мы назначаем MemStorage FileName,
-	// чтобы он мог синхронно писать изменения
+	// чтобы он мог синхронно писать изменения: каждое изменение дописывается
+	// в журнал WALFileName(FileName), который периодически сворачивается в слепок FileName
 	FileName string
+	// сжатие слепков (пустое значение - без сжатия); слепки читаются при любом сжатии
+	SnapshotCompression Compression
 	sync.RWMutex
 }
 
-func New(shouldRestore bool, storagePath string) (*MemStorage, error) {
+// Option - настройка хранилища, которая применяется в New до записи первого слепка
+type Option func(ms *MemStorage)
+
+// WithSnapshotCompression задает сжатие слепков (см. SnapshotCompression);
+// в том числе слепка, который New записывает сразу после восстановления
+func WithSnapshotCompression(compression Compression) Option {
+	return func(ms *MemStorage) {
+		ms.SnapshotCompression = compression
+	}
+}
+
+func New(shouldRestore bool, storagePath string, opts ...Option) (*MemStorage, error) {
 
 	if shouldRestore {
-		ms, err := ReadMetricsSnapshot(storagePath)
+		ms, err := Restore(storagePath)
 		if err != nil {
 			return nil, err
 		}
 		ms.FileName = storagePath
+		for _, opt := range opts {
+			opt(ms)
+		}
+		// восстановленное из журнала состояние сразу сохраняется в новый слепок
+		if err = ms.WriteSnapshot(); err != nil {
+			return nil, err
+		}
 		return ms, nil
 	}
 
 	gauge := make(map[string]float64)
 	counter := make(map[string]int64)
 
-	ms := &MemStorage{gauge: gauge, counter: counter, FileName: storagePath}
+	ms := &MemStorage{
+		gauge:          gauge,
+		counter:        counter,
+		histogram:      make(map[string]Histogram),
+		summary:        make(map[string]*ddsketch.Sketch),
+		gaugeHistory:   make(map[string]*sampleRing),
+		counterHistory: make(map[string]*sampleRing),
+		minuteRollups:  make(map[metricKey]rollupSeries),
+		hourRollups:    make(map[metricKey]rollupSeries),
+		updated:        make(map[metricKey]time.Time),
+		walLimit:       defaultWALLimit,
+		now:            time.Now,
+		FileName:       storagePath,
+	}
+	for _, opt := range opts {
+		opt(ms)
+	}
 
 	return ms, nil
 }
@@ -61,17 +172,32 @@ func (ms *MemStorage) Reset() error {
 	for k := range ms.counter {
 		delete(ms.counter, k)
 	}
-
-	if ms.FileName != "" {
-		err := WriteMetricsSnapshot(ms.FileName, ms)
-		if err != nil {
-			return err
-		}
+	for k := range ms.histogram {
+		delete(ms.histogram, k)
 	}
-	return nil
+	for k := range ms.summary {
+		delete(ms.summary, k)
+	}
+	for k := range ms.gaugeHistory {
+		delete(ms.gaugeHistory, k)
+	}
+	for k := range ms.counterHistory {
+		delete(ms.counterHistory, k)
+	}
+	for k := range ms.minuteRollups {
+		delete(ms.minuteRollups, k)
+	}
+	for k := range ms.hourRollups {
+		delete(ms.hourRollups, k)
+	}
+	for k := range ms.updated {
+		delete(ms.updated, k)
+	}
+
+	return ms.logWAL(walRecord{Op: walOpReset})
 }
 
-func (ms *MemStorage) GetGaugeMetric(name string) (float64, bool, error) {
+func (ms *MemStorage) GetGaugeMetric(_ context.Context, name string) (float64, bool, error) {
 	ms.RLock()
 	defer ms.RUnlock()
 
@@ -80,7 +206,7 @@ func (ms *MemStorage) GetGaugeMetric(name string) (float64, bool, error) {
 	return value, ok, nil
 }
 
-func (ms *MemStorage) GetCounterMetric(name string) (int64, bool, error) {
+func (ms *MemStorage) GetCounterMetric(_ context.Context, name string) (int64, bool, error) {
 	ms.RLock()
 	defer ms.RUnlock()
 
@@ -89,54 +215,226 @@ func (ms *MemStorage) GetCounterMetric(name string) (int64, bool, error) {
 	return value, ok, nil
 }
 
-func (ms *MemStorage) AddGaugeMetric(name string, value float64) error {
+func (ms *MemStorage) AddGaugeMetric(_ context.Context, name string, value float64) error {
 	ms.Lock()
 	defer ms.Unlock()
 
+	return ms.logWAL(ms.addGauge(name, value, ms.now()))
+}
+
+// addGauge записывает значение gauge метрики, полученное в момент at, под блокировкой
+// и возвращает запись для журнала
+func (ms *MemStorage) addGauge(name string, value float64, at time.Time) walRecord {
 	ms.gauge[name] = value
+	ms.touch("gauge", name)
+	ms.addSample(ms.gaugeHistory, name, Sample{Timestamp: at, Value: value})
+	ms.observeRollup("gauge", name, at, value)
 
-	if ms.FileName != "" {
-		err := WriteMetricsSnapshot(ms.FileName, ms)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	at = at.UTC()
+	return walRecord{Op: walOpAdd, Type: "gauge", Key: name, Value: &value, Time: &at}
 }
 
-func (ms *MemStorage) AddCounterMetric(name string, value int64) error {
+func (ms *MemStorage) AddCounterMetric(_ context.Context, name string, value int64) error {
 	ms.Lock()
 	defer ms.Unlock()
 
+	return ms.logWAL(ms.addCounter(name, value, ms.now()))
+}
+
+// addCounter прибавляет приращение counter метрики, полученное в момент at, под блокировкой
+// и возвращает запись для журнала
+func (ms *MemStorage) addCounter(name string, value int64, at time.Time) walRecord {
 	if _, exists := ms.counter[name]; !exists {
 		ms.counter[name] = value
 	} else {
 		ms.counter[name] += value
 	}
+	ms.addSample(ms.counterHistory, name, Sample{Timestamp: at, Value: float64(ms.counter[name])})
+	ms.observeRollup("counter", name, at, float64(value))
+	ms.touch("counter", name)
 
-	if ms.FileName != "" {
-		err := WriteMetricsSnapshot(ms.FileName, ms)
-		if err != nil {
+	at = at.UTC()
+	return walRecord{Op: walOpAdd, Type: "counter", Key: name, Delta: &value, Time: &at}
+}
+
+// GetHistogramMetric возвращает копию накопленной гистограммы
+func (ms *MemStorage) GetHistogramMetric(_ context.Context, name string) (Histogram, bool, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	h, ok := ms.histogram[name]
+	if !ok {
+		return Histogram{}, false, nil
+	}
+	return h.Clone(), true, nil
+}
+
+// AddHistogramMetric прибавляет к накопленной гистограмме приращение h (см. MergeHistograms)
+func (ms *MemStorage) AddHistogramMetric(_ context.Context, name string, h Histogram) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	return ms.logWAL(ms.addHistogram(name, h))
+}
+
+func (ms *MemStorage) addHistogram(name string, h Histogram) walRecord {
+	stored, exists := ms.histogram[name]
+	ms.histogram[name] = MergeHistograms(stored, exists, h)
+	ms.touch("histogram", name)
+
+	return walRecord{Op: walOpAdd, Type: "histogram", Key: name, Histogram: &h}
+}
+
+// GetAllHistogramMetrics возвращает копии всех гистограмм: хранилище может меняться,
+// пока вызывающий обходит результат
+func (ms *MemStorage) GetAllHistogramMetrics(_ context.Context) (map[string]Histogram, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	res := make(map[string]Histogram, len(ms.histogram))
+	for name, h := range ms.histogram {
+		res[name] = h.Clone()
+	}
+	return res, nil
+}
+
+// GetSummaryMetric возвращает копию накопленного скетча summary метрики
+func (ms *MemStorage) GetSummaryMetric(_ context.Context, name string) (*ddsketch.Sketch, bool, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	s, ok := ms.summary[name]
+	if !ok {
+		return nil, false, nil
+	}
+	return s.Clone(), true, nil
+}
+
+// AddSummaryMetric объединяет накопленный скетч с присланным (см. MergeSummaries)
+func (ms *MemStorage) AddSummaryMetric(_ context.Context, name string, s *ddsketch.Sketch) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	return ms.logWAL(ms.addSummary(name, s))
+}
+
+func (ms *MemStorage) addSummary(name string, s *ddsketch.Sketch) walRecord {
+	ms.summary[name] = MergeSummaries(ms.summary[name], s)
+	ms.touch("summary", name)
+
+	return walRecord{Op: walOpAdd, Type: "summary", Key: name, Summary: s}
+}
+
+// AddMetrics записывает пакет метрик под одной блокировкой: читатели видят либо весь пакет, либо ничего.
+// Пакет проверяется целиком до записи, а в журнал изменений попадает одной записью,
+// поэтому после сбоя он восстанавливается тоже целиком или не восстанавливается вовсе.
+func (ms *MemStorage) AddMetrics(_ context.Context, metrics []Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	for _, metric := range metrics {
+		if err := metric.Validate(); err != nil {
 			return err
 		}
 	}
-	return nil
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	now := ms.now()
+	batch := make([]walRecord, 0, len(metrics))
+	for _, metric := range metrics {
+		var rec walRecord
+		switch metric.MType {
+		case "gauge":
+			rec = ms.addGauge(metric.Key(), *metric.Value, now)
+		case "counter":
+			rec = ms.addCounter(metric.Key(), *metric.Delta, now)
+		case "histogram":
+			rec = ms.addHistogram(metric.Key(), *metric.Histogram)
+		case "summary":
+			rec = ms.addSummary(metric.Key(), metric.Summary)
+		}
+		batch = append(batch, rec)
+	}
+	return ms.logWAL(walRecord{Op: walOpBatch, Batch: batch})
 }
 
-func (ms *MemStorage) GetAllCounterMetrics() (map[string]int64, error) {
-	return ms.counter, nil
+// GetAllSummaryMetrics возвращает копии скетчей всех summary метрик
+func (ms *MemStorage) GetAllSummaryMetrics(_ context.Context) (map[string]*ddsketch.Sketch, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	res := make(map[string]*ddsketch.Sketch, len(ms.summary))
+	for name, s := range ms.summary {
+		res[name] = s.Clone()
+	}
+	return res, nil
 }
 
-func (ms *MemStorage) GetAllGaugeMetrics() (map[string]float64, error) {
-	return ms.gauge, nil
+// GetAllCounterMetrics возвращает копию значений всех counter метрик
+func (ms *MemStorage) GetAllCounterMetrics(_ context.Context) (map[string]int64, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	return maps.Clone(ms.counter), nil
+}
+
+// GetAllGaugeMetrics возвращает копию значений всех gauge метрик
+func (ms *MemStorage) GetAllGaugeMetrics(_ context.Context) (map[string]float64, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	return maps.Clone(ms.gauge), nil
+}
+
+// GetGaugeHistory возвращает значения gauge метрики, записанные с from по to включительно
+func (ms *MemStorage) GetGaugeHistory(_ context.Context, name string, from, to time.Time) ([]Sample, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	ring, ok := ms.gaugeHistory[name]
+	if !ok {
+		return []Sample{}, nil
+	}
+	return ring.between(from, to), nil
+}
+
+// GetCounterHistory возвращает накопленные значения counter метрики,
+// записанные с from по to включительно
+func (ms *MemStorage) GetCounterHistory(_ context.Context, name string, from, to time.Time) ([]Sample, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	ring, ok := ms.counterHistory[name]
+	if !ok {
+		return []Sample{}, nil
+	}
+	return ring.between(from, to), nil
+}
+
+// addSample добавляет значение в историю метрики; история хранится в пределах срока Retention.Raw
+func (ms *MemStorage) addSample(history map[string]*sampleRing, name string, s Sample) {
+	ring, ok := history[name]
+	if !ok {
+		ring = &sampleRing{}
+		history[name] = ring
+	}
+	ring.add(s, s.Timestamp.Add(-ms.Retention.WithDefaults().Raw))
 }
 
 // отрабатывает завершение приложения (при штатном завершении работы)
 // процесс финализации: объекты могут делать работу, пользоваться ресурсамии,
 // и при заверщении работы (без работы с БД или с файлом), надо содержимое memStorage записать на диск (в файл)
-func (ms *MemStorage) Finalize() error {
+func (ms *MemStorage) Finalize(_ context.Context) error {
 	log.Println("ms.FileName:", ms.FileName)
-	return WriteMetricsSnapshot(ms.FileName, ms)
+	ms.Lock()
+	defer ms.Unlock()
+
+	if err := ms.writeSnapshot(ms.FileName); err != nil {
+		return err
+	}
+	return ms.closeWAL()
 }
 
 // функция из структуры memStorage делает структуру AllMetrics
@@ -145,15 +443,29 @@ func MemStorageToAllMetrics(ms *MemStorage) AllMetrics {
 	var am AllMetrics
 
 	for k, v := range ms.gauge {
-		am.AllMetrics = append(am.AllMetrics, Metric{ID: k, MType: "gauge", Value: &v})
+		name, labels := SplitSeriesKey(k)
+		am.AllMetrics = append(am.AllMetrics, Metric{ID: name, MType: "gauge", Value: &v, Labels: labels})
 	}
 	for k, v := range ms.counter {
-		am.AllMetrics = append(am.AllMetrics, Metric{ID: k, MType: "counter", Delta: &v})
+		name, labels := SplitSeriesKey(k)
+		am.AllMetrics = append(am.AllMetrics, Metric{ID: name, MType: "counter", Delta: &v, Labels: labels})
+	}
+	for k, v := range ms.histogram {
+		name, labels := SplitSeriesKey(k)
+		h := v.Clone()
+		am.AllMetrics = append(am.AllMetrics, Metric{ID: name, MType: "histogram", Histogram: &h, Labels: labels})
+	}
+	for k, v := range ms.summary {
+		name, labels := SplitSeriesKey(k)
+		am.AllMetrics = append(am.AllMetrics, Metric{ID: name, MType: "summary", Summary: v.Clone(), Labels: labels})
 	}
 
 	return am
 }
 
+// AllMetricsToMemStorage восстанавливает хранилище из значений метрик (например, из слепка).
+// Значения записываются как есть: история и агрегаты по ним не ведутся, ведь для counter метрики
+// это накопленное значение, а не присланное приращение, и получено оно не в момент восстановления.
 func AllMetricsToMemStorage(am *AllMetrics) (*MemStorage, error) {
 	ms, err := New(false, "")
 	if err != nil {
@@ -161,15 +473,23 @@ func AllMetricsToMemStorage(am *AllMetrics) (*MemStorage, error) {
 	}
 
 	for _, metric := range am.AllMetrics {
+		if err = metric.Validate(); err != nil {
+			return nil, err
+		}
+		key := metric.Key()
 		switch metric.MType {
 		case "gauge":
-			ms.AddGaugeMetric(metric.ID, *metric.Value)
+			ms.gauge[key] = *metric.Value
 		case "counter":
-			ms.AddCounterMetric(metric.ID, *metric.Delta)
-		default:
-			return nil, fmt.Errorf("unknown metric type: %s", metric.MType)
+			ms.counter[key] += *metric.Delta
+		case "histogram":
+			ms.histogram[key] = metric.Histogram.Clone()
+		case "summary":
+			ms.summary[key] = metric.Summary.Clone()
 		}
+		ms.touch(metric.MType, key)
 	}
+	ms.walSeq = am.WALSeq
 
 	return ms, nil
 }
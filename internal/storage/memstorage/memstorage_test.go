@@ -1,9 +1,11 @@
 package memstorage_test
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"sort"
+	"sync"
 	"testing"
 
 	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
@@ -23,15 +25,15 @@ func ExampleMemStorage_AddCounterMetric() {
 	)
 
 	// записали метрику в хранилище
-	ms.AddCounterMetric(name, value1)
+	ms.AddCounterMetric(context.Background(), name, value1)
 	// проверка наличия метрики в map
-	val1, ok, err := ms.GetCounterMetric(name)
+	val1, ok, err := ms.GetCounterMetric(context.Background(), name)
 	if ok {
 		fmt.Println(val1)
 	}
 
-	ms.AddCounterMetric(name, value2)
-	val2, ok, err := ms.GetCounterMetric(name)
+	ms.AddCounterMetric(context.Background(), name, value2)
+	val2, ok, err := ms.GetCounterMetric(context.Background(), name)
 	if ok {
 		fmt.Println(val2)
 	}
@@ -53,15 +55,15 @@ func ExampleMemStorage_AddGaugeMetric() {
 	value2 := 100.555
 
 	// записали метрику в хранилище
-	ms.AddGaugeMetric(name, value1)
+	ms.AddGaugeMetric(context.Background(), name, value1)
 	// проверка наличия метрики в map
-	val1, ok, err := ms.GetGaugeMetric(name)
+	val1, ok, err := ms.GetGaugeMetric(context.Background(), name)
 	if ok {
 		fmt.Println(val1)
 	}
 
-	ms.AddGaugeMetric(name, value2)
-	val2, ok, err := ms.GetGaugeMetric(name)
+	ms.AddGaugeMetric(context.Background(), name, value2)
+	val2, ok, err := ms.GetGaugeMetric(context.Background(), name)
 	if ok {
 		fmt.Println(val2)
 	}
@@ -83,10 +85,10 @@ func ExampleMemStorage_GetAllCounterMetrics() {
 	}
 
 	for k, v := range metrics {
-		ms.AddCounterMetric(k, v)
+		ms.AddCounterMetric(context.Background(), k, v)
 	}
 
-	checkmetrics, err := ms.GetAllCounterMetrics()
+	checkmetrics, err := ms.GetAllCounterMetrics(context.Background())
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -113,21 +115,55 @@ func TestReset(t *testing.T) {
 	ms, err := memstorage.New(false, "")
 	require.NoError(t, err)
 
-	err = ms.AddCounterMetric("m1", 1)
+	err = ms.AddCounterMetric(context.Background(), "m1", 1)
 	require.NoError(t, err)
 
-	err = ms.AddGaugeMetric("g1", 1.1)
+	err = ms.AddGaugeMetric(context.Background(), "g1", 1.1)
 	require.NoError(t, err)
 
 	err = ms.Reset()
 	require.NoError(t, err)
 
-	cMetrics, err := ms.GetAllCounterMetrics()
+	cMetrics, err := ms.GetAllCounterMetrics(context.Background())
 	require.NoError(t, err)
 	require.Empty(t, cMetrics)
 
-	gMetrics, err := ms.GetAllGaugeMetrics()
+	gMetrics, err := ms.GetAllGaugeMetrics(context.Background())
 	require.NoError(t, err)
 	require.Empty(t, gMetrics)
 
 }
+
+// GetAll* возвращают копии: их можно обходить, пока хранилище меняется
+func TestGetAllReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+	require.NoError(t, ms.AddGaugeMetric(ctx, "g1", 1.1))
+	require.NoError(t, ms.AddCounterMetric(ctx, "c1", 1))
+
+	gMetrics, err := ms.GetAllGaugeMetrics(ctx)
+	require.NoError(t, err)
+	cMetrics, err := ms.GetAllCounterMetrics(ctx)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_ = ms.AddGaugeMetric(ctx, fmt.Sprintf("g%d", i), float64(i))
+			_ = ms.AddCounterMetric(ctx, fmt.Sprintf("c%d", i), 1)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		for range gMetrics {
+		}
+		for range cMetrics {
+		}
+	}
+	wg.Wait()
+
+	require.Equal(t, map[string]float64{"g1": 1.1}, gMetrics)
+	require.Equal(t, map[string]int64{"c1": 1}, cMetrics)
+}
@@ -1,6 +1,7 @@
 package memstorage
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -34,12 +35,12 @@ func TestAllMetricsToMemStorage(t *testing.T) {
 	require.NoError(t, err)
 
 	// получение всех counter метрик
-	cMetrics, err := res.GetAllCounterMetrics()
+	cMetrics, err := res.GetAllCounterMetrics(context.Background())
 	require.NoError(t, err)
 	require.Equal(t, map[string]int64{"c1": 655, "c2": 200}, cMetrics)
 
 	// получение всех gauge метрик
-	gMetrics, err := res.GetAllGaugeMetrics()
+	gMetrics, err := res.GetAllGaugeMetrics(context.Background())
 	require.NoError(t, err)
 	require.Equal(t, map[string]float64{"g1": 1.23, "g2": 10.1}, gMetrics)
 
@@ -102,12 +103,12 @@ func TestIncorrectMetricType(t *testing.T) {
 	require.Error(t, err)
 
 	// получение всех counter метрик
-	// cMetrics, err := res.GetAllCounterMetrics()
+	// cMetrics, err := res.GetAllCounterMetrics(context.Background())
 	// require.NoError(t, err)
 	// require.Equal(t, map[string]int64{"c1": 655, "c2": 200}, cMetrics)
 
 	// // получение всех gauge метрик
-	// gMetrics, err := res.GetAllGaugeMetrics()
+	// gMetrics, err := res.GetAllGaugeMetrics(context.Background())
 	// require.NoError(t, err)
 	// require.Equal(t, map[string]float64{"g1": 1.23, "g2": 10.1}, gMetrics)
 }
@@ -0,0 +1,236 @@
+package memstorage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+// разрешения агрегатов истории
+const (
+	MinuteResolution = time.Minute
+	HourResolution   = time.Hour
+)
+
+// ErrUnknownResolution - агрегаты хранятся только с минутным и часовым разрешением
+var ErrUnknownResolution = errors.New("unknown rollup resolution")
+
+// RetentionPolicy - сколько хранятся значения каждого уровня истории
+type RetentionPolicy struct {
+	Raw    time.Duration // исходные значения
+	Minute time.Duration // минутные агрегаты
+	Hour   time.Duration // часовые агрегаты
+}
+
+// DefaultRetention - исходные значения за сутки, минутные агрегаты за 30 дней, часовые за год
+var DefaultRetention = RetentionPolicy{
+	Raw:    24 * time.Hour,
+	Minute: 30 * 24 * time.Hour,
+	Hour:   365 * 24 * time.Hour,
+}
+
+// WithDefaults заменяет незаданные (нулевые) сроки хранения значениями DefaultRetention
+func (p RetentionPolicy) WithDefaults() RetentionPolicy {
+	if p.Raw <= 0 {
+		p.Raw = DefaultRetention.Raw
+	}
+	if p.Minute <= 0 {
+		p.Minute = DefaultRetention.Minute
+	}
+	if p.Hour <= 0 {
+		p.Hour = DefaultRetention.Hour
+	}
+	return p
+}
+
+// HourWindow возвращает интервал [from, to) часов, которые можно пересчитать из минутных агрегатов:
+// от since (до этого момента часы уже посчитаны) до начала текущего, еще не закончившегося часа.
+// Самый старый час, минутные агрегаты которого уже частично удалены, не пересчитывается.
+func (p RetentionPolicy) HourWindow(since, now time.Time) (time.Time, time.Time) {
+	from := now.Add(-p.Minute).Truncate(HourResolution).Add(HourResolution)
+	if since.After(from) {
+		from = since
+	}
+	return from, now.Truncate(HourResolution)
+}
+
+// Rollup - агрегат значений метрики за интервал [Start, Start+разрешение).
+// Для gauge метрик агрегируются сами значения, для counter - присланные приращения,
+// поэтому Sum counter метрики - прирост счетчика за интервал.
+type Rollup struct {
+	Start time.Time `json:"start"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Sum   float64   `json:"sum"`
+	Count uint64    `json:"count"`
+	Last  float64   `json:"last"` // последнее значение в интервале
+}
+
+// Avg - среднее значение за интервал
+func (r Rollup) Avg() float64 {
+	if r.Count == 0 {
+		return 0
+	}
+	return r.Sum / float64(r.Count)
+}
+
+// Observe добавляет в агрегат значение v
+func (r *Rollup) Observe(v float64) {
+	if r.Count == 0 || v < r.Min {
+		r.Min = v
+	}
+	if r.Count == 0 || v > r.Max {
+		r.Max = v
+	}
+	r.Sum += v
+	r.Count++
+	r.Last = v
+}
+
+// Merge добавляет к агрегату более поздний агрегат other
+func (r *Rollup) Merge(other Rollup) {
+	if r.Count == 0 || other.Min < r.Min {
+		r.Min = other.Min
+	}
+	if r.Count == 0 || other.Max > r.Max {
+		r.Max = other.Max
+	}
+	r.Sum += other.Sum
+	r.Count += other.Count
+	r.Last = other.Last
+}
+
+// rollupSeries - агрегаты одной метрики, упорядоченные по Start
+type rollupSeries []Rollup
+
+// observe добавляет значение v, записанное в момент t, в агрегат с разрешением res
+func (s rollupSeries) observe(t time.Time, res time.Duration, v float64) rollupSeries {
+	start := t.Truncate(res)
+	i := sort.Search(len(s), func(i int) bool { return !s[i].Start.Before(start) })
+	if i == len(s) || !s[i].Start.Equal(start) {
+		s = append(s, Rollup{})
+		copy(s[i+1:], s[i:])
+		s[i] = Rollup{Start: start}
+	}
+	s[i].Observe(v)
+	return s
+}
+
+// set заменяет (или вставляет) агрегат с тем же Start
+func (s rollupSeries) set(r Rollup) rollupSeries {
+	i := sort.Search(len(s), func(i int) bool { return !s[i].Start.Before(r.Start) })
+	if i == len(s) || !s[i].Start.Equal(r.Start) {
+		s = append(s, Rollup{})
+		copy(s[i+1:], s[i:])
+	}
+	s[i] = r
+	return s
+}
+
+// between возвращает агрегаты, начавшиеся с from по to включительно
+func (s rollupSeries) between(from, to time.Time) []Rollup {
+	res := []Rollup{}
+	for _, r := range s {
+		if r.Start.Before(from) || r.Start.After(to) {
+			continue
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// dropBefore удаляет агрегаты, начавшиеся раньше t
+func (s rollupSeries) dropBefore(t time.Time) rollupSeries {
+	i := sort.Search(len(s), func(i int) bool { return !s[i].Start.Before(t) })
+	return append(s[:0], s[i:]...)
+}
+
+// rollupKind проверяет, ведутся ли агрегаты истории для метрик типа metricType
+func rollupKind(metricType string) bool {
+	return metricType == "gauge" || metricType == "counter"
+}
+
+// observeRollup добавляет значение, полученное в момент at, в минутный агрегат метрики;
+// вызывается под блокировкой
+func (ms *MemStorage) observeRollup(metricType, name string, at time.Time, v float64) {
+	key := metricKey{mType: metricType, name: name}
+	ms.minuteRollups[key] = ms.minuteRollups[key].observe(at, MinuteResolution, v)
+}
+
+// GetRollups возвращает агрегаты gauge или counter метрики с разрешением resolution,
+// начавшиеся с from по to включительно. Часовые агрегаты появляются после компакции (см. Compact)
+// по окончании часа.
+func (ms *MemStorage) GetRollups(_ context.Context, metricType, name string, resolution time.Duration, from, to time.Time) ([]Rollup, error) {
+	if !rollupKind(metricType) {
+		return nil, ErrUnknownMetricType
+	}
+
+	ms.RLock()
+	defer ms.RUnlock()
+
+	key := metricKey{mType: metricType, name: name}
+	switch resolution {
+	case MinuteResolution:
+		return ms.minuteRollups[key].between(from, to), nil
+	case HourResolution:
+		return ms.hourRollups[key].between(from, to), nil
+	}
+	return nil, ErrUnknownResolution
+}
+
+// Compact пересчитывает часовые агрегаты из минутных для закончившихся часов
+// и удаляет значения и агрегаты старше сроков хранения (см. Retention)
+func (ms *MemStorage) Compact(_ context.Context) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	p := ms.Retention.WithDefaults()
+	now := ms.now()
+
+	from, to := p.HourWindow(ms.compactedUntil, now)
+	if from.Before(to) {
+		for key, minutes := range ms.minuteRollups {
+			hours := map[time.Time]*Rollup{}
+			var starts []time.Time
+			for _, m := range minutes {
+				if m.Start.Before(from) || !m.Start.Before(to) {
+					continue
+				}
+				start := m.Start.Truncate(HourResolution)
+				h, ok := hours[start]
+				if !ok {
+					h = &Rollup{Start: start}
+					hours[start] = h
+					starts = append(starts, start)
+				}
+				h.Merge(m)
+			}
+			for _, start := range starts {
+				ms.hourRollups[key] = ms.hourRollups[key].set(*hours[start])
+			}
+		}
+		ms.compactedUntil = to
+	}
+
+	for _, ring := range ms.gaugeHistory {
+		ring.dropBefore(now.Add(-p.Raw))
+	}
+	for _, ring := range ms.counterHistory {
+		ring.dropBefore(now.Add(-p.Raw))
+	}
+	pruneRollups(ms.minuteRollups, now.Add(-p.Minute))
+	pruneRollups(ms.hourRollups, now.Add(-p.Hour))
+	return nil
+}
+
+func pruneRollups(rollups map[metricKey]rollupSeries, before time.Time) {
+	for key, s := range rollups {
+		s = s.dropBefore(before)
+		if len(s) == 0 {
+			delete(rollups, key)
+			continue
+		}
+		rollups[key] = s
+	}
+}
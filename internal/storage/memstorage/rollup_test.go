@@ -0,0 +1,137 @@
+package memstorage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionPolicyWithDefaults(t *testing.T) {
+	p := RetentionPolicy{Raw: time.Hour}.WithDefaults()
+	require.Equal(t, RetentionPolicy{Raw: time.Hour, Minute: DefaultRetention.Minute, Hour: DefaultRetention.Hour}, p)
+}
+
+func TestRollupSeriesObserve(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var s rollupSeries
+
+	s = s.observe(start.Add(10*time.Second), MinuteResolution, 3)
+	s = s.observe(start.Add(2*time.Minute), MinuteResolution, 7)
+	s = s.observe(start.Add(20*time.Second), MinuteResolution, 1)
+	// значение, пришедшее позже, но за более ранний интервал, попадает в свой агрегат
+	s = s.observe(start.Add(time.Minute), MinuteResolution, 5)
+
+	require.Equal(t, rollupSeries{
+		{Start: start, Min: 1, Max: 3, Sum: 4, Count: 2, Last: 1},
+		{Start: start.Add(time.Minute), Min: 5, Max: 5, Sum: 5, Count: 1, Last: 5},
+		{Start: start.Add(2 * time.Minute), Min: 7, Max: 7, Sum: 7, Count: 1, Last: 7},
+	}, s)
+	require.Equal(t, 2.0, s[0].Avg())
+
+	s = s.dropBefore(start.Add(time.Minute))
+	require.Len(t, s, 2)
+	require.Equal(t, start.Add(time.Minute), s[0].Start)
+}
+
+func TestMetricRollups(t *testing.T) {
+	ms, err := New(false, "")
+	require.NoError(t, err)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	current := start
+	ms.now = func() time.Time { return current }
+
+	// по два значения в каждую из первых трех минут двух часов
+	for _, hour := range []time.Duration{0, time.Hour} {
+		for i := 0; i < 3; i++ {
+			for j, sec := range []time.Duration{10 * time.Second, 40 * time.Second} {
+				current = start.Add(hour + time.Duration(i)*time.Minute + sec)
+				require.NoError(t, ms.AddGaugeMetric(context.Background(), "g1", float64(i*10+j)))
+				require.NoError(t, ms.AddCounterMetric(context.Background(), "c1", 2))
+			}
+		}
+	}
+
+	gMinutes, err := ms.GetRollups(context.Background(), "gauge", "g1", MinuteResolution, start, start.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, []Rollup{
+		{Start: start, Min: 0, Max: 1, Sum: 1, Count: 2, Last: 1},
+		{Start: start.Add(time.Minute), Min: 10, Max: 11, Sum: 21, Count: 2, Last: 11},
+	}, gMinutes)
+
+	// до компакции часовых агрегатов нет
+	gHours, err := ms.GetRollups(context.Background(), "gauge", "g1", HourResolution, start, start.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, gHours)
+
+	// второй час еще не закончился, поэтому считается только первый
+	current = start.Add(time.Hour + 30*time.Minute)
+	require.NoError(t, ms.Compact(context.Background()))
+
+	gHours, err = ms.GetRollups(context.Background(), "gauge", "g1", HourResolution, start, start.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []Rollup{{Start: start, Min: 0, Max: 21, Sum: 63, Count: 6, Last: 21}}, gHours)
+
+	// для counter метрики агрегируются приращения
+	cHours, err := ms.GetRollups(context.Background(), "counter", "c1", HourResolution, start, start.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, cHours, 1)
+	require.Equal(t, 12.0, cHours[0].Sum)
+
+	current = start.Add(2*time.Hour + time.Minute)
+	require.NoError(t, ms.Compact(context.Background()))
+	cHours, err = ms.GetRollups(context.Background(), "counter", "c1", HourResolution, start, start.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, cHours, 2)
+
+	_, err = ms.GetRollups(context.Background(), "gauge", "g1", 5*time.Minute, start, current)
+	require.ErrorIs(t, err, ErrUnknownResolution)
+	_, err = ms.GetRollups(context.Background(), "histogram", "g1", MinuteResolution, start, current)
+	require.ErrorIs(t, err, ErrUnknownMetricType)
+
+	// удаление метрики удаляет и ее агрегаты
+	_, err = ms.DeleteMetric(context.Background(), "counter", "c1")
+	require.NoError(t, err)
+	cHours, err = ms.GetRollups(context.Background(), "counter", "c1", HourResolution, start, current)
+	require.NoError(t, err)
+	require.Empty(t, cHours)
+}
+
+func TestCompactRetention(t *testing.T) {
+	ms, err := New(false, "")
+	require.NoError(t, err)
+	ms.Retention = RetentionPolicy{Raw: time.Hour, Minute: 3 * time.Hour, Hour: 5 * time.Hour}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	current := start
+	ms.now = func() time.Time { return current }
+
+	for i := 0; i < 8; i++ {
+		current = start.Add(time.Duration(i) * time.Hour)
+		require.NoError(t, ms.AddGaugeMetric(context.Background(), "g1", float64(i)))
+		require.NoError(t, ms.Compact(context.Background()))
+	}
+
+	current = start.Add(8 * time.Hour)
+	require.NoError(t, ms.Compact(context.Background()))
+
+	// исходные значения хранятся час
+	raw, err := ms.GetGaugeHistory(context.Background(), "g1", start, current)
+	require.NoError(t, err)
+	require.Equal(t, []Sample{{Timestamp: start.Add(7 * time.Hour), Value: 7}}, raw)
+
+	// минутные агрегаты - три часа
+	minutes, err := ms.GetRollups(context.Background(), "gauge", "g1", MinuteResolution, start, current)
+	require.NoError(t, err)
+	require.Len(t, minutes, 3)
+	require.Equal(t, start.Add(5*time.Hour), minutes[0].Start)
+
+	// часовые агрегаты - пять часов, каждый посчитан по окончании часа
+	hours, err := ms.GetRollups(context.Background(), "gauge", "g1", HourResolution, start, current)
+	require.NoError(t, err)
+	require.Len(t, hours, 5)
+	require.Equal(t, start.Add(3*time.Hour), hours[0].Start)
+	require.Equal(t, 7.0, hours[4].Last)
+}
@@ -0,0 +1,299 @@
+package memstorage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Формат файла слепка (версия 1):
+//
+//	смещение  размер  поле
+//	0         6       сигнатура "MCSNAP"
+//	6         2       версия формата (big endian)
+//	8         1       сжатие данных: 0 - нет, 1 - gzip, 2 - zstd
+//	9         3       зарезервировано (нули)
+//	12        8       длина данных после заголовка (big endian)
+//	20        4       CRC-32C заголовка (байты 0-19) и данных (big endian)
+//	24        ...     данные: snapshotData в формате json, сжатые указанным способом
+//
+// Новые поля добавляются в snapshotData без смены версии: при чтении неизвестные поля пропускаются.
+// Версия меняется только при несовместимом изменении формата.
+// Файлы, записанные до появления заголовка, содержат AllMetrics в формате json и читаются как раньше.
+const (
+	snapshotMagic      = "MCSNAP"
+	snapshotVersion    = 1
+	snapshotHeaderSize = 24
+)
+
+// Compression - способ сжатия данных слепка
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// коды способов сжатия в заголовке слепка
+var compressionCodes = map[Compression]byte{
+	CompressionNone: 0,
+	CompressionGzip: 1,
+	CompressionZstd: 2,
+}
+
+var (
+	// ErrInvalidSnapshot - файл не является слепком метрик или поврежден
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+	// ErrUnsupportedSnapshotVersion - слепок записан более новой версией сервера
+	ErrUnsupportedSnapshotVersion = errors.New("unsupported snapshot version")
+	// ErrUnknownCompression - неизвестный способ сжатия слепка
+	ErrUnknownCompression = errors.New("unknown snapshot compression")
+)
+
+// ParseCompression разбирает способ сжатия слепка из конфигурации; пустая строка означает без сжатия
+func ParseCompression(s string) (Compression, error) {
+	if s == "" {
+		return CompressionNone, nil
+	}
+	c := Compression(s)
+	if _, ok := compressionCodes[c]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownCompression, s)
+	}
+	return c, nil
+}
+
+// snapshotData - содержимое слепка
+type snapshotData struct {
+	CreatedAt time.Time        `json:"created_at"`
+	Metrics   []snapshotMetric `json:"metrics"`
+	// номер последней записи журнала изменений, учтенной в слепке (см. walRecord)
+	WALSeq uint64 `json:"wal_seq,omitempty"`
+	// агрегаты истории, чтобы их сроки хранения (см. RetentionPolicy) не обрывались при перезапуске;
+	// исходные значения истории хранятся только в памяти
+	Rollups        []snapshotRollups `json:"rollups,omitempty"`
+	CompactedUntil *time.Time        `json:"compacted_until,omitempty"`
+}
+
+// snapshotRollups - минутные и часовые агрегаты истории одной метрики
+type snapshotRollups struct {
+	Type   string   `json:"type"`
+	Key    string   `json:"key"`
+	Minute []Rollup `json:"minute,omitempty"`
+	Hour   []Rollup `json:"hour,omitempty"`
+}
+
+// snapshotMetric - метрика слепка вместе со временем ее последнего обновления,
+// чтобы после перезапуска сервера устаревшие метрики удалялись в срок (см. DeleteStaleMetrics)
+type snapshotMetric struct {
+	Metric
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// encodeSnapshot записывает текущее состояние хранилища в формате слепка; вызывается под блокировкой
+func encodeSnapshot(ms *MemStorage, compression Compression) ([]byte, error) {
+	code, ok := compressionCodes[compression]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCompression, compression)
+	}
+
+	data := snapshotData{CreatedAt: ms.now().UTC(), WALSeq: ms.walSeq}
+	for _, m := range MemStorageToAllMetrics(ms).AllMetrics {
+		sm := snapshotMetric{Metric: m}
+		if updated, ok := ms.updated[metricKey{mType: m.MType, name: m.Key()}]; ok {
+			updated = updated.UTC()
+			sm.UpdatedAt = &updated
+		}
+		data.Metrics = append(data.Metrics, sm)
+	}
+	data.Rollups = snapshotRollupsOf(ms)
+	if !ms.compactedUntil.IsZero() {
+		compactedUntil := ms.compactedUntil.UTC()
+		data.CompactedUntil = &compactedUntil
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	if payload, err = compress(payload, compression); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, snapshotHeaderSize, snapshotHeaderSize+len(payload))
+	copy(buf, snapshotMagic)
+	binary.BigEndian.PutUint16(buf[6:], snapshotVersion)
+	buf[8] = code
+	binary.BigEndian.PutUint64(buf[12:], uint64(len(payload)))
+	buf = append(buf, payload...)
+	binary.BigEndian.PutUint32(buf[20:], snapshotChecksum(buf))
+	return buf, nil
+}
+
+// decodeSnapshot восстанавливает хранилище из содержимого файла слепка любой поддерживаемой версии
+func decodeSnapshot(raw []byte) (*MemStorage, error) {
+	if !bytes.HasPrefix(raw, []byte(snapshotMagic)) {
+		// слепок старого формата: AllMetrics в формате json без заголовка
+		var allMetrics AllMetrics
+		if err := json.Unmarshal(raw, &allMetrics); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+		}
+		return AllMetricsToMemStorage(&allMetrics)
+	}
+
+	if len(raw) < snapshotHeaderSize {
+		return nil, fmt.Errorf("%w: truncated header", ErrInvalidSnapshot)
+	}
+	if version := binary.BigEndian.Uint16(raw[6:]); version != snapshotVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedSnapshotVersion, version)
+	}
+	if length := binary.BigEndian.Uint64(raw[12:]); length != uint64(len(raw)-snapshotHeaderSize) {
+		return nil, fmt.Errorf("%w: data length %d, expected %d", ErrInvalidSnapshot, len(raw)-snapshotHeaderSize, length)
+	}
+	if binary.BigEndian.Uint32(raw[20:]) != snapshotChecksum(raw) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidSnapshot)
+	}
+
+	var compression Compression
+	for c, code := range compressionCodes {
+		if code == raw[8] {
+			compression = c
+		}
+	}
+	if compression == "" {
+		return nil, fmt.Errorf("%w: code %d", ErrUnknownCompression, raw[8])
+	}
+	payload, err := decompress(raw[snapshotHeaderSize:], compression)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+	}
+
+	var data snapshotData
+	if err = json.Unmarshal(payload, &data); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+	}
+
+	am := AllMetrics{WALSeq: data.WALSeq}
+	for _, sm := range data.Metrics {
+		am.AllMetrics = append(am.AllMetrics, sm.Metric)
+	}
+	ms, err := AllMetricsToMemStorage(&am)
+	if err != nil {
+		return nil, err
+	}
+	for _, sm := range data.Metrics {
+		if sm.UpdatedAt != nil {
+			ms.updated[metricKey{mType: sm.MType, name: sm.Key()}] = *sm.UpdatedAt
+		}
+	}
+	for _, r := range data.Rollups {
+		key := metricKey{mType: r.Type, name: r.Key}
+		if len(r.Minute) > 0 {
+			ms.minuteRollups[key] = r.Minute
+		}
+		if len(r.Hour) > 0 {
+			ms.hourRollups[key] = r.Hour
+		}
+	}
+	if data.CompactedUntil != nil {
+		ms.compactedUntil = *data.CompactedUntil
+	}
+	return ms, nil
+}
+
+// snapshotRollupsOf собирает агрегаты истории всех метрик в порядке типа и ключа; вызывается под блокировкой
+func snapshotRollupsOf(ms *MemStorage) []snapshotRollups {
+	byKey := make(map[metricKey]*snapshotRollups)
+	var keys []metricKey
+	get := func(key metricKey) *snapshotRollups {
+		r, ok := byKey[key]
+		if !ok {
+			r = &snapshotRollups{Type: key.mType, Key: key.name}
+			byKey[key] = r
+			keys = append(keys, key)
+		}
+		return r
+	}
+	for key, series := range ms.minuteRollups {
+		if len(series) > 0 {
+			get(key).Minute = series
+		}
+	}
+	for key, series := range ms.hourRollups {
+		if len(series) > 0 {
+			get(key).Hour = series
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].mType != keys[j].mType {
+			return keys[i].mType < keys[j].mType
+		}
+		return keys[i].name < keys[j].name
+	})
+	res := make([]snapshotRollups, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, *byKey[key])
+	}
+	return res
+}
+
+// snapshotChecksum считает CRC-32C заголовка без поля контрольной суммы и данных слепка
+func snapshotChecksum(raw []byte) uint32 {
+	h := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	h.Write(raw[:20])
+	h.Write(raw[snapshotHeaderSize:])
+	return h.Sum32()
+}
+
+func compress(data []byte, compression Compression) ([]byte, error) {
+	switch compression {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		w, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer w.Close()
+		return w.EncodeAll(data, nil), nil
+	}
+	return data, nil
+}
+
+func decompress(data []byte, compression Compression) ([]byte, error) {
+	switch compression {
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case CompressionZstd:
+		r, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return r.DecodeAll(data, nil)
+	}
+	return data, nil
+}
@@ -0,0 +1,113 @@
+package memstorage
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
+	"github.com/stretchr/testify/require"
+)
+
+func snapshotStorage(t *testing.T) *MemStorage {
+	ms, err := New(false, "")
+	require.NoError(t, err)
+	updated := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	ms.now = func() time.Time { return updated }
+
+	sketch := ddsketch.New(ddsketch.DefaultAlpha)
+	sketch.Add(2)
+	require.NoError(t, ms.AddGaugeMetric(context.Background(), "g1", 1.5))
+	require.NoError(t, ms.AddGaugeMetric(context.Background(), `g1{host="a"}`, 2.5))
+	require.NoError(t, ms.AddCounterMetric(context.Background(), "c1", 3))
+	require.NoError(t, ms.AddHistogramMetric(context.Background(), "h1", Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Sum: 0.5, Count: 1}))
+	require.NoError(t, ms.AddSummaryMetric(context.Background(), "s1", sketch))
+	ms.walSeq = 42
+	return ms
+}
+
+// слепок при любом сжатии читается обратно вместе с метками, временем обновления и номером записи журнала
+func TestSnapshotRoundTrip(t *testing.T) {
+	for _, compression := range []Compression{"", CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run(string(compression), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metrics-db.json")
+			ms := snapshotStorage(t)
+			ms.SnapshotCompression = compression
+			require.NoError(t, WriteMetricsSnapshot(path, ms))
+
+			raw, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Equal(t, snapshotMagic, string(raw[:len(snapshotMagic)]))
+
+			restored, err := ReadMetricsSnapshot(path)
+			require.NoError(t, err)
+			require.ElementsMatch(t, MemStorageToAllMetrics(ms).AllMetrics, MemStorageToAllMetrics(restored).AllMetrics)
+			require.Equal(t, ms.updated, restored.updated)
+			require.Equal(t, uint64(42), restored.walSeq)
+		})
+	}
+}
+
+// слепки, записанные до появления заголовка, по-прежнему читаются
+func TestReadLegacySnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+	legacy := `{"metrics":[{"value":1.5,"id":"g1","type":"gauge"},` +
+		`{"value":2.5,"id":"g1","type":"gauge","labels":{"host":"a"}},` +
+		`{"delta":3,"id":"c1","type":"counter"}],"wal_seq":7}` + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(legacy), 0600))
+
+	ms, err := ReadMetricsSnapshot(path)
+	require.NoError(t, err)
+	gauges, err := ms.GetAllGaugeMetrics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{"g1": 1.5, `g1{host="a"}`: 2.5}, gauges)
+	counters, err := ms.GetAllCounterMetrics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"c1": 3}, counters)
+	require.Equal(t, uint64(7), ms.walSeq)
+}
+
+func TestReadCorruptedSnapshot(t *testing.T) {
+	ms := snapshotStorage(t)
+	valid, err := encodeSnapshot(ms, CompressionGzip)
+	require.NoError(t, err)
+
+	corrupt := func(change func(raw []byte) []byte) []byte {
+		raw := append([]byte(nil), valid...)
+		return change(raw)
+	}
+	tests := []struct {
+		name string
+		raw  []byte
+		err  error
+	}{
+		{"flipped data byte", corrupt(func(raw []byte) []byte { raw[len(raw)-5] ^= 0xff; return raw }), ErrInvalidSnapshot},
+		{"flipped compression", corrupt(func(raw []byte) []byte { raw[8] = 0; return raw }), ErrInvalidSnapshot},
+		{"truncated data", corrupt(func(raw []byte) []byte { return raw[:len(raw)-1] }), ErrInvalidSnapshot},
+		{"truncated header", corrupt(func(raw []byte) []byte { return raw[:10] }), ErrInvalidSnapshot},
+		{"newer version", corrupt(func(raw []byte) []byte { binary.BigEndian.PutUint16(raw[6:], 2); return raw }), ErrUnsupportedSnapshotVersion},
+		{"not json", []byte("garbage"), ErrInvalidSnapshot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metrics-db.json")
+			require.NoError(t, os.WriteFile(path, tt.raw, 0600))
+
+			_, err := ReadMetricsSnapshot(path)
+			require.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for s, want := range map[string]Compression{"": CompressionNone, "none": CompressionNone, "gzip": CompressionGzip, "zstd": CompressionZstd} {
+		c, err := ParseCompression(s)
+		require.NoError(t, err)
+		require.Equal(t, want, c)
+	}
+	_, err := ParseCompression("lz4")
+	require.ErrorIs(t, err, ErrUnknownCompression)
+}
@@ -0,0 +1,22 @@
+package memstorage_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemStorageSuite(t *testing.T) {
+	ms, err := memstorage.New(false, filepath.Join(t.TempDir(), "metrics-db.json"))
+	require.NoError(t, err)
+
+	// общий для всех хранилищ набор проверок
+	storagetest.Run(t, ms)
+
+	err = ms.Finalize(context.Background())
+	require.NoError(t, err)
+}
@@ -0,0 +1,45 @@
+package memstorage
+
+import (
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
+)
+
+// ReportedQuantiles - квантили summary метрик, которые выводятся в /value/, отчете и /metrics
+var ReportedQuantiles = []float64{0.5, 0.95, 0.99}
+
+// SummaryValue - значение summary метрики для чтения человеком: количество,
+// сумма и квантили, вычисленные по скетчу
+type SummaryValue struct {
+	Count uint64  `json:"count"`
+	Sum   float64 `json:"sum"`
+	P50   float64 `json:"p50"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+}
+
+// NewSummaryValue вычисляет квантили по скетчу; у пустого скетча квантили равны 0
+func NewSummaryValue(s *ddsketch.Sketch) SummaryValue {
+	res := SummaryValue{Count: s.Count, Sum: s.Sum}
+	if s.Count == 0 {
+		return res
+	}
+	res.P50, _ = s.Quantile(0.5)
+	res.P95, _ = s.Quantile(0.95)
+	res.P99, _ = s.Quantile(0.99)
+	return res
+}
+
+// MergeSummaries возвращает объединение накопленного скетча stored (nil, если
+// метрики еще нет) и присланного скетча delta. Если точность скетчей разная
+// (например, изменилась в конфигурации агента), накопленные значения
+// отбрасываются и результатом становится delta.
+func MergeSummaries(stored *ddsketch.Sketch, delta *ddsketch.Sketch) *ddsketch.Sketch {
+	if stored == nil {
+		return delta.Clone()
+	}
+	res := stored.Clone()
+	if err := res.Merge(delta); err != nil {
+		return delta.Clone()
+	}
+	return res
+}
@@ -0,0 +1,51 @@
+package memstorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemStorageSummary(t *testing.T) {
+	ms, err := New(false, "")
+	require.NoError(t, err)
+
+	// скетчи от двух агентов объединяются
+	for _, values := range [][]float64{{1, 2, 3}, {4, 5, 6, 7, 8, 9, 10}} {
+		s := ddsketch.New(ddsketch.DefaultAlpha)
+		for _, v := range values {
+			s.Add(v)
+		}
+		require.NoError(t, ms.AddSummaryMetric(context.Background(), "latency", s))
+	}
+
+	s, ok, err := ms.GetSummaryMetric(context.Background(), "latency")
+	require.NoError(t, err)
+	require.True(t, ok)
+	value := NewSummaryValue(s)
+	require.Equal(t, uint64(10), value.Count)
+	require.Equal(t, 55.0, value.Sum)
+	require.InEpsilon(t, 5, value.P50, ddsketch.DefaultAlpha)
+	require.InEpsilon(t, 9, value.P99, ddsketch.DefaultAlpha)
+
+	// скетч попадает в слепок и восстанавливается из него
+	am := MemStorageToAllMetrics(ms)
+	restored, err := AllMetricsToMemStorage(&am)
+	require.NoError(t, err)
+	restoredSketch, ok, err := restored.GetSummaryMetric(context.Background(), "latency")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, s, restoredSketch)
+
+	// скетч с другой точностью заменяет накопленный
+	other := ddsketch.New(0.05)
+	other.Add(100)
+	require.NoError(t, ms.AddSummaryMetric(context.Background(), "latency", other))
+	s, _, err = ms.GetSummaryMetric(context.Background(), "latency")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), s.Count)
+
+	require.Equal(t, SummaryValue{}, NewSummaryValue(ddsketch.New(ddsketch.DefaultAlpha)))
+}
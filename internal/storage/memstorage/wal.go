@@ -0,0 +1,252 @@
+package memstorage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
+)
+
+// defaultWALLimit - после стольких записей журнал сворачивается в слепок
+const defaultWALLimit = 10000
+
+// операции, записываемые в журнал
+const (
+	walOpAdd    = "add"
+	walOpDelete = "delete"
+	walOpReset  = "reset"
+	walOpBatch  = "batch" // пакет изменений из AddMetrics или DeleteMetrics
+)
+
+// WALFileName - путь до журнала изменений, который ведется рядом со слепком snapshotPath
+func WALFileName(snapshotPath string) string {
+	return snapshotPath + ".wal"
+}
+
+// walRecord - одно изменение хранилища; в журнале записи хранятся по одной в строке в формате json.
+// Для add метрик поля значения содержат то же, что было передано в Add*Metric
+// (для counter - приращение, для histogram и summary - присланные приращения).
+// Записи нумеруются по порядку, и в слепке хранится номер последней учтенной записи:
+// если сбой случился после записи слепка, но до очистки журнала,
+// при восстановлении уже учтенные записи пропускаются и приращения не применяются дважды.
+type walRecord struct {
+	Seq       uint64           `json:"seq"`
+	Op        string           `json:"op"`
+	Type      string           `json:"type,omitempty"`
+	Key       string           `json:"key,omitempty"` // ключ метрики (см. SeriesKey)
+	Delta     *int64           `json:"delta,omitempty"`
+	Value     *float64         `json:"value,omitempty"`
+	Histogram *Histogram       `json:"histogram,omitempty"`
+	Summary   *ddsketch.Sketch `json:"summary,omitempty"`
+	Batch     []walRecord      `json:"batch,omitempty"` // записи пакета (без номеров)
+	// время изменения gauge или counter метрики: при восстановлении по нему ведутся история и агрегаты
+	Time *time.Time `json:"time,omitempty"`
+}
+
+// logWAL дописывает изменение в журнал, если хранилище синхронно сохраняется в файл (задан FileName);
+// вызывается под блокировкой. Когда журнал дорастает до walLimit записей,
+// он сворачивается в новый слепок.
+func (ms *MemStorage) logWAL(rec walRecord) error {
+	if ms.FileName == "" {
+		return nil
+	}
+
+	if ms.wal == nil {
+		f, err := os.OpenFile(WALFileName(ms.FileName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return err
+		}
+		ms.wal = f
+	}
+
+	rec.Seq = ms.walSeq + 1
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err = ms.wal.Write(data); err != nil {
+		return err
+	}
+	if err = ms.wal.Sync(); err != nil {
+		return err
+	}
+
+	ms.walSeq = rec.Seq
+	ms.walRecords++
+	if ms.walRecords >= ms.walLimit {
+		return ms.writeSnapshot(ms.FileName)
+	}
+	return nil
+}
+
+// writeSnapshot атомарно записывает слепок в fileName; если это файл хранилища,
+// журнал изменений после этого очищается. Вызывается под блокировкой.
+func (ms *MemStorage) writeSnapshot(fileName string) error {
+	if err := WriteMetricsSnapshot(fileName, ms); err != nil {
+		return err
+	}
+	if fileName != ms.FileName {
+		return nil
+	}
+	ms.walRecords = 0
+
+	if ms.wal == nil {
+		// журнал еще не открыт, например, сразу после восстановления
+		err := os.Truncate(WALFileName(fileName), 0)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	// файл журнала открыт с O_APPEND, поэтому следующие записи пойдут в его начало
+	if err := ms.wal.Truncate(0); err != nil {
+		return err
+	}
+	return ms.wal.Sync()
+}
+
+// WriteSnapshot сворачивает журнал изменений в новый слепок файла хранилища
+func (ms *MemStorage) WriteSnapshot() error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	return ms.writeSnapshot(ms.FileName)
+}
+
+// closeWAL закрывает файл журнала; вызывается под блокировкой
+func (ms *MemStorage) closeWAL() error {
+	if ms.wal == nil {
+		return nil
+	}
+	err := ms.wal.Close()
+	ms.wal = nil
+	return err
+}
+
+// Restore восстанавливает хранилище из слепка storagePath и журнала изменений, записанного после него;
+// сами файлы не меняются. Пустой или отсутствующий слепок означает пустое хранилище.
+func Restore(storagePath string) (*MemStorage, error) {
+	var ms *MemStorage
+	var err error
+
+	info, err := os.Stat(storagePath)
+	switch {
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	case err != nil || info.Size() == 0:
+		ms, err = New(false, "")
+	default:
+		ms, err = ReadMetricsSnapshot(storagePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := ms.replayWAL(WALFileName(storagePath))
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("replayed %d records from %s", applied, WALFileName(storagePath))
+	return ms, nil
+}
+
+// replayWAL применяет к хранилищу записи журнала fileName; отсутствие журнала не ошибка.
+// Последняя запись, недописанная из-за сбоя, отбрасывается.
+func (ms *MemStorage) replayWAL(fileName string) (int, error) {
+	file, err := os.Open(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	applied := 0
+	r := bufio.NewReader(file)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				log.Printf("discarding incomplete last record of %s", fileName)
+			}
+			return applied, nil
+		}
+		if err != nil {
+			return applied, err
+		}
+
+		var rec walRecord
+		if err = json.Unmarshal(line, &rec); err != nil {
+			return applied, fmt.Errorf("invalid record in %s: %w", fileName, err)
+		}
+		if rec.Seq <= ms.walSeq {
+			// запись уже учтена в слепке
+			continue
+		}
+		if err = ms.applyWAL(rec); err != nil {
+			return applied, fmt.Errorf("invalid record %d in %s: %w", rec.Seq, fileName, err)
+		}
+		ms.walSeq = rec.Seq
+		applied++
+	}
+}
+
+func (ms *MemStorage) applyWAL(rec walRecord) error {
+	switch rec.Op {
+	case walOpReset:
+		return ms.Reset()
+	case walOpDelete:
+		_, err := ms.DeleteMetric(context.Background(), rec.Type, rec.Key)
+		return err
+	case walOpBatch:
+		for _, r := range rec.Batch {
+			if err := ms.applyWAL(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case walOpAdd:
+	default:
+		return fmt.Errorf("unknown operation %q", rec.Op)
+	}
+
+	ms.Lock()
+	defer ms.Unlock()
+
+	// журнал хранит присланные значения и приращения, поэтому история и агрегаты по ним
+	// восстанавливаются на момент изменения; у записей, сделанных до появления поля Time,
+	// восстанавливаются только значения
+	switch {
+	case rec.Type == "gauge" && rec.Value != nil:
+		if rec.Time != nil {
+			ms.addGauge(rec.Key, *rec.Value, *rec.Time)
+		} else {
+			ms.gauge[rec.Key] = *rec.Value
+			ms.touch(rec.Type, rec.Key)
+		}
+	case rec.Type == "counter" && rec.Delta != nil:
+		if rec.Time != nil {
+			ms.addCounter(rec.Key, *rec.Delta, *rec.Time)
+		} else {
+			ms.counter[rec.Key] += *rec.Delta
+			ms.touch(rec.Type, rec.Key)
+		}
+	case rec.Type == "histogram" && rec.Histogram != nil:
+		ms.addHistogram(rec.Key, *rec.Histogram)
+	case rec.Type == "summary" && rec.Summary != nil:
+		ms.addSummary(rec.Key, rec.Summary)
+	default:
+		return fmt.Errorf("%s metric %s has no value", rec.Type, rec.Key)
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package memstorage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
+	"github.com/stretchr/testify/require"
+)
+
+func walLines(t *testing.T, path string) int {
+	data, err := os.ReadFile(WALFileName(path))
+	require.NoError(t, err)
+	return bytes.Count(data, []byte("\n"))
+}
+
+// изменения дописываются в журнал, а слепок не перезаписывается;
+// после сбоя (без Finalize) состояние восстанавливается из журнала
+func TestWALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+
+	ms, err := New(false, path)
+	require.NoError(t, err)
+
+	sketch := ddsketch.New(ddsketch.DefaultAlpha)
+	sketch.Add(2)
+
+	require.NoError(t, ms.AddGaugeMetric(context.Background(), "g1", 1.5))
+	require.NoError(t, ms.AddGaugeMetric(context.Background(), `g2{host="a"}`, 2.5))
+	require.NoError(t, ms.AddCounterMetric(context.Background(), "c1", 3))
+	require.NoError(t, ms.AddCounterMetric(context.Background(), "c1", 4))
+	require.NoError(t, ms.AddHistogramMetric(context.Background(), "h1", Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Sum: 0.5, Count: 1}))
+	require.NoError(t, ms.AddSummaryMetric(context.Background(), "s1", sketch))
+	_, err = ms.DeleteMetric(context.Background(), "gauge", "g1")
+	require.NoError(t, err)
+
+	_, err = os.Stat(path)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.Equal(t, 7, walLines(t, path))
+
+	restored, err := New(true, path)
+	require.NoError(t, err)
+	require.ElementsMatch(t, MemStorageToAllMetrics(ms).AllMetrics, MemStorageToAllMetrics(restored).AllMetrics)
+
+	// после восстановления журнал свернут в слепок
+	require.Equal(t, 0, walLines(t, path))
+	fromSnapshot, err := ReadMetricsSnapshot(path)
+	require.NoError(t, err)
+	require.ElementsMatch(t, MemStorageToAllMetrics(ms).AllMetrics, MemStorageToAllMetrics(fromSnapshot).AllMetrics)
+
+	require.NoError(t, restored.AddCounterMetric(context.Background(), "c1", 1))
+	require.NoError(t, restored.Finalize(context.Background()))
+	require.Equal(t, 0, walLines(t, path))
+
+	restored, err = New(true, path)
+	require.NoError(t, err)
+	c1, ok, err := restored.GetCounterMetric(context.Background(), "c1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(8), c1)
+}
+
+// пакет из AddMetrics пишется в журнал одной записью и восстанавливается целиком
+func TestWALReplayBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+
+	ms, err := New(false, path)
+	require.NoError(t, err)
+
+	d1, d2, v := int64(3), int64(4), 1.5
+	err = ms.AddMetrics(context.Background(), []Metric{
+		{ID: "c1", MType: "counter", Delta: &d1},
+		{ID: "g1", MType: "gauge", Value: &v, Labels: Labels{"host": "a"}},
+		{ID: "c1", MType: "counter", Delta: &d2},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, walLines(t, path))
+
+	// некорректный пакет не меняет ни хранилище, ни журнал
+	err = ms.AddMetrics(context.Background(), []Metric{{ID: "c1", MType: "counter", Delta: &d1}, {ID: "x", MType: "unknown"}})
+	require.ErrorIs(t, err, ErrUnknownMetricType)
+	require.Equal(t, 1, walLines(t, path))
+
+	restored, err := New(true, path)
+	require.NoError(t, err)
+	require.ElementsMatch(t, MemStorageToAllMetrics(ms).AllMetrics, MemStorageToAllMetrics(restored).AllMetrics)
+	c1, _, err := restored.GetCounterMetric(context.Background(), "c1")
+	require.NoError(t, err)
+	require.Equal(t, int64(7), c1)
+}
+
+// недописанная из-за сбоя последняя запись отбрасывается
+func TestWALReplayIncompleteRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+
+	ms, err := New(false, path)
+	require.NoError(t, err)
+	require.NoError(t, ms.AddCounterMetric(context.Background(), "c1", 3))
+
+	f, err := os.OpenFile(WALFileName(path), os.O_WRONLY|os.O_APPEND, 0666)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"seq":2,"op":"add","type":"counter","key":"c1","del`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	restored, err := New(true, path)
+	require.NoError(t, err)
+	c1, _, err := restored.GetCounterMetric(context.Background(), "c1")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), c1)
+}
+
+// слепок после восстановления записывается с заданным в New сжатием
+func TestRestoreSnapshotCompression(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+
+	ms, err := New(false, path)
+	require.NoError(t, err)
+	require.NoError(t, ms.AddGaugeMetric(context.Background(), "g1", 1.5))
+
+	restored, err := New(true, path, WithSnapshotCompression(CompressionZstd))
+	require.NoError(t, err)
+	require.Equal(t, CompressionZstd, restored.SnapshotCompression)
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, compressionCodes[CompressionZstd], raw[8])
+
+	fromSnapshot, err := ReadMetricsSnapshot(path)
+	require.NoError(t, err)
+	g1, ok, err := fromSnapshot.GetGaugeMetric(context.Background(), "g1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 1.5, g1)
+}
+
+func TestWALReplayInvalidRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+	err := os.WriteFile(WALFileName(path), []byte(`{"seq":1,"op":"add","type":"gauge","key":"g1"}`+"\n"), 0666)
+	require.NoError(t, err)
+
+	_, err = New(true, path)
+	require.Error(t, err)
+}
+
+// сбой после записи слепка, но до очистки журнала: учтенные в слепке записи не применяются повторно
+func TestWALReplaySkipsSnapshotted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+
+	ms, err := New(false, path)
+	require.NoError(t, err)
+	require.NoError(t, ms.AddCounterMetric(context.Background(), "c1", 3))
+	require.NoError(t, ms.AddCounterMetric(context.Background(), "c1", 4))
+
+	wal, err := os.ReadFile(WALFileName(path))
+	require.NoError(t, err)
+	require.NoError(t, ms.WriteSnapshot())
+	require.NoError(t, ms.AddCounterMetric(context.Background(), "c1", 5))
+
+	// возвращаем в журнал записи, уже учтенные в слепке
+	current, err := os.ReadFile(WALFileName(path))
+	require.NoError(t, err)
+	err = os.WriteFile(WALFileName(path), append(wal, current...), 0666)
+	require.NoError(t, err)
+
+	restored, err := New(true, path)
+	require.NoError(t, err)
+	c1, _, err := restored.GetCounterMetric(context.Background(), "c1")
+	require.NoError(t, err)
+	require.Equal(t, int64(12), c1)
+}
+
+// когда журнал дорастает до предела, он сворачивается в слепок
+func TestWALCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+
+	ms, err := New(false, path)
+	require.NoError(t, err)
+	ms.walLimit = 3
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, ms.AddCounterMetric(context.Background(), "c1", 1))
+	}
+	require.Equal(t, 1, walLines(t, path))
+
+	fromSnapshot, err := ReadMetricsSnapshot(path)
+	require.NoError(t, err)
+	c1, _, err := fromSnapshot.GetCounterMetric(context.Background(), "c1")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), c1)
+
+	require.NoError(t, ms.Reset())
+	require.NoError(t, ms.AddGaugeMetric(context.Background(), "g1", 1))
+
+	restored, err := New(true, path)
+	require.NoError(t, err)
+	require.Equal(t, []Metric{{ID: "g1", MType: "gauge", Value: ptrFloat(1)}}, MemStorageToAllMetrics(restored).AllMetrics)
+
+	// временные файлы слепков не остаются в каталоге
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
+
+func ptrFloat(v float64) *float64 {
+	return &v
+}
+
+// при восстановлении из слепка накопленные значения не попадают в историю и агрегаты,
+// записи журнала восстанавливают их на момент изменения, а агрегаты из слепка сохраняются
+func TestRestoreHistoryAndRollups(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics-db.json")
+	t0 := time.Date(2024, 10, 1, 12, 0, 30, 0, time.UTC)
+	t1 := t0.Add(2 * time.Minute)
+
+	ms, err := New(false, path)
+	require.NoError(t, err)
+	ms.now = func() time.Time { return t0 }
+	require.NoError(t, ms.AddCounterMetric(ctx, "c1", 5))
+	require.NoError(t, ms.WriteSnapshot())
+
+	ms.now = func() time.Time { return t1 }
+	require.NoError(t, ms.AddCounterMetric(ctx, "c1", 2))
+	require.Equal(t, 1, walLines(t, path))
+
+	restored, err := New(true, path)
+	require.NoError(t, err)
+	c1, _, err := restored.GetCounterMetric(ctx, "c1")
+	require.NoError(t, err)
+	require.Equal(t, int64(7), c1)
+
+	from, to := t0.Add(-time.Hour), time.Now().Add(time.Hour)
+	rollups, err := restored.GetRollups(ctx, "counter", "c1", MinuteResolution, from, to)
+	require.NoError(t, err)
+	require.Len(t, rollups, 2)
+	require.True(t, rollups[0].Start.Equal(t0.Truncate(time.Minute)))
+	require.Equal(t, 5.0, rollups[0].Sum)
+	require.True(t, rollups[1].Start.Equal(t1.Truncate(time.Minute)))
+	require.Equal(t, 2.0, rollups[1].Sum)
+
+	history, err := restored.GetCounterHistory(ctx, "c1", from, to)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.True(t, history[0].Timestamp.Equal(t1))
+	require.Equal(t, 7.0, history[0].Value)
+}
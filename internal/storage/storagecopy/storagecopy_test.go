@@ -0,0 +1,118 @@
+package storagecopy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSnapshot записывает слепок с метриками всех типов, как его оставляет сервер
+func writeSnapshot(t *testing.T, path string) *memstorage.MemStorage {
+	ctx := context.Background()
+	ms, err := memstorage.New(false, "")
+	require.NoError(t, err)
+
+	sketch := ddsketch.New(ddsketch.DefaultAlpha)
+	sketch.Add(1)
+	sketch.Add(2)
+	require.NoError(t, ms.AddGaugeMetric(ctx, "g1", 1.5))
+	require.NoError(t, ms.AddGaugeMetric(ctx, `g1{host="a"}`, 2.5))
+	require.NoError(t, ms.AddCounterMetric(ctx, "c1", 7))
+	require.NoError(t, ms.AddHistogramMetric(ctx, "h1",
+		memstorage.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 2}, Sum: 4.5, Count: 3}))
+	require.NoError(t, ms.AddSummaryMetric(ctx, "s1", sketch))
+
+	require.NoError(t, memstorage.WriteMetricsSnapshot(path, ms))
+	return ms
+}
+
+// слепок -> bbolt -> новый слепок: значения всех метрик сохраняются
+func TestCopyFileToBoltAndBack(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "metrics-db.json")
+	want := writeSnapshot(t, srcPath)
+	wantMetrics, err := ReadAll(ctx, want)
+	require.NoError(t, err)
+	require.Len(t, wantMetrics, 5)
+
+	src, err := Open("file:"+srcPath, false)
+	require.NoError(t, err)
+	dst, err := Open("bolt:"+filepath.Join(dir, "metrics.db"), true)
+	require.NoError(t, err)
+
+	copied, err := Copy(ctx, src, dst, false)
+	require.NoError(t, err)
+	require.Equal(t, 5, copied)
+	require.NoError(t, src.Close(ctx))
+	require.NoError(t, dst.Close(ctx))
+
+	src, err = Open("bolt:"+filepath.Join(dir, "metrics.db"), false)
+	require.NoError(t, err)
+	dstPath := filepath.Join(dir, "copy", "metrics-db.json")
+	require.NoError(t, os.Mkdir(filepath.Dir(dstPath), 0755))
+	dst, err = Open("file:"+dstPath, true)
+	require.NoError(t, err)
+
+	copied, err = Copy(ctx, src, dst, false)
+	require.NoError(t, err)
+	require.Equal(t, 5, copied)
+	require.NoError(t, src.Close(ctx))
+	require.NoError(t, dst.Close(ctx))
+
+	restored, err := memstorage.ReadMetricsSnapshot(dstPath)
+	require.NoError(t, err)
+	gotMetrics, err := ReadAll(ctx, restored)
+	require.NoError(t, err)
+	require.Equal(t, wantMetrics, gotMetrics)
+}
+
+// в непустое хранилище метрики переносятся только с merge, счетчики при этом складываются
+func TestCopyIntoNonEmptyDestination(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "metrics-db.json")
+	writeSnapshot(t, srcPath)
+
+	src, err := Open("file:"+srcPath, false)
+	require.NoError(t, err)
+	dst, err := memstorage.New(false, "")
+	require.NoError(t, err)
+	require.NoError(t, dst.AddCounterMetric(ctx, "c1", 3))
+
+	_, err = Copy(ctx, src, dst, false)
+	require.ErrorIs(t, err, ErrDestinationNotEmpty)
+	_, ok, err := dst.GetGaugeMetric(ctx, "g1")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	copied, err := Copy(ctx, src, dst, true)
+	require.NoError(t, err)
+	require.Equal(t, 5, copied)
+	c1, _, err := dst.GetCounterMetric(ctx, "c1")
+	require.NoError(t, err)
+	require.Equal(t, int64(10), c1)
+}
+
+func TestOpenErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, spec := range []string{"", "metrics-db.json", "file:", "mysql:localhost"} {
+		_, err := Open(spec, false)
+		require.ErrorIs(t, err, ErrUnknownScheme, spec)
+	}
+
+	// источник должен существовать и не создается
+	for _, spec := range []string{"file:" + filepath.Join(dir, "none.json"), "bolt:" + filepath.Join(dir, "none.db")} {
+		_, err := Open(spec, false)
+		require.ErrorIs(t, err, os.ErrNotExist, spec)
+	}
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
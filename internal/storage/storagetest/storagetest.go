@@ -0,0 +1,402 @@
+// Package storagetest - общий набор тестов для реализаций api.Storager
+// (MemStorage, DBStorage, BoltStorage), проверяющий, что их семантика совпадает.
+package storagetest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adettelle/go-metric-collector/internal/api"
+	"github.com/adettelle/go-metric-collector/internal/storage/memstorage"
+	"github.com/adettelle/go-metric-collector/pkg/ddsketch"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// Run проверяет хранилище s, в котором еще нет метрик; s не финализируется
+func Run(t *testing.T, s api.Storager) {
+	var err error
+	ctx := context.Background()
+
+	cm1Name := uuid.NewString()[:30]
+	cm2Name := uuid.NewString()[:30]
+
+	err = s.AddCounterMetric(ctx, cm1Name, 100)
+	require.NoError(t, err)
+
+	// получение существующей метрики
+	cm1Value, ok, err := s.GetCounterMetric(ctx, cm1Name)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(100), cm1Value)
+
+	// получение несуществующей метрики
+	_, ok, err = s.GetCounterMetric(ctx, "inexistentCounter")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// добавление той же (существующей) counter метрики, должно сохранить сумму двух значений
+	err = s.AddCounterMetric(ctx, cm1Name, 111)
+	require.NoError(t, err)
+
+	// получение существующей метрики
+	cm1Value, ok, err = s.GetCounterMetric(ctx, cm1Name)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(211), cm1Value)
+
+	// добавление другой counter метрики
+	err = s.AddCounterMetric(ctx, cm2Name, 200)
+	require.NoError(t, err)
+
+	// получение всех counter метрик
+	cMetrics, err := s.GetAllCounterMetrics(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{cm1Name: 211, cm2Name: 200}, cMetrics)
+
+	// ------
+	gm1Name := uuid.NewString()[:30]
+	gm2Name := uuid.NewString()[:30]
+
+	err = s.AddGaugeMetric(ctx, gm1Name, 1.1)
+	require.NoError(t, err)
+
+	// получение существующей метрики
+	gm1Value, ok, err := s.GetGaugeMetric(ctx, gm1Name)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 1.1, gm1Value)
+
+	// получение несуществующей метрики
+	_, ok, err = s.GetGaugeMetric(ctx, "inexistentGauge")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// добавление той же (существующей) gauge метрики, должно перезаписывать значение
+	err = s.AddGaugeMetric(ctx, gm1Name, 2.2)
+	require.NoError(t, err)
+
+	// получение существующей метрики
+	gm1Value, ok, err = s.GetGaugeMetric(ctx, gm1Name)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 2.2, gm1Value)
+
+	// добавление другой counter метрики
+	err = s.AddGaugeMetric(ctx, gm2Name, 22.222)
+	require.NoError(t, err)
+
+	// получение всех gauge метрик
+	gMetrics, err := s.GetAllGaugeMetrics(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{gm1Name: 2.2, gm2Name: 22.222}, gMetrics)
+
+	// история метрик
+	from := time.Now().Add(-time.Hour)
+	to := time.Now().Add(time.Hour)
+
+	gHistory, err := s.GetGaugeHistory(ctx, gm1Name, from, to)
+	require.NoError(t, err)
+	require.Len(t, gHistory, 2)
+	require.Equal(t, 1.1, gHistory[0].Value)
+	require.Equal(t, 2.2, gHistory[1].Value)
+
+	cHistory, err := s.GetCounterHistory(ctx, cm1Name, from, to)
+	require.NoError(t, err)
+	require.Len(t, cHistory, 2)
+	require.Equal(t, float64(100), cHistory[0].Value)
+	require.Equal(t, float64(211), cHistory[1].Value)
+
+	// метрики с тем же именем, но с метками хранятся отдельно
+	lm1Key := memstorage.SeriesKey(gm1Name, memstorage.Labels{"host": "a"})
+	lm2Key := memstorage.SeriesKey(gm1Name, memstorage.Labels{"host": "b", "env": "prod"})
+
+	err = s.AddGaugeMetric(ctx, lm1Key, 3.3)
+	require.NoError(t, err)
+	err = s.AddGaugeMetric(ctx, lm2Key, 4.4)
+	require.NoError(t, err)
+
+	gm1Value, ok, err = s.GetGaugeMetric(ctx, gm1Name)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 2.2, gm1Value)
+
+	lm1Value, ok, err := s.GetGaugeMetric(ctx, lm1Key)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 3.3, lm1Value)
+
+	gMetrics, err = s.GetAllGaugeMetrics(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{gm1Name: 2.2, gm2Name: 22.222, lm1Key: 3.3, lm2Key: 4.4}, gMetrics)
+
+	gHistory, err = s.GetGaugeHistory(ctx, lm2Key, from, to)
+	require.NoError(t, err)
+	require.Len(t, gHistory, 1)
+	require.Equal(t, 4.4, gHistory[0].Value)
+
+	// гистограмма накапливает присланные приращения
+	hmName := uuid.NewString()[:30]
+	delta := memstorage.Histogram{Bounds: []float64{0.1, 1}, Counts: []uint64{1, 0, 1}, Sum: 5.05, Count: 2}
+
+	err = s.AddHistogramMetric(ctx, hmName, delta)
+	require.NoError(t, err)
+	err = s.AddHistogramMetric(ctx, hmName, delta)
+	require.NoError(t, err)
+
+	hm, ok, err := s.GetHistogramMetric(ctx, hmName)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, []uint64{2, 0, 2}, hm.Counts)
+	require.Equal(t, uint64(4), hm.Count)
+	require.InDelta(t, 10.1, hm.Sum, 1e-9)
+
+	_, ok, err = s.GetHistogramMetric(ctx, "inexistentHistogram")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	hMetrics, err := s.GetAllHistogramMetrics(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]memstorage.Histogram{hmName: hm}, hMetrics)
+
+	// скетчи summary метрики объединяются
+	smName := uuid.NewString()[:30]
+	sketch := ddsketch.New(ddsketch.DefaultAlpha)
+	sketch.Add(1)
+	sketch.Add(3)
+
+	err = s.AddSummaryMetric(ctx, smName, sketch)
+	require.NoError(t, err)
+	err = s.AddSummaryMetric(ctx, smName, sketch)
+	require.NoError(t, err)
+
+	sm, ok, err := s.GetSummaryMetric(ctx, smName)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(4), sm.Count)
+	require.Equal(t, 8.0, sm.Sum)
+
+	_, ok, err = s.GetSummaryMetric(ctx, "inexistentSummary")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	sMetrics, err := s.GetAllSummaryMetrics(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]*ddsketch.Sketch{smName: sm}, sMetrics)
+
+	// минутные агрегаты пишутся вместе со значениями
+	gRollups, err := s.GetRollups(ctx, "gauge", gm1Name, memstorage.MinuteResolution, from, to)
+	require.NoError(t, err)
+	require.NotEmpty(t, gRollups)
+	require.Equal(t, 1.1, gRollups[0].Min)
+	require.Equal(t, 2.2, gRollups[len(gRollups)-1].Last)
+
+	cRollups, err := s.GetRollups(ctx, "counter", cm1Name, memstorage.MinuteResolution, from, to)
+	require.NoError(t, err)
+	var cSum float64
+	for _, r := range cRollups {
+		cSum += r.Sum
+	}
+	require.Equal(t, float64(211), cSum)
+
+	_, err = s.GetRollups(ctx, "gauge", gm1Name, 5*time.Minute, from, to)
+	require.ErrorIs(t, err, memstorage.ErrUnknownResolution)
+
+	// компакция не удаляет свежие значения
+	err = s.Compact(ctx)
+	require.NoError(t, err)
+	gHistory, err = s.GetGaugeHistory(ctx, gm1Name, from, to)
+	require.NoError(t, err)
+	require.Len(t, gHistory, 2)
+
+	// удаление метрики вместе с историей
+	ok, err = s.DeleteMetric(ctx, "gauge", gm1Name)
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, ok, err = s.GetGaugeMetric(ctx, gm1Name)
+	require.NoError(t, err)
+	require.False(t, ok)
+	gHistory, err = s.GetGaugeHistory(ctx, gm1Name, from, to)
+	require.NoError(t, err)
+	require.Empty(t, gHistory)
+
+	ok, err = s.DeleteMetric(ctx, "gauge", gm1Name)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, err = s.DeleteMetric(ctx, "unknown", gm1Name)
+	require.ErrorIs(t, err, memstorage.ErrUnknownMetricType)
+
+	// пакетная запись: приращения одной counter метрики в пакете складываются
+	bcName := uuid.NewString()[:30]
+	bgName := uuid.NewString()[:30]
+	d1, d2, v := int64(3), int64(4), 5.5
+	err = s.AddMetrics(ctx, []memstorage.Metric{
+		{ID: bcName, MType: "counter", Delta: &d1},
+		{ID: bgName, MType: "gauge", Value: &v, Labels: memstorage.Labels{"host": "a"}},
+		{ID: bcName, MType: "counter", Delta: &d2},
+	})
+	require.NoError(t, err)
+	cm1Value, ok, err = s.GetCounterMetric(ctx, bcName)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(7), cm1Value)
+	gm1Value, ok, err = s.GetGaugeMetric(ctx, memstorage.SeriesKey(bgName, memstorage.Labels{"host": "a"}))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 5.5, gm1Value)
+	// хранилище может записать в историю как каждое обновление пакета, так и только итоговое значение
+	cHistory, err = s.GetCounterHistory(ctx, bcName, from, to)
+	require.NoError(t, err)
+	require.NotEmpty(t, cHistory)
+	require.Equal(t, 7.0, cHistory[len(cHistory)-1].Value)
+
+	// пакет с некорректной метрикой не сохраняется целиком
+	bc2Name := uuid.NewString()[:30]
+	err = s.AddMetrics(ctx, []memstorage.Metric{
+		{ID: bc2Name, MType: "counter", Delta: &d1},
+		{ID: bgName, MType: "gauge"},
+	})
+	require.ErrorIs(t, err, memstorage.ErrNoMetricValue)
+	_, ok, err = s.GetCounterMetric(ctx, bc2Name)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	err = s.AddMetrics(ctx, nil)
+	require.NoError(t, err)
+
+	// пакетное удаление: метрики, которых нет, не учитываются
+	deleted, err := s.DeleteMetrics(ctx, []memstorage.Metric{
+		{ID: bcName, MType: "counter"},
+		{ID: bgName, MType: "gauge", Labels: memstorage.Labels{"host": "a"}},
+		{ID: bc2Name, MType: "counter"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, deleted)
+	_, ok, err = s.GetCounterMetric(ctx, bcName)
+	require.NoError(t, err)
+	require.False(t, ok)
+	cHistory, err = s.GetCounterHistory(ctx, bcName, from, to)
+	require.NoError(t, err)
+	require.Empty(t, cHistory)
+	_, ok, err = s.GetGaugeMetric(ctx, memstorage.SeriesKey(bgName, memstorage.Labels{"host": "a"}))
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// пакет с неизвестным типом не удаляется целиком
+	err = s.AddMetrics(ctx, []memstorage.Metric{{ID: bc2Name, MType: "counter", Delta: &d1}})
+	require.NoError(t, err)
+	_, err = s.DeleteMetrics(ctx, []memstorage.Metric{{ID: bc2Name, MType: "counter"}, {ID: bc2Name, MType: "unknown"}})
+	require.ErrorIs(t, err, memstorage.ErrUnknownMetricType)
+	_, ok, err = s.GetCounterMetric(ctx, bc2Name)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	deleted, err = s.DeleteMetrics(ctx, nil)
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+
+	// выборка метрик по шаблону имени с сортировкой и страницей
+	prefix := "list_" + uuid.NewString()[:8] + "_"
+	g1, g2, g3, g4, g5, c1 := 3.0, 1.0, 2.0, 5.0, 4.0, int64(10)
+	err = s.AddMetrics(ctx, []memstorage.Metric{
+		{ID: prefix + "cpu1", MType: "gauge", Value: &g1},
+		{ID: prefix + "cpu2", MType: "gauge", Value: &g2},
+		{ID: prefix + "cpu2", MType: "gauge", Value: &g3, Labels: memstorage.Labels{"host": "a"}},
+		{ID: prefix + "mem", MType: "gauge", Value: &g4},
+		{ID: prefix + "50%_", MType: "gauge", Value: &g5},
+		{ID: prefix + "cpu1", MType: "counter", Delta: &c1},
+	})
+	require.NoError(t, err)
+
+	listKeys := func(metrics []memstorage.Metric) []string {
+		var keys []string
+		for _, m := range metrics {
+			keys = append(keys, m.MType+":"+strings.TrimPrefix(m.Key(), prefix))
+		}
+		return keys
+	}
+
+	list, total, err := s.ListMetrics(ctx, memstorage.ListQuery{Match: prefix + "*"})
+	require.NoError(t, err)
+	require.Equal(t, 6, total)
+	require.Equal(t, []string{"gauge:50%_", "counter:cpu1", "gauge:cpu1", "gauge:cpu2", `gauge:cpu2{host="a"}`, "gauge:mem"}, listKeys(list))
+
+	list, total, err = s.ListMetrics(ctx, memstorage.ListQuery{Type: "gauge", Match: prefix + "cpu?", SortBy: memstorage.ListSortValue, Desc: true})
+	require.NoError(t, err)
+	require.Equal(t, 3, total)
+	require.Equal(t, []string{"gauge:cpu1", `gauge:cpu2{host="a"}`, "gauge:cpu2"}, listKeys(list))
+	require.Equal(t, 3.0, *list[0].Value)
+
+	list, total, err = s.ListMetrics(ctx, memstorage.ListQuery{Match: prefix + "cpu*", SortBy: memstorage.ListSortType, Offset: 1, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, 4, total)
+	require.Equal(t, []string{"gauge:cpu1", "gauge:cpu2"}, listKeys(list))
+
+	list, total, err = s.ListMetrics(ctx, memstorage.ListQuery{Match: prefix + "(cpu|mem)\\d*", Regex: true, Type: "gauge"})
+	require.NoError(t, err)
+	require.Equal(t, 4, total)
+	require.Equal(t, []string{"gauge:cpu1", "gauge:cpu2", `gauge:cpu2{host="a"}`, "gauge:mem"}, listKeys(list))
+
+	// регулярное выражение везде разбирается по синтаксису Go и выполняется одинаково
+	list, _, err = s.ListMetrics(ctx, memstorage.ListQuery{Match: "(?i)" + prefix + "CPU[^2]", Regex: true, Type: "gauge"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"gauge:cpu1"}, listKeys(list))
+
+	// конструкции без общего смысла в RE2 и Postgres (в Postgres \b - это не граница слова) отклоняются
+	_, _, err = s.ListMetrics(ctx, memstorage.ListQuery{Match: prefix + "cpu1\\b", Regex: true})
+	require.ErrorIs(t, err, memstorage.ErrInvalidListQuery)
+
+	// % и _ в glob шаблоне сравниваются как есть
+	list, total, err = s.ListMetrics(ctx, memstorage.ListQuery{Match: prefix + "%*"})
+	require.NoError(t, err)
+	require.Equal(t, 0, total)
+	require.Empty(t, list)
+	list, _, err = s.ListMetrics(ctx, memstorage.ListQuery{Match: prefix + "50%_"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"gauge:50%_"}, listKeys(list))
+
+	// страница за концом выборки
+	list, total, err = s.ListMetrics(ctx, memstorage.ListQuery{Match: prefix + "*", Offset: 10})
+	require.NoError(t, err)
+	require.Equal(t, 6, total)
+	require.Empty(t, list)
+
+	_, _, err = s.ListMetrics(ctx, memstorage.ListQuery{Match: "(", Regex: true})
+	require.ErrorIs(t, err, memstorage.ErrInvalidListQuery)
+	_, _, err = s.ListMetrics(ctx, memstorage.ListQuery{SortBy: memstorage.ListSortValue})
+	require.ErrorIs(t, err, memstorage.ErrInvalidListQuery)
+
+	// имена длиннее 30 символов (например, от Graphite, InfluxDB или OTLP) сохраняются вместе с историей
+	longName := "servers." + uuid.NewString() + ".cpu.total.user"
+	err = s.AddGaugeMetric(ctx, longName, 1.5)
+	require.NoError(t, err)
+	err = s.AddCounterMetric(ctx, longName, 3)
+	require.NoError(t, err)
+	gm1Value, ok, err = s.GetGaugeMetric(ctx, longName)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 1.5, gm1Value)
+	cm1Value, ok, err = s.GetCounterMetric(ctx, longName)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(3), cm1Value)
+	gHistory, err = s.GetGaugeHistory(ctx, longName, from, to)
+	require.NoError(t, err)
+	require.Len(t, gHistory, 1)
+
+	// все метрики только что обновлены и не устарели
+	deleted, err = s.DeleteStaleMetrics(ctx, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, 0, deleted)
+
+	time.Sleep(10 * time.Millisecond)
+	deleted, err = s.DeleteStaleMetrics(ctx, time.Millisecond)
+	require.NoError(t, err)
+	require.Greater(t, deleted, 0)
+	cMetrics, err = s.GetAllCounterMetrics(ctx)
+	require.NoError(t, err)
+	require.Empty(t, cMetrics)
+}
@@ -0,0 +1,36 @@
+// Package agentid describes how an agent identifies itself to the server.
+// It is shared by the agent and the server, so that neither imports the other.
+package agentid
+
+import "fmt"
+
+// HeaderName - HTTP заголовок (и ключ метаданных gRPC), в котором агент передает свой ID
+const HeaderName = "X-Agent-ID"
+
+// LabelName - метка, которой сервер отмечает метрики, присланные агентом
+const LabelName = "agent_id"
+
+// MaxLen - наибольшая длина ID агента в байтах
+const MaxLen = 256
+
+// Validate проверяет ID агента, полученный сервером; пустой ID допустим - запрос не от агента
+func Validate(id string) error {
+	if len(id) > MaxLen {
+		return fmt.Errorf("agent id is longer than %d bytes", MaxLen)
+	}
+	return nil
+}
+
+// Stamp возвращает копию меток labels с меткой LabelName, равной id.
+// Для пустого id метки возвращаются как есть.
+func Stamp(labels map[string]string, id string) map[string]string {
+	if id == "" {
+		return labels
+	}
+	stamped := make(map[string]string, len(labels)+1)
+	for name, value := range labels {
+		stamped[name] = value
+	}
+	stamped[LabelName] = id
+	return stamped
+}
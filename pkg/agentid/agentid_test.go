@@ -0,0 +1,22 @@
+package agentid
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStamp(t *testing.T) {
+	labels := map[string]string{"host": "a", LabelName: "other"}
+	require.Equal(t, map[string]string{"host": "a", LabelName: "web-1"}, Stamp(labels, "web-1"))
+	require.Equal(t, "other", labels[LabelName]) // исходные метки не меняются
+	require.Equal(t, map[string]string{LabelName: "web-1"}, Stamp(nil, "web-1"))
+	require.Nil(t, Stamp(nil, ""))
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, Validate(""))
+	require.NoError(t, Validate("web-1"))
+	require.Error(t, Validate(strings.Repeat("a", MaxLen+1)))
+}
@@ -0,0 +1,219 @@
+// Package ddsketch implements DDSketch, a mergeable quantile sketch with
+// relative-error guarantees (Masson et al., "DDSketch: A fast and fully-mergeable
+// quantile sketch with relative-error guarantees", VLDB 2019).
+//
+// Values are counted in logarithmically sized bins, so any quantile is
+// returned with a relative error of at most Alpha. Sketches with the same
+// Alpha are merged exactly by adding bin counts, which lets the server
+// combine observations sent by many agents.
+package ddsketch
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DefaultAlpha is the relative accuracy used when none is configured.
+const DefaultAlpha = 0.01
+
+// minIndexableValue - values with a smaller magnitude are counted as zero,
+// which bounds the number of bins.
+const minIndexableValue = 1e-9
+
+var (
+	// ErrEmptySketch is returned when a quantile of an empty sketch is requested.
+	ErrEmptySketch = errors.New("sketch is empty")
+	// ErrAlphaMismatch is returned when sketches with different accuracy are merged.
+	ErrAlphaMismatch = errors.New("sketch relative accuracy mismatch")
+)
+
+// Sketch is a DDSketch. Positive and Negative map a bin index to the number of
+// values in it; the bin with index i holds values with magnitude in
+// (gamma^(i-1), gamma^i], where gamma = (1+Alpha)/(1-Alpha).
+type Sketch struct {
+	Alpha    float64        `json:"alpha"`
+	Positive map[int]uint64 `json:"positive,omitempty"`
+	Negative map[int]uint64 `json:"negative,omitempty"`
+	Zero     uint64         `json:"zero,omitempty"`
+	Sum      float64        `json:"sum"`
+	Count    uint64         `json:"count"`
+	Min      float64        `json:"min"`
+	Max      float64        `json:"max"`
+}
+
+// New returns an empty sketch with relative accuracy alpha.
+// Bins are allocated on first use, so an empty sketch equals its JSON round trip.
+func New(alpha float64) *Sketch {
+	return &Sketch{Alpha: alpha}
+}
+
+func (s *Sketch) gamma() float64 {
+	return (1 + s.Alpha) / (1 - s.Alpha)
+}
+
+func (s *Sketch) key(v float64) int {
+	return int(math.Ceil(math.Log(v) / math.Log(s.gamma())))
+}
+
+// value returns the representative value of the bin, which is within
+// Alpha of every value in it.
+func (s *Sketch) value(key int) float64 {
+	g := s.gamma()
+	return 2 * math.Pow(g, float64(key)) / (g + 1)
+}
+
+// Add counts the value v. NaN and infinite values are ignored.
+func (s *Sketch) Add(v float64) {
+	if !isFinite(v) {
+		return
+	}
+	switch {
+	case v > minIndexableValue:
+		if s.Positive == nil {
+			s.Positive = make(map[int]uint64)
+		}
+		s.Positive[s.key(v)]++
+	case v < -minIndexableValue:
+		if s.Negative == nil {
+			s.Negative = make(map[int]uint64)
+		}
+		s.Negative[s.key(-v)]++
+	default:
+		s.Zero++
+	}
+
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Sum += v
+	s.Count++
+}
+
+// Merge adds the values counted in other to the sketch.
+func (s *Sketch) Merge(other *Sketch) error {
+	if s.Alpha != other.Alpha {
+		return ErrAlphaMismatch
+	}
+	if other.Count == 0 {
+		return nil
+	}
+	s.Positive = mergeBins(s.Positive, other.Positive)
+	s.Negative = mergeBins(s.Negative, other.Negative)
+	s.Zero += other.Zero
+
+	if s.Count == 0 || other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if s.Count == 0 || other.Max > s.Max {
+		s.Max = other.Max
+	}
+	s.Sum += other.Sum
+	s.Count += other.Count
+	return nil
+}
+
+// Quantile returns an approximation of the q-quantile (0 <= q <= 1)
+// of the counted values.
+func (s *Sketch) Quantile(q float64) (float64, error) {
+	if q < 0 || q > 1 || math.IsNaN(q) {
+		return 0, fmt.Errorf("quantile %v is out of range [0, 1]", q)
+	}
+	if s.Count == 0 {
+		return 0, ErrEmptySketch
+	}
+
+	rank := q * float64(s.Count-1)
+	var seen float64
+
+	// отрицательные значения: от наибольшего модуля к наименьшему
+	for _, k := range sortedKeys(s.Negative, true) {
+		seen += float64(s.Negative[k])
+		if seen > rank {
+			return s.clamp(-s.value(k)), nil
+		}
+	}
+	seen += float64(s.Zero)
+	if seen > rank {
+		return s.clamp(0), nil
+	}
+	for _, k := range sortedKeys(s.Positive, false) {
+		seen += float64(s.Positive[k])
+		if seen > rank {
+			return s.clamp(s.value(k)), nil
+		}
+	}
+	return s.Max, nil
+}
+
+// clamp ограничивает приближенное значение точными минимумом и максимумом
+func (s *Sketch) clamp(v float64) float64 {
+	return math.Max(s.Min, math.Min(s.Max, v))
+}
+
+// Validate checks that the sketch received from a client is consistent.
+func (s *Sketch) Validate() error {
+	if !(s.Alpha > 0 && s.Alpha < 1) {
+		return fmt.Errorf("sketch relative accuracy %v is out of range (0, 1)", s.Alpha)
+	}
+	if !isFinite(s.Sum) || !isFinite(s.Min) || !isFinite(s.Max) {
+		return errors.New("sketch contains NaN or infinite values")
+	}
+	total := s.Zero
+	for _, c := range s.Positive {
+		total += c
+	}
+	for _, c := range s.Negative {
+		total += c
+	}
+	if total != s.Count {
+		return fmt.Errorf("sketch count %d does not match sum of bin counts %d", s.Count, total)
+	}
+	if s.Count > 0 && s.Min > s.Max {
+		return errors.New("sketch min is greater than max")
+	}
+	return nil
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// Clone returns a deep copy of the sketch.
+func (s *Sketch) Clone() *Sketch {
+	res := *s
+	res.Positive = mergeBins(nil, s.Positive)
+	res.Negative = mergeBins(nil, s.Negative)
+	return &res
+}
+
+// mergeBins прибавляет к корзинам dst корзины src; пустые корзины остаются nil
+func mergeBins(dst, src map[int]uint64) map[int]uint64 {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[int]uint64, len(src))
+	}
+	for k, c := range src {
+		dst[k] += c
+	}
+	return dst
+}
+
+func sortedKeys(bins map[int]uint64, desc bool) []int {
+	keys := make([]int, 0, len(bins))
+	for k := range bins {
+		keys = append(keys, k)
+	}
+	if desc {
+		sort.Sort(sort.Reverse(sort.IntSlice(keys)))
+	} else {
+		sort.Ints(keys)
+	}
+	return keys
+}
@@ -0,0 +1,112 @@
+package ddsketch
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSketchQuantile(t *testing.T) {
+	s := New(DefaultAlpha)
+	for i := 1; i <= 1000; i++ {
+		s.Add(float64(i))
+	}
+
+	for _, tt := range []struct {
+		q        float64
+		expected float64
+	}{
+		{0, 1},
+		{0.5, 500.5},
+		{0.95, 950.05},
+		{0.99, 990.01},
+		{1, 1000},
+	} {
+		v, err := s.Quantile(tt.q)
+		require.NoError(t, err)
+		require.InEpsilon(t, tt.expected, v, DefaultAlpha+0.001, "q=%v", tt.q)
+	}
+	require.Equal(t, uint64(1000), s.Count)
+	require.Equal(t, 500500.0, s.Sum)
+}
+
+func TestSketchNegativeAndZero(t *testing.T) {
+	s := New(DefaultAlpha)
+	for _, v := range []float64{-100, -10, 0, 10, 100, math.NaN()} {
+		s.Add(v)
+	}
+	require.Equal(t, uint64(5), s.Count)
+
+	v, err := s.Quantile(0)
+	require.NoError(t, err)
+	require.Equal(t, -100.0, v)
+
+	v, err = s.Quantile(0.5)
+	require.NoError(t, err)
+	require.Equal(t, 0.0, v)
+
+	v, err = s.Quantile(0.25)
+	require.NoError(t, err)
+	require.InEpsilon(t, -10, v, DefaultAlpha)
+}
+
+func TestSketchMerge(t *testing.T) {
+	a, b, all := New(DefaultAlpha), New(DefaultAlpha), New(DefaultAlpha)
+	for i := 1; i <= 100; i++ {
+		a.Add(float64(i))
+		all.Add(float64(i))
+	}
+	for i := 101; i <= 200; i++ {
+		b.Add(float64(i))
+		all.Add(float64(i))
+	}
+
+	require.NoError(t, a.Merge(b))
+	require.Equal(t, all, a)
+
+	require.ErrorIs(t, a.Merge(New(0.05)), ErrAlphaMismatch)
+}
+
+func TestSketchValidate(t *testing.T) {
+	s := New(DefaultAlpha)
+	s.Add(1)
+	s.Add(2)
+	require.NoError(t, s.Validate())
+
+	// скетч переживает сериализацию в JSON
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+	var restored Sketch
+	require.NoError(t, json.Unmarshal(data, &restored))
+	require.NoError(t, restored.Validate())
+	require.Equal(t, s.Positive, restored.Positive)
+
+	bad := s.Clone()
+	bad.Count = 3
+	require.Error(t, bad.Validate())
+
+	bad = s.Clone()
+	bad.Alpha = 1
+	require.Error(t, bad.Validate())
+
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		bad = s.Clone()
+		bad.Sum = v
+		require.Error(t, bad.Validate(), v)
+		bad = s.Clone()
+		bad.Max = v
+		require.Error(t, bad.Validate(), v)
+
+		// такие значения не добавляются в скетч
+		added := s.Clone()
+		added.Add(v)
+		require.Equal(t, s, added)
+	}
+
+	_, err = New(DefaultAlpha).Quantile(0.5)
+	require.ErrorIs(t, err, ErrEmptySketch)
+	_, err = s.Quantile(1.5)
+	require.Error(t, err)
+}
@@ -23,7 +23,8 @@ func GzipMiddleware(h http.HandlerFunc) http.HandlerFunc {
 		contentType := r.Header.Values("Content-Type")
 		for _, ct := range contentType {
 			if !strings.Contains(ct, "application/json") &&
-				!strings.Contains(ct, "text/html") {
+				!strings.Contains(ct, "text/html") &&
+				!strings.Contains(ct, "text/plain") {
 				w.WriteHeader(http.StatusBadRequest)
 				return
 			}
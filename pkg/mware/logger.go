@@ -39,6 +39,12 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode // захватываем код статуса
 }
 
+// Unwrap возвращает оригинальный http.ResponseWriter, чтобы через http.ResponseController
+// были доступны Flush и Hijack (нужны для потоковых ответов и WebSocket)
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 // WithLogging wraps an http.HandlerFunc to add logging functionality.
 // It logs information about each HTTP request, including the URI, method, response status code,
 // response size, and the duration of the request.
@@ -147,6 +147,33 @@ func TestGzipMiddlewareCompressBadRequest(t *testing.T) {
 	defer resp.Body.Close()
 }
 
+// text/plain body (e.g. InfluxDB line protocol) is decompressed as well
+func TestGzipMiddlewareDecompressTextPlain(t *testing.T) {
+	handler := http.HandlerFunc(GzipMiddleware(EchoHandler))
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	requestBody := "cpu,host=a usage_idle=97.5 1700000000"
+
+	buf := compress([]byte(requestBody), t)
+
+	r := httptest.NewRequest("POST", srv.URL, buf)
+	r.RequestURI = ""
+	r.Header.Set("Content-Encoding", "gzip")
+	r.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	resp, err := http.DefaultClient.Do(r)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, requestBody, string(b))
+}
+
 // запрос перед отправкой не надо заgzip'овать
 // middleware получает незаархивированные данные
 // потом он передает обычный json в хэндлер, хэндлер отвечает тем же самым json'ом
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -61,25 +62,25 @@ func TestAddCounterMetric(t *testing.T) {
 	name := "someMetric"
 	var value int64 = 525
 
-	cms, err := ms.GetAllCounterMetrics()
+	cms, err := ms.GetAllCounterMetrics(context.Background())
 	assert.Nil(t, err)
 	lenBeforeAdding := len(cms)
 	// записали метрику в хранилище
-	ms.AddCounterMetric(name, value)
-	cmsAfter, err := ms.GetAllCounterMetrics()
+	ms.AddCounterMetric(context.Background(), name, value)
+	cmsAfter, err := ms.GetAllCounterMetrics(context.Background())
 	assert.Nil(t, err)
 	lenAfterAdding := len(cmsAfter)
 	assert.NotEqual(t, lenBeforeAdding, lenAfterAdding)
 
 	// проверка наличия метрики в map
-	val1, ok, err := ms.GetCounterMetric(name)
+	val1, ok, err := ms.GetCounterMetric(context.Background(), name)
 	assert.Equal(t, value, val1)
 	assert.True(t, ok)
 	assert.Nil(t, err)
 
 	// проверка добавление уже сущ-ей метрики
-	ms.AddCounterMetric(name, value)
-	val2, ok, err := ms.GetCounterMetric(name)
+	ms.AddCounterMetric(context.Background(), name, value)
+	val2, ok, err := ms.GetCounterMetric(context.Background(), name)
 	assert.Equal(t, int64(1050), val2)
 	assert.True(t, ok)
 	assert.Nil(t, err)
@@ -87,7 +88,7 @@ func TestAddCounterMetric(t *testing.T) {
 	// проверка получения несущ-ей метрики
 	unrealName := "UnrealMetric"
 	var zero int64 = 0
-	v, ok, err := ms.GetCounterMetric(unrealName)
+	v, ok, err := ms.GetCounterMetric(context.Background(), unrealName)
 	assert.False(t, ok)
 	assert.Equal(t, v, zero)
 	assert.Nil(t, err)
@@ -102,32 +103,32 @@ func TestAddGaugeMetric(t *testing.T) {
 	name := "someMetric"
 	var value float64 = 527
 
-	gms, err := ms.GetAllGaugeMetrics()
+	gms, err := ms.GetAllGaugeMetrics(context.Background())
 	assert.Nil(t, err)
 	lenBeforeAdding := len(gms)
 	// записали метрику в хранилище
-	ms.AddGaugeMetric(name, value)
-	gmsAfter, err := ms.GetAllGaugeMetrics()
+	ms.AddGaugeMetric(context.Background(), name, value)
+	gmsAfter, err := ms.GetAllGaugeMetrics(context.Background())
 	assert.Nil(t, err)
 	lenAfterAdding := len(gmsAfter)
 
 	assert.NotEqual(t, lenBeforeAdding, lenAfterAdding)
 
-	checkValue, ok, err := ms.GetCounterMetric(name) // ms.Counter[name]
+	checkValue, ok, err := ms.GetCounterMetric(context.Background(), name) // ms.Counter[name]
 	assert.Nil(t, err)
 	if ok {
 		assert.Equal(t, value, checkValue)
 	}
 
 	// проверка наличия метрики в map
-	val1, ok, err := ms.GetGaugeMetric(name)
+	val1, ok, err := ms.GetGaugeMetric(context.Background(), name)
 	assert.Equal(t, value, val1)
 	assert.True(t, ok)
 	assert.Nil(t, err)
 
 	// проверка добавление уже сущ-ей метрики
-	ms.AddGaugeMetric(name, value)
-	val2, ok, err := ms.GetGaugeMetric(name)
+	ms.AddGaugeMetric(context.Background(), name, value)
+	val2, ok, err := ms.GetGaugeMetric(context.Background(), name)
 	assert.Equal(t, value, val2) // при добавлении сущ-ей метрики метрика заменятеся на новую
 	assert.True(t, ok)
 	assert.Nil(t, err)
@@ -135,7 +136,7 @@ func TestAddGaugeMetric(t *testing.T) {
 	// проверка получения несущ-ей метрики
 	unrealName := "UnrealMetric"
 	var zero float64 = 0
-	v, ok, err := ms.GetGaugeMetric(unrealName)
+	v, ok, err := ms.GetGaugeMetric(context.Background(), unrealName)
 	assert.False(t, ok)
 	assert.Equal(t, v, zero)
 	assert.Nil(t, err)
@@ -217,10 +218,10 @@ func TestGetAllMetrics(t *testing.T) {
 	}
 	var wg *sync.WaitGroup
 	metricAPI := api.NewMetricHandlers(metricStore, Config, wg)
-	metricStore.AddCounterMetric("C1", 123)
-	metricStore.AddCounterMetric("C1", 456)
-	metricStore.AddGaugeMetric("G1", 123)
-	metricStore.AddGaugeMetric("G2", 150984.573)
+	metricStore.AddCounterMetric(context.Background(), "C1", 123)
+	metricStore.AddCounterMetric(context.Background(), "C1", 456)
+	metricStore.AddGaugeMetric(context.Background(), "G1", 123)
+	metricStore.AddGaugeMetric(context.Background(), "G2", 150984.573)
 
 	query := "/"
 	w := httptest.NewRecorder()
@@ -268,10 +269,10 @@ func TestGetMetricByValue(t *testing.T) {
 	}
 	mAPI := api.NewMetricHandlers(metricStore, Config, wg)
 
-	_ = metricStore.AddCounterMetric("C1", 123)
-	_ = metricStore.AddCounterMetric("C1", 456)
-	_ = metricStore.AddGaugeMetric("G1", 123)
-	_ = metricStore.AddGaugeMetric("G2", 150984.573)
+	_ = metricStore.AddCounterMetric(context.Background(), "C1", 123)
+	_ = metricStore.AddCounterMetric(context.Background(), "C1", 456)
+	_ = metricStore.AddGaugeMetric(context.Background(), "G1", 123)
+	_ = metricStore.AddGaugeMetric(context.Background(), "G2", 150984.573)
 
 	var testTable = []struct {
 		mType  string